@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mustafadubul/product/internal/bulk"
+	"github.com/mustafadubul/product/internal/domain"
+	"github.com/mustafadubul/product/internal/service"
+	"github.com/mustafadubul/product/internal/tenant"
+)
+
+// runExport writes the catalogue to a file, or stdout when no file or "-" is
+// given.
+func runExport(svc *service.Service, args []string) (err error) {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	formatName := fs.String("format", "", "catalogue format, csv, ndjson or geojson, guessed from the file extension and ndjson by default")
+	term := fs.String("term", "", "only export products matching the term")
+	lat := fs.Float64("lat", 0, "latitude of the area to export")
+	lng := fs.Float64("lng", 0, "longitude of the area to export")
+	radius := fs.Float64("radius", 0, "only export products within radius meters of lat and lng")
+	tenantID := fs.String("tenant", tenant.Default, "tenant whose products are exported")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		return fmt.Errorf("usage: export [-format csv|ndjson|geojson] [-term term] [-lat lat -lng lng -radius meters] [-tenant id] [file]")
+	}
+	if err := tenant.Validate(*tenantID); err != nil {
+		return fmt.Errorf("%w %q", err, *tenantID)
+	}
+	path := fs.Arg(0)
+
+	if *formatName == "" {
+		*formatName = strings.TrimPrefix(filepath.Ext(path), ".")
+	}
+	format := bulk.NDJSON
+	if *formatName != "" {
+		if format, err = bulk.ParseFormat(*formatName); err != nil {
+			return err
+		}
+	}
+
+	var q *domain.Query
+	if *term != "" || *radius != 0 {
+		q = &domain.Query{Term: *term, Lat: *lat, Lng: *lng, Radius: *radius}
+	}
+
+	var w io.Writer = os.Stdout
+	if path != "" && path != "-" {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+		}()
+		w = f
+	}
+
+	buf := bufio.NewWriter(w)
+	enc, err := bulk.NewEncoder(format, buf)
+	if err != nil {
+		return err
+	}
+	if err := svc.Export(tenant.NewContext(context.Background(), *tenantID), q, enc.Encode); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	return buf.Flush()
+}
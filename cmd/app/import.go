@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mustafadubul/product/internal/audit"
+	"github.com/mustafadubul/product/internal/bulk"
+	"github.com/mustafadubul/product/internal/service"
+	"github.com/mustafadubul/product/internal/tenant"
+)
+
+// runImport imports a catalogue file, or stdin when the file is "-", and
+// writes the report as JSON to stdout.
+func runImport(svc *service.Service, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	formatName := fs.String("format", "", "catalogue format, csv, ndjson or geojson, guessed from the file extension when not set")
+	actor := fs.String("actor", os.Getenv("USER"), "actor the products are recorded as created by in their history")
+	tenantID := fs.String("tenant", tenant.Default, "tenant the products are imported into")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: import [-format csv|ndjson|geojson] [-actor name] [-tenant id] file")
+	}
+	if err := tenant.Validate(*tenantID); err != nil {
+		return fmt.Errorf("%w %q", err, *tenantID)
+	}
+	path := fs.Arg(0)
+
+	if *formatName == "" {
+		*formatName = strings.TrimPrefix(filepath.Ext(path), ".")
+	}
+	format, err := bulk.ParseFormat(*formatName)
+	if err != nil {
+		return err
+	}
+
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	ctx := tenant.NewContext(audit.NewContext(context.Background(), audit.Info{Actor: *actor}), *tenantID)
+	report, err := svc.Import(ctx, r, format)
+	if report != nil {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "%d accepted, %d rejected\n", report.Accepted, report.Rejected)
+	}
+	return err
+}
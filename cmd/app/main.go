@@ -10,53 +10,300 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/mustafadubul/product/internal/auth"
+	"github.com/mustafadubul/product/internal/events"
+	"github.com/mustafadubul/product/internal/metrics"
+	"github.com/mustafadubul/product/internal/ratelimit"
+	"github.com/mustafadubul/product/internal/savedsearch"
 	"github.com/mustafadubul/product/internal/service"
+	"github.com/mustafadubul/product/internal/trace"
+	"github.com/mustafadubul/product/internal/webhook"
 	"github.com/rs/zerolog"
 
 	"github.com/mustafadubul/product/internal/handler/http"
+	"github.com/mustafadubul/product/internal/repository"
+	"github.com/mustafadubul/product/internal/repository/memory"
+	"github.com/mustafadubul/product/internal/repository/postgres"
 	"github.com/mustafadubul/product/internal/repository/sqlite"
 )
 
+// serviceName names the process in the traces it exports.
+const serviceName = "product"
+
+type store interface {
+	repository.Product
+	repository.Outbox
+	repository.Webhooks
+	repository.SavedSearches
+	Migrate() error
+	Close() error
+}
+
+func openRepository(backend string, inMemory bool, filePath, postgresDSN string) (store, error) {
+	switch backend {
+	case "sqlite":
+		db, err := sqlite.Open(inMemory, filePath)
+		if err != nil {
+			return nil, err
+		}
+		return sqlite.New(db), nil
+	case "postgres":
+		db, err := postgres.Open(postgresDSN)
+		if err != nil {
+			return nil, err
+		}
+		return postgres.New(db), nil
+	case "memory":
+		return memory.New(), nil
+	}
+	return nil, fmt.Errorf("unknown backend %q", backend)
+}
+
+// main starts the HTTP server, or runs a subcommand given after the flags:
+//
+//	app [flags] import [-format csv|ndjson|geojson] [-actor name] [-tenant id] file
+//	app [flags] export [-format csv|ndjson|geojson] [-term term] [-lat lat -lng lng -radius meters] [-tenant id] [file]
 func main() {
 
+	backend := flag.String("backend", "sqlite", "repository backend, sqlite, postgres or memory")
 	filePath := flag.String("path", "", "path to SQLite file")
+	postgresDSN := flag.String("postgres_dsn", "", "PostgreSQL connection string")
 	host := flag.String("host", "0.0.0.0:8080", "server port")
 	debug := flag.Bool("debug", false, "sets log level to debug")
-	inMemory := flag.Bool("db_in_memory", false, "choose to have the Database in memory")
+	inMemory := flag.Bool("db_in_memory", false, "choose to have the SQLite Database in memory, -backend memory needs no SQLite at all")
 
 	migrate := flag.Bool("migrate", false, "migrate database")
 
+	searchLimit := flag.Int("search_limit", service.DefaultLimit, "default number of results returned by a search")
+	searchCandidates := flag.Int("search_candidates", service.DefaultCandidates, "number of products a search with a term reads from the repository at a time")
+	batchSize := flag.Int("batch_size", service.DefaultBatchSize, "number of products stored per transaction by an import")
+	retention := flag.Duration("trash_retention", service.DefaultRetention, "how long deleted products stay in the trash")
+	purgeInterval := flag.Duration("purge_interval", time.Hour, "how often the trash is purged, 0 disables purging")
+	eventsFile := flag.String("events_file", "", "file the events of the outbox are appended to as NDJSON")
+	eventsWebhook := flag.String("events_webhook", "", "URL the events of the outbox are posted to")
+	webhookAttempts := flag.Int("webhook_attempts", webhook.DefaultAttempts, "how often a webhook delivery is tried before the event is dead lettered")
+	webhookBackoff := flag.Duration("webhook_backoff", webhook.DefaultBackoff, "wait after the first failed webhook delivery, doubled for every further attempt")
+	webhookPause := flag.Duration("webhook_pause", webhook.DefaultPause, "how long a webhook is paused after a failed delivery, its events are dead lettered meanwhile")
+	dispatchInterval := flag.Duration("dispatch_interval", events.DefaultInterval, "how often the outbox is checked for events to dispatch")
+	rankWeights := flag.String("rank_weights", "", "search ranking weights e.g. text=0.7,proximity=0.3,exact=1,prefix=0.8,token=0.6,fuzzy=0.3")
+	apiKeys := flag.String("api_keys", "", "JSON file of the API keys, with their subject, scopes and optional tenant")
+	jwtSecret := flag.String("jwt_hs256_secret", os.Getenv("JWT_HS256_SECRET"), "secret HS256 tokens are signed with, defaults to $JWT_HS256_SECRET")
+	jwks := flag.String("jwt_jwks", "", "JWKS file of the keys RS256 tokens are signed with")
+	jwtIssuer := flag.String("jwt_issuer", "", "only accept tokens issued by this issuer")
+	jwtAudience := flag.String("jwt_audience", "", "only accept tokens meant for this audience")
+	searchRate := flag.Float64("search_rate", ratelimit.DefaultSearch.Rate, "searches and exports a client may make a second, 0 disables the limit")
+	searchBurst := flag.Int("search_burst", ratelimit.DefaultSearch.Burst, "searches and exports a client may make at once")
+	writeRate := flag.Float64("write_rate", ratelimit.DefaultWrite.Rate, "writes a client may make a second, 0 disables the limit")
+	writeBurst := flag.Int("write_burst", ratelimit.DefaultWrite.Burst, "writes a client may make at once")
+	rateLimits := flag.String("rate_limits", "", "JSON file of the limits of clients, by key:<API key ID>, jwt:<token subject> or ip:<address>")
+	traceExporter := flag.String("trace_exporter", "", "where the spans of the requests are exported to, stdout or otlp, none when empty")
+	otlpEndpoint := flag.String("otlp_endpoint", trace.DefaultOTLPEndpoint, "URL of the OTLP/HTTP traces endpoint of the collector for -trace_exporter otlp")
+
 	flag.Parse()
 
-	db, err := sqlite.Open(*inMemory, *filePath)
+	weights, err := service.ParseWeights(*rankWeights)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%v", err)
 		os.Exit(2)
 	}
 
+	if *batchSize < 1 {
+		fmt.Fprintf(os.Stderr, "batch_size must be at least 1")
+		os.Exit(2)
+	}
+
 	zerolog.SetGlobalLevel(zerolog.InfoLevel)
 	if *debug {
 		zerolog.SetGlobalLevel(zerolog.DebugLevel)
 	}
 
-	l := zerolog.New(os.Stdout).With().Logger()
+	// subcommands write their output to stdout, so they log to stderr
+	logOutput := os.Stdout
+	if flag.NArg() > 0 {
+		logOutput = os.Stderr
+	}
+	l := zerolog.New(logOutput).With().Logger()
 
-	repo := sqlite.New(db)
+	repo, err := openRepository(*backend, *inMemory, *filePath, *postgresDSN)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v", err)
+		os.Exit(2)
+	}
 	defer repo.Close()
 
 	if *migrate {
-		repo.Migrate()
+		if err := repo.Migrate(); err != nil {
+			fmt.Fprintf(os.Stderr, "%v", err)
+			os.Exit(2)
+		}
 	}
 
-	svc := service.New(&l, repo)
+	reg := metrics.NewRegistry()
+	svc := service.New(&l, repository.Traced(repository.Metered(repo, reg)), service.WithWeights(weights), service.WithLimit(*searchLimit), service.WithCandidates(*searchCandidates),
+		service.WithBatchSize(*batchSize), service.WithRetention(*retention), service.WithOutbox(repo),
+		service.WithWebhooks(repo), service.WithSavedSearches(repo))
+
+	switch cmd := flag.Arg(0); cmd {
+	case "":
+		var jobs []func(context.Context)
+		if *purgeInterval > 0 {
+			interval := *purgeInterval
+			jobs = append(jobs, func(ctx context.Context) { svc.PurgeEvery(ctx, interval) })
+		}
+		if *eventsFile != "" {
+			sink, err := events.NewFileSink(*eventsFile)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v", err)
+				os.Exit(2)
+			}
+			defer sink.Close()
+			jobs = append(jobs, events.NewDispatcher(&l, repo, "file", sink, events.WithInterval(*dispatchInterval)).Run)
+		}
+		if *eventsWebhook != "" {
+			sink := events.NewWebhookSink(*eventsWebhook, nil)
+			jobs = append(jobs, events.NewDispatcher(&l, repo, "webhook", sink, events.WithInterval(*dispatchInterval)).Run)
+		}
+		deliverer := webhook.NewDeliverer(&l, repo, webhook.WithAttempts(*webhookAttempts),
+			webhook.WithBackoff(*webhookBackoff, webhook.DefaultMaxBackoff), webhook.WithPause(*webhookPause))
+		jobs = append(jobs, events.NewDispatcher(&l, repo, "webhooks", deliverer, events.WithInterval(*dispatchInterval)).Run)
+		evaluator := savedsearch.NewEvaluator(&l, repo)
+		jobs = append(jobs, events.NewDispatcher(&l, repo, "saved-searches", evaluator, events.WithInterval(*dispatchInterval)).Run)
+		authenticator, err := newAuthenticator(*apiKeys, *jwtSecret, *jwks, *jwtIssuer, *jwtAudience)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v", err)
+			os.Exit(2)
+		}
+		limiter, err := newLimiter(ratelimit.Limit{Rate: *searchRate, Burst: *searchBurst},
+			ratelimit.Limit{Rate: *writeRate, Burst: *writeBurst}, *rateLimits)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v", err)
+			os.Exit(2)
+		}
+		handlerOpts := []http.Option{http.WithRateLimiter(limiter), http.WithMetrics(reg)}
+		if authenticator != nil {
+			handlerOpts = append(handlerOpts, http.WithAuthenticator(authenticator))
+		}
+		tracer, err := newTracer(&l, *traceExporter, *otlpEndpoint)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v", err)
+			os.Exit(2)
+		}
+		if tracer != nil {
+			handlerOpts = append(handlerOpts, http.WithTracer(tracer))
+			defer shutdownTracer(&l, tracer)
+		}
+		serve(&l, svc, *host, handlerOpts, jobs...)
+	case "import":
+		if err := runImport(svc, flag.Args()[1:]); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			repo.Close()
+			os.Exit(1)
+		}
+	case "export":
+		if err := runExport(svc, flag.Args()[1:]); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			repo.Close()
+			os.Exit(1)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", cmd)
+		repo.Close()
+		os.Exit(2)
+	}
+}
+
+// newAuthenticator returns the authenticator of the configured API keys and
+// JWT keys, nil when none are configured.
+func newAuthenticator(apiKeys, jwtSecret, jwks, issuer, audience string) (auth.Authenticator, error) {
+	var chain auth.Chain
+	if apiKeys != "" {
+		keys, err := auth.LoadAPIKeys(apiKeys)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, keys)
+	}
+
+	opts := []auth.JWTOption{auth.WithIssuer(issuer), auth.WithAudience(audience)}
+	if jwtSecret != "" {
+		opts = append(opts, auth.WithHS256([]byte(jwtSecret)))
+	}
+	if jwks != "" {
+		keys, err := auth.LoadJWKS(jwks)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, auth.WithRS256(keys))
+	}
+	if jwtSecret != "" || jwks != "" {
+		chain = append(chain, auth.NewJWT(opts...))
+	}
+
+	if len(chain) == 0 {
+		return nil, nil
+	}
+	return chain, nil
+}
+
+// newLimiter returns the limiter of the default limits and of the clients in
+// the rate limits file.
+func newLimiter(search, write ratelimit.Limit, rateLimits string) (*ratelimit.Limiter, error) {
+	config := &ratelimit.Config{Default: ratelimit.Limits{ratelimit.Search: search, ratelimit.Write: write}}
+	if rateLimits != "" {
+		clients, err := ratelimit.LoadClients(rateLimits)
+		if err != nil {
+			return nil, err
+		}
+		config.Clients = clients
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return ratelimit.New(config), nil
+}
+
+// newTracer returns the tracer exporting to the named exporter, nil when it is
+// empty.
+func newTracer(l *zerolog.Logger, exporter, otlpEndpoint string) (*trace.Tracer, error) {
+	switch exporter {
+	case "":
+		return nil, nil
+	case "stdout":
+		return trace.NewTracer(l, trace.NewWriterExporter(os.Stdout)), nil
+	case "otlp":
+		return trace.NewTracer(l, trace.NewOTLPExporter(otlpEndpoint, serviceName, nil)), nil
+	}
+	return nil, fmt.Errorf("unknown trace exporter %q", exporter)
+}
+
+// shutdownTracer exports the spans of the requests served last.
+func shutdownTracer(l *zerolog.Logger, t *trace.Tracer) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := t.Shutdown(ctx); err != nil {
+		l.Error().Err(err).Msg("Unable to export the last spans")
+	}
+}
+
+// serve runs the HTTP server and the background jobs until the process is
+// interrupted.
+func serve(l *zerolog.Logger, svc *service.Service, host string, opts []http.Option, jobs ...func(context.Context)) {
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	for _, job := range jobs {
+		go job(jobsCtx)
+	}
 
+	handler := http.NewHandler(l, svc, opts...)
 	server := net.Server{
-		Addr:    *host,
-		Handler: http.NewHandler(&l, svc).Setup(),
+		Addr:    host,
+		Handler: handler.Setup(),
 	}
+	server.RegisterOnShutdown(handler.Close)
 
 	go func() {
-		l.Info().Str("host", *host).Msg("Listening...")
+		l.Info().Str("host", host).Msg("Listening...")
 		if err := server.ListenAndServe(); err != net.ErrServerClosed {
 			fmt.Fprintf(os.Stderr, "%v", err)
 			os.Exit(2)
@@ -79,5 +326,4 @@ func main() {
 	}
 
 	l.Info().Msg("Server stopped")
-	os.Exit(0)
 }
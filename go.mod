@@ -6,6 +6,8 @@ require (
 	github.com/go-chi/chi v4.1.2+incompatible
 	github.com/golang/mock v1.4.3
 	github.com/jinzhu/gorm v1.9.14
+	github.com/lib/pq v1.1.1
+	github.com/mattn/go-sqlite3 v1.14.0
 	github.com/rs/zerolog v1.19.0
 	github.com/stretchr/testify v1.6.1
 )
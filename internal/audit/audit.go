@@ -0,0 +1,95 @@
+// Package audit builds the revisions the repositories record for every write
+// to a product, from the product before and after the write and the actor and
+// request carried by the context.
+package audit
+
+import (
+	"context"
+	"time"
+
+	"github.com/mustafadubul/product/internal/domain"
+)
+
+// Anonymous is the actor of writes made without one.
+const Anonymous = "anonymous"
+
+// Info is who made a write and in which request.
+type Info struct {
+	Actor     string
+	RequestID string
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying info.
+func NewContext(ctx context.Context, info Info) context.Context {
+	return context.WithValue(ctx, contextKey{}, info)
+}
+
+// FromContext returns the info carried by ctx. The actor is Anonymous when
+// ctx carries none.
+func FromContext(ctx context.Context) Info {
+	info, _ := ctx.Value(contextKey{}).(Info)
+	if info.Actor == "" {
+		info.Actor = Anonymous
+	}
+	return info
+}
+
+// NewRevision returns the revision of a write that turned before into after.
+// Before is nil for a product that did not exist. The repository numbers the
+// revision when it records it.
+func NewRevision(ctx context.Context, action string, before, after *domain.Product) domain.Revision {
+	info := FromContext(ctx)
+	return domain.Revision{
+		ProductID: after.ID,
+		Tenant:    after.Tenant,
+		Action:    action,
+		Actor:     info.Actor,
+		RequestID: info.RequestID,
+		At:        time.Now().UTC(),
+		Snapshot:  *after,
+		Changes:   Diff(before, after),
+	}
+}
+
+// Diff returns the fields that differ between before and after, in the order
+// they are declared in. A nil before is an empty product. The ID and version
+// are left out, they are not set by the caller.
+func Diff(before, after *domain.Product) []domain.Change {
+	if before == nil {
+		before = &domain.Product{}
+	}
+
+	changes := []domain.Change{}
+	add := func(field string, from, to interface{}) {
+		changes = append(changes, domain.Change{Field: field, From: from, To: to})
+	}
+
+	if before.ItemName != after.ItemName {
+		add("description", before.ItemName, after.ItemName)
+	}
+	if before.Lat != after.Lat {
+		add("lat", before.Lat, after.Lat)
+	}
+	if before.Lng != after.Lng {
+		add("lng", before.Lng, after.Lng)
+	}
+	if before.ImageURL != after.ImageURL {
+		add("img_URL", before.ImageURL, after.ImageURL)
+	}
+	if before.URL != after.URL {
+		add("product_URL", before.URL, after.URL)
+	}
+	if !sameTime(before.DeletedAt, after.DeletedAt) {
+		add("deleted_at", before.DeletedAt, after.DeletedAt)
+	}
+	return changes
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
@@ -0,0 +1,62 @@
+package audit_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mustafadubul/product/internal/audit"
+	"github.com/mustafadubul/product/internal/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func fields(changes []domain.Change) []string {
+	names := make([]string, len(changes))
+	for i, c := range changes {
+		names[i] = c.Field
+	}
+	return names
+}
+
+func TestDiff(t *testing.T) {
+	deletedAt := time.Now()
+	before := &domain.Product{ID: 1, ItemName: "camera", Lat: 51.5, Lng: -0.1, URL: "http://a", Version: 1}
+
+	tests := []struct {
+		name   string
+		before *domain.Product
+		after  domain.Product
+		fields []string
+	}{
+		{"created", nil, *before, []string{"description", "lat", "lng", "product_URL"}},
+		{"unchanged", before, domain.Product{ID: 1, ItemName: "camera", Lat: 51.5, Lng: -0.1, URL: "http://a", Version: 2}, []string{}},
+		{"updated", before, domain.Product{ID: 1, ItemName: "lens", Lat: 51.5, Lng: -0.1, ImageURL: "http://img"}, []string{"description", "img_URL", "product_URL"}},
+		{"deleted", before, domain.Product{ID: 1, ItemName: "camera", Lat: 51.5, Lng: -0.1, URL: "http://a", DeletedAt: &deletedAt}, []string{"deleted_at"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.fields, fields(audit.Diff(tt.before, &tt.after)))
+		})
+	}
+
+	changes := audit.Diff(before, &domain.Product{ID: 1, ItemName: "lens", Lat: 51.5, Lng: -0.1, URL: "http://a"})
+	assert.Equal(t, []domain.Change{{Field: "description", From: "camera", To: "lens"}}, changes)
+}
+
+func TestNewRevision(t *testing.T) {
+	p := &domain.Product{ID: 7, ItemName: "camera", Version: 1}
+
+	rev := audit.NewRevision(context.Background(), domain.ActionCreate, nil, p)
+	assert.Equal(t, audit.Anonymous, rev.Actor)
+	assert.Equal(t, uint64(7), rev.ProductID)
+	assert.Equal(t, *p, rev.Snapshot)
+	assert.WithinDuration(t, time.Now(), rev.At, time.Minute)
+
+	ctx := audit.NewContext(context.Background(), audit.Info{Actor: "alice", RequestID: "req-1"})
+	rev = audit.NewRevision(ctx, domain.ActionUpdate, p, p)
+	assert.Equal(t, "alice", rev.Actor)
+	assert.Equal(t, "req-1", rev.RequestID)
+	assert.Equal(t, domain.ActionUpdate, rev.Action)
+	assert.Empty(t, rev.Changes)
+}
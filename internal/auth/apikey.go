@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/mustafadubul/product/internal/tenant"
+)
+
+// APIKeyHeader carries the API key of a request.
+const APIKeyHeader = "X-API-Key"
+
+// APIKey is a static key and the principal it authenticates.
+type APIKey struct {
+	Key     string   `json:"key"`
+	Subject string   `json:"subject"`
+	Tenant  string   `json:"tenant,omitempty"`
+	Scopes  []string `json:"scopes"`
+}
+
+// APIKeys authenticates requests by the key in their X-API-Key header. The
+// keys are held as their SHA-256 hashes.
+type APIKeys struct {
+	keys map[[sha256.Size]byte]*Principal
+}
+
+// NewAPIKeys checks the keys and returns their authenticator.
+func NewAPIKeys(keys []APIKey) (*APIKeys, error) {
+	a := &APIKeys{keys: make(map[[sha256.Size]byte]*Principal, len(keys))}
+	for i, k := range keys {
+		if k.Key == "" || k.Subject == "" {
+			return nil, fmt.Errorf("API key %d: key and subject are required", i)
+		}
+		if k.Tenant != "" {
+			if err := tenant.Validate(k.Tenant); err != nil {
+				return nil, fmt.Errorf("API key %d: %w %q", i, err, k.Tenant)
+			}
+		}
+		for _, s := range k.Scopes {
+			if !validScope(s) {
+				return nil, fmt.Errorf("API key %d: unknown scope %q", i, s)
+			}
+		}
+
+		sum := sha256.Sum256([]byte(k.Key))
+		if _, ok := a.keys[sum]; ok {
+			return nil, fmt.Errorf("API key %d: duplicate key", i)
+		}
+		a.keys[sum] = &Principal{Subject: k.Subject, Tenant: k.Tenant, Scopes: k.Scopes, Method: MethodAPIKey, KeyID: KeyID(k.Key)}
+	}
+	return a, nil
+}
+
+// KeyID returns the identity of key, the first 16 hex digits of its SHA-256.
+func KeyID(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+// LoadAPIKeys reads the keys from a JSON file holding an array of APIKey.
+func LoadAPIKeys(path string) (*APIKeys, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var keys []APIKey
+	if err := json.Unmarshal(b, &keys); err != nil {
+		return nil, fmt.Errorf("failed to read API keys %s: %w", path, err)
+	}
+	return NewAPIKeys(keys)
+}
+
+func (a *APIKeys) Authenticate(r *http.Request) (*Principal, error) {
+	key := r.Header.Get(APIKeyHeader)
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+	p, ok := a.keys[sha256.Sum256([]byte(key))]
+	if !ok {
+		return nil, fmt.Errorf("unknown API key: %w", ErrUnauthenticated)
+	}
+	principal := *p
+	return &principal, nil
+}
@@ -0,0 +1,110 @@
+// Package auth authenticates the callers of the API, by static API keys or by
+// locally verified JWTs, and carries the principal of a request in its
+// context.
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// The scopes a principal is granted. A scope grants the scopes below it, so
+// products:admin grants products:write which grants products:read.
+const (
+	ScopeRead  = "products:read"
+	ScopeWrite = "products:write"
+	ScopeAdmin = "products:admin"
+)
+
+// implied lists the scopes a scope grants besides itself.
+var implied = map[string][]string{
+	ScopeRead:  nil,
+	ScopeWrite: {ScopeRead},
+	ScopeAdmin: {ScopeWrite, ScopeRead},
+}
+
+var (
+	// ErrNoCredentials is returned by an Authenticator for a request that
+	// carries none of the credentials it checks.
+	ErrNoCredentials = errors.New("no credentials")
+	// ErrUnauthenticated is returned for credentials that are not valid.
+	ErrUnauthenticated = errors.New("unauthenticated")
+)
+
+// The methods a principal is authenticated by.
+const (
+	MethodAPIKey = "api_key"
+	MethodJWT    = "jwt"
+)
+
+// Principal is the authenticated caller of a request. A principal without a
+// tenant may act for any tenant when it is granted ScopeAdmin, and for the
+// default tenant otherwise.
+type Principal struct {
+	Subject string
+	Tenant  string
+	Scopes  []string
+	Method  string
+
+	// KeyID identifies the API key a principal is authenticated by without
+	// revealing it, it is empty for tokens.
+	KeyID string
+}
+
+// Has reports whether the principal is granted scope.
+func (p *Principal) Has(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+		for _, i := range implied[s] {
+			if i == scope {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Authenticator authenticates the caller of a request. It returns
+// ErrNoCredentials when the request carries none of its credentials, so the
+// next authenticator can be tried.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// Chain is an Authenticator trying its authenticators in order, the first
+// that finds its credentials in the request decides.
+type Chain []Authenticator
+
+func (c Chain) Authenticate(r *http.Request) (*Principal, error) {
+	for _, a := range c {
+		p, err := a.Authenticate(r)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		return p, err
+	}
+	return nil, ErrNoCredentials
+}
+
+// validScope reports whether scope is one of the known scopes.
+func validScope(scope string) bool {
+	_, ok := implied[scope]
+	return ok
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying the principal.
+func NewContext(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+// FromContext returns the principal carried by ctx, nil for requests that
+// were not authenticated.
+func FromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(contextKey{}).(*Principal)
+	return p
+}
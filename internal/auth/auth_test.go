@@ -0,0 +1,94 @@
+package auth_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/mustafadubul/product/internal/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrincipalHas(t *testing.T) {
+	admin := &auth.Principal{Scopes: []string{auth.ScopeAdmin}}
+	writer := &auth.Principal{Scopes: []string{auth.ScopeWrite}}
+	reader := &auth.Principal{Scopes: []string{auth.ScopeRead}}
+
+	assert.True(t, admin.Has(auth.ScopeRead))
+	assert.True(t, admin.Has(auth.ScopeWrite))
+	assert.True(t, writer.Has(auth.ScopeRead))
+	assert.False(t, writer.Has(auth.ScopeAdmin))
+	assert.False(t, reader.Has(auth.ScopeWrite))
+	assert.False(t, (&auth.Principal{}).Has(auth.ScopeRead))
+}
+
+func TestAPIKeys(t *testing.T) {
+	keys, err := auth.NewAPIKeys([]auth.APIKey{
+		{Key: "k1", Subject: "importer", Tenant: "acme", Scopes: []string{auth.ScopeWrite}},
+		{Key: "k2", Subject: "ops", Scopes: []string{auth.ScopeAdmin}},
+	})
+	assert.NoError(t, err)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	_, err = keys.Authenticate(r)
+	assert.True(t, errors.Is(err, auth.ErrNoCredentials), "got %v", err)
+
+	r.Header.Set(auth.APIKeyHeader, "k1")
+	p, err := keys.Authenticate(r)
+	assert.NoError(t, err)
+	assert.Equal(t, &auth.Principal{Subject: "importer", Tenant: "acme", Scopes: []string{auth.ScopeWrite}, Method: auth.MethodAPIKey, KeyID: auth.KeyID("k1")}, p)
+	assert.Len(t, p.KeyID, 16)
+	assert.NotEqual(t, auth.KeyID("k2"), p.KeyID)
+
+	r.Header.Set(auth.APIKeyHeader, "k3")
+	_, err = keys.Authenticate(r)
+	assert.True(t, errors.Is(err, auth.ErrUnauthenticated), "got %v", err)
+}
+
+func TestNewAPIKeysInvalid(t *testing.T) {
+	for _, keys := range [][]auth.APIKey{
+		{{Key: "k1"}},
+		{{Key: "k1", Subject: "a", Scopes: []string{"products:delete"}}},
+		{{Key: "k1", Subject: "a", Tenant: "Acme"}},
+		{{Key: "k1", Subject: "a"}, {Key: "k1", Subject: "b"}},
+	} {
+		_, err := auth.NewAPIKeys(keys)
+		assert.Error(t, err, "%+v", keys)
+	}
+}
+
+func TestLoadAPIKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`[{"key": "k1", "subject": "importer", "scopes": ["products:write"]}]`), 0600))
+
+	keys, err := auth.LoadAPIKeys(path)
+	assert.NoError(t, err)
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(auth.APIKeyHeader, "k1")
+	p, err := keys.Authenticate(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "importer", p.Subject)
+}
+
+func TestChain(t *testing.T) {
+	keys, err := auth.NewAPIKeys([]auth.APIKey{{Key: "k1", Subject: "importer"}})
+	assert.NoError(t, err)
+	chain := auth.Chain{auth.NewJWT(auth.WithHS256([]byte("secret"))), keys}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	_, err = chain.Authenticate(r)
+	assert.True(t, errors.Is(err, auth.ErrNoCredentials), "got %v", err)
+
+	r.Header.Set(auth.APIKeyHeader, "k1")
+	p, err := chain.Authenticate(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "importer", p.Subject)
+
+	// the first authenticator finding its credentials decides
+	r.Header.Set("Authorization", "Bearer not-a-token")
+	_, err = chain.Authenticate(r)
+	assert.True(t, errors.Is(err, auth.ErrUnauthenticated), "got %v", err)
+}
@@ -0,0 +1,296 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mustafadubul/product/internal/tenant"
+)
+
+// DefaultLeeway is the clock skew tolerated when checking the expiry and
+// not-before times of a token.
+const DefaultLeeway = time.Minute
+
+// JWT authenticates requests by the bearer token in their Authorization
+// header. Tokens are verified locally, signed with HS256 by a shared secret or
+// with RS256 by a key of a JWKS. A token must expire, its scopes are taken
+// from the space separated scope claim or the scp array and its tenant from
+// the tenant claim.
+type JWT struct {
+	secret   []byte
+	keys     map[string]*rsa.PublicKey
+	issuer   string
+	audience string
+	leeway   time.Duration
+	now      func() time.Time
+}
+
+// JWTOption configures a JWT.
+type JWTOption func(*JWT)
+
+// WithHS256 accepts tokens signed with HS256 by secret.
+func WithHS256(secret []byte) JWTOption {
+	return func(j *JWT) {
+		j.secret = secret
+	}
+}
+
+// WithRS256 accepts tokens signed with RS256 by one of the keys, which are
+// looked up by the kid of the token.
+func WithRS256(keys map[string]*rsa.PublicKey) JWTOption {
+	return func(j *JWT) {
+		j.keys = keys
+	}
+}
+
+// WithIssuer only accepts tokens issued by iss.
+func WithIssuer(iss string) JWTOption {
+	return func(j *JWT) {
+		j.issuer = iss
+	}
+}
+
+// WithAudience only accepts tokens meant for aud.
+func WithAudience(aud string) JWTOption {
+	return func(j *JWT) {
+		j.audience = aud
+	}
+}
+
+// WithLeeway sets the clock skew tolerated on the expiry and not-before times.
+func WithLeeway(d time.Duration) JWTOption {
+	return func(j *JWT) {
+		j.leeway = d
+	}
+}
+
+// WithClock sets the clock tokens are checked against, for tests.
+func WithClock(now func() time.Time) JWTOption {
+	return func(j *JWT) {
+		j.now = now
+	}
+}
+
+func NewJWT(opts ...JWTOption) *JWT {
+	j := &JWT{leeway: DefaultLeeway, now: time.Now}
+	for _, opt := range opts {
+		opt(j)
+	}
+	return j
+}
+
+func (j *JWT) Authenticate(r *http.Request) (*Principal, error) {
+	h := r.Header.Get("Authorization")
+	if len(h) < 7 || !strings.EqualFold(h[:7], "bearer ") {
+		return nil, ErrNoCredentials
+	}
+	return j.Verify(strings.TrimSpace(h[7:]))
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type claims struct {
+	Subject   string   `json:"sub"`
+	Issuer    string   `json:"iss"`
+	Audience  audience `json:"aud"`
+	ExpiresAt *float64 `json:"exp"`
+	NotBefore *float64 `json:"nbf"`
+	Scope     string   `json:"scope"`
+	Scp       []string `json:"scp"`
+	Tenant    string   `json:"tenant"`
+}
+
+// audience is the aud claim, a string or an array of strings.
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var one string
+	if err := json.Unmarshal(b, &one); err == nil {
+		*a = audience{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(b, &many); err != nil {
+		return err
+	}
+	*a = many
+	return nil
+}
+
+// Verify checks the signature and claims of a compact serialized token and
+// returns its principal.
+func (j *JWT) Verify(token string) (*Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed token: %w", ErrUnauthenticated)
+	}
+
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return nil, fmt.Errorf("malformed token header: %w", ErrUnauthenticated)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token signature: %w", ErrUnauthenticated)
+	}
+	if err := j.verifySignature(&h, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+
+	var c claims
+	if err := decodeSegment(parts[1], &c); err != nil {
+		return nil, fmt.Errorf("malformed token claims: %w", ErrUnauthenticated)
+	}
+	if err := j.verifyClaims(&c); err != nil {
+		return nil, err
+	}
+
+	scopes := c.Scp
+	if c.Scope != "" {
+		scopes = strings.Fields(c.Scope)
+	}
+	return &Principal{Subject: c.Subject, Tenant: c.Tenant, Scopes: scopes, Method: MethodJWT}, nil
+}
+
+// verifySignature checks sig over the signing input with the algorithm of the
+// header, only the algorithms a key was configured for are accepted.
+func (j *JWT) verifySignature(h *header, input string, sig []byte) error {
+	switch h.Alg {
+	case "HS256":
+		if len(j.secret) == 0 {
+			return fmt.Errorf("HS256 tokens are not accepted: %w", ErrUnauthenticated)
+		}
+		mac := hmac.New(sha256.New, j.secret)
+		mac.Write([]byte(input))
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			return fmt.Errorf("invalid token signature: %w", ErrUnauthenticated)
+		}
+		return nil
+	case "RS256":
+		key, ok := j.keys[h.Kid]
+		if !ok && h.Kid == "" && len(j.keys) == 1 {
+			for _, k := range j.keys {
+				key, ok = k, true
+			}
+		}
+		if !ok {
+			return fmt.Errorf("unknown token key %q: %w", h.Kid, ErrUnauthenticated)
+		}
+		sum := sha256.Sum256([]byte(input))
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, sum[:], sig); err != nil {
+			return fmt.Errorf("invalid token signature: %w", ErrUnauthenticated)
+		}
+		return nil
+	}
+	return fmt.Errorf("token algorithm %q is not accepted: %w", h.Alg, ErrUnauthenticated)
+}
+
+func (j *JWT) verifyClaims(c *claims) error {
+	now := j.now()
+	if c.Subject == "" {
+		return fmt.Errorf("token has no subject: %w", ErrUnauthenticated)
+	}
+	if c.ExpiresAt == nil {
+		return fmt.Errorf("token does not expire: %w", ErrUnauthenticated)
+	}
+	if now.Add(-j.leeway).After(unixTime(*c.ExpiresAt)) {
+		return fmt.Errorf("token expired: %w", ErrUnauthenticated)
+	}
+	if c.NotBefore != nil && now.Add(j.leeway).Before(unixTime(*c.NotBefore)) {
+		return fmt.Errorf("token not valid yet: %w", ErrUnauthenticated)
+	}
+	if j.issuer != "" && c.Issuer != j.issuer {
+		return fmt.Errorf("token issuer %q is not accepted: %w", c.Issuer, ErrUnauthenticated)
+	}
+	if j.audience != "" && !c.Audience.has(j.audience) {
+		return fmt.Errorf("token is not meant for %q: %w", j.audience, ErrUnauthenticated)
+	}
+	if c.Tenant != "" {
+		if err := tenant.Validate(c.Tenant); err != nil {
+			return fmt.Errorf("token tenant %q: %v: %w", c.Tenant, err, ErrUnauthenticated)
+		}
+	}
+	return nil
+}
+
+func (a audience) has(aud string) bool {
+	for _, s := range a {
+		if s == aud {
+			return true
+		}
+	}
+	return false
+}
+
+func unixTime(sec float64) time.Time {
+	return time.Unix(0, int64(sec*float64(time.Second)))
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// jwk is an RSA key of a JWKS, the other keys are skipped.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// LoadJWKS reads the RSA signing keys of a JWKS file by their kid.
+func LoadJWKS(path string) (map[string]*rsa.PublicKey, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(b, &set); err != nil {
+		return nil, fmt.Errorf("failed to read JWKS %s: %w", path, err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") || (k.Alg != "" && k.Alg != "RS256") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("JWKS key %q: invalid modulus", k.Kid)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("JWKS key %q: invalid exponent", k.Kid)
+		}
+		exp := 0
+		for _, c := range e {
+			exp = exp<<8 | int(c)
+		}
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exp}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("JWKS %s holds no RSA signing keys", path)
+	}
+	return keys, nil
+}
@@ -0,0 +1,124 @@
+package auth_test
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mustafadubul/product/internal/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+var now = time.Date(2020, 7, 1, 12, 0, 0, 0, time.UTC)
+
+func segment(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func hs256(secret string, claims map[string]interface{}) string {
+	input := segment(map[string]string{"alg": "HS256", "typ": "JWT"}) + "." + segment(claims)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(input))
+	return input + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func rs256(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	input := segment(map[string]string{"alg": "RS256", "typ": "JWT", "kid": kid}) + "." + segment(claims)
+	sum := sha256.Sum256([]byte(input))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	assert.NoError(t, err)
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func valid(extra map[string]interface{}) map[string]interface{} {
+	claims := map[string]interface{}{"sub": "alice", "exp": now.Add(time.Hour).Unix()}
+	for k, v := range extra {
+		claims[k] = v
+	}
+	return claims
+}
+
+func TestJWTHS256(t *testing.T) {
+	j := auth.NewJWT(auth.WithHS256([]byte("s3cr3t")), auth.WithIssuer("https://id.example.com"),
+		auth.WithAudience("product"), auth.WithClock(func() time.Time { return now }))
+
+	token := hs256("s3cr3t", valid(map[string]interface{}{
+		"iss": "https://id.example.com", "aud": []string{"product", "other"},
+		"scope": "products:read products:write", "tenant": "acme",
+	}))
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	p, err := j.Authenticate(r)
+	assert.NoError(t, err)
+	assert.Equal(t, &auth.Principal{Subject: "alice", Tenant: "acme", Scopes: []string{auth.ScopeRead, auth.ScopeWrite}, Method: auth.MethodJWT}, p)
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"wrong secret", hs256("other", valid(map[string]interface{}{"iss": "https://id.example.com", "aud": "product"}))},
+		{"expired", hs256("s3cr3t", valid(map[string]interface{}{"iss": "https://id.example.com", "aud": "product", "exp": now.Add(-time.Hour).Unix()}))},
+		{"not yet valid", hs256("s3cr3t", valid(map[string]interface{}{"iss": "https://id.example.com", "aud": "product", "nbf": now.Add(time.Hour).Unix()}))},
+		{"no expiry", hs256("s3cr3t", map[string]interface{}{"sub": "alice", "iss": "https://id.example.com", "aud": "product"})},
+		{"other issuer", hs256("s3cr3t", valid(map[string]interface{}{"iss": "https://evil.example.com", "aud": "product"}))},
+		{"other audience", hs256("s3cr3t", valid(map[string]interface{}{"iss": "https://id.example.com", "aud": "billing"}))},
+		{"invalid tenant", hs256("s3cr3t", valid(map[string]interface{}{"iss": "https://id.example.com", "aud": "product", "tenant": "../acme"}))},
+		{"unsigned", segment(map[string]string{"alg": "none"}) + "." + segment(valid(nil)) + "."},
+		{"malformed", "abc.def"},
+	}
+	for _, tt := range tests {
+		_, err := j.Verify(tt.token)
+		assert.True(t, errors.Is(err, auth.ErrUnauthenticated), "%s: got %v", tt.name, err)
+	}
+}
+
+func TestJWTRS256(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	jwks := fmt.Sprintf(`{"keys": [
+		{"kty": "RSA", "kid": "k1", "use": "sig", "alg": "RS256", "n": %q, "e": %q},
+		{"kty": "EC", "kid": "k2", "crv": "P-256", "x": "AA", "y": "AA"}
+	]}`, base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()))
+	assert.NoError(t, ioutil.WriteFile(path, []byte(jwks), 0600))
+
+	keys, err := auth.LoadJWKS(path)
+	assert.NoError(t, err)
+	assert.Len(t, keys, 1)
+	j := auth.NewJWT(auth.WithRS256(keys), auth.WithClock(func() time.Time { return now }))
+
+	p, err := j.Verify(rs256(t, key, "k1", valid(map[string]interface{}{"scp": []string{auth.ScopeAdmin}})))
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", p.Subject)
+	assert.True(t, p.Has(auth.ScopeWrite))
+
+	// with a single key the kid may be left out
+	_, err = j.Verify(rs256(t, key, "", valid(nil)))
+	assert.NoError(t, err)
+
+	_, err = j.Verify(rs256(t, other, "k1", valid(nil)))
+	assert.True(t, errors.Is(err, auth.ErrUnauthenticated), "got %v", err)
+	_, err = j.Verify(rs256(t, key, "k9", valid(nil)))
+	assert.True(t, errors.Is(err, auth.ErrUnauthenticated), "got %v", err)
+	// no HS256 secret is configured
+	_, err = j.Verify(hs256("", valid(nil)))
+	assert.True(t, errors.Is(err, auth.ErrUnauthenticated), "got %v", err)
+}
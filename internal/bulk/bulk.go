@@ -0,0 +1,61 @@
+// Package bulk reads and writes catalogues of products as CSV, NDJSON and
+// GeoJSON, one product at a time so large catalogues never have to fit in
+// memory.
+package bulk
+
+import (
+	"fmt"
+	"mime"
+	"strings"
+)
+
+type Format string
+
+const (
+	CSV     Format = "csv"
+	NDJSON  Format = "ndjson"
+	GeoJSON Format = "geojson"
+)
+
+var contentTypes = map[Format]string{
+	CSV:     "text/csv",
+	NDJSON:  "application/x-ndjson",
+	GeoJSON: "application/geo+json",
+}
+
+// ParseFormat returns the format with the given name.
+func ParseFormat(name string) (Format, error) {
+	switch f := Format(strings.ToLower(name)); f {
+	case CSV, NDJSON, GeoJSON:
+		return f, nil
+	case "jsonl":
+		return NDJSON, nil
+	}
+	return "", fmt.Errorf("unknown format %q", name)
+}
+
+// FormatOf returns the format of a media type, e.g. from a Content-Type header.
+func FormatOf(mediaType string) (Format, error) {
+	mt, _, err := mime.ParseMediaType(mediaType)
+	if err != nil {
+		return "", fmt.Errorf("invalid media type %q", mediaType)
+	}
+	for f, ct := range contentTypes {
+		if mt == ct {
+			return f, nil
+		}
+	}
+	if mt == "application/jsonl" {
+		return NDJSON, nil
+	}
+	return "", fmt.Errorf("unsupported media type %q", mt)
+}
+
+// ContentType returns the media type of the format.
+func (f Format) ContentType() string {
+	return contentTypes[f]
+}
+
+// csvHeader are the columns of a CSV catalogue, named like the JSON fields of
+// domain.Product.
+var csvHeader = []string{"id", "description", "lat", "lng", "img_URL", "product_URL"}
@@ -0,0 +1,270 @@
+package bulk
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/mustafadubul/product/internal/domain"
+)
+
+// Row is a single product read from a catalogue. Err is set when the row could
+// not be read, the decoder carries on with the next row.
+type Row struct {
+	Line    int
+	Product domain.Product
+	Err     error
+}
+
+// Decoder reads the rows of a catalogue. Next returns io.EOF after the last
+// row, any other error means the catalogue as a whole can not be read.
+type Decoder interface {
+	Next() (Row, error)
+}
+
+func NewDecoder(f Format, r io.Reader) (Decoder, error) {
+	switch f {
+	case CSV:
+		return newCSVDecoder(r)
+	case NDJSON:
+		return &ndjsonDecoder{scanner: newScanner(r)}, nil
+	case GeoJSON:
+		return newGeoJSONDecoder(r)
+	}
+	return nil, fmt.Errorf("unknown format %q", f)
+}
+
+type csvDecoder struct {
+	reader  *csv.Reader
+	columns map[string]int
+	line    int
+}
+
+func newCSVDecoder(r io.Reader) (*csvDecoder, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read csv header: %w", err)
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		for _, known := range csvHeader {
+			if strings.EqualFold(strings.TrimSpace(name), known) {
+				columns[known] = i
+			}
+		}
+	}
+	for _, required := range []string{"description", "lat", "lng"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("csv header is missing the %s column", required)
+		}
+	}
+
+	return &csvDecoder{reader: reader, columns: columns, line: 1}, nil
+}
+
+func (d *csvDecoder) Next() (Row, error) {
+	record, err := d.reader.Read()
+	d.line++
+	if err == io.EOF {
+		return Row{}, io.EOF
+	}
+
+	row := Row{Line: d.line}
+	if err != nil {
+		var perr *csv.ParseError
+		if errors.As(err, &perr) {
+			row.Line = perr.Line
+		}
+		row.Err = err
+		return row, nil
+	}
+
+	value := func(column string) string {
+		i, ok := d.columns[column]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	p := &row.Product
+	p.ItemName = value("description")
+	p.ImageURL = value("img_URL")
+	p.URL = value("product_URL")
+
+	if v := value("id"); v != "" {
+		if p.ID, err = strconv.ParseUint(v, 10, 64); err != nil {
+			row.Err = fmt.Errorf("invalid id %q", v)
+			return row, nil
+		}
+	}
+	if p.Lat, err = strconv.ParseFloat(value("lat"), 64); err != nil {
+		row.Err = fmt.Errorf("invalid lat %q", value("lat"))
+		return row, nil
+	}
+	if p.Lng, err = strconv.ParseFloat(value("lng"), 64); err != nil {
+		row.Err = fmt.Errorf("invalid lng %q", value("lng"))
+		return row, nil
+	}
+	return row, nil
+}
+
+// maxLine is the longest NDJSON line accepted.
+const maxLine = 1 << 20
+
+func newScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLine)
+	return scanner
+}
+
+type ndjsonDecoder struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func (d *ndjsonDecoder) Next() (Row, error) {
+	for d.scanner.Scan() {
+		d.line++
+		data := bytes.TrimSpace(d.scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		row := Row{Line: d.line}
+		if err := json.Unmarshal(data, &row.Product); err != nil {
+			row.Err = fmt.Errorf("invalid json: %w", err)
+		}
+		return row, nil
+	}
+	if err := d.scanner.Err(); err != nil {
+		return Row{}, fmt.Errorf("failed to read line %d: %w", d.line+1, err)
+	}
+	return Row{}, io.EOF
+}
+
+// geoJSONDecoder reads the features of a FeatureCollection one by one. Rows
+// are numbered by the position of the feature in the collection.
+type geoJSONDecoder struct {
+	decoder *json.Decoder
+	feature int
+	done    bool
+}
+
+type feature struct {
+	Type     string `json:"type"`
+	Geometry *struct {
+		Type        string          `json:"type"`
+		Coordinates json.RawMessage `json:"coordinates"`
+	} `json:"geometry"`
+	Properties struct {
+		ID       uint64 `json:"id"`
+		ItemName string `json:"description"`
+		ImageURL string `json:"img_URL"`
+		URL      string `json:"product_URL"`
+	} `json:"properties"`
+	ID json.RawMessage `json:"id"`
+}
+
+func newGeoJSONDecoder(r io.Reader) (*geoJSONDecoder, error) {
+	d := &geoJSONDecoder{decoder: json.NewDecoder(r)}
+
+	if err := d.expect(json.Delim('{')); err != nil {
+		return nil, err
+	}
+
+	// skip to the features, the other members of the collection are ignored
+	for {
+		tok, err := d.decoder.Token()
+		if err != nil {
+			return nil, fmt.Errorf("invalid geojson: %w", err)
+		}
+		key, ok := tok.(string)
+		if !ok {
+			return nil, errors.New("invalid geojson: features not found")
+		}
+		if key == "features" {
+			break
+		}
+		var skip json.RawMessage
+		if err := d.decoder.Decode(&skip); err != nil {
+			return nil, fmt.Errorf("invalid geojson: %w", err)
+		}
+	}
+
+	if err := d.expect(json.Delim('[')); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *geoJSONDecoder) expect(delim json.Delim) error {
+	tok, err := d.decoder.Token()
+	if err != nil {
+		return fmt.Errorf("invalid geojson: %w", err)
+	}
+	if tok != delim {
+		return fmt.Errorf("invalid geojson: expected %v", delim)
+	}
+	return nil
+}
+
+func (d *geoJSONDecoder) Next() (Row, error) {
+	if d.done || !d.decoder.More() {
+		d.done = true
+		return Row{}, io.EOF
+	}
+
+	d.feature++
+	row := Row{Line: d.feature}
+
+	var raw json.RawMessage
+	if err := d.decoder.Decode(&raw); err != nil {
+		// the position in the stream is lost, so nothing after it can be read
+		d.done = true
+		return Row{}, fmt.Errorf("invalid geojson feature %d: %w", d.feature, err)
+	}
+
+	var f feature
+	if err := json.Unmarshal(raw, &f); err != nil {
+		row.Err = fmt.Errorf("invalid feature: %w", err)
+		return row, nil
+	}
+
+	var coordinates []float64
+
+	switch {
+	case f.Type != "Feature":
+		row.Err = fmt.Errorf("expected a Feature, got %q", f.Type)
+	case f.Geometry == nil || f.Geometry.Type != "Point":
+		row.Err = errors.New("geometry must be a Point")
+	case json.Unmarshal(f.Geometry.Coordinates, &coordinates) != nil || len(coordinates) < 2:
+		row.Err = errors.New("point must have a longitude and a latitude")
+	default:
+		row.Product = domain.Product{
+			ID:       f.Properties.ID,
+			ItemName: f.Properties.ItemName,
+			Lat:      coordinates[1],
+			Lng:      coordinates[0],
+			ImageURL: f.Properties.ImageURL,
+			URL:      f.Properties.URL,
+		}
+		if row.Product.ID == 0 && len(f.ID) > 0 {
+			if err := json.Unmarshal(f.ID, &row.Product.ID); err != nil {
+				row.Err = fmt.Errorf("invalid id %s", f.ID)
+			}
+		}
+	}
+	return row, nil
+}
@@ -0,0 +1,112 @@
+package bulk_test
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/mustafadubul/product/internal/bulk"
+	"github.com/mustafadubul/product/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readAll(t *testing.T, f bulk.Format, input string) []bulk.Row {
+	d, err := bulk.NewDecoder(f, strings.NewReader(input))
+	require.NoError(t, err)
+
+	var rows []bulk.Row
+	for {
+		row, err := d.Next()
+		if err == io.EOF {
+			return rows
+		}
+		require.NoError(t, err)
+		rows = append(rows, row)
+	}
+}
+
+func TestDecodeCSV(t *testing.T) {
+	input := "id,description,lat,lng,img_URL,product_URL\n" +
+		"7,Canon EOS,51.5,-0.1,http://img/1,http://product/1\n" +
+		",Nikon Z6,north,-0.1,,\n" +
+		",\"Sony, A7\",51.6,-0.2,,\n"
+
+	rows := readAll(t, bulk.CSV, input)
+	require.Len(t, rows, 3)
+
+	assert.NoError(t, rows[0].Err)
+	assert.Equal(t, 2, rows[0].Line)
+	assert.Equal(t, domain.Product{ID: 7, ItemName: "Canon EOS", Lat: 51.5, Lng: -0.1, ImageURL: "http://img/1", URL: "http://product/1"}, rows[0].Product)
+
+	assert.EqualError(t, rows[1].Err, `invalid lat "north"`)
+	assert.Equal(t, 3, rows[1].Line)
+
+	assert.NoError(t, rows[2].Err)
+	assert.Equal(t, "Sony, A7", rows[2].Product.ItemName)
+}
+
+func TestDecodeCSVMissingColumn(t *testing.T) {
+	_, err := bulk.NewDecoder(bulk.CSV, strings.NewReader("description,lat\ncamera,51.5\n"))
+	assert.EqualError(t, err, "csv header is missing the lng column")
+}
+
+func TestDecodeNDJSON(t *testing.T) {
+	input := `{"description":"Canon EOS","lat":51.5,"lng":-0.1}` + "\n" +
+		"\n" +
+		`{"description":"Nikon Z6","lat":` + "\n" +
+		`{"id":3,"description":"Sony A7","lat":51.6,"lng":-0.2}` + "\n"
+
+	rows := readAll(t, bulk.NDJSON, input)
+	require.Len(t, rows, 3)
+
+	assert.NoError(t, rows[0].Err)
+	assert.Equal(t, domain.Product{ItemName: "Canon EOS", Lat: 51.5, Lng: -0.1}, rows[0].Product)
+
+	assert.Error(t, rows[1].Err)
+	assert.Equal(t, 3, rows[1].Line)
+
+	assert.NoError(t, rows[2].Err)
+	assert.Equal(t, 4, rows[2].Line)
+	assert.Equal(t, uint64(3), rows[2].Product.ID)
+}
+
+func TestDecodeGeoJSON(t *testing.T) {
+	input := `{
+		"type": "FeatureCollection",
+		"name": "catalogue",
+		"features": [
+			{"type": "Feature", "id": 4, "geometry": {"type": "Point", "coordinates": [-0.1, 51.5]},
+			 "properties": {"description": "Canon EOS", "img_URL": "http://img/1"}},
+			{"type": "Feature", "geometry": {"type": "LineString", "coordinates": [[-0.1, 51.5], [-0.2, 51.6]]},
+			 "properties": {"description": "Nikon Z6"}},
+			{"type": "Feature", "geometry": {"type": "Point", "coordinates": [-0.2, 51.6]},
+			 "properties": {"id": 5, "description": "Sony A7"}}
+		]
+	}`
+
+	rows := readAll(t, bulk.GeoJSON, input)
+	require.Len(t, rows, 3)
+
+	assert.NoError(t, rows[0].Err)
+	assert.Equal(t, domain.Product{ID: 4, ItemName: "Canon EOS", Lat: 51.5, Lng: -0.1, ImageURL: "http://img/1"}, rows[0].Product)
+
+	assert.Error(t, rows[1].Err)
+	assert.Equal(t, 2, rows[1].Line)
+
+	assert.NoError(t, rows[2].Err)
+	assert.Equal(t, domain.Product{ID: 5, ItemName: "Sony A7", Lat: 51.6, Lng: -0.2}, rows[2].Product)
+}
+
+func TestParseFormat(t *testing.T) {
+	f, err := bulk.ParseFormat("jsonl")
+	assert.NoError(t, err)
+	assert.Equal(t, bulk.NDJSON, f)
+
+	f, err = bulk.FormatOf("text/csv; charset=utf-8")
+	assert.NoError(t, err)
+	assert.Equal(t, bulk.CSV, f)
+
+	_, err = bulk.ParseFormat("xml")
+	assert.Error(t, err)
+}
@@ -0,0 +1,130 @@
+package bulk
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/mustafadubul/product/internal/domain"
+)
+
+// Encoder writes the products of a catalogue one by one. Close writes what the
+// format needs after the last product, it does not close the writer.
+type Encoder interface {
+	Encode(p *domain.Product) error
+	Close() error
+}
+
+func NewEncoder(f Format, w io.Writer) (Encoder, error) {
+	switch f {
+	case CSV:
+		return &csvEncoder{writer: csv.NewWriter(w)}, nil
+	case NDJSON:
+		return &ndjsonEncoder{encoder: json.NewEncoder(w)}, nil
+	case GeoJSON:
+		return &geoJSONEncoder{w: w}, nil
+	}
+	return nil, fmt.Errorf("unknown format %q", f)
+}
+
+type csvEncoder struct {
+	writer      *csv.Writer
+	wroteHeader bool
+}
+
+func (e *csvEncoder) Encode(p *domain.Product) error {
+	if !e.wroteHeader {
+		if err := e.writer.Write(csvHeader); err != nil {
+			return err
+		}
+		e.wroteHeader = true
+	}
+	return e.writer.Write([]string{
+		strconv.FormatUint(p.ID, 10),
+		p.ItemName,
+		strconv.FormatFloat(p.Lat, 'f', -1, 64),
+		strconv.FormatFloat(p.Lng, 'f', -1, 64),
+		p.ImageURL,
+		p.URL,
+	})
+}
+
+func (e *csvEncoder) Close() error {
+	if !e.wroteHeader {
+		if err := e.writer.Write(csvHeader); err != nil {
+			return err
+		}
+	}
+	e.writer.Flush()
+	return e.writer.Error()
+}
+
+type ndjsonEncoder struct {
+	encoder *json.Encoder
+}
+
+func (e *ndjsonEncoder) Encode(p *domain.Product) error {
+	return e.encoder.Encode(p)
+}
+
+func (e *ndjsonEncoder) Close() error {
+	return nil
+}
+
+// geoJSONEncoder writes a FeatureCollection, the features are written as they
+// come so the collection is only valid once the encoder is closed.
+type geoJSONEncoder struct {
+	w        io.Writer
+	features int
+}
+
+type pointFeature struct {
+	Type     string `json:"type"`
+	ID       uint64 `json:"id"`
+	Geometry struct {
+		Type        string     `json:"type"`
+		Coordinates [2]float64 `json:"coordinates"`
+	} `json:"geometry"`
+	Properties struct {
+		ItemName string `json:"description"`
+		ImageURL string `json:"img_URL"`
+		URL      string `json:"product_URL"`
+	} `json:"properties"`
+}
+
+func (e *geoJSONEncoder) Encode(p *domain.Product) error {
+	f := pointFeature{Type: "Feature", ID: p.ID}
+	f.Geometry.Type = "Point"
+	f.Geometry.Coordinates = [2]float64{p.Lng, p.Lat}
+	f.Properties.ItemName = p.ItemName
+	f.Properties.ImageURL = p.ImageURL
+	f.Properties.URL = p.URL
+
+	data, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+
+	prefix := ",\n"
+	if e.features == 0 {
+		prefix = `{"type":"FeatureCollection","features":[` + "\n"
+	}
+	e.features++
+
+	if _, err := io.WriteString(e.w, prefix); err != nil {
+		return err
+	}
+	_, err = e.w.Write(data)
+	return err
+}
+
+func (e *geoJSONEncoder) Close() error {
+	if e.features == 0 {
+		_, err := io.WriteString(e.w, `{"type":"FeatureCollection","features":[]}`+"\n")
+		return err
+	}
+	_, err := io.WriteString(e.w, "\n]}\n")
+	return err
+}
@@ -0,0 +1,49 @@
+package bulk_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/mustafadubul/product/internal/bulk"
+	"github.com/mustafadubul/product/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeRoundTrip(t *testing.T) {
+	products := []domain.Product{
+		{ID: 1, ItemName: "Canon EOS", Lat: 51.5, Lng: -0.1, ImageURL: "http://img/1", URL: "http://product/1"},
+		{ID: 2, ItemName: `Sony "A7", body only`, Lat: -33.8688, Lng: 151.2093},
+	}
+
+	for _, f := range []bulk.Format{bulk.CSV, bulk.NDJSON, bulk.GeoJSON} {
+		t.Run(string(f), func(t *testing.T) {
+			var buf bytes.Buffer
+			enc, err := bulk.NewEncoder(f, &buf)
+			require.NoError(t, err)
+			for i := range products {
+				require.NoError(t, enc.Encode(&products[i]))
+			}
+			require.NoError(t, enc.Close())
+
+			var decoded []domain.Product
+			for _, row := range readAll(t, f, buf.String()) {
+				assert.NoError(t, row.Err)
+				decoded = append(decoded, row.Product)
+			}
+			assert.Equal(t, products, decoded)
+		})
+	}
+}
+
+func TestEncodeEmptyGeoJSON(t *testing.T) {
+	var buf bytes.Buffer
+	enc, err := bulk.NewEncoder(bulk.GeoJSON, &buf)
+	require.NoError(t, err)
+	require.NoError(t, enc.Close())
+
+	var collection map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &collection))
+	assert.Equal(t, []interface{}{}, collection["features"])
+}
@@ -1,23 +1,219 @@
 package domain
 
+import "time"
+
+// Product is an item of the catalogue. Version counts the writes of the
+// product and DeletedAt is set while the product is in the trash, both are
+// set by the repository, as is Tenant from the context of the write.
 type Product struct {
 	ID       uint64  `gorm:"column:id;primary_key" json:"id"`
+	Tenant   string  `gorm:"column:tenant;not null;default:'default';index" json:"-"`
 	ItemName string  `json:"description"`
 	Lat      float64 `json:"lat"`
 	Lng      float64 `json:"lng"`
 	ImageURL string  `json:"img_URL"`
 	URL      string  `json:"product_URL"`
+	Version  uint64  `gorm:"column:version;not null;default:1" json:"version"`
+
+	DeletedAt *time.Time `gorm:"column:deleted_at;index" json:"deleted_at,omitempty"`
 }
 
 func (p *Product) TableName() string {
 	return "items"
 }
 
+// ProductPatch holds the fields a merge patch changes, nil fields are left as
+// they are. A field the patch sets to null is cleared to its zero value.
+type ProductPatch struct {
+	ItemName *string
+	Lat      *float64
+	Lng      *float64
+	ImageURL *string
+	URL      *string
+}
+
+// Apply writes the fields of the patch to p.
+func (pp *ProductPatch) Apply(p *Product) {
+	if pp.ItemName != nil {
+		p.ItemName = *pp.ItemName
+	}
+	if pp.Lat != nil {
+		p.Lat = *pp.Lat
+	}
+	if pp.Lng != nil {
+		p.Lng = *pp.Lng
+	}
+	if pp.ImageURL != nil {
+		p.ImageURL = *pp.ImageURL
+	}
+	if pp.URL != nil {
+		p.URL = *pp.URL
+	}
+}
+
+// The actions a revision records.
+const (
+	ActionCreate  = "create"
+	ActionUpdate  = "update"
+	ActionDelete  = "delete"
+	ActionRestore = "restore"
+)
+
+// Revision is an immutable record of a write to a product. Snapshot is the
+// product as the write left it and Changes the fields the write changed.
+// Revisions of a product are numbered from 1 in the order of the writes.
+type Revision struct {
+	ProductID uint64    `json:"product_id"`
+	Tenant    string    `json:"-"`
+	Number    uint64    `json:"revision"`
+	Action    string    `json:"action"`
+	Actor     string    `json:"actor"`
+	RequestID string    `json:"request_id,omitempty"`
+	At        time.Time `json:"at"`
+	Snapshot  Product   `json:"snapshot"`
+	Changes   []Change  `json:"changes"`
+}
+
+// Change is a field of a product changed by a write, named as in the JSON of
+// the product.
+type Change struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+// The types of the events written for the actions of revisions.
+const (
+	EventCreated  = "product.created"
+	EventUpdated  = "product.updated"
+	EventDeleted  = "product.deleted"
+	EventRestored = "product.restored"
+)
+
+var eventTypes = map[string]string{
+	ActionCreate:  EventCreated,
+	ActionUpdate:  EventUpdated,
+	ActionDelete:  EventDeleted,
+	ActionRestore: EventRestored,
+}
+
+// Event tells the consumers of the outbox about a write to a product. Offset
+// is its position in the outbox, set by the repository.
+type Event struct {
+	Offset    uint64    `json:"offset"`
+	Tenant    string    `json:"tenant,omitempty"`
+	Type      string    `json:"type"`
+	ProductID uint64    `json:"product_id"`
+	Revision  uint64    `json:"revision"`
+	Actor     string    `json:"actor"`
+	RequestID string    `json:"request_id,omitempty"`
+	At        time.Time `json:"at"`
+	Product   Product   `json:"product"`
+}
+
+// Event returns the event of the revision.
+func (r *Revision) Event() Event {
+	return Event{
+		Type:      eventTypes[r.Action],
+		Tenant:    r.Tenant,
+		ProductID: r.ProductID,
+		Revision:  r.Number,
+		Actor:     r.Actor,
+		RequestID: r.RequestID,
+		At:        r.At,
+		Product:   r.Snapshot,
+	}
+}
+
+// Webhook is a subscription to the events of the products of its tenant
+// matching Query, the limit and cursor of the query are not used. Every
+// delivery is signed with Secret.
+type Webhook struct {
+	ID        uint64    `json:"id"`
+	Tenant    string    `json:"-"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"`
+	Query     Query     `json:"query"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// DeadLetter is an event that could not be delivered to a webhook, Error is
+// why the last attempt failed.
+type DeadLetter struct {
+	ID        uint64    `json:"id"`
+	WebhookID uint64    `json:"webhook_id"`
+	Event     Event     `json:"event"`
+	Attempts  int       `json:"attempts"`
+	Error     string    `json:"error"`
+	FailedAt  time.Time `json:"failed_at"`
+}
+
+// SavedSearch is a query an owner keeps running. Products of its tenant
+// created, updated or restored after CreatedAt are matched against it as they
+// change, the limit and cursor of the query are not used.
+type SavedSearch struct {
+	ID        uint64    `json:"id"`
+	Tenant    string    `json:"-"`
+	Owner     string    `json:"owner"`
+	Name      string    `json:"name"`
+	Query     Query     `json:"query"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Match is a product that came into a saved search. Product is the product as
+// of the event at Offset which matched it, a product matches a saved search
+// once.
+type Match struct {
+	ID            uint64    `json:"id"`
+	SavedSearchID uint64    `json:"saved_search_id"`
+	ProductID     uint64    `json:"product_id"`
+	Offset        uint64    `json:"offset"`
+	Product       Product   `json:"product"`
+	MatchedAt     time.Time `json:"matched_at"`
+}
+
+// SearchResult is a product matched by a search together with its great-circle
+// distance in meters from the queried location and the score it was ranked by.
+type SearchResult struct {
+	Product
+	Distance float64 `json:"distance_m"`
+	Score    float64 `json:"score"`
+}
+
+// Page is a page of search results. NextCursor is empty on the last page.
+// TotalEstimate is the number of results on this and the following pages the
+// search has found, it is an estimate as the search stops reading once it has
+// the page.
+type Page struct {
+	Items         []SearchResult `json:"items"`
+	NextCursor    string         `json:"next_cursor"`
+	TotalEstimate int            `json:"total_estimate"`
+}
+
 type Query struct {
 	Term   string  `json:"term"`
 	Lat    float64 `json:"lat"`
 	Lng    float64 `json:"lng"`
 	Radius float64 `json:"radius"`
+
+	Limit  int    `json:"limit"`
+	Cursor string `json:"cursor"`
+}
+
+// ImportReport is the outcome of a bulk import, with a row for every product
+// read from the catalogue.
+type ImportReport struct {
+	Accepted int         `json:"accepted"`
+	Rejected int         `json:"rejected"`
+	Rows     []ImportRow `json:"rows"`
+}
+
+// ImportRow reports whether a row was stored, Reason says why it was not.
+type ImportRow struct {
+	Line     int    `json:"line"`
+	ID       uint64 `json:"id,omitempty"`
+	Accepted bool   `json:"accepted"`
+	Reason   string `json:"reason,omitempty"`
 }
 
 type Point struct {
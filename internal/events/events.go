@@ -0,0 +1,115 @@
+// Package events delivers the events of the outbox to publishers. Every
+// publisher is fed by its own dispatcher, which remembers the offset of the
+// last event it delivered, so events are delivered at least once and in order.
+package events
+
+import (
+	"context"
+	"time"
+
+	"github.com/mustafadubul/product/internal/domain"
+	"github.com/mustafadubul/product/internal/repository"
+	"github.com/rs/zerolog"
+)
+
+// Defaults of a dispatcher that is not configured otherwise.
+const (
+	DefaultBatchSize = 100
+	DefaultInterval  = time.Second
+)
+
+// Publisher sends events on to a sink. Publish either delivers all events or
+// returns an error, the dispatcher then retries the whole batch.
+type Publisher interface {
+	Publish(ctx context.Context, events []domain.Event) error
+}
+
+// Dispatcher reads the outbox and hands the events to a publisher.
+type Dispatcher struct {
+	logger *zerolog.Logger
+
+	consumer  string
+	outbox    repository.Outbox
+	publisher Publisher
+
+	batchSize int
+	interval  time.Duration
+}
+
+// Option configures optional behaviour of the Dispatcher.
+type Option func(*Dispatcher)
+
+// WithBatchSize sets how many events are published at once.
+func WithBatchSize(n int) Option {
+	return func(d *Dispatcher) {
+		d.batchSize = n
+	}
+}
+
+// WithInterval sets how long the dispatcher waits for new events once it
+// caught up with the outbox, or after a publisher failed.
+func WithInterval(interval time.Duration) Option {
+	return func(d *Dispatcher) {
+		d.interval = interval
+	}
+}
+
+// NewDispatcher returns a dispatcher publishing the outbox to p. The consumer
+// names the offset the dispatcher keeps in the outbox, it has to be unique for
+// every publisher.
+func NewDispatcher(l *zerolog.Logger, outbox repository.Outbox, consumer string, p Publisher, opts ...Option) *Dispatcher {
+	componentLogger := l.With().Str("component", "dispatcher").Str("consumer", consumer).Logger()
+	d := &Dispatcher{
+		logger:    &componentLogger,
+		consumer:  consumer,
+		outbox:    outbox,
+		publisher: p,
+		batchSize: DefaultBatchSize,
+		interval:  DefaultInterval,
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+// Dispatch publishes the next batch of events and returns how many it
+// published.
+func (d *Dispatcher) Dispatch(ctx context.Context) (int, error) {
+	offset, err := d.outbox.Offset(d.consumer)
+	if err != nil {
+		return 0, err
+	}
+	events, err := d.outbox.Events("", offset, d.batchSize)
+	if err != nil || len(events) == 0 {
+		return 0, err
+	}
+
+	if err := d.publisher.Publish(ctx, events); err != nil {
+		return 0, err
+	}
+	if err := d.outbox.SetOffset(d.consumer, events[len(events)-1].Offset); err != nil {
+		return 0, err
+	}
+	return len(events), nil
+}
+
+// Run dispatches events until ctx is done. It keeps going while there are
+// full batches to publish and waits for the interval otherwise.
+func (d *Dispatcher) Run(ctx context.Context) {
+	for {
+		n, err := d.Dispatch(ctx)
+		if err != nil {
+			d.logger.Error().Err(err).Msg("failed to dispatch events")
+		}
+		if n == d.batchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(d.interval):
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package events_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/mustafadubul/product/internal/domain"
+	"github.com/mustafadubul/product/internal/events"
+	"github.com/mustafadubul/product/internal/repository/memory"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+type recorder struct {
+	events []domain.Event
+	err    error
+}
+
+func (r *recorder) Publish(ctx context.Context, events []domain.Event) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.events = append(r.events, events...)
+	return nil
+}
+
+func TestDispatch(t *testing.T) {
+	ctx := context.Background()
+	repo := memory.New()
+	for _, name := range []string{"camera", "lens", "tripod"} {
+		_, err := repo.Create(ctx, &domain.Product{ItemName: name})
+		assert.NoError(t, err)
+	}
+
+	l := zerolog.Nop()
+	failing := &recorder{err: errors.New("sink down")}
+	d := events.NewDispatcher(&l, repo, "test", failing, events.WithBatchSize(2))
+
+	// a failed batch is published again
+	_, err := d.Dispatch(ctx)
+	assert.Error(t, err)
+	offset, _ := repo.Offset("test")
+	assert.Equal(t, uint64(0), offset)
+
+	r := &recorder{}
+	d = events.NewDispatcher(&l, repo, "test", r, events.WithBatchSize(2))
+
+	n, err := d.Dispatch(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	n, err = d.Dispatch(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	n, err = d.Dispatch(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	if assert.Len(t, r.events, 3) {
+		assert.Equal(t, "tripod", r.events[2].Product.ItemName)
+		assert.Equal(t, domain.EventCreated, r.events[2].Type)
+	}
+	offset, _ = repo.Offset("test")
+	assert.Equal(t, uint64(3), offset)
+
+	// every consumer keeps its own offset
+	other := &recorder{}
+	n, err = events.NewDispatcher(&l, repo, "other", other).Dispatch(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+}
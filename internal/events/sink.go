@@ -0,0 +1,113 @@
+package events
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mustafadubul/product/internal/domain"
+)
+
+// FileSink appends events to a file as NDJSON, one event per line.
+type FileSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileSink opens the file at path for appending, it is created when it
+// does not exist.
+func NewFileSink(path string) (*FileSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{file: f}, nil
+}
+
+// Publish writes the events and syncs the file, so they are on disk before
+// the dispatcher moves past them.
+func (s *FileSink) Publish(ctx context.Context, events []domain.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w := bufio.NewWriter(s.file)
+	enc := json.NewEncoder(w)
+	for i := range events {
+		if err := enc.Encode(&events[i]); err != nil {
+			return fmt.Errorf("failed to write event: %w", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to write events: %w", err)
+	}
+	return s.file.Sync()
+}
+
+func (s *FileSink) Close() error {
+	return s.file.Close()
+}
+
+// DefaultWebhookTimeout bounds a delivery to a webhook.
+const DefaultWebhookTimeout = 10 * time.Second
+
+// WebhookSink posts every event as JSON to a URL. Any status but 2xx fails the
+// delivery.
+type WebhookSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookSink returns a sink posting to url with the given client, the
+// default client with DefaultWebhookTimeout when it is nil.
+func NewWebhookSink(url string, client *http.Client) *WebhookSink {
+	if client == nil {
+		client = &http.Client{Timeout: DefaultWebhookTimeout}
+	}
+	return &WebhookSink{url: url, client: client}
+}
+
+func (s *WebhookSink) Publish(ctx context.Context, events []domain.Event) error {
+	for i := range events {
+		if err := s.post(ctx, &events[i]); err != nil {
+			return fmt.Errorf("failed to deliver event %d: %w", events[i].Offset, err)
+		}
+	}
+	return nil
+}
+
+func (s *WebhookSink) post(ctx context.Context, e *domain.Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Event-Type", e.Type)
+	req.Header.Set("X-Event-Offset", fmt.Sprint(e.Offset))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// drain the body so the connection can be reused
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
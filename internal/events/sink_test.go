@@ -0,0 +1,65 @@
+package events_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mustafadubul/product/internal/domain"
+	"github.com/mustafadubul/product/internal/events"
+	"github.com/stretchr/testify/assert"
+)
+
+var batch = []domain.Event{
+	{Offset: 1, Type: domain.EventCreated, ProductID: 7, Revision: 1, Product: domain.Product{ID: 7, ItemName: "camera"}},
+	{Offset: 2, Type: domain.EventDeleted, ProductID: 7, Revision: 2, Product: domain.Product{ID: 7, ItemName: "camera"}},
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.ndjson")
+
+	for i := 0; i < 2; i++ {
+		sink, err := events.NewFileSink(path)
+		assert.NoError(t, err)
+		assert.NoError(t, sink.Publish(context.Background(), batch[i:i+1]))
+		assert.NoError(t, sink.Close())
+	}
+
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if assert.Len(t, lines, 2) {
+		var e domain.Event
+		assert.NoError(t, json.Unmarshal([]byte(lines[1]), &e))
+		assert.Equal(t, batch[1], e)
+	}
+}
+
+func TestWebhookSink(t *testing.T) {
+	var received []domain.Event
+	var types []string
+	status := http.StatusNoContent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e domain.Event
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&e))
+		received = append(received, e)
+		types = append(types, r.Header.Get("X-Event-Type"))
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	sink := events.NewWebhookSink(server.URL, nil)
+	assert.NoError(t, sink.Publish(context.Background(), batch))
+	assert.Equal(t, batch, received)
+	assert.Equal(t, []string{domain.EventCreated, domain.EventDeleted}, types)
+
+	status = http.StatusServiceUnavailable
+	err := sink.Publish(context.Background(), batch)
+	assert.Error(t, err)
+	assert.Len(t, received, 3, "delivery stops at the first failure")
+}
@@ -0,0 +1,81 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/mustafadubul/product/internal/audit"
+	"github.com/mustafadubul/product/internal/auth"
+	"github.com/mustafadubul/product/internal/tenant"
+)
+
+// Option configures a Handler.
+type Option func(*Handler)
+
+// WithAuthenticator requires every request to be authenticated by a and to be
+// granted the scope of its route. Without an authenticator the API is open.
+func WithAuthenticator(a auth.Authenticator) Option {
+	return func(h *Handler) {
+		h.authenticator = a
+	}
+}
+
+// authenticate puts the principal of the request into its context. The
+// principal is the actor of the writes of the request. A principal bound to a
+// tenant acts for it alone, one that is not acts for the default tenant and
+// needs products:admin to name another in TenantHeader.
+func (h *Handler) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.authenticator == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		l := h.logger.With().Str("middleware", "authenticate").Logger()
+
+		p, err := h.authenticator.Authenticate(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="product"`)
+			fail(w, r, &l, newProblem(http.StatusUnauthorized, CodeUnauthenticated, err.Error()), err, "failed to authenticate request")
+			return
+		}
+
+		ctx := r.Context()
+		id := r.Header.Get(TenantHeader)
+		switch {
+		case p.Tenant != "":
+			if id != "" && id != p.Tenant {
+				err := fmt.Errorf("%s may not act for tenant %q", p.Subject, id)
+				fail(w, r, &l, newProblem(http.StatusForbidden, CodeForbidden, err.Error()), err, "request for another tenant")
+				return
+			}
+			ctx = tenant.NewContext(ctx, p.Tenant)
+		case id != "" && id != tenant.Default && !p.Has(auth.ScopeAdmin):
+			err := fmt.Errorf("scope %s required to act for tenant %q", auth.ScopeAdmin, id)
+			fail(w, r, &l, newProblem(http.StatusForbidden, CodeForbidden, err.Error()), err, "request for another tenant")
+			return
+		}
+		info := audit.FromContext(ctx)
+		info.Actor = p.Subject
+		ctx = audit.NewContext(ctx, info)
+		next.ServeHTTP(w, r.WithContext(auth.NewContext(ctx, p)))
+	})
+}
+
+// require refuses requests whose principal is not granted scope.
+func (h *Handler) require(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if h.authenticator == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if p := auth.FromContext(r.Context()); p == nil || !p.Has(scope) {
+				l := h.logger.With().Str("middleware", "require").Logger()
+				err := fmt.Errorf("scope %s required", scope)
+				fail(w, r, &l, newProblem(http.StatusForbidden, CodeForbidden, err.Error()), err, "request lacks scope")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/mustafadubul/product/internal/domain"
+	"github.com/mustafadubul/product/internal/service"
+	"github.com/rs/zerolog"
+)
+
+// ProblemContentType is the media type of error responses.
+const ProblemContentType = "application/problem+json"
+
+// Codes identify the kind of a Problem. Unlike the detail message they are
+// stable, clients can switch on them.
+const (
+	CodeBadRequest           = "bad_request"
+	CodeUnauthenticated      = "unauthenticated"
+	CodeForbidden            = "forbidden"
+	CodeInputInvalid         = "input_invalid"
+	CodeNotFound             = "not_found"
+	CodeMethodNotAllowed     = "method_not_allowed"
+	CodeConflict             = "conflict"
+	CodePreconditionFailed   = "precondition_failed"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodeRateLimited          = "rate_limited"
+	CodeRequestFailed        = "request_failed"
+	CodeInternal             = "internal_error"
+)
+
+// Problem is the RFC 7807 problem details body of every error response.
+// Fields lists the invalid fields of an input_invalid problem and Report the
+// rows stored by an import that could not be finished.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Code     string `json:"code"`
+
+	Fields []service.FieldError `json:"fields,omitempty"`
+	Report *domain.ImportReport `json:"report,omitempty"`
+}
+
+// problems maps the service errors to their status and code, the first
+// matching error wins.
+var problems = []struct {
+	err    error
+	status int
+	code   string
+}{
+	{service.ErrInputInvalid, http.StatusUnprocessableEntity, CodeInputInvalid},
+	{service.ErrNotFound, http.StatusNotFound, CodeNotFound},
+	{service.ErrConflict, http.StatusConflict, CodeConflict},
+	{service.ErrPreconditionFailed, http.StatusPreconditionFailed, CodePreconditionFailed},
+	{service.ErrRequestFailed, http.StatusInternalServerError, CodeRequestFailed},
+}
+
+func newProblem(status int, code, detail string) *Problem {
+	return &Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// problemOf translates an error returned by the service. Errors the service
+// does not know about are reported without their detail.
+func problemOf(err error) *Problem {
+	for _, p := range problems {
+		if errors.Is(err, p.err) {
+			problem := newProblem(p.status, p.code, err.Error())
+			var verr *service.ValidationError
+			if errors.As(err, &verr) {
+				problem.Fields = verr.Fields
+			}
+			return problem
+		}
+	}
+	return newProblem(http.StatusInternalServerError, CodeInternal, "")
+}
+
+// fail logs err and answers with its problem, server errors are logged as
+// errors and client errors as info.
+func fail(w http.ResponseWriter, r *http.Request, l *zerolog.Logger, p *Problem, err error, msg string) {
+	if p.Status >= http.StatusInternalServerError {
+		l.Error().Err(err).Msg(msg)
+	} else {
+		l.Info().Err(err).Msg(msg)
+	}
+	_ = writeProblem(w, r, p)
+}
+
+// badRequest answers a request the handler could not parse.
+func badRequest(w http.ResponseWriter, r *http.Request, l *zerolog.Logger, err error, msg string) {
+	fail(w, r, l, newProblem(http.StatusBadRequest, CodeBadRequest, err.Error()), err, msg)
+}
+
+func writeProblem(w http.ResponseWriter, r *http.Request, p *Problem) error {
+	p.Instance = r.URL.Path
+
+	body, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(p.Status)
+	_, err = w.Write(body)
+	return err
+}
+
+func notFound(w http.ResponseWriter, r *http.Request) {
+	_ = writeProblem(w, r, newProblem(http.StatusNotFound, CodeNotFound, "no such endpoint"))
+}
+
+func methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	_ = writeProblem(w, r, newProblem(http.StatusMethodNotAllowed, CodeMethodNotAllowed, r.Method+" is not allowed on this endpoint"))
+}
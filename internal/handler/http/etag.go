@@ -0,0 +1,33 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mustafadubul/product/internal/service"
+)
+
+// etag returns the entity tag of a product version.
+func etag(version uint64) string {
+	return `"` + strconv.FormatUint(version, 10) + `"`
+}
+
+// ifMatch returns the product version the If-Match header asks for, zero when
+// the header is missing or "*". A header that can not match any version of a
+// product fails the precondition.
+func ifMatch(r *http.Request) (uint64, error) {
+	h := strings.TrimSpace(r.Header.Get("If-Match"))
+	if h == "" || h == "*" {
+		return 0, nil
+	}
+
+	// only strong tags match, so weak tags and lists of tags are rejected
+	if len(h) > 2 && h[0] == '"' && h[len(h)-1] == '"' {
+		if v, err := strconv.ParseUint(h[1:len(h)-1], 10, 64); err == nil && v > 0 {
+			return v, nil
+		}
+	}
+	return 0, fmt.Errorf("If-Match %s does not match any version: %w", h, service.ErrPreconditionFailed)
+}
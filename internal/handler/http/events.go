@@ -0,0 +1,108 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var (
+	// EventsPollInterval is how often the event stream looks for new events
+	// once it caught up with the outbox.
+	EventsPollInterval = time.Second
+	// EventsHeartbeat is how long the event stream may stay silent before it
+	// sends a comment, so proxies do not close an idle stream.
+	EventsHeartbeat = 15 * time.Second
+)
+
+// eventsBatch is how many events the stream reads from the outbox at once.
+const eventsBatch = 100
+
+// Events streams the events of the outbox as server-sent events, with the
+// offset of every event as its id. The stream starts after the offset in the
+// Last-Event-ID header, which browsers send when they reconnect, or the offset
+// query parameter, and from the start of the outbox without either.
+func (h *Handler) Events(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l := h.logger.With().Str("handler", "Events").Logger()
+	l.WithContext(ctx)
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		fail(w, r, &l, newProblem(http.StatusInternalServerError, CodeInternal, ""),
+			fmt.Errorf("%T can not flush", w), "streaming unsupported")
+		return
+	}
+
+	offset := r.Header.Get("Last-Event-ID")
+	if offset == "" {
+		offset = r.URL.Query().Get("offset")
+	}
+	var after uint64
+	if offset != "" {
+		var err error
+		if after, err = strconv.ParseUint(offset, 10, 64); err != nil {
+			badRequest(w, r, &l, fmt.Errorf("offset invalid value"), "invalid request query")
+			return
+		}
+	}
+
+	events, err := h.service.Events(ctx, after, eventsBatch)
+	if err != nil {
+		fail(w, r, &l, problemOf(err), err, "failed to read events")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	poll := time.NewTicker(EventsPollInterval)
+	defer poll.Stop()
+	lastWrite := time.Now()
+
+	for {
+		for _, e := range events {
+			data, err := json.Marshal(e)
+			if err != nil {
+				l.Error().Err(err).Uint64("offset", e.Offset).Msg("failed to encode event")
+				return
+			}
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.Offset, e.Type, data); err != nil {
+				return
+			}
+			after = e.Offset
+		}
+		if len(events) > 0 {
+			flusher.Flush()
+			lastWrite = time.Now()
+		}
+
+		if len(events) < eventsBatch {
+			select {
+			case <-ctx.Done():
+				return
+			case <-h.done:
+				return
+			case <-poll.C:
+			}
+		}
+
+		if time.Since(lastWrite) >= EventsHeartbeat {
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+			lastWrite = time.Now()
+		}
+
+		// the client reconnects with Last-Event-ID when the stream ends
+		if events, err = h.service.Events(ctx, after, eventsBatch); err != nil {
+			l.Error().Err(err).Msg("failed to read events")
+			return
+		}
+	}
+}
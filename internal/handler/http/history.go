@@ -0,0 +1,117 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/mustafadubul/product/internal/audit"
+	"github.com/mustafadubul/product/internal/domain"
+)
+
+// ActorHeader names the actor the revisions of a write are recorded for.
+const ActorHeader = "X-Actor"
+
+// withAudit puts the actor and the request ID into the context of the request
+// for the revisions its writes record. The request ID is set by
+// middleware.RequestID, from the X-Request-Id header when the client sends
+// one, and echoed in the response.
+func withAudit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info := audit.Info{
+			Actor:     r.Header.Get(ActorHeader),
+			RequestID: middleware.GetReqID(r.Context()),
+		}
+		w.Header().Set(middleware.RequestIDHeader, info.RequestID)
+		next.ServeHTTP(w, r.WithContext(audit.NewContext(r.Context(), info)))
+	})
+}
+
+// History lists the revisions of a product, oldest first. The next page
+// starts after the number of the last revision.
+func (h *Handler) History(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l := h.logger.With().Str("handler", "History").Logger()
+	l.WithContext(ctx)
+
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		badRequest(w, r, &l, err, "id not valid")
+		return
+	}
+	after, limit, err := pageOf(r.URL.Query())
+	if err != nil {
+		badRequest(w, r, &l, err, "invalid request query")
+		return
+	}
+
+	history, err := h.service.History(ctx, id, after, limit)
+	if err != nil {
+		fail(w, r, &l, problemOf(err), err, "failed to read history")
+		return
+	}
+	if history == nil {
+		history = []domain.Revision{}
+	}
+	_ = writeJSON(w, http.StatusOK, history)
+}
+
+// Revision returns a revision of a product.
+func (h *Handler) Revision(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l := h.logger.With().Str("handler", "Revision").Logger()
+	l.WithContext(ctx)
+
+	id, number, err := revisionOf(r)
+	if err != nil {
+		badRequest(w, r, &l, err, "revision not valid")
+		return
+	}
+
+	rev, err := h.service.Revision(ctx, id, number)
+	if err != nil {
+		fail(w, r, &l, problemOf(err), err, "failed to get revision")
+		return
+	}
+	_ = writeJSON(w, http.StatusOK, rev)
+}
+
+// Revert sets the product back to a revision. With If-Match the revert only
+// applies to that version.
+func (h *Handler) Revert(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l := h.logger.With().Str("handler", "Revert").Logger()
+	l.WithContext(ctx)
+
+	id, number, err := revisionOf(r)
+	if err != nil {
+		badRequest(w, r, &l, err, "revision not valid")
+		return
+	}
+	version, err := ifMatch(r)
+	if err != nil {
+		fail(w, r, &l, problemOf(err), err, "precondition failed")
+		return
+	}
+
+	p, err := h.service.Revert(ctx, id, number, version)
+	if err != nil {
+		fail(w, r, &l, problemOf(err), err, "failed to revert product")
+		return
+	}
+
+	w.Header().Set("ETag", etag(p.Version))
+	_ = writeJSON(w, http.StatusOK, p)
+}
+
+// revisionOf parses the product id and revision number in the path.
+func revisionOf(r *http.Request) (id uint64, number uint64, err error) {
+	if id, err = strconv.ParseUint(chi.URLParam(r, "id"), 10, 64); err != nil {
+		return 0, 0, err
+	}
+	if number, err = strconv.ParseUint(chi.URLParam(r, "revision"), 10, 64); err != nil {
+		return 0, 0, err
+	}
+	return id, number, nil
+}
@@ -4,40 +4,96 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"strconv"
+	"strings"
+	"sync"
 
-	"errors"
 	"net/url"
 
 	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/mustafadubul/product/internal/auth"
+	"github.com/mustafadubul/product/internal/bulk"
 	"github.com/mustafadubul/product/internal/domain"
-	"github.com/mustafadubul/product/internal/repository"
+	"github.com/mustafadubul/product/internal/metrics"
+	"github.com/mustafadubul/product/internal/ratelimit"
+	"github.com/mustafadubul/product/internal/trace"
 	"github.com/rs/zerolog"
 )
 
 type Handler struct {
-	logger  *zerolog.Logger
-	service Service
+	logger        *zerolog.Logger
+	service       Service
+	authenticator auth.Authenticator
+	limiter       *ratelimit.Limiter
+
+	metrics  *metrics.Registry
+	requests *metrics.Counter
+	latency  *metrics.Histogram
+	calls    *metrics.Counter
+
+	tracer *trace.Tracer
+
+	// done is closed by Close to end the event streams
+	done      chan struct{}
+	closeOnce sync.Once
 }
 
 // mockgen -source=http.go  -package=mocks -destination=../../../mocks/mocks_http_service.go -mock_names Service=MockHTTPService
 type Service interface {
 	Create(ctx context.Context, p *domain.Product) (*domain.Product, error)
 	Get(ctx context.Context, id uint64) (*domain.Product, error)
-	Search(ctx context.Context, q *domain.Query) ([]domain.Product, error)
+	Search(ctx context.Context, q *domain.Query) (*domain.Page, error)
 
 	Update(ctx context.Context, p *domain.Product) (*domain.Product, error)
-	Delete(ctx context.Context, id uint64) error
+	Patch(ctx context.Context, id uint64, version uint64, patch *domain.ProductPatch) (*domain.Product, error)
+	Delete(ctx context.Context, id uint64, version uint64) error
+	Trash(ctx context.Context, after uint64, limit int) ([]domain.Product, error)
+	Restore(ctx context.Context, id uint64) (*domain.Product, error)
+
+	History(ctx context.Context, id uint64, after uint64, limit int) ([]domain.Revision, error)
+	Revision(ctx context.Context, id uint64, number uint64) (*domain.Revision, error)
+	Revert(ctx context.Context, id uint64, number uint64, version uint64) (*domain.Product, error)
+
+	Events(ctx context.Context, after uint64, limit int) ([]domain.Event, error)
+
+	CreateWebhook(ctx context.Context, w *domain.Webhook) (*domain.Webhook, error)
+	Webhooks(ctx context.Context) ([]domain.Webhook, error)
+	DeleteWebhook(ctx context.Context, id uint64) error
+	DeadLetters(ctx context.Context, webhookID uint64, after uint64, limit int) ([]domain.DeadLetter, error)
+
+	CreateSavedSearch(ctx context.Context, s *domain.SavedSearch) (*domain.SavedSearch, error)
+	SavedSearches(ctx context.Context) ([]domain.SavedSearch, error)
+	DeleteSavedSearch(ctx context.Context, id uint64) error
+	Matches(ctx context.Context, id uint64, after uint64, limit int) ([]domain.Match, error)
+
+	Import(ctx context.Context, r io.Reader, format bulk.Format) (*domain.ImportReport, error)
+	Export(ctx context.Context, q *domain.Query, fn func(p *domain.Product) error) error
 }
 
-func NewHandler(l *zerolog.Logger, svc Service) *Handler {
+func NewHandler(l *zerolog.Logger, svc Service, opts ...Option) *Handler {
 	componentLogger := l.With().Str("component", "http-handler").Logger()
-	return &Handler{
+	h := &Handler{
 		logger:  &componentLogger,
 		service: svc,
+		done:    make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	if h.calls != nil || h.tracer != nil {
+		h.service = newInstrumentedService(h.service, h.calls)
 	}
+	return h
+}
+
+// Close ends the event streams, which would otherwise keep a graceful
+// shutdown of the server waiting.
+func (h *Handler) Close() {
+	h.closeOnce.Do(func() { close(h.done) })
 }
 
 var (
@@ -46,23 +102,111 @@ var (
 	GetEndpoint    = "/product/{id}"
 	DeleteEndpoint = "/product/{id}"
 	UpdateEndpoint = "/product/{id}"
+	PatchEndpoint  = "/product/{id}"
 	SearchEndpoint = "/q"
+
+	TrashEndpoint   = "/products/trash"
+	RestoreEndpoint = "/product/{id}:restore"
+
+	HistoryEndpoint  = "/product/{id}/history"
+	RevisionEndpoint = "/product/{id}/history/{revision}"
+	RevertEndpoint   = "/product/{id}/history/{revision}:revert"
+
+	ImportEndpoint = "/products:import"
+	ExportEndpoint = "/products:export"
+
+	EventsEndpoint = "/events"
+
+	WebhooksEndpoint    = "/webhooks"
+	WebhookEndpoint     = "/webhooks/{id}"
+	DeadLettersEndpoint = "/webhooks/{id}/dead-letters"
+
+	SavedSearchesEndpoint = "/saved-searches"
+	SavedSearchEndpoint   = "/saved-searches/{id}"
+	MatchesEndpoint       = "/saved-searches/{id}/matches"
 )
 
+// Setup routes the endpoints. Every request is traced and measured and every
+// endpoint but MetricsEndpoint sits behind the audit, authentication and
+// tenant middleware, so anonymous requests are refused before their tenant is
+// looked at.
 func (h *Handler) Setup() http.Handler {
+	if h.authenticator == nil {
+		h.logger.Warn().Msg("no authentication configured, every endpoint is open")
+	}
+
 	r := chi.NewRouter()
-	r.Get(GetEndpoint, h.Get)
+	r.Use(middleware.RequestID, h.traceRequest, h.measure)
 
-	r.Post(CreateEndpoint, h.Create)
+	if h.metrics != nil {
+		r.Get(MetricsEndpoint, h.metrics.ServeHTTP)
+	}
 
-	r.Get(SearchEndpoint, h.Search)
+	r.Group(func(r chi.Router) {
+		r.Use(withAudit, h.authenticate, withTenant)
+		h.routes(r)
+	})
 
-	r.Delete(DeleteEndpoint, h.Delete)
-	r.Put(UpdateEndpoint, h.Update)
+	r.NotFound(notFound)
+	r.MethodNotAllowed(methodNotAllowed)
 
 	return r
 }
 
+// routes routes the endpoints of the API. With an authenticator every route
+// requires a scope: reading products, their history and events and keeping
+// saved searches require products:read, writing products products:write, and
+// imports and webhooks products:admin. Searches and exports are counted
+// against the search budget of the client and writes against its write budget.
+func (h *Handler) routes(r chi.Router) {
+	r.Group(func(r chi.Router) {
+		r.Use(h.require(auth.ScopeRead))
+
+		r.Get(GetEndpoint, h.Get)
+		r.With(h.limit(ratelimit.Search)).Get(SearchEndpoint, h.Search)
+
+		r.Get(HistoryEndpoint, h.History)
+		r.Get(RevisionEndpoint, h.Revision)
+
+		r.With(h.limit(ratelimit.Search)).Get(ExportEndpoint, h.Export)
+		r.Get(EventsEndpoint, h.Events)
+
+		r.Post(SavedSearchesEndpoint, h.CreateSavedSearch)
+		r.Get(SavedSearchesEndpoint, h.SavedSearches)
+		r.Delete(SavedSearchEndpoint, h.DeleteSavedSearch)
+		r.Get(MatchesEndpoint, h.Matches)
+	})
+
+	r.Group(func(r chi.Router) {
+		r.Use(h.require(auth.ScopeWrite))
+
+		r.Get(TrashEndpoint, h.Trash)
+
+		r.Group(func(r chi.Router) {
+			r.Use(h.limit(ratelimit.Write))
+
+			r.Post(CreateEndpoint, h.Create)
+			r.Delete(DeleteEndpoint, h.Delete)
+			r.Put(UpdateEndpoint, h.Update)
+			r.Patch(PatchEndpoint, h.Patch)
+
+			r.Post(RestoreEndpoint, h.Restore)
+			r.Post(RevertEndpoint, h.Revert)
+		})
+	})
+
+	r.Group(func(r chi.Router) {
+		r.Use(h.require(auth.ScopeAdmin))
+
+		r.With(h.limit(ratelimit.Write)).Post(ImportEndpoint, h.Import)
+
+		r.Post(WebhooksEndpoint, h.CreateWebhook)
+		r.Get(WebhooksEndpoint, h.Webhooks)
+		r.Delete(WebhookEndpoint, h.DeleteWebhook)
+		r.Get(DeadLettersEndpoint, h.DeadLetters)
+	})
+}
+
 func (h *Handler) Search(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	l := h.logger.With().Str("handler", "Search").Logger()
@@ -70,25 +214,20 @@ func (h *Handler) Search(w http.ResponseWriter, r *http.Request) {
 
 	q, err := url.ParseQuery(r.URL.RawQuery)
 	if err != nil {
-		l.Info().Interface("payload", q).Msg("invalid url parameters")
-		_ = writeError(w, http.StatusBadRequest, err)
+		badRequest(w, r, &l, err, "invalid url parameters")
 		return
 	}
 
 	query, err := validateSearchInput(q)
 	if err != nil {
-		l.Info().Interface("query", query).Msg("invalid request query")
-		_ = writeError(w, http.StatusBadRequest, err)
+		badRequest(w, r, &l, err, "invalid request query")
 		return
 	}
 
 	results, err := h.service.Search(ctx, query)
 	if err != nil {
-		if !errors.Is(err, repository.ErrNotFound) {
-			l.Error().Err(err).Interface("payload", q).Msg("failed to making db request")
-			_ = writeError(w, http.StatusInternalServerError, err)
-			return
-		}
+		fail(w, r, &l, problemOf(err), err, "failed to search products")
+		return
 	}
 	_ = writeJSON(w, http.StatusOK, results)
 }
@@ -100,28 +239,28 @@ func (h *Handler) Create(w http.ResponseWriter, r *http.Request) {
 
 	data, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		l.Info().Err(err).Msg("failed to read body")
-		writeError(w, http.StatusBadRequest, err)
+		badRequest(w, r, &l, err, "failed to read body")
 		return
 	}
 
 	var product domain.Product
 	if err = json.Unmarshal(data, &product); err != nil {
-		l.Info().Err(err).Msg("failed to unmarshal body")
-		writeError(w, http.StatusBadRequest, err)
+		badRequest(w, r, &l, err, "failed to unmarshal body")
 		return
 	}
 
 	p, err := h.service.Create(ctx, &product)
 	if err != nil {
-		l.Info().Err(err).Msg("failed to create product")
-		writeError(w, http.StatusInternalServerError, err)
+		fail(w, r, &l, problemOf(err), err, "failed to create product")
 		return
 	}
 
+	w.Header().Set("ETag", etag(p.Version))
 	_ = writeJSON(w, http.StatusCreated, p)
 }
 
+// Delete moves the product to the trash, from where it can be restored until
+// it is purged.
 func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	l := h.logger.With().Str("handler", "Delete").Logger()
@@ -129,68 +268,276 @@ func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
 
 	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
 	if err != nil {
-		l.Info().Interface("id", chi.URLParam(r, "id")).Msg("id not valid")
-		_ = writeError(w, http.StatusBadRequest, err)
+		badRequest(w, r, &l, err, "id not valid")
 		return
 	}
-	err = h.service.Delete(ctx, id)
+	version, err := ifMatch(r)
 	if err != nil {
-		l.Error().Err(err).Interface("id", chi.URLParam(r, "id")).Msg("failed to delete product")
-		_ = writeError(w, http.StatusInternalServerError, err)
+		fail(w, r, &l, problemOf(err), err, "precondition failed")
+		return
+	}
+
+	err = h.service.Delete(ctx, id, version)
+	if err != nil {
+		fail(w, r, &l, problemOf(err), err, "failed to delete product")
 		return
 	}
 }
 
+// Update replaces the product with the id in the path, fields left out of the
+// body are cleared. An id in the body has to match the path. With If-Match
+// the update only applies to that version.
 func (h *Handler) Update(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	l := h.logger.With().Str("handler", "Update").Logger()
 	l.WithContext(ctx)
 
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		badRequest(w, r, &l, err, "id not valid")
+		return
+	}
+
 	data, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		l.Info().Err(err).Msg("failed to read body")
-		writeError(w, http.StatusBadRequest, err)
+		badRequest(w, r, &l, err, "failed to read body")
 		return
 	}
 
 	var product domain.Product
 	if err = json.Unmarshal(data, &product); err != nil {
-		l.Info().Err(err).Msg("failed to unmarshal body")
-		writeError(w, http.StatusBadRequest, err)
+		badRequest(w, r, &l, err, "failed to unmarshal body")
+		return
+	}
+	if product.ID != 0 && product.ID != id {
+		badRequest(w, r, &l, fmt.Errorf("id %d in body does not match id %d in path", product.ID, id), "id mismatch")
+		return
+	}
+	product.ID = id
+
+	// the version a client holds is sent as If-Match, not in the body
+	product.Version, err = ifMatch(r)
+	if err != nil {
+		fail(w, r, &l, problemOf(err), err, "precondition failed")
 		return
 	}
 
 	p, err := h.service.Update(ctx, &product)
 	if err != nil {
-		l.Info().Err(err).Msg("failed to update product")
-		writeError(w, http.StatusInternalServerError, err)
+		fail(w, r, &l, problemOf(err), err, "failed to update product")
 		return
 	}
 
+	w.Header().Set("ETag", etag(p.Version))
 	_ = writeJSON(w, http.StatusAccepted, p)
 }
 
 func (h *Handler) Get(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	l := h.logger.With().Str("handler", "Search").Logger()
+	l := h.logger.With().Str("handler", "Get").Logger()
 	l.WithContext(ctx)
 
 	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
 	if err != nil {
-		l.Info().Interface("id", chi.URLParam(r, "id")).Msg("id not valid")
-		_ = writeError(w, http.StatusBadRequest, err)
+		badRequest(w, r, &l, err, "id not valid")
 		return
 	}
 
 	p, err := h.service.Get(ctx, id)
 	if err != nil {
-		l.Error().Err(err).Interface("id", chi.URLParam(r, "id")).Msg("failed to delete product")
-		_ = writeError(w, http.StatusInternalServerError, err)
+		fail(w, r, &l, problemOf(err), err, "failed to get product")
 		return
 	}
+	w.Header().Set("ETag", etag(p.Version))
 	_ = writeJSON(w, http.StatusOK, p)
 }
 
+// Trash lists the deleted products in ID order. The next page starts after
+// the ID of the last product.
+func (h *Handler) Trash(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l := h.logger.With().Str("handler", "Trash").Logger()
+	l.WithContext(ctx)
+
+	after, limit, err := pageOf(r.URL.Query())
+	if err != nil {
+		badRequest(w, r, &l, err, "invalid request query")
+		return
+	}
+
+	products, err := h.service.Trash(ctx, after, limit)
+	if err != nil {
+		fail(w, r, &l, problemOf(err), err, "failed to list trash")
+		return
+	}
+	if products == nil {
+		products = []domain.Product{}
+	}
+	_ = writeJSON(w, http.StatusOK, products)
+}
+
+// pageOf parses the after and limit query parameters of a listing, both are
+// zero when they are left out.
+func pageOf(q url.Values) (after uint64, limit int, err error) {
+	if v := q.Get("after"); v != "" {
+		if after, err = strconv.ParseUint(v, 10, 64); err != nil {
+			return 0, 0, fmt.Errorf("after invalid value")
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil {
+			return 0, 0, fmt.Errorf("limit invalid value")
+		}
+	}
+	return after, limit, nil
+}
+
+// Restore takes a product out of the trash.
+func (h *Handler) Restore(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l := h.logger.With().Str("handler", "Restore").Logger()
+	l.WithContext(ctx)
+
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		badRequest(w, r, &l, err, "id not valid")
+		return
+	}
+
+	p, err := h.service.Restore(ctx, id)
+	if err != nil {
+		fail(w, r, &l, problemOf(err), err, "failed to restore product")
+		return
+	}
+
+	w.Header().Set("ETag", etag(p.Version))
+	_ = writeJSON(w, http.StatusOK, p)
+}
+
+// Import stores the products of a catalogue sent as the request body. The
+// format is taken from the format query parameter or the Content-Type header.
+// When the catalogue can not be read to the end the problem carries the
+// report of the rows stored before that.
+func (h *Handler) Import(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l := h.logger.With().Str("handler", "Import").Logger()
+	l.WithContext(ctx)
+
+	format, err := bulkFormat(r)
+	if err != nil {
+		badRequest(w, r, &l, err, "invalid catalogue format")
+		return
+	}
+
+	report, err := h.service.Import(ctx, r.Body, format)
+	if err != nil {
+		problem := problemOf(err)
+		problem.Report = report
+		fail(w, r, &l, problem, err, "failed to import catalogue")
+		return
+	}
+
+	_ = writeJSON(w, http.StatusOK, report)
+}
+
+// Export streams the catalogue, optionally filtered by term and by radius
+// around lat and lng. The format is taken from the format parameter or the
+// Accept header and defaults to NDJSON. Once the first product is written
+// errors can no longer be reported, the response is then cut short.
+func (h *Handler) Export(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l := h.logger.With().Str("handler", "Export").Logger()
+	l.WithContext(ctx)
+
+	format, err := exportFormat(r)
+	if err != nil {
+		badRequest(w, r, &l, err, "invalid catalogue format")
+		return
+	}
+
+	q, err := validateExportInput(r.URL.Query())
+	if err != nil {
+		badRequest(w, r, &l, err, "invalid export input")
+		return
+	}
+
+	out := &exportWriter{ResponseWriter: w, contentType: format.ContentType()}
+	enc, err := bulk.NewEncoder(format, out)
+	if err != nil {
+		badRequest(w, r, &l, err, "invalid catalogue format")
+		return
+	}
+
+	err = h.service.Export(ctx, q, enc.Encode)
+	if err == nil {
+		err = enc.Close()
+	}
+	if err == nil {
+		return
+	}
+
+	if out.wrote {
+		l.Error().Err(err).Msg("export cut short")
+		return
+	}
+	fail(w, r, &l, problemOf(err), err, "failed to export catalogue")
+}
+
+// exportWriter sets the Content-Type when the first byte is written, so an
+// export that fails before that can still answer with an error.
+type exportWriter struct {
+	http.ResponseWriter
+	contentType string
+	wrote       bool
+}
+
+func (w *exportWriter) Write(p []byte) (int, error) {
+	if !w.wrote {
+		w.Header().Set("Content-Type", w.contentType)
+		w.wrote = true
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func exportFormat(r *http.Request) (bulk.Format, error) {
+	if f := r.URL.Query().Get("format"); f != "" {
+		return bulk.ParseFormat(f)
+	}
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		if f, err := bulk.FormatOf(strings.TrimSpace(accept)); err == nil {
+			return f, nil
+		}
+	}
+	return bulk.NDJSON, nil
+}
+
+// validateExportInput returns nil when the export is not filtered. A radius
+// needs lat and lng.
+func validateExportInput(v url.Values) (*domain.Query, error) {
+	if v.Get("term") == "" && v.Get("radius") == "" {
+		return nil, nil
+	}
+	if v.Get("radius") == "" {
+		return &domain.Query{Term: v.Get("term")}, nil
+	}
+
+	q, err := validateSearchInput(v)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.Query{Term: q.Term, Lat: q.Lat, Lng: q.Lng, Radius: q.Radius}, nil
+}
+
+func bulkFormat(r *http.Request) (bulk.Format, error) {
+	if f := r.URL.Query().Get("format"); f != "" {
+		return bulk.ParseFormat(f)
+	}
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		return bulk.FormatOf(ct)
+	}
+	return "", fmt.Errorf("missing format")
+}
+
 func validateSearchInput(v url.Values) (*domain.Query, error) {
 	if v.Get("lat") == "" {
 		return nil, fmt.Errorf("missing lat")
@@ -212,14 +559,24 @@ func validateSearchInput(v url.Values) (*domain.Query, error) {
 	}
 	radius, err := strconv.ParseFloat(v.Get("radius"), 64)
 	if err != nil {
-		return nil, fmt.Errorf("lng invalid value")
+		return nil, fmt.Errorf("radius invalid value")
+	}
+
+	var limit int
+	if v.Get("limit") != "" {
+		limit, err = strconv.Atoi(v.Get("limit"))
+		if err != nil {
+			return nil, fmt.Errorf("limit invalid value")
+		}
 	}
 
 	return &domain.Query{
 		Lat:    lat,
 		Lng:    lng,
 		Radius: radius,
-		Term:   v.Get("term")}, nil
+		Term:   v.Get("term"),
+		Limit:  limit,
+		Cursor: v.Get("cursor")}, nil
 }
 
 func writeJSON(w http.ResponseWriter, status int, data interface{}) error {
@@ -231,11 +588,3 @@ func writeJSON(w http.ResponseWriter, status int, data interface{}) error {
 	_, err = w.Write(body)
 	return err
 }
-
-func writeError(w http.ResponseWriter, status int, err error) error {
-	return writeJSON(w, status, ErrorStatus{Error: err.Error()})
-}
-
-type ErrorStatus struct {
-	Error string `json:"error"`
-}
@@ -1,20 +1,32 @@
 package http_test
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/mustafadubul/product/internal/audit"
+	"github.com/mustafadubul/product/internal/auth"
+	"github.com/mustafadubul/product/internal/bulk"
 	"github.com/mustafadubul/product/internal/domain"
 
 	"github.com/go-chi/chi"
 	"github.com/golang/mock/gomock"
 	httpHandler "github.com/mustafadubul/product/internal/handler/http"
+	"github.com/mustafadubul/product/internal/metrics"
+	"github.com/mustafadubul/product/internal/ratelimit"
+	"github.com/mustafadubul/product/internal/service"
+	"github.com/mustafadubul/product/internal/tenant"
+	"github.com/mustafadubul/product/internal/trace"
 	"github.com/mustafadubul/product/mocks"
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
@@ -29,14 +41,14 @@ type Handler struct {
 	service *mocks.MockHTTPService
 }
 
-func NewTestHandler(t *testing.T) *Handler {
+func NewTestHandler(t *testing.T, opts ...httpHandler.Option) *Handler {
 	mockCtrl := gomock.NewController(t)
 	mockService := mocks.NewMockHTTPService(mockCtrl)
 
 	_, cancel := context.WithCancel(context.Background())
 	l := zerolog.Nop()
 	h := &Handler{
-		Handler:  httpHandler.NewHandler(&l, mockService),
+		Handler:  httpHandler.NewHandler(&l, mockService, opts...),
 		service:  mockService,
 		mockCtrl: mockCtrl,
 	}
@@ -61,8 +73,12 @@ type testRequest struct {
 func TestHandler_Search(t *testing.T) {
 	h := NewTestHandler(t)
 
-	products := []domain.Product{
-		{ItemName: "camera"},
+	products := &domain.Page{
+		Items: []domain.SearchResult{
+			{Product: domain.Product{ItemName: "camera"}, Distance: 2.5},
+		},
+		NextCursor:    "next",
+		TotalEstimate: 2,
 	}
 
 	query := &domain.Query{
@@ -70,13 +86,15 @@ func TestHandler_Search(t *testing.T) {
 		Lng:    10,
 		Radius: 5,
 		Term:   "camera",
+		Limit:  1,
+		Cursor: "abc",
 	}
 
 	h.service.EXPECT().Search(gomock.Any(), query).Return(products, nil)
 
 	request := testRequest{
 		method:    http.MethodGet,
-		endpoint:  "/q?radius=5&lng=10&lat=15&term=camera",
+		endpoint:  "/q?radius=5&lng=10&lat=15&term=camera&limit=1&cursor=abc",
 		handler:   h.Search,
 		payload:   query,
 		urlParams: nil,
@@ -91,6 +109,45 @@ func TestHandler_Search(t *testing.T) {
 	assert.Equal(t, expectBody, data)
 }
 
+func TestHandler_SearchInvalidInput(t *testing.T) {
+	h := NewTestHandler(t)
+	defer h.Finish()
+
+	invalid := &service.ValidationError{Fields: []service.FieldError{
+		{Field: "radius", Message: "must be greater than 0 and at most 100000"},
+		{Field: "limit", Message: "must be between 1 and 100"},
+	}}
+	h.service.EXPECT().Search(gomock.Any(), gomock.Any()).Return(nil, invalid)
+
+	request := testRequest{
+		method:   http.MethodGet,
+		endpoint: "/q?radius=-5&lng=10&lat=15&limit=-1",
+		handler:  h.Search,
+	}
+
+	res := httpTestRequestRecord(request)
+	assert.Equal(t, http.StatusUnprocessableEntity, res.StatusCode)
+
+	var body httpHandler.Problem
+	assert.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+	assert.Equal(t, httpHandler.CodeInputInvalid, body.Code)
+	assert.Equal(t, invalid.Fields, body.Fields)
+}
+
+func TestHandler_SearchUnparsableLimit(t *testing.T) {
+	h := NewTestHandler(t)
+	defer h.Finish()
+
+	request := testRequest{
+		method:   http.MethodGet,
+		endpoint: "/q?radius=5&lng=10&lat=15&limit=ten",
+		handler:  h.Search,
+	}
+
+	res := httpTestRequestRecord(request)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+}
+
 func TestHandler_Create(t *testing.T) {
 	h := NewTestHandler(t)
 	defer h.Finish()
@@ -132,6 +189,42 @@ func TestHandler_Create(t *testing.T) {
 	assert.Equal(t, expectBody, data)
 }
 
+func TestHandler_CreateInvalid(t *testing.T) {
+	h := NewTestHandler(t)
+	defer h.Finish()
+
+	product := &domain.Product{Lat: 500, Lng: 10}
+	h.service.EXPECT().Create(gomock.Any(), product).Return(nil, &service.ValidationError{Fields: []service.FieldError{
+		{Field: "description", Message: "must not be empty"},
+		{Field: "lat", Message: "must be between -90 and 90"},
+	}})
+
+	request := testRequest{
+		method:   http.MethodPost,
+		endpoint: httpHandler.CreateEndpoint,
+		handler:  h.Create,
+		payload:  product,
+	}
+
+	res := httpTestRequestRecord(request)
+	assert.Equal(t, http.StatusUnprocessableEntity, res.StatusCode)
+
+	data, _ := ioutil.ReadAll(res.Body)
+	assert.Equal(t, httpHandler.ProblemContentType, res.Header.Get("Content-Type"))
+	assert.JSONEq(t, `{
+		"type": "about:blank",
+		"title": "Unprocessable Entity",
+		"status": 422,
+		"detail": "input invalid: description: must not be empty; lat: must be between -90 and 90",
+		"instance": "/product",
+		"code": "input_invalid",
+		"fields": [
+			{"field": "description", "message": "must not be empty"},
+			{"field": "lat", "message": "must be between -90 and 90"}
+		]
+	}`, string(data))
+}
+
 func TestHandler_Get(t *testing.T) {
 	h := NewTestHandler(t)
 	defer h.Finish()
@@ -141,6 +234,7 @@ func TestHandler_Get(t *testing.T) {
 		Lat:      15,
 		Lng:      10,
 		ItemName: "camera",
+		Version:  3,
 	}
 	h.service.EXPECT().Get(gomock.Any(), uint64(99)).Return(product, nil)
 
@@ -154,6 +248,7 @@ func TestHandler_Get(t *testing.T) {
 
 	res := httpTestRequestRecord(request)
 	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, `"3"`, res.Header.Get("ETag"))
 }
 
 func TestHandler_Delete(t *testing.T) {
@@ -168,7 +263,7 @@ func TestHandler_Delete(t *testing.T) {
 		urlParams: map[string]string{"id": "99"},
 	}
 
-	h.service.EXPECT().Delete(gomock.Any(), uint64(99)).Return(nil)
+	h.service.EXPECT().Delete(gomock.Any(), uint64(99), uint64(0)).Return(nil)
 	res := httpTestRequestRecord(request)
 
 	assert.Equal(t, http.StatusOK, res.StatusCode)
@@ -199,6 +294,114 @@ func TestHandler_Update(t *testing.T) {
 	assert.Equal(t, http.StatusAccepted, res.StatusCode)
 }
 
+func TestHandler_UpdateIfMatch(t *testing.T) {
+	h := NewTestHandler(t)
+	defer h.Finish()
+
+	product := &domain.Product{ID: 99, Lat: 15, Lng: 10, ItemName: "camera", Version: 3}
+	h.service.EXPECT().Update(gomock.Any(), product).Return(&domain.Product{ID: 99, Lat: 15, Lng: 10, ItemName: "camera", Version: 4}, nil)
+
+	data, _ := json.Marshal(product)
+	req := httptest.NewRequest(http.MethodPut, "/product/99", bytes.NewReader(data))
+	req.Header.Set("If-Match", `"3"`)
+	rec := httptest.NewRecorder()
+	h.Setup().ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	assert.Equal(t, `"4"`, rec.Header().Get("ETag"))
+}
+
+func TestHandler_IfMatchFails(t *testing.T) {
+	h := NewTestHandler(t)
+	defer h.Finish()
+
+	stale := fmt.Errorf("product was changed since version 2: %w", service.ErrPreconditionFailed)
+	h.service.EXPECT().Delete(gomock.Any(), uint64(99), uint64(2)).Return(stale)
+
+	for _, tag := range []string{`"2"`, `W/"3"`, `"3", "4"`, `"abc"`} {
+		req := httptest.NewRequest(http.MethodDelete, "/product/99", nil)
+		req.Header.Set("If-Match", tag)
+		rec := httptest.NewRecorder()
+		h.Setup().ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusPreconditionFailed, rec.Code, tag)
+	}
+}
+
+func TestHandler_UpdateIDMismatch(t *testing.T) {
+	h := NewTestHandler(t)
+	defer h.Finish()
+
+	request := testRequest{
+		method:    http.MethodPut,
+		endpoint:  httpHandler.UpdateEndpoint,
+		handler:   h.Update,
+		payload:   &domain.Product{ID: 98, ItemName: "camera"},
+		urlParams: map[string]string{"id": "99"},
+	}
+
+	res := httpTestRequestRecord(request)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+}
+
+func TestHandler_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{"not found", fmt.Errorf("product not found: %w", service.ErrNotFound), http.StatusNotFound, httpHandler.CodeNotFound},
+		{"conflict", fmt.Errorf("product already exists: %w", service.ErrConflict), http.StatusConflict, httpHandler.CodeConflict},
+		{"precondition failed", fmt.Errorf("stale version: %w", service.ErrPreconditionFailed), http.StatusPreconditionFailed, httpHandler.CodePreconditionFailed},
+		{"input invalid", fmt.Errorf("bad cursor: %w", service.ErrInputInvalid), http.StatusUnprocessableEntity, httpHandler.CodeInputInvalid},
+		{"request failed", fmt.Errorf("failed to get products: %w", service.ErrRequestFailed), http.StatusInternalServerError, httpHandler.CodeRequestFailed},
+		{"unknown", errors.New("connection refused"), http.StatusInternalServerError, httpHandler.CodeInternal},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewTestHandler(t)
+			defer h.Finish()
+
+			h.service.EXPECT().Get(gomock.Any(), uint64(99)).Return(nil, tt.err)
+			h.service.EXPECT().Delete(gomock.Any(), uint64(99), uint64(0)).Return(tt.err)
+
+			for _, handler := range []http.HandlerFunc{h.Get, h.Delete} {
+				res := httpTestRequestRecord(testRequest{
+					method:    http.MethodGet,
+					endpoint:  httpHandler.GetEndpoint,
+					handler:   handler,
+					urlParams: map[string]string{"id": "99"},
+				})
+				assert.Equal(t, tt.status, res.StatusCode)
+				assert.Equal(t, httpHandler.ProblemContentType, res.Header.Get("Content-Type"))
+
+				var problem httpHandler.Problem
+				assert.NoError(t, json.NewDecoder(res.Body).Decode(&problem))
+				assert.Equal(t, tt.status, problem.Status)
+				assert.Equal(t, tt.code, problem.Code)
+				assert.Equal(t, "/product/99", problem.Instance)
+			}
+		})
+	}
+}
+
+func TestHandler_UnknownRoute(t *testing.T) {
+	h := NewTestHandler(t)
+	defer h.Finish()
+
+	rec := httptest.NewRecorder()
+	h.Setup().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/nope", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, httpHandler.ProblemContentType, rec.Header().Get("Content-Type"))
+
+	rec = httptest.NewRecorder()
+	h.Setup().ServeHTTP(rec, httptest.NewRequest(http.MethodPatch, "/q", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
 func httpTestRequestRecord(t testRequest) *http.Response {
 	var buf *bytes.Buffer
 	data, _ := json.Marshal(&t.payload)
@@ -224,3 +427,699 @@ func httpTestRequestRecord(t testRequest) *http.Response {
 
 	return rec.Result()
 }
+
+func TestHandler_Import(t *testing.T) {
+	h := NewTestHandler(t)
+	defer h.Finish()
+
+	report := &domain.ImportReport{
+		Accepted: 1,
+		Rejected: 1,
+		Rows: []domain.ImportRow{
+			{Line: 2, ID: 1, Accepted: true},
+			{Line: 3, Reason: `invalid lat "north"`},
+		},
+	}
+
+	h.service.EXPECT().Import(gomock.Any(), gomock.Any(), bulk.CSV).Return(report, nil)
+
+	body := "description,lat,lng\ncamera,51.5,-0.1\nlens,north,-0.1\n"
+	req := httptest.NewRequest(http.MethodPost, httpHandler.ImportEndpoint, strings.NewReader(body))
+	req.Header.Set("Content-Type", "text/csv")
+	rec := httptest.NewRecorder()
+
+	h.Import(rec, req)
+
+	res := rec.Result()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	expectBody, _ := json.Marshal(report)
+	data, _ := ioutil.ReadAll(res.Body)
+	assert.JSONEq(t, string(expectBody), string(data))
+}
+
+func TestHandler_ImportUnknownFormat(t *testing.T) {
+	h := NewTestHandler(t)
+	defer h.Finish()
+
+	req := httptest.NewRequest(http.MethodPost, httpHandler.ImportEndpoint+"?format=xml", strings.NewReader("<products/>"))
+	rec := httptest.NewRecorder()
+
+	h.Import(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Result().StatusCode)
+}
+
+func TestHandler_Export(t *testing.T) {
+	h := NewTestHandler(t)
+	defer h.Finish()
+
+	query := &domain.Query{Term: "camera", Lat: 15, Lng: 10, Radius: 5}
+	h.service.EXPECT().Export(gomock.Any(), query, gomock.Any()).DoAndReturn(
+		func(_ context.Context, _ *domain.Query, fn func(*domain.Product) error) error {
+			return fn(&domain.Product{ID: 1, ItemName: "camera", Lat: 15, Lng: 10})
+		})
+
+	req := httptest.NewRequest(http.MethodGet, httpHandler.ExportEndpoint+"?term=camera&lat=15&lng=10&radius=5", nil)
+	req.Header.Set("Accept", "text/csv")
+	rec := httptest.NewRecorder()
+
+	h.Export(rec, req)
+
+	res := rec.Result()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "text/csv", res.Header.Get("Content-Type"))
+
+	data, _ := ioutil.ReadAll(res.Body)
+	assert.Equal(t, "id,description,lat,lng,img_URL,product_URL\n1,camera,15,10,,\n", string(data))
+}
+
+func TestHandler_ExportFailed(t *testing.T) {
+	h := NewTestHandler(t)
+	defer h.Finish()
+
+	h.service.EXPECT().Export(gomock.Any(), nil, gomock.Any()).Return(errors.New("failed"))
+
+	req := httptest.NewRequest(http.MethodGet, httpHandler.ExportEndpoint, nil)
+	rec := httptest.NewRecorder()
+
+	h.Export(rec, req)
+	assert.Equal(t, http.StatusInternalServerError, rec.Result().StatusCode)
+}
+
+func patchRequest(h *Handler, contentType, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPatch, "/product/99", strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	rec := httptest.NewRecorder()
+	h.Setup().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandler_Patch(t *testing.T) {
+	h := NewTestHandler(t)
+	defer h.Finish()
+
+	name := "Canon"
+	empty := ""
+	zero := 0.0
+	patch := &domain.ProductPatch{ItemName: &name, ImageURL: &empty, Lat: &zero}
+	patched := &domain.Product{ID: 99, ItemName: "Canon", Lng: 10, Version: 4}
+
+	h.service.EXPECT().Patch(gomock.Any(), uint64(99), uint64(0), patch).Return(patched, nil)
+
+	rec := patchRequest(h, httpHandler.MergePatchContentType, `{"description": "Canon", "img_URL": null, "lat": 0}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `"4"`, rec.Header().Get("ETag"))
+
+	expectBody, _ := json.Marshal(patched)
+	assert.JSONEq(t, string(expectBody), rec.Body.String())
+}
+
+func TestHandler_PatchInvalid(t *testing.T) {
+	h := NewTestHandler(t)
+	defer h.Finish()
+
+	rec := patchRequest(h, httpHandler.MergePatchContentType, `{"lat": "north", "id": 3, "colour": "red"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+
+	var problem httpHandler.Problem
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&problem))
+	assert.Equal(t, []service.FieldError{
+		{Field: "colour", Message: "unknown field"},
+		{Field: "id", Message: "can not be patched"},
+		{Field: "lat", Message: "must be a number"},
+	}, problem.Fields)
+
+	rec = patchRequest(h, httpHandler.MergePatchContentType, `["description"]`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = patchRequest(h, "text/plain", `{"description": "Canon"}`)
+	assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+}
+
+func TestHandler_Trash(t *testing.T) {
+	h := NewTestHandler(t)
+	defer h.Finish()
+
+	deletedAt := time.Date(2020, 7, 1, 12, 0, 0, 0, time.UTC)
+	trash := []domain.Product{{ID: 12, ItemName: "camera", Version: 1, DeletedAt: &deletedAt}}
+	h.service.EXPECT().Trash(gomock.Any(), uint64(10), 5).Return(trash, nil)
+	h.service.EXPECT().Trash(gomock.Any(), uint64(12), 0).Return(nil, nil)
+
+	rec := httptest.NewRecorder()
+	h.Setup().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/products/trash?after=10&limit=5", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `[{"id": 12, "description": "camera", "lat": 0, "lng": 0, "img_URL": "", "product_URL": "",
+		"version": 1, "deleted_at": "2020-07-01T12:00:00Z"}]`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	h.Setup().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/products/trash?after=12", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "[]", rec.Body.String())
+}
+
+func TestHandler_Restore(t *testing.T) {
+	h := NewTestHandler(t)
+	defer h.Finish()
+
+	h.service.EXPECT().Restore(gomock.Any(), uint64(12)).Return(&domain.Product{ID: 12, ItemName: "camera", Version: 2}, nil)
+	h.service.EXPECT().Restore(gomock.Any(), uint64(13)).Return(nil, fmt.Errorf("product not in trash: %w", service.ErrNotFound))
+
+	rec := httptest.NewRecorder()
+	h.Setup().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/product/12:restore", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `"2"`, rec.Header().Get("ETag"))
+
+	rec = httptest.NewRecorder()
+	h.Setup().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/product/13:restore", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestHandler_History(t *testing.T) {
+	h := NewTestHandler(t)
+	defer h.Finish()
+
+	at := time.Date(2020, 7, 1, 12, 0, 0, 0, time.UTC)
+	history := []domain.Revision{{
+		ProductID: 12, Number: 3, Action: domain.ActionUpdate, Actor: "alice", RequestID: "req-1", At: at,
+		Snapshot: domain.Product{ID: 12, ItemName: "lens", Version: 3},
+		Changes:  []domain.Change{{Field: "description", From: "camera", To: "lens"}},
+	}}
+	h.service.EXPECT().History(gomock.Any(), uint64(12), uint64(2), 1).Return(history, nil)
+	h.service.EXPECT().History(gomock.Any(), uint64(13), uint64(0), 0).Return(nil, nil)
+
+	rec := httptest.NewRecorder()
+	h.Setup().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/product/12/history?after=2&limit=1", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `[{"product_id": 12, "revision": 3, "action": "update", "actor": "alice", "request_id": "req-1",
+		"at": "2020-07-01T12:00:00Z",
+		"snapshot": {"id": 12, "description": "lens", "lat": 0, "lng": 0, "img_URL": "", "product_URL": "", "version": 3},
+		"changes": [{"field": "description", "from": "camera", "to": "lens"}]}]`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	h.Setup().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/product/13/history", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "[]", rec.Body.String())
+}
+
+func TestHandler_Revision(t *testing.T) {
+	h := NewTestHandler(t)
+	defer h.Finish()
+
+	h.service.EXPECT().Revision(gomock.Any(), uint64(12), uint64(2)).Return(&domain.Revision{ProductID: 12, Number: 2}, nil)
+	h.service.EXPECT().Revision(gomock.Any(), uint64(12), uint64(9)).Return(nil, fmt.Errorf("revision not found: %w", service.ErrNotFound))
+
+	rec := httptest.NewRecorder()
+	h.Setup().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/product/12/history/2", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	h.Setup().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/product/12/history/9", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = httptest.NewRecorder()
+	h.Setup().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/product/12/history/latest", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestHandler_Revert(t *testing.T) {
+	h := NewTestHandler(t)
+	defer h.Finish()
+
+	h.service.EXPECT().Revert(gomock.Any(), uint64(12), uint64(2), uint64(5)).
+		DoAndReturn(func(ctx context.Context, id, number, version uint64) (*domain.Product, error) {
+			info := audit.FromContext(ctx)
+			assert.Equal(t, "alice", info.Actor)
+			assert.Equal(t, "req-1", info.RequestID)
+			return &domain.Product{ID: 12, Version: 6}, nil
+		})
+
+	req := httptest.NewRequest(http.MethodPost, "/product/12/history/2:revert", nil)
+	req.Header.Set("If-Match", `"5"`)
+	req.Header.Set("X-Actor", "alice")
+	req.Header.Set("X-Request-Id", "req-1")
+
+	rec := httptest.NewRecorder()
+	h.Setup().ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `"6"`, rec.Header().Get("ETag"))
+	assert.Equal(t, "req-1", rec.Header().Get("X-Request-Id"))
+}
+
+func TestHandler_Events(t *testing.T) {
+	h := NewTestHandler(t)
+	defer h.Finish()
+	httpHandler.EventsPollInterval = time.Millisecond
+
+	events := []domain.Event{
+		{Offset: 4, Type: domain.EventCreated, ProductID: 12, Revision: 1},
+		{Offset: 5, Type: domain.EventDeleted, ProductID: 12, Revision: 2},
+	}
+	h.service.EXPECT().Events(gomock.Any(), uint64(3), 100).Return(events, nil)
+	h.service.EXPECT().Events(gomock.Any(), uint64(5), 100).Return(nil, nil).AnyTimes()
+
+	server := httptest.NewServer(h.Setup())
+	defer server.Close()
+	defer h.Close()
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/events?offset=1", nil)
+	assert.NoError(t, err)
+	req.Header.Set("Last-Event-ID", "3")
+	resp, err := http.DefaultClient.Do(req)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	var lines []string
+	scanner := bufio.NewScanner(resp.Body)
+	for len(lines) < 8 && scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	assert.Equal(t, []string{"id: 4", "event: product.created"}, lines[:2])
+	assert.Equal(t, []string{"id: 5", "event: product.deleted"}, lines[4:6])
+
+	var e domain.Event
+	assert.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(lines[6], "data: ")), &e))
+	assert.Equal(t, events[1], e)
+}
+
+func TestHandler_EventsInvalidOffset(t *testing.T) {
+	h := NewTestHandler(t)
+	defer h.Finish()
+
+	rec := httptest.NewRecorder()
+	h.Setup().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/events?offset=latest", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestHandler_CreateWebhook(t *testing.T) {
+	h := NewTestHandler(t)
+	defer h.Finish()
+
+	created := time.Date(2020, 7, 1, 12, 0, 0, 0, time.UTC)
+	h.service.EXPECT().CreateWebhook(gomock.Any(), &domain.Webhook{
+		URL: "https://partner.example.com/hook", Query: domain.Query{Term: "camera", Lat: 51.5, Lng: -0.1, Radius: 1000},
+	}).DoAndReturn(func(_ context.Context, w *domain.Webhook) (*domain.Webhook, error) {
+		w.ID, w.Secret, w.CreatedAt = 3, "s3cr3t", created
+		return w, nil
+	})
+
+	rec := httptest.NewRecorder()
+	h.Setup().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/webhooks",
+		strings.NewReader(`{"url": "https://partner.example.com/hook", "query": {"term": "camera", "lat": 51.5, "lng": -0.1, "radius": 1000}}`)))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.JSONEq(t, `{"id": 3, "url": "https://partner.example.com/hook", "secret": "s3cr3t", "created_at": "2020-07-01T12:00:00Z",
+		"query": {"term": "camera", "lat": 51.5, "lng": -0.1, "radius": 1000, "limit": 0, "cursor": ""}}`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	h.Setup().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/webhooks", strings.NewReader(`{"url":`)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestHandler_Webhooks(t *testing.T) {
+	h := NewTestHandler(t)
+	defer h.Finish()
+
+	h.service.EXPECT().Webhooks(gomock.Any()).Return(nil, nil)
+	h.service.EXPECT().DeleteWebhook(gomock.Any(), uint64(3)).Return(nil)
+	h.service.EXPECT().DeleteWebhook(gomock.Any(), uint64(4)).Return(fmt.Errorf("webhook not found: %w", service.ErrNotFound))
+
+	rec := httptest.NewRecorder()
+	h.Setup().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/webhooks", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "[]", rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	h.Setup().ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/webhooks/3", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	h.Setup().ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/webhooks/4", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestHandler_DeadLetters(t *testing.T) {
+	h := NewTestHandler(t)
+	defer h.Finish()
+
+	failed := time.Date(2020, 7, 1, 12, 0, 0, 0, time.UTC)
+	h.service.EXPECT().DeadLetters(gomock.Any(), uint64(3), uint64(1), 10).Return([]domain.DeadLetter{{
+		ID: 2, WebhookID: 3, Attempts: 5, Error: "webhook answered 503 Service Unavailable", FailedAt: failed,
+		Event: domain.Event{Offset: 9, Type: domain.EventCreated, ProductID: 12, Revision: 1, At: failed},
+	}}, nil)
+
+	rec := httptest.NewRecorder()
+	h.Setup().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/webhooks/3/dead-letters?after=1&limit=10", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var letters []domain.DeadLetter
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &letters))
+	if assert.Len(t, letters, 1) {
+		assert.Equal(t, uint64(9), letters[0].Event.Offset)
+		assert.Equal(t, 5, letters[0].Attempts)
+	}
+
+	rec = httptest.NewRecorder()
+	h.Setup().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/webhooks/3/dead-letters?limit=many", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestHandler_CreateSavedSearch(t *testing.T) {
+	h := NewTestHandler(t)
+	defer h.Finish()
+
+	created := time.Date(2020, 7, 1, 12, 0, 0, 0, time.UTC)
+	h.service.EXPECT().CreateSavedSearch(gomock.Any(), &domain.SavedSearch{
+		Name: "cameras", Query: domain.Query{Term: "camera", Lat: 51.5, Lng: -0.1, Radius: 1000},
+	}).DoAndReturn(func(ctx context.Context, s *domain.SavedSearch) (*domain.SavedSearch, error) {
+		s.ID, s.Owner, s.CreatedAt = 4, audit.FromContext(ctx).Actor, created
+		return s, nil
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/saved-searches",
+		strings.NewReader(`{"name": "cameras", "query": {"term": "camera", "lat": 51.5, "lng": -0.1, "radius": 1000}}`))
+	req.Header.Set(httpHandler.ActorHeader, "alice")
+	rec := httptest.NewRecorder()
+	h.Setup().ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.JSONEq(t, `{"id": 4, "owner": "alice", "name": "cameras", "created_at": "2020-07-01T12:00:00Z",
+		"query": {"term": "camera", "lat": 51.5, "lng": -0.1, "radius": 1000, "limit": 0, "cursor": ""}}`, rec.Body.String())
+}
+
+func TestHandler_Matches(t *testing.T) {
+	h := NewTestHandler(t)
+	defer h.Finish()
+
+	matched := time.Date(2020, 7, 1, 12, 0, 0, 0, time.UTC)
+	h.service.EXPECT().Matches(gomock.Any(), uint64(4), uint64(2), 10).Return([]domain.Match{{
+		ID: 3, SavedSearchID: 4, ProductID: 12, Offset: 9, MatchedAt: matched,
+		Product: domain.Product{ID: 12, ItemName: "camera", Version: 1},
+	}}, nil)
+	h.service.EXPECT().Matches(gomock.Any(), uint64(5), uint64(0), 0).Return(nil, fmt.Errorf("saved search not found: %w", service.ErrNotFound))
+	h.service.EXPECT().SavedSearches(gomock.Any()).Return(nil, nil)
+
+	rec := httptest.NewRecorder()
+	h.Setup().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/saved-searches/4/matches?after=2&limit=10", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `[{"id": 3, "saved_search_id": 4, "product_id": 12, "offset": 9, "matched_at": "2020-07-01T12:00:00Z",
+		"product": {"id": 12, "description": "camera", "lat": 0, "lng": 0, "img_URL": "", "product_URL": "", "version": 1}}]`,
+		rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	h.Setup().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/saved-searches/5/matches", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = httptest.NewRecorder()
+	h.Setup().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/saved-searches", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "[]", rec.Body.String())
+}
+
+func TestHandler_Tenant(t *testing.T) {
+	h := NewTestHandler(t)
+	defer h.Finish()
+
+	var tenants []string
+	h.service.EXPECT().Get(gomock.Any(), uint64(7)).DoAndReturn(func(ctx context.Context, id uint64) (*domain.Product, error) {
+		tenants = append(tenants, tenant.FromContext(ctx))
+		return &domain.Product{ID: id, Version: 1}, nil
+	}).Times(2)
+
+	for _, id := range []string{"acme", ""} {
+		req := httptest.NewRequest(http.MethodGet, "/product/7", nil)
+		req.Header.Set(httpHandler.TenantHeader, id)
+		rec := httptest.NewRecorder()
+		h.Setup().ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+	}
+	assert.Equal(t, []string{"acme", tenant.Default}, tenants)
+
+	// an invalid tenant never reaches the service
+	req := httptest.NewRequest(http.MethodGet, "/product/7", nil)
+	req.Header.Set(httpHandler.TenantHeader, "../acme")
+	rec := httptest.NewRecorder()
+	h.Setup().ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, httpHandler.ProblemContentType, rec.Header().Get("Content-Type"))
+}
+
+func TestHandler_Auth(t *testing.T) {
+	keys, err := auth.NewAPIKeys([]auth.APIKey{
+		{Key: "reader-key", Subject: "reader", Scopes: []string{auth.ScopeRead}},
+		{Key: "writer-key", Subject: "writer", Tenant: "acme", Scopes: []string{auth.ScopeWrite}},
+		{Key: "admin-key", Subject: "admin", Scopes: []string{auth.ScopeAdmin}},
+	})
+	assert.NoError(t, err)
+	h := NewTestHandler(t, httpHandler.WithAuthenticator(keys))
+	defer h.Finish()
+
+	h.service.EXPECT().Get(gomock.Any(), uint64(7)).Return(&domain.Product{ID: 7, Version: 1}, nil).Times(4)
+	h.service.EXPECT().Delete(gomock.Any(), uint64(7), uint64(0)).DoAndReturn(func(ctx context.Context, id, version uint64) error {
+		// the principal is the actor of the write and its tenant is enforced
+		assert.Equal(t, "writer", audit.FromContext(ctx).Actor)
+		assert.Equal(t, "acme", tenant.FromContext(ctx))
+		assert.Equal(t, auth.MethodAPIKey, auth.FromContext(ctx).Method)
+		return nil
+	})
+
+	tests := []struct {
+		name    string
+		method  string
+		key     string
+		headers map[string]string
+		status  int
+		code    string
+	}{
+		{"no key", http.MethodGet, "", nil, http.StatusUnauthorized, httpHandler.CodeUnauthenticated},
+		{"unknown key", http.MethodGet, "other-key", nil, http.StatusUnauthorized, httpHandler.CodeUnauthenticated},
+		{"reader reads", http.MethodGet, "reader-key", nil, http.StatusOK, ""},
+		{"reader deletes", http.MethodDelete, "reader-key", nil, http.StatusForbidden, httpHandler.CodeForbidden},
+		{"writer reads", http.MethodGet, "writer-key", nil, http.StatusOK, ""},
+		{"writer deletes", http.MethodDelete, "writer-key", map[string]string{httpHandler.ActorHeader: "mallory"}, http.StatusOK, ""},
+		{"writer of another tenant", http.MethodDelete, "writer-key", map[string]string{httpHandler.TenantHeader: "globex"}, http.StatusForbidden, httpHandler.CodeForbidden},
+		{"no key for an invalid tenant", http.MethodGet, "", map[string]string{httpHandler.TenantHeader: "../acme"}, http.StatusUnauthorized, httpHandler.CodeUnauthenticated},
+		{"reader of the default tenant", http.MethodGet, "reader-key", map[string]string{httpHandler.TenantHeader: tenant.Default}, http.StatusOK, ""},
+		{"reader of another tenant", http.MethodGet, "reader-key", map[string]string{httpHandler.TenantHeader: "globex"}, http.StatusForbidden, httpHandler.CodeForbidden},
+		{"admin of another tenant", http.MethodGet, "admin-key", map[string]string{httpHandler.TenantHeader: "globex"}, http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "/product/7", nil)
+		if tt.key != "" {
+			req.Header.Set(auth.APIKeyHeader, tt.key)
+		}
+		for k, v := range tt.headers {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		h.Setup().ServeHTTP(rec, req)
+		assert.Equal(t, tt.status, rec.Code, tt.name)
+		if tt.code != "" {
+			var p httpHandler.Problem
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &p), tt.name)
+			assert.Equal(t, tt.code, p.Code, tt.name)
+		}
+		if tt.status == http.StatusUnauthorized {
+			assert.NotEmpty(t, rec.Header().Get("WWW-Authenticate"), tt.name)
+		}
+	}
+
+	// webhooks need the admin scope
+	req := httptest.NewRequest(http.MethodGet, "/webhooks", nil)
+	req.Header.Set(auth.APIKeyHeader, "writer-key")
+	rec := httptest.NewRecorder()
+	h.Setup().ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+func TestHandler_RateLimit(t *testing.T) {
+	now := time.Date(2020, 7, 1, 12, 0, 0, 0, time.UTC)
+	limiter := ratelimit.New(&ratelimit.Config{
+		Default: ratelimit.Limits{ratelimit.Search: {Rate: 0.5, Burst: 2}, ratelimit.Write: {Rate: 1, Burst: 1}},
+	}, ratelimit.WithClock(func() time.Time { return now }))
+	h := NewTestHandler(t, httpHandler.WithRateLimiter(limiter))
+	defer h.Finish()
+
+	h.service.EXPECT().Search(gomock.Any(), gomock.Any()).Return(&domain.Page{}, nil).Times(3)
+	h.service.EXPECT().Delete(gomock.Any(), uint64(7), uint64(0)).Return(nil)
+
+	search := func(addr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/q?radius=5&lng=10&lat=15&term=camera", nil)
+		req.RemoteAddr = addr
+		rec := httptest.NewRecorder()
+		h.Setup().ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := search("10.0.0.1:4000")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "2", rec.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", rec.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "2", rec.Header().Get("RateLimit-Reset"))
+	assert.Equal(t, http.StatusOK, search("10.0.0.1:4001").Code)
+
+	rec = search("10.0.0.1:4002")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "2", rec.Header().Get("Retry-After"))
+	assert.Equal(t, "0", rec.Header().Get("RateLimit-Remaining"))
+	var p httpHandler.Problem
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &p))
+	assert.Equal(t, httpHandler.CodeRateLimited, p.Code)
+
+	// other clients and the write budget are counted apart
+	assert.Equal(t, http.StatusOK, search("10.0.0.2:4000").Code)
+	req := httptest.NewRequest(http.MethodDelete, "/product/7", nil)
+	req.RemoteAddr = "10.0.0.1:4003"
+	rec = httptest.NewRecorder()
+	h.Setup().ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("RateLimit-Limit"))
+}
+
+// bearerSubject authenticates a bearer token as the subject it names.
+type bearerSubject struct{}
+
+func (bearerSubject) Authenticate(r *http.Request) (*auth.Principal, error) {
+	sub := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if sub == "" {
+		return nil, auth.ErrNoCredentials
+	}
+	return &auth.Principal{Subject: sub, Scopes: []string{auth.ScopeRead}, Method: auth.MethodJWT}, nil
+}
+
+func TestHandler_RateLimitClients(t *testing.T) {
+	now := time.Date(2020, 7, 1, 12, 0, 0, 0, time.UTC)
+	config := &ratelimit.Config{
+		Default: ratelimit.Limits{ratelimit.Search: {Rate: 0.5, Burst: 1}},
+		Clients: map[string]ratelimit.Limits{"ip:10.0.0.1": {ratelimit.Search: {Rate: 0.5, Burst: 5}}},
+	}
+	keys, err := auth.NewAPIKeys([]auth.APIKey{
+		{Key: "k1", Subject: "importer", Scopes: []string{auth.ScopeRead}},
+		{Key: "k2", Subject: "importer", Scopes: []string{auth.ScopeRead}},
+	})
+	assert.NoError(t, err)
+	limiter := ratelimit.New(config, ratelimit.WithClock(func() time.Time { return now }))
+	h := NewTestHandler(t, httpHandler.WithRateLimiter(limiter), httpHandler.WithAuthenticator(auth.Chain{keys, bearerSubject{}}))
+	defer h.Finish()
+
+	h.service.EXPECT().Search(gomock.Any(), gomock.Any()).Return(&domain.Page{}, nil).Times(3)
+
+	search := func(header, value string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/q?radius=5&lng=10&lat=15", nil)
+		req.RemoteAddr = "10.0.0.1:4000"
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		rec := httptest.NewRecorder()
+		h.Setup().ServeHTTP(rec, req)
+		return rec
+	}
+
+	// keys of the same subject have budgets of their own
+	assert.Equal(t, http.StatusOK, search(auth.APIKeyHeader, "k1").Code)
+	assert.Equal(t, http.StatusTooManyRequests, search(auth.APIKeyHeader, "k1").Code)
+	assert.Equal(t, http.StatusOK, search(auth.APIKeyHeader, "k2").Code)
+
+	// a subject that looks like an address is not that address
+	rec := search("Authorization", "Bearer 10.0.0.1")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("RateLimit-Limit"))
+
+	// without an authenticator clients are known by their address
+	h = NewTestHandler(t, httpHandler.WithRateLimiter(limiter))
+	defer h.Finish()
+	h.service.EXPECT().Search(gomock.Any(), gomock.Any()).Return(&domain.Page{}, nil)
+	rec = search("", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "5", rec.Header().Get("RateLimit-Limit"))
+}
+
+func TestHandler_Metrics(t *testing.T) {
+	keys, err := auth.NewAPIKeys([]auth.APIKey{{Key: "k1", Subject: "reader", Scopes: []string{auth.ScopeRead}}})
+	assert.NoError(t, err)
+	reg := metrics.NewRegistry()
+	h := NewTestHandler(t, httpHandler.WithMetrics(reg), httpHandler.WithAuthenticator(keys))
+	defer h.Finish()
+
+	h.service.EXPECT().Get(gomock.Any(), uint64(7)).Return(&domain.Product{ID: 7, Version: 1}, nil)
+	h.service.EXPECT().Get(gomock.Any(), uint64(8)).Return(nil, fmt.Errorf("product not found: %w", service.ErrNotFound))
+	h.service.EXPECT().Get(gomock.Any(), uint64(9)).Return(nil, fmt.Errorf("failed to get product: %w", service.ErrRequestFailed))
+
+	router := h.Setup()
+	for _, path := range []string{"/product/7", "/product/8", "/product/9", "/nowhere"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set(auth.APIKeyHeader, "k1")
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// the metrics are served without authentication
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, httpHandler.MetricsEndpoint, nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, metrics.ContentType, rec.Header().Get("Content-Type"))
+
+	body := rec.Body.String()
+	for _, line := range []string{
+		`http_requests_total{method="GET",route="/product/{id}",status="200"} 1`,
+		`http_requests_total{method="GET",route="/product/{id}",status="404"} 1`,
+		`http_requests_total{method="GET",route="/product/{id}",status="500"} 1`,
+		`http_request_duration_seconds_count{method="GET",route="/product/{id}",status="200"} 1`,
+		`service_operations_total{operation="Get",outcome="ok"} 1`,
+		`service_operations_total{operation="Get",outcome="not_found"} 1`,
+		`service_operations_total{operation="Get",outcome="request_failed"} 1`,
+		`http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+	} {
+		assert.Contains(t, body, line+"\n")
+	}
+	assert.NotContains(t, body, "/product/7")
+	assert.NotContains(t, body, "/nowhere")
+}
+
+func TestHandler_Trace(t *testing.T) {
+	rec := &trace.Recorder{}
+	l := zerolog.Nop()
+	tracer := trace.NewTracer(&l, rec)
+	h := NewTestHandler(t, httpHandler.WithTracer(tracer))
+	defer h.Finish()
+
+	var inner trace.SpanID
+	h.service.EXPECT().Get(gomock.Any(), uint64(7)).DoAndReturn(func(ctx context.Context, id uint64) (*domain.Product, error) {
+		// the service is called within the span of its call
+		inner = trace.FromContext(ctx).SpanContext().SpanID
+		return &domain.Product{ID: 7, Version: 1}, nil
+	})
+	h.service.EXPECT().Get(gomock.Any(), uint64(9)).Return(nil, fmt.Errorf("failed to get product: %w", service.ErrRequestFailed))
+
+	router := h.Setup()
+	req := httptest.NewRequest(http.MethodGet, "/product/7", nil)
+	req.Header.Set(trace.TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/product/9", nil))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, httpHandler.MetricsEndpoint, nil))
+	assert.NoError(t, tracer.Shutdown(context.Background()))
+
+	spans := rec.Spans()
+	if !assert.Len(t, spans, 4) {
+		return
+	}
+	get, request := spans[0], spans[1]
+	assert.Equal(t, "service.Get", get.Name)
+	assert.Equal(t, inner, get.SpanID)
+	assert.Equal(t, request.SpanID, get.Parent)
+	assert.Empty(t, get.Error)
+	assert.Equal(t, "GET /product/{id}", request.Name)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", request.TraceID.String())
+	assert.Equal(t, "00f067aa0ba902b7", request.Parent.String())
+	assert.Contains(t, request.Attributes, trace.String("http.route", "/product/{id}"))
+	assert.Contains(t, request.Attributes, trace.String("http.target", "/product/7"))
+	assert.Contains(t, request.Attributes, trace.Int("http.status_code", 200))
+
+	failed, request := spans[2], spans[3]
+	assert.Equal(t, "service.Get", failed.Name)
+	assert.Contains(t, failed.Error, "request failed")
+	assert.Contains(t, failed.Attributes, trace.String("service.outcome", "request_failed"))
+	assert.NotEqual(t, "4bf92f3577b34da6a3ce929d0e0e4736", request.TraceID.String())
+	assert.False(t, request.Parent.IsValid())
+	assert.Equal(t, "answered 500 Internal Server Error", request.Error)
+}
@@ -0,0 +1,201 @@
+package http
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/mustafadubul/product/internal/bulk"
+	"github.com/mustafadubul/product/internal/domain"
+	"github.com/mustafadubul/product/internal/metrics"
+	"github.com/mustafadubul/product/internal/trace"
+)
+
+// instrumentedService traces the calls to the service as children of the span
+// of the request, and counts them by operation and outcome when calls is set,
+// the outcome being ok or the code of the problem the error is answered with.
+type instrumentedService struct {
+	service Service
+	calls   *metrics.Counter
+}
+
+func newInstrumentedService(svc Service, calls *metrics.Counter) *instrumentedService {
+	return &instrumentedService{service: svc, calls: calls}
+}
+
+// start starts the span of a call and returns the context to make it with and
+// the func to call with its error once it returned. Only errors answered with
+// a server error fail the span, a product that is not found is no failure of
+// the service.
+func (s *instrumentedService) start(ctx context.Context, operation string) (context.Context, func(err error)) {
+	ctx, span := trace.Start(ctx, "service."+operation)
+	return ctx, func(err error) {
+		outcome := "ok"
+		if err != nil {
+			p := problemOf(err)
+			outcome = p.Code
+			if p.Status >= http.StatusInternalServerError {
+				span.SetError(err)
+			}
+		}
+		span.SetAttributes(trace.String("service.outcome", outcome))
+		span.End()
+		if s.calls != nil {
+			s.calls.Inc(operation, outcome)
+		}
+	}
+}
+
+func (s *instrumentedService) Create(ctx context.Context, p *domain.Product) (*domain.Product, error) {
+	ctx, done := s.start(ctx, "Create")
+	created, err := s.service.Create(ctx, p)
+	done(err)
+	return created, err
+}
+
+func (s *instrumentedService) Get(ctx context.Context, id uint64) (*domain.Product, error) {
+	ctx, done := s.start(ctx, "Get")
+	p, err := s.service.Get(ctx, id)
+	done(err)
+	return p, err
+}
+
+func (s *instrumentedService) Search(ctx context.Context, q *domain.Query) (*domain.Page, error) {
+	ctx, done := s.start(ctx, "Search")
+	page, err := s.service.Search(ctx, q)
+	done(err)
+	return page, err
+}
+
+func (s *instrumentedService) Update(ctx context.Context, p *domain.Product) (*domain.Product, error) {
+	ctx, done := s.start(ctx, "Update")
+	updated, err := s.service.Update(ctx, p)
+	done(err)
+	return updated, err
+}
+
+func (s *instrumentedService) Patch(ctx context.Context, id uint64, version uint64, patch *domain.ProductPatch) (*domain.Product, error) {
+	ctx, done := s.start(ctx, "Patch")
+	p, err := s.service.Patch(ctx, id, version, patch)
+	done(err)
+	return p, err
+}
+
+func (s *instrumentedService) Delete(ctx context.Context, id uint64, version uint64) error {
+	ctx, done := s.start(ctx, "Delete")
+	err := s.service.Delete(ctx, id, version)
+	done(err)
+	return err
+}
+
+func (s *instrumentedService) Trash(ctx context.Context, after uint64, limit int) ([]domain.Product, error) {
+	ctx, done := s.start(ctx, "Trash")
+	products, err := s.service.Trash(ctx, after, limit)
+	done(err)
+	return products, err
+}
+
+func (s *instrumentedService) Restore(ctx context.Context, id uint64) (*domain.Product, error) {
+	ctx, done := s.start(ctx, "Restore")
+	p, err := s.service.Restore(ctx, id)
+	done(err)
+	return p, err
+}
+
+func (s *instrumentedService) History(ctx context.Context, id uint64, after uint64, limit int) ([]domain.Revision, error) {
+	ctx, done := s.start(ctx, "History")
+	revisions, err := s.service.History(ctx, id, after, limit)
+	done(err)
+	return revisions, err
+}
+
+func (s *instrumentedService) Revision(ctx context.Context, id uint64, number uint64) (*domain.Revision, error) {
+	ctx, done := s.start(ctx, "Revision")
+	rev, err := s.service.Revision(ctx, id, number)
+	done(err)
+	return rev, err
+}
+
+func (s *instrumentedService) Revert(ctx context.Context, id uint64, number uint64, version uint64) (*domain.Product, error) {
+	ctx, done := s.start(ctx, "Revert")
+	p, err := s.service.Revert(ctx, id, number, version)
+	done(err)
+	return p, err
+}
+
+func (s *instrumentedService) Events(ctx context.Context, after uint64, limit int) ([]domain.Event, error) {
+	ctx, done := s.start(ctx, "Events")
+	events, err := s.service.Events(ctx, after, limit)
+	done(err)
+	return events, err
+}
+
+func (s *instrumentedService) CreateWebhook(ctx context.Context, w *domain.Webhook) (*domain.Webhook, error) {
+	ctx, done := s.start(ctx, "CreateWebhook")
+	created, err := s.service.CreateWebhook(ctx, w)
+	done(err)
+	return created, err
+}
+
+func (s *instrumentedService) Webhooks(ctx context.Context) ([]domain.Webhook, error) {
+	ctx, done := s.start(ctx, "Webhooks")
+	webhooks, err := s.service.Webhooks(ctx)
+	done(err)
+	return webhooks, err
+}
+
+func (s *instrumentedService) DeleteWebhook(ctx context.Context, id uint64) error {
+	ctx, done := s.start(ctx, "DeleteWebhook")
+	err := s.service.DeleteWebhook(ctx, id)
+	done(err)
+	return err
+}
+
+func (s *instrumentedService) DeadLetters(ctx context.Context, webhookID uint64, after uint64, limit int) ([]domain.DeadLetter, error) {
+	ctx, done := s.start(ctx, "DeadLetters")
+	letters, err := s.service.DeadLetters(ctx, webhookID, after, limit)
+	done(err)
+	return letters, err
+}
+
+func (s *instrumentedService) CreateSavedSearch(ctx context.Context, search *domain.SavedSearch) (*domain.SavedSearch, error) {
+	ctx, done := s.start(ctx, "CreateSavedSearch")
+	created, err := s.service.CreateSavedSearch(ctx, search)
+	done(err)
+	return created, err
+}
+
+func (s *instrumentedService) SavedSearches(ctx context.Context) ([]domain.SavedSearch, error) {
+	ctx, done := s.start(ctx, "SavedSearches")
+	searches, err := s.service.SavedSearches(ctx)
+	done(err)
+	return searches, err
+}
+
+func (s *instrumentedService) DeleteSavedSearch(ctx context.Context, id uint64) error {
+	ctx, done := s.start(ctx, "DeleteSavedSearch")
+	err := s.service.DeleteSavedSearch(ctx, id)
+	done(err)
+	return err
+}
+
+func (s *instrumentedService) Matches(ctx context.Context, id uint64, after uint64, limit int) ([]domain.Match, error) {
+	ctx, done := s.start(ctx, "Matches")
+	matches, err := s.service.Matches(ctx, id, after, limit)
+	done(err)
+	return matches, err
+}
+
+func (s *instrumentedService) Import(ctx context.Context, r io.Reader, format bulk.Format) (*domain.ImportReport, error) {
+	ctx, done := s.start(ctx, "Import")
+	report, err := s.service.Import(ctx, r, format)
+	done(err)
+	return report, err
+}
+
+func (s *instrumentedService) Export(ctx context.Context, q *domain.Query, fn func(p *domain.Product) error) error {
+	ctx, done := s.start(ctx, "Export")
+	err := s.service.Export(ctx, q, fn)
+	done(err)
+	return err
+}
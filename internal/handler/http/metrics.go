@@ -0,0 +1,61 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/mustafadubul/product/internal/metrics"
+)
+
+// MetricsEndpoint serves the metrics of the handler, it is open to scrapers
+// without authentication.
+const MetricsEndpoint = "/metrics"
+
+// WithMetrics records the requests served by route and status and the outcome
+// of the service calls in reg, and exposes reg on MetricsEndpoint.
+func WithMetrics(reg *metrics.Registry) Option {
+	return func(h *Handler) {
+		h.metrics = reg
+		h.requests = reg.Counter("http_requests_total", "HTTP requests served.", "method", "route", "status")
+		h.latency = reg.Histogram("http_request_duration_seconds", "Time taken to serve HTTP requests.",
+			metrics.DefaultBuckets, "method", "route", "status")
+		h.calls = reg.Counter("service_operations_total", "Calls to the service by outcome.", "operation", "outcome")
+	}
+}
+
+// measure records the request once it is served, by the pattern of the route
+// it matched so the IDs in the path do not make a series each.
+func (h *Handler) measure(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.metrics == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		route, status := served(ww, r)
+		labels := []string{r.Method, route, strconv.Itoa(status)}
+		h.requests.Inc(labels...)
+		h.latency.Observe(time.Since(start).Seconds(), labels...)
+	})
+}
+
+// served returns the pattern of the route r matched, or "unmatched", and the
+// status it was answered with once w has served it.
+func served(w middleware.WrapResponseWriter, r *http.Request) (route string, status int) {
+	route = chi.RouteContext(r.Context()).RoutePattern()
+	if route == "" {
+		route = "unmatched"
+	}
+	status = w.Status()
+	if status == 0 {
+		status = http.StatusOK
+	}
+	return route, status
+}
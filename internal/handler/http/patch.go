@@ -0,0 +1,131 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/mustafadubul/product/internal/domain"
+	"github.com/mustafadubul/product/internal/service"
+)
+
+// MergePatchContentType is the media type of RFC 7396 JSON merge patches.
+const MergePatchContentType = "application/merge-patch+json"
+
+// Patch applies a JSON merge patch to the product with the id in the path.
+// Fields left out of the patch keep their value and fields set to null are
+// cleared. With If-Match the patch only applies to that version.
+func (h *Handler) Patch(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l := h.logger.With().Str("handler", "Patch").Logger()
+	l.WithContext(ctx)
+
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		badRequest(w, r, &l, err, "id not valid")
+		return
+	}
+
+	if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt != MergePatchContentType && mt != "application/json" {
+		err := fmt.Errorf("patches must be sent as %s", MergePatchContentType)
+		fail(w, r, &l, newProblem(http.StatusUnsupportedMediaType, CodeUnsupportedMediaType, err.Error()), err, "unsupported patch")
+		return
+	}
+
+	version, err := ifMatch(r)
+	if err != nil {
+		fail(w, r, &l, problemOf(err), err, "precondition failed")
+		return
+	}
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		badRequest(w, r, &l, err, "failed to read body")
+		return
+	}
+
+	patch, err := decodeMergePatch(data)
+	if errors.Is(err, service.ErrInputInvalid) {
+		fail(w, r, &l, problemOf(err), err, "invalid patch")
+		return
+	}
+	if err != nil {
+		badRequest(w, r, &l, err, "failed to unmarshal body")
+		return
+	}
+
+	p, err := h.service.Patch(ctx, id, version, patch)
+	if err != nil {
+		fail(w, r, &l, problemOf(err), err, "failed to patch product")
+		return
+	}
+
+	w.Header().Set("ETag", etag(p.Version))
+	_ = writeJSON(w, http.StatusOK, p)
+}
+
+// decodeMergePatch reads a merge patch of a product. The id and version can
+// not be patched, and as products have no nested objects every member of the
+// patch replaces a field.
+func decodeMergePatch(data []byte) (*domain.ProductPatch, error) {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(data, &members); err != nil {
+		return nil, fmt.Errorf("a merge patch must be a JSON object: %w", err)
+	}
+
+	patch := &domain.ProductPatch{}
+	var fields []service.FieldError
+	invalid := func(field, message string) {
+		fields = append(fields, service.FieldError{Field: field, Message: message})
+	}
+
+	for name, raw := range members {
+		null := bytes.Equal(bytes.TrimSpace(raw), []byte("null"))
+
+		switch name {
+		case "description":
+			patch.ItemName = new(string)
+			if !null && json.Unmarshal(raw, patch.ItemName) != nil {
+				invalid(name, "must be a string")
+			}
+		case "img_URL":
+			patch.ImageURL = new(string)
+			if !null && json.Unmarshal(raw, patch.ImageURL) != nil {
+				invalid(name, "must be a string")
+			}
+		case "product_URL":
+			patch.URL = new(string)
+			if !null && json.Unmarshal(raw, patch.URL) != nil {
+				invalid(name, "must be a string")
+			}
+		case "lat":
+			patch.Lat = new(float64)
+			if !null && json.Unmarshal(raw, patch.Lat) != nil {
+				invalid(name, "must be a number")
+			}
+		case "lng":
+			patch.Lng = new(float64)
+			if !null && json.Unmarshal(raw, patch.Lng) != nil {
+				invalid(name, "must be a number")
+			}
+		case "id", "version":
+			invalid(name, "can not be patched")
+		default:
+			invalid(name, "unknown field")
+		}
+	}
+
+	if len(fields) > 0 {
+		// map order is random, keep the errors stable
+		sort.Slice(fields, func(i, j int) bool { return fields[i].Field < fields[j].Field })
+		return nil, &service.ValidationError{Fields: fields}
+	}
+	return patch, nil
+}
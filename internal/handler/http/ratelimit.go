@@ -0,0 +1,73 @@
+package http
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mustafadubul/product/internal/auth"
+	"github.com/mustafadubul/product/internal/ratelimit"
+)
+
+// WithRateLimiter limits the search and write routes by the budgets of l.
+func WithRateLimiter(l *ratelimit.Limiter) Option {
+	return func(h *Handler) {
+		h.limiter = l
+	}
+}
+
+// limit counts the request against the budget of its client and refuses it
+// when the budget is used up. The RateLimit-Limit, RateLimit-Remaining and
+// RateLimit-Reset headers tell the client about its budget.
+func (h *Handler) limit(budget string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if h.limiter == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			c := client(r)
+			res := h.limiter.Allow(budget, c)
+			if res.Limit > 0 {
+				w.Header().Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+				w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+				w.Header().Set("RateLimit-Reset", ceilSeconds(res.Reset))
+			}
+			if !res.Allowed {
+				l := h.logger.With().Str("middleware", "limit").Str("client", c).Logger()
+				err := fmt.Errorf("%s budget used up", budget)
+				w.Header().Set("Retry-After", ceilSeconds(res.RetryAfter))
+				fail(w, r, &l, newProblem(http.StatusTooManyRequests, CodeRateLimited, err.Error()), err, "request rate limited")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// client identifies the caller of a request for its budgets, prefixed by its
+// kind so the kinds never share a budget: key: and the KeyID of its API key,
+// jwt: and the subject of its token, or else ip: and the address it connects
+// from.
+func client(r *http.Request) string {
+	if p := auth.FromContext(r.Context()); p != nil {
+		if p.Method == auth.MethodAPIKey {
+			return "key:" + p.KeyID
+		}
+		return "jwt:" + p.Subject
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return "ip:" + r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// ceilSeconds formats d as whole seconds, rounded up.
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,101 @@
+package http
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/mustafadubul/product/internal/domain"
+)
+
+// CreateSavedSearch saves a search for the actor of the request.
+func (h *Handler) CreateSavedSearch(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l := h.logger.With().Str("handler", "CreateSavedSearch").Logger()
+	l.WithContext(ctx)
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		badRequest(w, r, &l, err, "failed to read body")
+		return
+	}
+
+	var search domain.SavedSearch
+	if err = json.Unmarshal(data, &search); err != nil {
+		badRequest(w, r, &l, err, "failed to unmarshal body")
+		return
+	}
+
+	created, err := h.service.CreateSavedSearch(ctx, &search)
+	if err != nil {
+		fail(w, r, &l, problemOf(err), err, "failed to create saved search")
+		return
+	}
+	_ = writeJSON(w, http.StatusCreated, created)
+}
+
+// SavedSearches lists the saved searches of the actor of the request.
+func (h *Handler) SavedSearches(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l := h.logger.With().Str("handler", "SavedSearches").Logger()
+	l.WithContext(ctx)
+
+	searches, err := h.service.SavedSearches(ctx)
+	if err != nil {
+		fail(w, r, &l, problemOf(err), err, "failed to list saved searches")
+		return
+	}
+	if searches == nil {
+		searches = []domain.SavedSearch{}
+	}
+	_ = writeJSON(w, http.StatusOK, searches)
+}
+
+// DeleteSavedSearch removes a saved search with its matches.
+func (h *Handler) DeleteSavedSearch(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l := h.logger.With().Str("handler", "DeleteSavedSearch").Logger()
+	l.WithContext(ctx)
+
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		badRequest(w, r, &l, err, "id not valid")
+		return
+	}
+
+	if err := h.service.DeleteSavedSearch(ctx, id); err != nil {
+		fail(w, r, &l, problemOf(err), err, "failed to delete saved search")
+		return
+	}
+}
+
+// Matches lists the products that came into a saved search, oldest first. The
+// next page starts after the ID of the last match.
+func (h *Handler) Matches(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l := h.logger.With().Str("handler", "Matches").Logger()
+	l.WithContext(ctx)
+
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		badRequest(w, r, &l, err, "id not valid")
+		return
+	}
+	after, limit, err := pageOf(r.URL.Query())
+	if err != nil {
+		badRequest(w, r, &l, err, "invalid request query")
+		return
+	}
+
+	matches, err := h.service.Matches(ctx, id, after, limit)
+	if err != nil {
+		fail(w, r, &l, problemOf(err), err, "failed to read matches")
+		return
+	}
+	if matches == nil {
+		matches = []domain.Match{}
+	}
+	_ = writeJSON(w, http.StatusOK, matches)
+}
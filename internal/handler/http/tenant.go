@@ -0,0 +1,28 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/mustafadubul/product/internal/tenant"
+)
+
+// TenantHeader names the tenant whose catalogue a request works on. Requests
+// without it work on the default tenant.
+const TenantHeader = "X-Tenant"
+
+// withTenant puts the tenant of the request into its context, a request
+// naming an invalid tenant is refused before it reaches a handler.
+func withTenant(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(TenantHeader)
+		if id == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if err := tenant.Validate(id); err != nil {
+			_ = writeProblem(w, r, newProblem(http.StatusBadRequest, CodeBadRequest, err.Error()))
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(tenant.NewContext(r.Context(), id)))
+	})
+}
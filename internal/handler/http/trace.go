@@ -0,0 +1,51 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/mustafadubul/product/internal/trace"
+)
+
+// WithTracer traces every request but the scrapes of MetricsEndpoint, joining
+// the trace of the caller given in its traceparent header, and the calls the
+// handlers make to the service.
+func WithTracer(t *trace.Tracer) Option {
+	return func(h *Handler) {
+		h.tracer = t
+	}
+}
+
+// traceRequest starts the span of the request, which is named by the pattern
+// of the route it matched once it is served, e.g. GET /product/{id}. A
+// malformed traceparent starts a new trace.
+func (h *Handler) traceRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.tracer == nil || r.URL.Path == MetricsEndpoint {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := r.Context()
+		if sc, err := trace.ParseTraceparent(r.Header.Get(trace.TraceparentHeader)); err == nil {
+			ctx = trace.ContextWithRemote(ctx, sc)
+		}
+		ctx, span := h.tracer.Start(ctx, r.Method,
+			trace.String("http.method", r.Method),
+			trace.String("http.target", r.URL.Path),
+			trace.String("http.request_id", middleware.GetReqID(ctx)),
+		)
+		defer span.End()
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r.WithContext(ctx))
+
+		route, status := served(ww, r)
+		span.SetName(r.Method + " " + route)
+		span.SetAttributes(trace.String("http.route", route), trace.Int("http.status_code", int64(status)))
+		if status >= http.StatusInternalServerError {
+			span.SetError(fmt.Errorf("answered %d %s", status, http.StatusText(status)))
+		}
+	})
+}
@@ -0,0 +1,102 @@
+package http
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/mustafadubul/product/internal/domain"
+)
+
+// CreateWebhook subscribes a webhook. The response holds the secret the
+// deliveries are signed with, it is not returned again.
+func (h *Handler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l := h.logger.With().Str("handler", "CreateWebhook").Logger()
+	l.WithContext(ctx)
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		badRequest(w, r, &l, err, "failed to read body")
+		return
+	}
+
+	var webhook domain.Webhook
+	if err = json.Unmarshal(data, &webhook); err != nil {
+		badRequest(w, r, &l, err, "failed to unmarshal body")
+		return
+	}
+
+	created, err := h.service.CreateWebhook(ctx, &webhook)
+	if err != nil {
+		fail(w, r, &l, problemOf(err), err, "failed to create webhook")
+		return
+	}
+	_ = writeJSON(w, http.StatusCreated, created)
+}
+
+// Webhooks lists the webhooks without their secrets.
+func (h *Handler) Webhooks(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l := h.logger.With().Str("handler", "Webhooks").Logger()
+	l.WithContext(ctx)
+
+	webhooks, err := h.service.Webhooks(ctx)
+	if err != nil {
+		fail(w, r, &l, problemOf(err), err, "failed to list webhooks")
+		return
+	}
+	if webhooks == nil {
+		webhooks = []domain.Webhook{}
+	}
+	_ = writeJSON(w, http.StatusOK, webhooks)
+}
+
+// DeleteWebhook unsubscribes a webhook.
+func (h *Handler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l := h.logger.With().Str("handler", "DeleteWebhook").Logger()
+	l.WithContext(ctx)
+
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		badRequest(w, r, &l, err, "id not valid")
+		return
+	}
+
+	if err := h.service.DeleteWebhook(ctx, id); err != nil {
+		fail(w, r, &l, problemOf(err), err, "failed to delete webhook")
+		return
+	}
+}
+
+// DeadLetters lists the events a webhook failed to receive. The next page
+// starts after the ID of the last dead letter.
+func (h *Handler) DeadLetters(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l := h.logger.With().Str("handler", "DeadLetters").Logger()
+	l.WithContext(ctx)
+
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		badRequest(w, r, &l, err, "id not valid")
+		return
+	}
+	after, limit, err := pageOf(r.URL.Query())
+	if err != nil {
+		badRequest(w, r, &l, err, "invalid request query")
+		return
+	}
+
+	letters, err := h.service.DeadLetters(ctx, id, after, limit)
+	if err != nil {
+		fail(w, r, &l, problemOf(err), err, "failed to read dead letters")
+		return
+	}
+	if letters == nil {
+		letters = []domain.DeadLetter{}
+	}
+	_ = writeJSON(w, http.StatusOK, letters)
+}
@@ -0,0 +1,275 @@
+// Package metrics keeps counters and histograms and exposes them in the
+// Prometheus text format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the media type of the Prometheus text format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets are the upper bounds of the buckets of latency histograms, in
+// seconds.
+var DefaultBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Registry holds the metrics exposed together. Registering a metric whose name
+// is taken panics, as does using a metric with the wrong number of label
+// values.
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+	names   map[string]bool
+}
+
+type metric interface {
+	write(w *bufio.Writer)
+}
+
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]bool)}
+}
+
+func (r *Registry) register(name string, m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.names[name] {
+		panic(fmt.Sprintf("metric %s registered twice", name))
+	}
+	r.names[name] = true
+	r.metrics = append(r.metrics, m)
+}
+
+// Write writes the metrics in the order they were registered, the series of a
+// metric sorted by their label values.
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	metrics := append([]metric(nil), r.metrics...)
+	r.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, m := range metrics {
+		m.write(bw)
+	}
+	return bw.Flush()
+}
+
+// ServeHTTP exposes the metrics to a Prometheus scrape.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	_ = r.Write(w)
+}
+
+// family is what counters and histograms share: their name, help and labels,
+// and their series by label values.
+type family struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	series map[string][]string
+}
+
+func newFamily(name, help string, labels []string) family {
+	return family{name: name, help: help, labels: labels, series: make(map[string][]string)}
+}
+
+// key returns the key of the series of the label values, creating the series
+// when it is new.
+func (f *family) key(values []string) string {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metric %s has %d labels, got %d values", f.name, len(f.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	if _, ok := f.series[key]; !ok {
+		f.series[key] = append([]string(nil), values...)
+	}
+	return key
+}
+
+// keys returns the keys of the series in order.
+func (f *family) keys() []string {
+	keys := make([]string, 0, len(f.series))
+	for k := range f.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (f *family) header(w *bufio.Writer, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, typ)
+}
+
+// labelPairs formats the labels of a series with extra pairs appended, e.g.
+// {route="/q",le="0.5"}.
+func (f *family) labelPairs(values []string, extra ...string) string {
+	if len(f.labels) == 0 && len(extra) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, l := range f.labels {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", l, escapeValue(values[i]))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		if b.Len() > 1 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", extra[i], escapeValue(extra[i+1]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// Counter is a value that only goes up, with a series per label values.
+type Counter struct {
+	family
+	values map[string]float64
+}
+
+// Counter registers a counter with the labels.
+func (r *Registry) Counter(name, help string, labels ...string) *Counter {
+	c := &Counter{family: newFamily(name, help, labels), values: make(map[string]float64)}
+	r.register(name, c)
+	return c
+}
+
+// Inc adds one to the series of the label values.
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add adds v, which must not be negative, to the series of the label values.
+func (c *Counter) Add(v float64, values ...string) {
+	if v < 0 {
+		panic(fmt.Sprintf("counter %s decreased", c.name))
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[c.key(values)] += v
+}
+
+// Value returns the value of the series of the label values.
+func (c *Counter) Value(values ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[strings.Join(values, "\xff")]
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.header(w, "counter")
+	for _, k := range c.keys() {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, c.labelPairs(c.series[k]), formatFloat(c.values[k]))
+	}
+}
+
+// Histogram counts observations in buckets, with a series per label values.
+type Histogram struct {
+	family
+	buckets []float64
+	counts  map[string]*histogramCounts
+}
+
+type histogramCounts struct {
+	buckets []uint64
+	count   uint64
+	sum     float64
+}
+
+// Histogram registers a histogram with the upper bounds of its buckets, which
+// must be sorted, and the labels.
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if !sort.Float64sAreSorted(buckets) {
+		panic(fmt.Sprintf("buckets of histogram %s not sorted", name))
+	}
+	h := &Histogram{family: newFamily(name, help, labels), buckets: buckets, counts: make(map[string]*histogramCounts)}
+	r.register(name, h)
+	return h
+}
+
+// Observe adds v to the series of the label values.
+func (h *Histogram) Observe(v float64, values ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	key := h.key(values)
+	c, ok := h.counts[key]
+	if !ok {
+		c = &histogramCounts{buckets: make([]uint64, len(h.buckets))}
+		h.counts[key] = c
+	}
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		c.buckets[i]++
+	}
+	c.count++
+	c.sum += v
+}
+
+// Count returns the number of observations of the series of the label values.
+func (h *Histogram) Count(values ...string) uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if c, ok := h.counts[strings.Join(values, "\xff")]; ok {
+		return c.count
+	}
+	return 0
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.header(w, "histogram")
+	for _, k := range h.keys() {
+		values, c := h.series[k], h.counts[k]
+		var cumulative uint64
+		for i, le := range h.buckets {
+			cumulative += c.buckets[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelPairs(values, "le", formatFloat(le)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelPairs(values, "le", "+Inf"), c.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.labelPairs(values), formatFloat(c.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.labelPairs(values), c.count)
+	}
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	valueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeValue(s string) string {
+	return valueEscaper.Replace(s)
+}
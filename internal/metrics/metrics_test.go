@@ -0,0 +1,67 @@
+package metrics_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mustafadubul/product/internal/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistryWrite(t *testing.T) {
+	r := metrics.NewRegistry()
+	requests := r.Counter("requests_total", "Requests served.\nBy route.", "route", "status")
+	latency := r.Histogram("latency_seconds", "Request latency.", []float64{0.1, 1}, "route")
+	up := r.Counter("up", "Whether the server is up.")
+
+	requests.Inc("/q", "200")
+	requests.Add(2, "/q", "200")
+	requests.Inc(`/a"b`, "500")
+	latency.Observe(0.05, "/q")
+	latency.Observe(0.1, "/q")
+	latency.Observe(3, "/q")
+	up.Inc()
+
+	assert.Equal(t, float64(3), requests.Value("/q", "200"))
+	assert.Equal(t, uint64(3), latency.Count("/q"))
+
+	var b bytes.Buffer
+	assert.NoError(t, r.Write(&b))
+	assert.Equal(t, `# HELP requests_total Requests served.\nBy route.
+# TYPE requests_total counter
+requests_total{route="/a\"b",status="500"} 1
+requests_total{route="/q",status="200"} 3
+# HELP latency_seconds Request latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/q",le="0.1"} 2
+latency_seconds_bucket{route="/q",le="1"} 2
+latency_seconds_bucket{route="/q",le="+Inf"} 3
+latency_seconds_sum{route="/q"} 3.15
+latency_seconds_count{route="/q"} 3
+# HELP up Whether the server is up.
+# TYPE up counter
+up 1
+`, b.String())
+}
+
+func TestRegistryServeHTTP(t *testing.T) {
+	r := metrics.NewRegistry()
+	r.Counter("up", "Whether the server is up.").Inc()
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, metrics.ContentType, rec.Header().Get("Content-Type"))
+	assert.Contains(t, rec.Body.String(), "up 1\n")
+}
+
+func TestRegistryMisuse(t *testing.T) {
+	r := metrics.NewRegistry()
+	c := r.Counter("up", "Whether the server is up.", "instance")
+
+	assert.Panics(t, func() { r.Counter("up", "Again.") })
+	assert.Panics(t, func() { c.Inc() })
+	assert.Panics(t, func() { c.Add(-1, "a") })
+	assert.Panics(t, func() { r.Histogram("h", "Unsorted.", []float64{1, 0.5}) })
+}
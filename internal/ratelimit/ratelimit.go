@@ -0,0 +1,205 @@
+// Package ratelimit limits how often clients may call the API with token
+// buckets. Every client has a bucket per budget, which holds up to Burst
+// tokens and is refilled at Rate tokens a second; a request takes a token.
+package ratelimit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"sync"
+	"time"
+)
+
+// The budgets requests are counted against.
+const (
+	Search = "search"
+	Write  = "write"
+)
+
+// The limits of the budgets of clients without limits of their own.
+var (
+	DefaultSearch = Limit{Rate: 10, Burst: 20}
+	DefaultWrite  = Limit{Rate: 5, Burst: 10}
+)
+
+// sweepInterval is how often the buckets that refilled are dropped.
+const sweepInterval = time.Minute
+
+// Limit is the size of a bucket and the rate it is refilled at, in tokens a
+// second. A zero rate does not limit the budget.
+type Limit struct {
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+}
+
+func (l Limit) validate() error {
+	if l.Rate < 0 || math.IsNaN(l.Rate) || math.IsInf(l.Rate, 0) {
+		return fmt.Errorf("rate must be a number of at least 0")
+	}
+	if l.Rate > 0 && l.Burst < 1 {
+		return fmt.Errorf("burst must be at least 1")
+	}
+	return nil
+}
+
+// Limits are the limits of the budgets by their name.
+type Limits map[string]Limit
+
+func (ls Limits) validate() error {
+	for budget, l := range ls {
+		if budget != Search && budget != Write {
+			return fmt.Errorf("unknown budget %q", budget)
+		}
+		if err := l.validate(); err != nil {
+			return fmt.Errorf("budget %s: %w", budget, err)
+		}
+	}
+	return nil
+}
+
+// Config holds the default limits and the limits of the clients that have
+// their own, by client. A client named in Clients keeps the default limits of
+// the budgets it does not set.
+type Config struct {
+	Default Limits
+	Clients map[string]Limits
+}
+
+// Validate checks the limits of the config.
+func (c *Config) Validate() error {
+	if err := c.Default.validate(); err != nil {
+		return err
+	}
+	for client, ls := range c.Clients {
+		if err := ls.validate(); err != nil {
+			return fmt.Errorf("client %s: %w", client, err)
+		}
+	}
+	return nil
+}
+
+// limit returns the limit of the budget of the client.
+func (c *Config) limit(budget, client string) Limit {
+	if l, ok := c.Clients[client][budget]; ok {
+		return l
+	}
+	return c.Default[budget]
+}
+
+// LoadClients reads the limits of the clients from a JSON file, e.g.
+// {"importer": {"write": {"rate": 50, "burst": 100}}}.
+func LoadClients(path string) (map[string]Limits, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var clients map[string]Limits
+	if err := json.Unmarshal(b, &clients); err != nil {
+		return nil, fmt.Errorf("failed to read rate limits %s: %w", path, err)
+	}
+	return clients, nil
+}
+
+// Result is the state of the bucket of a request. Reset is how long the bucket
+// takes to fill up and RetryAfter how long a refused request should wait for a
+// token. Limit is zero for an unlimited budget.
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	limit  Limit
+}
+
+// refill adds the tokens earned since the last request.
+func (b *bucket) refill(now time.Time) {
+	b.tokens = math.Min(float64(b.limit.Burst), b.tokens+now.Sub(b.last).Seconds()*b.limit.Rate)
+	b.last = now
+}
+
+// Limiter holds the buckets of the clients.
+type Limiter struct {
+	config *Config
+	now    func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// Option configures a Limiter.
+type Option func(*Limiter)
+
+// WithClock sets the clock the buckets are refilled by, for tests.
+func WithClock(now func() time.Time) Option {
+	return func(l *Limiter) {
+		l.now = now
+	}
+}
+
+func New(c *Config, opts ...Option) *Limiter {
+	l := &Limiter{config: c, now: time.Now, buckets: make(map[string]*bucket)}
+	for _, opt := range opts {
+		opt(l)
+	}
+	l.lastSweep = l.now()
+	return l
+}
+
+// Allow takes a token from the bucket of the budget of the client.
+func (l *Limiter) Allow(budget, client string) Result {
+	limit := l.config.limit(budget, client)
+	if limit.Rate <= 0 {
+		return Result{Allowed: true}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastSweep) >= sweepInterval {
+		l.sweep(now)
+	}
+
+	key := budget + "\x00" + client
+	b, ok := l.buckets[key]
+	if !ok || b.limit != limit {
+		b = &bucket{tokens: float64(limit.Burst), last: now, limit: limit}
+		l.buckets[key] = b
+	}
+	b.refill(now)
+
+	res := Result{Limit: limit.Burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((1 - b.tokens) / limit.Rate)
+	}
+	res.Remaining = int(b.tokens)
+	res.Reset = seconds((float64(limit.Burst) - b.tokens) / limit.Rate)
+	return res
+}
+
+// sweep drops the buckets that are full again, a new bucket starts full.
+func (l *Limiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		b.refill(now)
+		if b.tokens >= float64(b.limit.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
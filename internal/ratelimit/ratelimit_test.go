@@ -0,0 +1,79 @@
+package ratelimit_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mustafadubul/product/internal/ratelimit"
+	"github.com/stretchr/testify/assert"
+)
+
+type clock struct{ now time.Time }
+
+func (c *clock) Now() time.Time { return c.now }
+
+func TestLimiter(t *testing.T) {
+	c := &clock{now: time.Date(2020, 7, 1, 12, 0, 0, 0, time.UTC)}
+	l := ratelimit.New(&ratelimit.Config{
+		Default: ratelimit.Limits{ratelimit.Search: {Rate: 2, Burst: 3}},
+		Clients: map[string]ratelimit.Limits{"importer": {ratelimit.Search: {Rate: 1, Burst: 1}}},
+	}, ratelimit.WithClock(c.Now))
+
+	for i := 2; i >= 0; i-- {
+		res := l.Allow(ratelimit.Search, "10.0.0.1")
+		assert.True(t, res.Allowed)
+		assert.Equal(t, 3, res.Limit)
+		assert.Equal(t, i, res.Remaining)
+	}
+	res := l.Allow(ratelimit.Search, "10.0.0.1")
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 500*time.Millisecond, res.RetryAfter)
+	assert.Equal(t, 1500*time.Millisecond, res.Reset)
+
+	// every client has its own bucket
+	assert.True(t, l.Allow(ratelimit.Search, "10.0.0.2").Allowed)
+
+	// the bucket refills at the rate
+	c.now = c.now.Add(500 * time.Millisecond)
+	assert.True(t, l.Allow(ratelimit.Search, "10.0.0.1").Allowed)
+	assert.False(t, l.Allow(ratelimit.Search, "10.0.0.1").Allowed)
+
+	// a client with limits of its own
+	assert.True(t, l.Allow(ratelimit.Search, "importer").Allowed)
+	res = l.Allow(ratelimit.Search, "importer")
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 1, res.Limit)
+	assert.Equal(t, time.Second, res.RetryAfter)
+
+	// budgets without a limit are not limited
+	for i := 0; i < 100; i++ {
+		assert.Equal(t, ratelimit.Result{Allowed: true}, l.Allow(ratelimit.Write, "10.0.0.1"))
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	valid := &ratelimit.Config{
+		Default: ratelimit.Limits{ratelimit.Search: ratelimit.DefaultSearch, ratelimit.Write: {}},
+		Clients: map[string]ratelimit.Limits{"importer": {ratelimit.Write: {Rate: 0.5, Burst: 1}}},
+	}
+	assert.NoError(t, valid.Validate())
+
+	for _, c := range []*ratelimit.Config{
+		{Default: ratelimit.Limits{"export": ratelimit.DefaultSearch}},
+		{Default: ratelimit.Limits{ratelimit.Search: {Rate: -1}}},
+		{Clients: map[string]ratelimit.Limits{"importer": {ratelimit.Write: {Rate: 1}}}},
+	} {
+		assert.Error(t, c.Validate(), "%+v", c)
+	}
+}
+
+func TestLoadClients(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "limits.json")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`{"importer": {"write": {"rate": 50, "burst": 100}}}`), 0600))
+
+	clients, err := ratelimit.LoadClients(path)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]ratelimit.Limits{"importer": {ratelimit.Write: {Rate: 50, Burst: 100}}}, clients)
+}
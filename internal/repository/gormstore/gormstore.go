@@ -0,0 +1,31 @@
+// Package gormstore holds the tables the gorm backends share, whose queries
+// are the same on SQLite and PostgreSQL. The backends embed Store and keep
+// the items table and the outbox, which each index or lock their own way.
+package gormstore
+
+import (
+	"context"
+
+	"github.com/jinzhu/gorm"
+	"github.com/mustafadubul/product/internal/repository/gormtrace"
+	"github.com/mustafadubul/product/internal/tenant"
+)
+
+// Store reads and writes the shared tables of a database.
+type Store struct {
+	db *gorm.DB
+}
+
+func New(db *gorm.DB) *Store {
+	return &Store{db: db}
+}
+
+// conn returns the database running its statements for ctx.
+func (s *Store) conn(ctx context.Context) *gorm.DB {
+	return gormtrace.WithContext(ctx, s.db)
+}
+
+// scoped narrows tx to the rows of the tenant of ctx.
+func scoped(ctx context.Context, tx *gorm.DB) *gorm.DB {
+	return tx.Where("tenant = ?", tenant.FromContext(ctx))
+}
@@ -0,0 +1,136 @@
+package gormstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/mustafadubul/product/internal/domain"
+	"github.com/mustafadubul/product/internal/repository"
+)
+
+// revision is a row of the revisions table. The snapshot and changes are
+// stored as JSON.
+type revision struct {
+	ID        uint64    `gorm:"column:id;primary_key"`
+	ProductID uint64    `gorm:"column:product_id;not null;unique_index:revisions_product_number"`
+	Number    uint64    `gorm:"column:number;not null;unique_index:revisions_product_number"`
+	Tenant    string    `gorm:"column:tenant;not null;default:'default'"`
+	Action    string    `gorm:"column:action;not null"`
+	Actor     string    `gorm:"column:actor;not null"`
+	RequestID string    `gorm:"column:request_id"`
+	CreatedAt time.Time `gorm:"column:created_at;not null"`
+	Snapshot  string    `gorm:"column:snapshot;type:text;not null"`
+	Changes   string    `gorm:"column:changes;type:text;not null"`
+}
+
+func (revision) TableName() string {
+	return "revisions"
+}
+
+func (r *revision) domain() (*domain.Revision, error) {
+	rev := &domain.Revision{
+		ProductID: r.ProductID,
+		Number:    r.Number,
+		Tenant:    r.Tenant,
+		Action:    r.Action,
+		Actor:     r.Actor,
+		RequestID: r.RequestID,
+		At:        r.CreatedAt.UTC(),
+	}
+	if err := json.Unmarshal([]byte(r.Snapshot), &rev.Snapshot); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(r.Changes), &rev.Changes); err != nil {
+		return nil, err
+	}
+	return rev, nil
+}
+
+// MigrateHistory creates the revisions table.
+func MigrateHistory(db *gorm.DB) error {
+	if err := db.AutoMigrate(&revision{}).Error; err != nil {
+		return fmt.Errorf("failed to migrate revisions: %w", err)
+	}
+	return nil
+}
+
+// Record numbers rev and appends it to the history of its product. It has to
+// run in the transaction of the write the revision is of, whose lock keeps
+// concurrent writes of the product from taking the same number.
+func Record(tx *gorm.DB, rev *domain.Revision) error {
+	snapshot, err := json.Marshal(rev.Snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to record revision: %w", repository.ErrFatal)
+	}
+	changes, err := json.Marshal(rev.Changes)
+	if err != nil {
+		return fmt.Errorf("failed to record revision: %w", repository.ErrFatal)
+	}
+
+	var last struct{ Number uint64 }
+	err = tx.Table("revisions").Select("COALESCE(MAX(number), 0) AS number").
+		Where("product_id = ?", rev.ProductID).Scan(&last).Error
+	if err != nil {
+		return fmt.Errorf("failed to record revision: %w", repository.ErrFatal)
+	}
+
+	row := &revision{
+		ProductID: rev.ProductID,
+		Number:    last.Number + 1,
+		Tenant:    rev.Tenant,
+		Action:    rev.Action,
+		Actor:     rev.Actor,
+		RequestID: rev.RequestID,
+		CreatedAt: rev.At,
+		Snapshot:  string(snapshot),
+		Changes:   string(changes),
+	}
+	if err := tx.Create(row).Error; err != nil {
+		return fmt.Errorf("failed to record revision: %w", repository.ErrFatal)
+	}
+
+	rev.Number = row.Number
+	return nil
+}
+
+func (s *Store) History(ctx context.Context, id uint64, after uint64, limit int) ([]domain.Revision, error) {
+	var rows []revision
+	q := scoped(ctx, s.conn(ctx)).Where("product_id = ? AND number > ?", id, after).Order("number")
+	if limit > 0 {
+		q = q.Limit(limit)
+	}
+	if err := q.Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", repository.ErrFatal)
+	}
+
+	history := make([]domain.Revision, len(rows))
+	for i := range rows {
+		rev, err := rows[i].domain()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read history: %w", repository.ErrFatal)
+		}
+		history[i] = *rev
+	}
+	return history, nil
+}
+
+func (s *Store) Revision(ctx context.Context, id uint64, number uint64) (*domain.Revision, error) {
+	var row revision
+	err := scoped(ctx, s.conn(ctx)).Where("product_id = ? AND number = ?", id, number).First(&row).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("not found revision: %w", repository.ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to get revision: %w", repository.ErrFatal)
+	}
+
+	rev, err := row.domain()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get revision: %w", repository.ErrFatal)
+	}
+	return rev, nil
+}
@@ -0,0 +1,189 @@
+package gormstore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/mustafadubul/product/internal/domain"
+	"github.com/mustafadubul/product/internal/repository"
+)
+
+// savedSearch is a row of the saved_searches table, with the query in its own
+// columns.
+type savedSearch struct {
+	ID        uint64    `gorm:"column:id;primary_key"`
+	Tenant    string    `gorm:"column:tenant;not null;default:'default';index"`
+	Owner     string    `gorm:"column:owner;not null;index"`
+	Name      string    `gorm:"column:name"`
+	Term      string    `gorm:"column:term"`
+	Lat       float64   `gorm:"column:lat"`
+	Lng       float64   `gorm:"column:lng"`
+	Radius    float64   `gorm:"column:radius"`
+	CreatedAt time.Time `gorm:"column:created_at;not null"`
+}
+
+func (savedSearch) TableName() string {
+	return "saved_searches"
+}
+
+func (s *savedSearch) domain() domain.SavedSearch {
+	return domain.SavedSearch{
+		ID:        s.ID,
+		Tenant:    s.Tenant,
+		Owner:     s.Owner,
+		Name:      s.Name,
+		Query:     domain.Query{Term: s.Term, Lat: s.Lat, Lng: s.Lng, Radius: s.Radius},
+		CreatedAt: s.CreatedAt.UTC(),
+	}
+}
+
+// match is a row of the saved_search_matches table, a product matches a saved
+// search once. The product is stored as JSON.
+type match struct {
+	ID            uint64    `gorm:"column:id;primary_key"`
+	SavedSearchID uint64    `gorm:"column:saved_search_id;not null;unique_index:matches_search_product"`
+	ProductID     uint64    `gorm:"column:product_id;not null;unique_index:matches_search_product"`
+	Offset        uint64    `gorm:"column:event_offset;not null"`
+	Product       string    `gorm:"column:product;type:text;not null"`
+	MatchedAt     time.Time `gorm:"column:matched_at;not null"`
+}
+
+func (match) TableName() string {
+	return "saved_search_matches"
+}
+
+// MigrateSavedSearches creates the saved_searches and saved_search_matches
+// tables.
+func MigrateSavedSearches(db *gorm.DB) error {
+	if err := db.AutoMigrate(&savedSearch{}, &match{}).Error; err != nil {
+		return fmt.Errorf("failed to migrate saved searches: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) CreateSavedSearch(ss *domain.SavedSearch) (*domain.SavedSearch, error) {
+	row := &savedSearch{
+		Tenant:    ss.Tenant,
+		Owner:     ss.Owner,
+		Name:      ss.Name,
+		Term:      ss.Query.Term,
+		Lat:       ss.Query.Lat,
+		Lng:       ss.Query.Lng,
+		Radius:    ss.Query.Radius,
+		CreatedAt: ss.CreatedAt,
+	}
+	if err := s.db.Create(row).Error; err != nil {
+		return nil, fmt.Errorf("failed to insert saved search: %w", repository.ErrFatal)
+	}
+	ss.ID = row.ID
+	return ss, nil
+}
+
+func (s *Store) SavedSearch(id uint64) (*domain.SavedSearch, error) {
+	var row savedSearch
+	if err := s.db.Where("id = ?", id).First(&row).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("not found saved search: %w", repository.ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to get saved search: %w", repository.ErrFatal)
+	}
+	ss := row.domain()
+	return &ss, nil
+}
+
+func (s *Store) SavedSearches(owner string) ([]domain.SavedSearch, error) {
+	var rows []savedSearch
+	q := s.db.Order("id")
+	if owner != "" {
+		q = q.Where("owner = ?", owner)
+	}
+	if err := q.Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to read saved searches: %w", repository.ErrFatal)
+	}
+
+	searches := make([]domain.SavedSearch, len(rows))
+	for i := range rows {
+		searches[i] = rows[i].domain()
+	}
+	return searches, nil
+}
+
+func (s *Store) DeleteSavedSearch(id uint64) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("id = ?", id).Delete(&savedSearch{})
+		if err := res.Error; err != nil {
+			return fmt.Errorf("failed to delete saved search: %w", repository.ErrFatal)
+		}
+		if res.RowsAffected == 0 {
+			return fmt.Errorf("not found saved search: %w", repository.ErrNotFound)
+		}
+		if err := tx.Where("saved_search_id = ?", id).Delete(&match{}).Error; err != nil {
+			return fmt.Errorf("failed to delete saved search: %w", repository.ErrFatal)
+		}
+		return nil
+	})
+}
+
+func (s *Store) AddMatch(m *domain.Match) (bool, error) {
+	product, err := json.Marshal(m.Product)
+	if err != nil {
+		return false, fmt.Errorf("failed to insert match: %w", repository.ErrFatal)
+	}
+
+	added := false
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var count int
+		err := tx.Model(&match{}).Where("saved_search_id = ? AND product_id = ?", m.SavedSearchID, m.ProductID).
+			Count(&count).Error
+		if err != nil {
+			return fmt.Errorf("failed to insert match: %w", repository.ErrFatal)
+		}
+		if count > 0 {
+			return nil
+		}
+
+		row := &match{
+			SavedSearchID: m.SavedSearchID,
+			ProductID:     m.ProductID,
+			Offset:        m.Offset,
+			Product:       string(product),
+			MatchedAt:     m.MatchedAt,
+		}
+		if err := tx.Create(row).Error; err != nil {
+			return fmt.Errorf("failed to insert match: %w", repository.ErrFatal)
+		}
+		m.ID = row.ID
+		added = true
+		return nil
+	})
+	return added, err
+}
+
+func (s *Store) Matches(savedSearchID uint64, after uint64, limit int) ([]domain.Match, error) {
+	var rows []match
+	q := s.db.Where("saved_search_id = ? AND id > ?", savedSearchID, after).Order("id")
+	if limit > 0 {
+		q = q.Limit(limit)
+	}
+	if err := q.Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to read matches: %w", repository.ErrFatal)
+	}
+
+	matches := make([]domain.Match, len(rows))
+	for i, row := range rows {
+		matches[i] = domain.Match{
+			ID:            row.ID,
+			SavedSearchID: row.SavedSearchID,
+			ProductID:     row.ProductID,
+			Offset:        row.Offset,
+			MatchedAt:     row.MatchedAt.UTC(),
+		}
+		if err := json.Unmarshal([]byte(row.Product), &matches[i].Product); err != nil {
+			return nil, fmt.Errorf("failed to read matches: %w", repository.ErrFatal)
+		}
+	}
+	return matches, nil
+}
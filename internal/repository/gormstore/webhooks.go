@@ -0,0 +1,154 @@
+package gormstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/mustafadubul/product/internal/domain"
+	"github.com/mustafadubul/product/internal/repository"
+)
+
+// webhook is a row of the webhooks table, with the query in its own columns.
+type webhook struct {
+	ID        uint64    `gorm:"column:id;primary_key"`
+	Tenant    string    `gorm:"column:tenant;not null;default:'default';index"`
+	URL       string    `gorm:"column:url;not null"`
+	Secret    string    `gorm:"column:secret;not null"`
+	Term      string    `gorm:"column:term"`
+	Lat       float64   `gorm:"column:lat"`
+	Lng       float64   `gorm:"column:lng"`
+	Radius    float64   `gorm:"column:radius"`
+	CreatedAt time.Time `gorm:"column:created_at;not null"`
+}
+
+func (webhook) TableName() string {
+	return "webhooks"
+}
+
+func (w *webhook) domain() domain.Webhook {
+	return domain.Webhook{
+		ID:        w.ID,
+		Tenant:    w.Tenant,
+		URL:       w.URL,
+		Secret:    w.Secret,
+		Query:     domain.Query{Term: w.Term, Lat: w.Lat, Lng: w.Lng, Radius: w.Radius},
+		CreatedAt: w.CreatedAt.UTC(),
+	}
+}
+
+// deadLetter is a row of the dead_letters table, the event is stored as JSON.
+type deadLetter struct {
+	ID        uint64    `gorm:"column:id;primary_key"`
+	WebhookID uint64    `gorm:"column:webhook_id;not null;index"`
+	Event     string    `gorm:"column:event;type:text;not null"`
+	Attempts  int       `gorm:"column:attempts;not null"`
+	Error     string    `gorm:"column:error;type:text"`
+	FailedAt  time.Time `gorm:"column:failed_at;not null"`
+}
+
+func (deadLetter) TableName() string {
+	return "dead_letters"
+}
+
+// MigrateWebhooks creates the webhooks and dead_letters tables.
+func MigrateWebhooks(db *gorm.DB) error {
+	if err := db.AutoMigrate(&webhook{}, &deadLetter{}).Error; err != nil {
+		return fmt.Errorf("failed to migrate webhooks: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) CreateWebhook(w *domain.Webhook) (*domain.Webhook, error) {
+	row := &webhook{
+		Tenant:    w.Tenant,
+		URL:       w.URL,
+		Secret:    w.Secret,
+		Term:      w.Query.Term,
+		Lat:       w.Query.Lat,
+		Lng:       w.Query.Lng,
+		Radius:    w.Query.Radius,
+		CreatedAt: w.CreatedAt,
+	}
+	if err := s.db.Create(row).Error; err != nil {
+		return nil, fmt.Errorf("failed to insert webhook: %w", repository.ErrFatal)
+	}
+	w.ID = row.ID
+	return w, nil
+}
+
+func (s *Store) Webhooks() ([]domain.Webhook, error) {
+	var rows []webhook
+	if err := s.db.Order("id").Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to read webhooks: %w", repository.ErrFatal)
+	}
+
+	webhooks := make([]domain.Webhook, len(rows))
+	for i := range rows {
+		webhooks[i] = rows[i].domain()
+	}
+	return webhooks, nil
+}
+
+func (s *Store) DeleteWebhook(id uint64) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("id = ?", id).Delete(&webhook{})
+		if err := res.Error; err != nil {
+			return fmt.Errorf("failed to delete webhook: %w", repository.ErrFatal)
+		}
+		if res.RowsAffected == 0 {
+			return fmt.Errorf("not found webhook: %w", repository.ErrNotFound)
+		}
+		if err := tx.Where("webhook_id = ?", id).Delete(&deadLetter{}).Error; err != nil {
+			return fmt.Errorf("failed to delete webhook: %w", repository.ErrFatal)
+		}
+		return nil
+	})
+}
+
+func (s *Store) AddDeadLetter(dl *domain.DeadLetter) error {
+	event, err := json.Marshal(dl.Event)
+	if err != nil {
+		return fmt.Errorf("failed to insert dead letter: %w", repository.ErrFatal)
+	}
+
+	row := &deadLetter{
+		WebhookID: dl.WebhookID,
+		Event:     string(event),
+		Attempts:  dl.Attempts,
+		Error:     dl.Error,
+		FailedAt:  dl.FailedAt,
+	}
+	if err := s.db.Create(row).Error; err != nil {
+		return fmt.Errorf("failed to insert dead letter: %w", repository.ErrFatal)
+	}
+	dl.ID = row.ID
+	return nil
+}
+
+func (s *Store) DeadLetters(webhookID uint64, after uint64, limit int) ([]domain.DeadLetter, error) {
+	var rows []deadLetter
+	q := s.db.Where("webhook_id = ? AND id > ?", webhookID, after).Order("id")
+	if limit > 0 {
+		q = q.Limit(limit)
+	}
+	if err := q.Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to read dead letters: %w", repository.ErrFatal)
+	}
+
+	deadLetters := make([]domain.DeadLetter, len(rows))
+	for i, row := range rows {
+		deadLetters[i] = domain.DeadLetter{
+			ID:        row.ID,
+			WebhookID: row.WebhookID,
+			Attempts:  row.Attempts,
+			Error:     row.Error,
+			FailedAt:  row.FailedAt.UTC(),
+		}
+		if err := json.Unmarshal([]byte(row.Event), &deadLetters[i].Event); err != nil {
+			return nil, fmt.Errorf("failed to read dead letters: %w", repository.ErrFatal)
+		}
+	}
+	return deadLetters, nil
+}
@@ -0,0 +1,105 @@
+// Package gormtrace traces the SQL statements gorm runs as children of the span
+// of the context they are run for, with their shape and the number of rows
+// they return or write as attributes.
+package gormtrace
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+	"github.com/mustafadubul/product/internal/trace"
+)
+
+const (
+	contextKey = "trace:context"
+	spanKey    = "trace:span"
+)
+
+// WithContext returns db running its statements for ctx, as does every
+// transaction begun from it.
+func WithContext(ctx context.Context, db *gorm.DB) *gorm.DB {
+	return db.Set(contextKey, ctx)
+}
+
+// Register traces the statements db runs, system naming the database in the
+// spans, e.g. sqlite. Registering a db twice has no further effect.
+func Register(db *gorm.DB, system string) {
+	// gorm logs every callback it registers, which is of no interest
+	quiet := db.New()
+	quiet.SetLogger(gorm.Logger{LogWriter: log.New(ioutil.Discard, "", 0)})
+	callbacks := quiet.Callback()
+	if callbacks.Query().Get("trace:before_query") != nil {
+		return
+	}
+
+	before, after := start(system), end(system, true)
+	callbacks.Create().Before("gorm:create").Register("trace:before_create", before)
+	callbacks.Create().After("gorm:create").Register("trace:after_create", after)
+	callbacks.Query().Before("gorm:query").Register("trace:before_query", before)
+	callbacks.Query().After("gorm:query").Register("trace:after_query", after)
+	callbacks.RowQuery().Before("gorm:row_query").Register("trace:before_row_query", before)
+	callbacks.RowQuery().After("gorm:row_query").Register("trace:after_row_query", end(system, false))
+	callbacks.Update().Before("gorm:update").Register("trace:before_update", before)
+	callbacks.Update().After("gorm:update").Register("trace:after_update", after)
+	callbacks.Delete().Before("gorm:delete").Register("trace:before_delete", before)
+	callbacks.Delete().After("gorm:delete").Register("trace:after_delete", after)
+}
+
+func start(system string) func(scope *gorm.Scope) {
+	return func(scope *gorm.Scope) {
+		v, ok := scope.Get(contextKey)
+		if !ok {
+			return
+		}
+		ctx, _ := v.(context.Context)
+		if ctx == nil {
+			return
+		}
+		if _, span := trace.Start(ctx, system); span != nil {
+			span.SetKind(trace.KindClient)
+			scope.InstanceSet(spanKey, span)
+		}
+	}
+}
+
+// end ends the span of a statement once it ran. The span is named by the
+// verb of the statement and its table, e.g. sqlite SELECT items, and carries
+// the statement with its placeholders, so no values searched for or written
+// end up in the trace, and the rows it returned or wrote unless they are
+// read as it goes. A query for a single record that found none is no
+// failure.
+func end(system string, rows bool) func(scope *gorm.Scope) {
+	return func(scope *gorm.Scope) {
+		v, ok := scope.InstanceGet(spanKey)
+		if !ok {
+			return
+		}
+		span, _ := v.(*trace.Span)
+
+		name := system
+		if verb := strings.Fields(scope.SQL); len(verb) > 0 {
+			name += " " + strings.ToUpper(verb[0])
+		}
+		table := scope.TableName()
+		if table != "" {
+			name += " " + table
+		}
+		span.SetName(name)
+		span.SetAttributes(
+			trace.String("db.system", system),
+			trace.String("db.sql.table", table),
+			trace.String("db.statement", scope.SQL),
+		)
+		if rows {
+			span.SetAttributes(trace.Int("db.rows", scope.DB().RowsAffected))
+		}
+		if err := scope.DB().Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			span.SetError(err)
+		}
+		span.End()
+	}
+}
@@ -0,0 +1,581 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mustafadubul/product/internal/audit"
+	"github.com/mustafadubul/product/internal/domain"
+	"github.com/mustafadubul/product/internal/repository"
+	"github.com/mustafadubul/product/internal/tenant"
+	"github.com/mustafadubul/product/pkg/geo"
+	"github.com/rs/zerolog"
+)
+
+// DefaultCellSize is the size in degrees of the cells of the spatial grid,
+// about 11km north to south.
+const DefaultCellSize = 0.1
+
+// cell is a square of the uniform grid products are indexed in.
+type cell struct {
+	lat int
+	lng int
+}
+
+// DB is a pure Go repository that keeps the products in memory. Products are
+// indexed in a uniform grid for bounding box searches and by the tokens of
+// their item names for term searches.
+type DB struct {
+	mu     sync.RWMutex
+	logger *zerolog.Logger
+
+	products map[uint64]domain.Product
+	nextID   uint64
+
+	// trash holds the deleted products, they are not indexed
+	trash map[uint64]domain.Product
+	// history holds the revisions of every product ever stored
+	history map[uint64][]domain.Revision
+	// outbox holds the events of all writes, the offset of an event is its
+	// index plus one
+	outbox  []domain.Event
+	offsets map[string]uint64
+
+	webhooks         map[uint64]domain.Webhook
+	nextWebhookID    uint64
+	deadLetters      []domain.DeadLetter
+	nextDeadLetterID uint64
+
+	savedSearches     map[uint64]domain.SavedSearch
+	nextSavedSearchID uint64
+	matches           []domain.Match
+	nextMatchID       uint64
+
+	cellSize float64
+	grid     map[cell]map[uint64]struct{}
+
+	names  map[uint64][]string
+	tokens map[string]map[uint64]struct{}
+}
+
+func New() *DB {
+	componentLogger := zerolog.New(os.Stdout).With().Str("component", "repository").Logger()
+	return &DB{
+		logger:   &componentLogger,
+		products: map[uint64]domain.Product{},
+		nextID:   1,
+		trash:    map[uint64]domain.Product{},
+		history:  map[uint64][]domain.Revision{},
+		offsets:  map[string]uint64{},
+		webhooks: map[uint64]domain.Webhook{},
+
+		savedSearches: map[uint64]domain.SavedSearch{},
+
+		cellSize: DefaultCellSize,
+		grid:     map[cell]map[uint64]struct{}{},
+		names:    map[uint64][]string{},
+		tokens:   map[string]map[uint64]struct{}{},
+	}
+}
+
+// Close does nothing, it is there so DB can be used like the SQL backends.
+func (d *DB) Close() error {
+	return nil
+}
+
+// Migrate does nothing, it is there so DB can be used like the SQL backends.
+func (d *DB) Migrate() error {
+	return nil
+}
+
+// Search returns the products matching the filter in its order.
+func (d *DB) Search(ctx context.Context, f repository.Filter) ([]domain.Product, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	ids := d.query(tenant.FromContext(ctx), f)
+	products := make([]domain.Product, len(ids))
+	for i, id := range ids {
+		products[i] = d.products[id]
+	}
+	return products, nil
+}
+
+// Each only holds the lock while it looks up the matching IDs and while it
+// copies each product, products deleted in between are skipped.
+func (d *DB) Each(ctx context.Context, f repository.Filter, fn func(p *domain.Product) error) error {
+	d.mu.RLock()
+	ids := d.query(tenant.FromContext(ctx), f)
+	d.mu.RUnlock()
+
+	for _, id := range ids {
+		d.mu.RLock()
+		p, ok := d.products[id]
+		d.mu.RUnlock()
+		if !ok {
+			continue
+		}
+		if err := fn(&p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// query returns the IDs of the products of the tenant matching the filter in
+// order. The caller holds the read lock.
+func (d *DB) query(t string, f repository.Filter) []uint64 {
+	var candidates map[uint64]struct{}
+	if len(f.Box) == 4 {
+		candidates = d.inBox(f.Box)
+	}
+	// like the SQL backends a term without words matches every product
+	if q := repository.ParseTerm(f.Term); len(q) > 0 {
+		candidates = intersect(candidates, d.matching(q))
+	}
+
+	var ids []uint64
+	if candidates == nil {
+		ids = make([]uint64, 0, len(d.products))
+		for id, p := range d.products {
+			if p.Tenant == t {
+				ids = append(ids, id)
+			}
+		}
+	} else {
+		ids = make([]uint64, 0, len(candidates))
+		for id := range candidates {
+			if d.products[id].Tenant == t {
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	ids = d.order(ids, f)
+	if f.Limit > 0 && len(ids) > f.Limit {
+		ids = ids[:f.Limit]
+	}
+	return ids
+}
+
+// order sorts the IDs in the order of the filter and leaves out those up to
+// f.After. The caller holds the read lock.
+func (d *DB) order(ids []uint64, f repository.Filter) []uint64 {
+	key := func(lat, lng float64) float64 { return 0 }
+	if f.Order == repository.OrderDistance {
+		c := f.Within
+		key = func(lat, lng float64) float64 { return geo.Distance(c.Lat, c.Lng, lat, lng) }
+	}
+
+	keys := make(map[uint64]float64, len(ids))
+	for _, id := range ids {
+		p := d.products[id]
+		keys[id] = key(p.Lat, p.Lng)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if keys[ids[i]] != keys[ids[j]] {
+			return keys[ids[i]] < keys[ids[j]]
+		}
+		return ids[i] < ids[j]
+	})
+
+	if f.After != nil {
+		after := key(f.After.Lat, f.After.Lng)
+		i := sort.Search(len(ids), func(i int) bool {
+			k := keys[ids[i]]
+			return k > after || k == after && ids[i] > f.After.ID
+		})
+		ids = ids[i:]
+	}
+	return ids
+}
+
+// inBox returns the products in the bounding box given by its top, right,
+// bottom and left points. A box crossing the antimeridian is read as the two
+// boxes on either side of it.
+func (d *DB) inBox(points []domain.Point) map[uint64]struct{} {
+	top, right, bottom, left := points[0].X, points[1].Y, points[2].X, points[3].Y
+	spans := [][2]float64{{left, right}}
+	if left > right {
+		spans = [][2]float64{{left, 180}, {-180, right}}
+	}
+	inside := func(p domain.Product) bool {
+		if p.Lat < bottom || p.Lat > top {
+			return false
+		}
+		for _, s := range spans {
+			if p.Lng >= s[0] && p.Lng <= s[1] {
+				return true
+			}
+		}
+		return false
+	}
+
+	ids := map[uint64]struct{}{}
+
+	cells := 0
+	for _, s := range spans {
+		from, to := d.cellOf(bottom, s[0]), d.cellOf(top, s[1])
+		cells += (to.lat - from.lat + 1) * (to.lng - from.lng + 1)
+	}
+	if cells > len(d.products) {
+		d.logger.Debug().Str("index", "scan").Msg("bounding box search")
+		for id, p := range d.products {
+			if inside(p) {
+				ids[id] = struct{}{}
+			}
+		}
+		return ids
+	}
+
+	d.logger.Debug().Str("index", "grid").Int("cells", cells).Msg("bounding box search")
+	for _, s := range spans {
+		from, to := d.cellOf(bottom, s[0]), d.cellOf(top, s[1])
+		for lat := from.lat; lat <= to.lat; lat++ {
+			for lng := from.lng; lng <= to.lng; lng++ {
+				for id := range d.grid[cell{lat: lat, lng: lng}] {
+					if inside(d.products[id]) {
+						ids[id] = struct{}{}
+					}
+				}
+			}
+		}
+	}
+	return ids
+}
+
+// matching returns the products whose item names match the term.
+func (d *DB) matching(q repository.TermQuery) map[uint64]struct{} {
+	d.logger.Debug().Str("index", "tokens").Msg("term search")
+
+	ids := map[uint64]struct{}{}
+	for _, group := range q {
+		var groupIDs map[uint64]struct{}
+		for _, part := range group {
+			groupIDs = intersect(groupIDs, d.matchingPart(part))
+		}
+		for id := range groupIDs {
+			ids[id] = struct{}{}
+		}
+	}
+	return ids
+}
+
+// matchingPart returns the products whose item names contain the tokens of
+// the part next to each other, with the last one as a prefix if asked for.
+func (d *DB) matchingPart(part repository.TermPart) map[uint64]struct{} {
+	ids := map[uint64]struct{}{}
+
+	want := repository.Tokenize(part.Text)
+	if len(want) == 0 {
+		return ids
+	}
+
+	// the postings of the first token narrow down the products to check
+	var candidates []map[uint64]struct{}
+	if part.Prefix && len(want) == 1 {
+		for token, postings := range d.tokens {
+			if strings.HasPrefix(token, want[0]) {
+				candidates = append(candidates, postings)
+			}
+		}
+	} else {
+		candidates = append(candidates, d.tokens[want[0]])
+	}
+
+	for _, postings := range candidates {
+		for id := range postings {
+			if repository.ContainsTokens(d.names[id], want, part.Prefix) {
+				ids[id] = struct{}{}
+			}
+		}
+	}
+	return ids
+}
+
+func (d *DB) Create(ctx context.Context, p *domain.Product) (*domain.Product, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	p.ID = d.nextID
+	d.nextID++
+	p.Tenant = tenant.FromContext(ctx)
+	p.Version = 1
+	p.DeletedAt = nil
+	d.index(*p)
+	d.record(audit.NewRevision(ctx, domain.ActionCreate, nil, p))
+	return p, nil
+}
+
+func (d *DB) CreateMany(ctx context.Context, products []*domain.Product) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, p := range products {
+		p.ID = d.nextID
+		d.nextID++
+		p.Tenant = tenant.FromContext(ctx)
+		p.Version = 1
+		p.DeletedAt = nil
+		d.index(*p)
+		d.record(audit.NewRevision(ctx, domain.ActionCreate, nil, p))
+	}
+	return nil
+}
+
+func (d *DB) Get(ctx context.Context, id uint64) (*domain.Product, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	p, ok := d.products[id]
+	if !ok || p.Tenant != tenant.FromContext(ctx) {
+		return nil, fmt.Errorf("not found product: %w", repository.ErrNotFound)
+	}
+	return &p, nil
+}
+
+// Update replaces the stored product.
+func (d *DB) Update(ctx context.Context, p *domain.Product) (*domain.Product, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	old, ok := d.products[p.ID]
+	if !ok || old.Tenant != tenant.FromContext(ctx) {
+		return nil, fmt.Errorf("not found product: %w", repository.ErrNotFound)
+	}
+	if p.Version != 0 && p.Version != old.Version {
+		return nil, fmt.Errorf("stale product: %w", repository.ErrVersionMismatch)
+	}
+
+	p.Tenant = old.Tenant
+	p.Version = old.Version + 1
+	p.DeletedAt = nil
+	d.unindex(old)
+	d.index(*p)
+	d.record(audit.NewRevision(ctx, domain.ActionUpdate, &old, p))
+	return p, nil
+}
+
+func (d *DB) Delete(ctx context.Context, id uint64, version uint64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	p, ok := d.products[id]
+	if !ok || p.Tenant != tenant.FromContext(ctx) {
+		return fmt.Errorf("not found product: %w", repository.ErrNotFound)
+	}
+	if version != 0 && version != p.Version {
+		return fmt.Errorf("stale product: %w", repository.ErrVersionMismatch)
+	}
+	d.unindex(p)
+
+	old := p
+	now := time.Now().UTC()
+	p.DeletedAt = &now
+	d.trash[id] = p
+	d.record(audit.NewRevision(ctx, domain.ActionDelete, &old, &p))
+	return nil
+}
+
+func (d *DB) Trash(ctx context.Context, after uint64, limit int) ([]domain.Product, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	t := tenant.FromContext(ctx)
+	products := make([]domain.Product, 0, len(d.trash))
+	for id, p := range d.trash {
+		if id > after && p.Tenant == t {
+			products = append(products, p)
+		}
+	}
+	sort.Slice(products, func(i, j int) bool { return products[i].ID < products[j].ID })
+	if limit > 0 && len(products) > limit {
+		products = products[:limit]
+	}
+	return products, nil
+}
+
+func (d *DB) Restore(ctx context.Context, id uint64) (*domain.Product, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	p, ok := d.trash[id]
+	if !ok || p.Tenant != tenant.FromContext(ctx) {
+		return nil, fmt.Errorf("not found product in trash: %w", repository.ErrNotFound)
+	}
+	delete(d.trash, id)
+
+	old := p
+	p.DeletedAt = nil
+	p.Version++
+	d.index(p)
+	d.record(audit.NewRevision(ctx, domain.ActionRestore, &old, &p))
+	return &p, nil
+}
+
+func (d *DB) Purge(before time.Time) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var purged int
+	for id, p := range d.trash {
+		if p.DeletedAt.Before(before) {
+			delete(d.trash, id)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+func (d *DB) History(ctx context.Context, id uint64, after uint64, limit int) ([]domain.Revision, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	history := d.ownHistory(ctx, id)
+	if after > uint64(len(history)) {
+		after = uint64(len(history))
+	}
+	history = history[after:]
+	if limit > 0 && len(history) > limit {
+		history = history[:limit]
+	}
+	return append([]domain.Revision(nil), history...), nil
+}
+
+func (d *DB) Revision(ctx context.Context, id uint64, number uint64) (*domain.Revision, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	history := d.ownHistory(ctx, id)
+	if number == 0 || number > uint64(len(history)) {
+		return nil, fmt.Errorf("not found revision: %w", repository.ErrNotFound)
+	}
+	rev := history[number-1]
+	return &rev, nil
+}
+
+// ownHistory returns the history of the product when it belongs to the tenant
+// of ctx. d.mu must be held.
+func (d *DB) ownHistory(ctx context.Context, id uint64) []domain.Revision {
+	history := d.history[id]
+	if len(history) == 0 || history[0].Tenant != tenant.FromContext(ctx) {
+		return nil
+	}
+	return history
+}
+
+// record numbers rev, appends it to the history of its product and writes its
+// event to the outbox. d.mu must be held.
+func (d *DB) record(rev domain.Revision) {
+	rev.Number = uint64(len(d.history[rev.ProductID]) + 1)
+	d.history[rev.ProductID] = append(d.history[rev.ProductID], rev)
+
+	event := rev.Event()
+	event.Offset = uint64(len(d.outbox) + 1)
+	d.outbox = append(d.outbox, event)
+}
+
+func (d *DB) Events(t string, after uint64, limit int) ([]domain.Event, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if after > uint64(len(d.outbox)) {
+		after = uint64(len(d.outbox))
+	}
+
+	var events []domain.Event
+	for _, e := range d.outbox[after:] {
+		if limit > 0 && len(events) == limit {
+			break
+		}
+		if t == "" || e.Tenant == t {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+func (d *DB) Offset(consumer string) (uint64, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return d.offsets[consumer], nil
+}
+
+func (d *DB) SetOffset(consumer string, offset uint64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.offsets[consumer] = offset
+	return nil
+}
+
+// index stores p and adds it to the grid and token index. d.mu must be held.
+func (d *DB) index(p domain.Product) {
+	d.products[p.ID] = p
+
+	c := d.cellOf(p.Lat, p.Lng)
+	if d.grid[c] == nil {
+		d.grid[c] = map[uint64]struct{}{}
+	}
+	d.grid[c][p.ID] = struct{}{}
+
+	name := repository.Tokenize(p.ItemName)
+	d.names[p.ID] = name
+	for _, token := range name {
+		if d.tokens[token] == nil {
+			d.tokens[token] = map[uint64]struct{}{}
+		}
+		d.tokens[token][p.ID] = struct{}{}
+	}
+}
+
+// unindex removes p from the store and indexes. d.mu must be held.
+func (d *DB) unindex(p domain.Product) {
+	delete(d.products, p.ID)
+
+	c := d.cellOf(p.Lat, p.Lng)
+	delete(d.grid[c], p.ID)
+	if len(d.grid[c]) == 0 {
+		delete(d.grid, c)
+	}
+
+	for _, token := range d.names[p.ID] {
+		delete(d.tokens[token], p.ID)
+		if len(d.tokens[token]) == 0 {
+			delete(d.tokens, token)
+		}
+	}
+	delete(d.names, p.ID)
+}
+
+func (d *DB) cellOf(lat, lng float64) cell {
+	return cell{
+		lat: int(math.Floor(lat / d.cellSize)),
+		lng: int(math.Floor(lng / d.cellSize)),
+	}
+}
+
+// intersect returns the ids in both a and b, a nil set means all ids.
+func intersect(a, b map[uint64]struct{}) map[uint64]struct{} {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+
+	ids := map[uint64]struct{}{}
+	for id := range a {
+		if _, ok := b[id]; ok {
+			ids[id] = struct{}{}
+		}
+	}
+	return ids
+}
@@ -0,0 +1,65 @@
+package memory_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mustafadubul/product/internal/domain"
+	"github.com/mustafadubul/product/internal/repository"
+	"github.com/mustafadubul/product/internal/repository/memory"
+	"github.com/mustafadubul/product/internal/repository/repositorytest"
+	"github.com/mustafadubul/product/pkg/geo"
+	"github.com/stretchr/testify/assert"
+)
+
+var ctx = context.Background()
+
+func TestRepositoryContract(t *testing.T) {
+	repositorytest.Run(t, func(t *testing.T) repository.Product {
+		return memory.New()
+	})
+}
+
+func TestSearchAcrossCells(t *testing.T) {
+	db := memory.New()
+
+	// spread over the cells around the prime meridian and the equator
+	products := []*domain.Product{
+		{ItemName: "camera", Lat: 0.05, Lng: -0.05},
+		{ItemName: "camera", Lat: -0.05, Lng: 0.05},
+		{ItemName: "camera", Lat: -0.15, Lng: -0.15},
+		{ItemName: "camera", Lat: 0.25, Lng: 0.25},
+		{ItemName: "camera", Lat: 5, Lng: 5},
+	}
+	for i := 0; i < 100; i++ {
+		products = append(products, &domain.Product{ItemName: "camera", Lat: 40, Lng: 40})
+	}
+	for _, p := range products {
+		_, err := db.Create(ctx, p)
+		assert.Nil(t, err)
+	}
+
+	found, err := db.Search(ctx, repository.Filter{Box: geo.BoundingBox(0, 0, 30000)})
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(found))
+
+	// a box covering more cells than there are products falls back to a scan
+	found, err = db.Search(ctx, repository.Filter{Box: geo.BoundingBox(0, 0, 2000000)})
+	assert.Nil(t, err)
+	assert.Equal(t, 5, len(found))
+}
+
+func TestSearchReturnsCopies(t *testing.T) {
+	db := memory.New()
+
+	_, err := db.Create(ctx, &domain.Product{ItemName: "camera"})
+	assert.Nil(t, err)
+
+	found, err := db.Search(ctx, repository.Filter{Term: "camera"})
+	assert.Nil(t, err)
+	found[0].ItemName = "changed"
+
+	p, err := db.Get(ctx, found[0].ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "camera", p.ItemName)
+}
@@ -0,0 +1,96 @@
+package memory
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/mustafadubul/product/internal/domain"
+	"github.com/mustafadubul/product/internal/repository"
+)
+
+func (d *DB) CreateSavedSearch(s *domain.SavedSearch) (*domain.SavedSearch, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.nextSavedSearchID++
+	s.ID = d.nextSavedSearchID
+	d.savedSearches[s.ID] = *s
+	return s, nil
+}
+
+func (d *DB) SavedSearch(id uint64) (*domain.SavedSearch, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	s, ok := d.savedSearches[id]
+	if !ok {
+		return nil, fmt.Errorf("not found saved search: %w", repository.ErrNotFound)
+	}
+	return &s, nil
+}
+
+func (d *DB) SavedSearches(owner string) ([]domain.SavedSearch, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	var searches []domain.SavedSearch
+	for _, s := range d.savedSearches {
+		if owner == "" || s.Owner == owner {
+			searches = append(searches, s)
+		}
+	}
+	sort.Slice(searches, func(i, j int) bool { return searches[i].ID < searches[j].ID })
+	return searches, nil
+}
+
+func (d *DB) DeleteSavedSearch(id uint64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.savedSearches[id]; !ok {
+		return fmt.Errorf("not found saved search: %w", repository.ErrNotFound)
+	}
+	delete(d.savedSearches, id)
+
+	kept := d.matches[:0]
+	for _, m := range d.matches {
+		if m.SavedSearchID != id {
+			kept = append(kept, m)
+		}
+	}
+	d.matches = kept
+	return nil
+}
+
+func (d *DB) AddMatch(m *domain.Match) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, stored := range d.matches {
+		if stored.SavedSearchID == m.SavedSearchID && stored.ProductID == m.ProductID {
+			return false, nil
+		}
+	}
+
+	d.nextMatchID++
+	m.ID = d.nextMatchID
+	d.matches = append(d.matches, *m)
+	return true, nil
+}
+
+func (d *DB) Matches(savedSearchID uint64, after uint64, limit int) ([]domain.Match, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	var matches []domain.Match
+	for _, m := range d.matches {
+		if m.SavedSearchID != savedSearchID || m.ID <= after {
+			continue
+		}
+		if limit > 0 && len(matches) == limit {
+			break
+		}
+		matches = append(matches, m)
+	}
+	return matches, nil
+}
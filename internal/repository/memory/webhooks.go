@@ -0,0 +1,79 @@
+package memory
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/mustafadubul/product/internal/domain"
+	"github.com/mustafadubul/product/internal/repository"
+)
+
+func (d *DB) CreateWebhook(w *domain.Webhook) (*domain.Webhook, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.nextWebhookID++
+	w.ID = d.nextWebhookID
+	d.webhooks[w.ID] = *w
+	return w, nil
+}
+
+func (d *DB) Webhooks() ([]domain.Webhook, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	webhooks := make([]domain.Webhook, 0, len(d.webhooks))
+	for _, w := range d.webhooks {
+		webhooks = append(webhooks, w)
+	}
+	sort.Slice(webhooks, func(i, j int) bool { return webhooks[i].ID < webhooks[j].ID })
+	return webhooks, nil
+}
+
+func (d *DB) DeleteWebhook(id uint64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.webhooks[id]; !ok {
+		return fmt.Errorf("not found webhook: %w", repository.ErrNotFound)
+	}
+	delete(d.webhooks, id)
+
+	kept := d.deadLetters[:0]
+	for _, dl := range d.deadLetters {
+		if dl.WebhookID != id {
+			kept = append(kept, dl)
+		}
+	}
+	d.deadLetters = kept
+	return nil
+}
+
+// AddDeadLetter numbers the dead letters across all webhooks, like the SQL
+// backends do.
+func (d *DB) AddDeadLetter(dl *domain.DeadLetter) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.nextDeadLetterID++
+	dl.ID = d.nextDeadLetterID
+	d.deadLetters = append(d.deadLetters, *dl)
+	return nil
+}
+
+func (d *DB) DeadLetters(webhookID uint64, after uint64, limit int) ([]domain.DeadLetter, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	var deadLetters []domain.DeadLetter
+	for _, dl := range d.deadLetters {
+		if dl.WebhookID != webhookID || dl.ID <= after {
+			continue
+		}
+		if limit > 0 && len(deadLetters) == limit {
+			break
+		}
+		deadLetters = append(deadLetters, dl)
+	}
+	return deadLetters, nil
+}
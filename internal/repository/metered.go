@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/mustafadubul/product/internal/domain"
+	"github.com/mustafadubul/product/internal/metrics"
+)
+
+// searchResultBuckets are the upper bounds of the buckets of the number of
+// products a search returns.
+var searchResultBuckets = []float64{0, 1, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000}
+
+type metered struct {
+	Product
+	duration *metrics.Histogram
+	results  *metrics.Histogram
+}
+
+// Metered returns p recording the time its Search, Get, Create, Update and
+// Delete queries take and the number of products its searches return in reg.
+func Metered(p Product, reg *metrics.Registry) Product {
+	return &metered{
+		Product: p,
+		duration: reg.Histogram("repository_query_duration_seconds", "Time taken by the queries of the repository.",
+			metrics.DefaultBuckets, "operation"),
+		results: reg.Histogram("repository_search_results", "Number of products returned by the searches of the repository.",
+			searchResultBuckets),
+	}
+}
+
+func (m *metered) observe(operation string, start time.Time) {
+	m.duration.Observe(time.Since(start).Seconds(), operation)
+}
+
+func (m *metered) Search(ctx context.Context, f Filter) ([]domain.Product, error) {
+	defer m.observe("search", time.Now())
+	products, err := m.Product.Search(ctx, f)
+	if err == nil {
+		m.results.Observe(float64(len(products)))
+	}
+	return products, err
+}
+
+func (m *metered) Get(ctx context.Context, id uint64) (*domain.Product, error) {
+	defer m.observe("get", time.Now())
+	return m.Product.Get(ctx, id)
+}
+
+func (m *metered) Create(ctx context.Context, p *domain.Product) (*domain.Product, error) {
+	defer m.observe("create", time.Now())
+	return m.Product.Create(ctx, p)
+}
+
+func (m *metered) Update(ctx context.Context, p *domain.Product) (*domain.Product, error) {
+	defer m.observe("update", time.Now())
+	return m.Product.Update(ctx, p)
+}
+
+func (m *metered) Delete(ctx context.Context, id uint64, version uint64) error {
+	defer m.observe("delete", time.Now())
+	return m.Product.Delete(ctx, id, version)
+}
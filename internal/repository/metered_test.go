@@ -0,0 +1,47 @@
+package repository_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/mustafadubul/product/internal/domain"
+	"github.com/mustafadubul/product/internal/metrics"
+	"github.com/mustafadubul/product/internal/repository"
+	"github.com/mustafadubul/product/internal/repository/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetered(t *testing.T) {
+	reg := metrics.NewRegistry()
+	repo := repository.Metered(memory.New(), reg)
+	ctx := context.Background()
+
+	for _, name := range []string{"camera", "camera lens"} {
+		_, err := repo.Create(ctx, &domain.Product{ItemName: name})
+		assert.NoError(t, err)
+	}
+	_, err := repo.Get(ctx, 1)
+	assert.NoError(t, err)
+	found, err := repo.Search(ctx, repository.Filter{Term: "camera"})
+	assert.NoError(t, err)
+	assert.Len(t, found, 2)
+	// the other methods reach the wrapped repository
+	trash, err := repo.Trash(ctx, 0, 10)
+	assert.NoError(t, err)
+	assert.Empty(t, trash)
+
+	out := scrape(t, reg)
+	assert.Contains(t, out, `repository_query_duration_seconds_count{operation="create"} 2`)
+	assert.Contains(t, out, `repository_query_duration_seconds_count{operation="get"} 1`)
+	assert.Contains(t, out, `repository_query_duration_seconds_count{operation="search"} 1`)
+	assert.Contains(t, out, `repository_search_results_bucket{le="1"} 0`)
+	assert.Contains(t, out, `repository_search_results_bucket{le="5"} 1`)
+	assert.Contains(t, out, `repository_search_results_sum 2`)
+}
+
+func scrape(t *testing.T, reg *metrics.Registry) string {
+	var b strings.Builder
+	assert.NoError(t, reg.Write(&b))
+	return b.String()
+}
@@ -0,0 +1,115 @@
+package postgres
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/mustafadubul/product/internal/domain"
+	"github.com/mustafadubul/product/internal/repository"
+	"github.com/mustafadubul/product/internal/repository/gormstore"
+)
+
+// event is a row of the outbox table, the ID is the offset of the event. The
+// event is stored as JSON.
+type event struct {
+	ID        uint64    `gorm:"column:id;primary_key"`
+	Tenant    string    `gorm:"column:tenant;not null;default:'default';index"`
+	Type      string    `gorm:"column:type;not null"`
+	ProductID uint64    `gorm:"column:product_id;not null"`
+	CreatedAt time.Time `gorm:"column:created_at;not null"`
+	Payload   string    `gorm:"column:payload;type:text;not null"`
+}
+
+func (event) TableName() string {
+	return "outbox"
+}
+
+// offset is how far a consumer got through the outbox.
+type offset struct {
+	Consumer string `gorm:"column:consumer;primary_key"`
+	Offset   uint64 `gorm:"column:last_offset;not null"`
+}
+
+func (offset) TableName() string {
+	return "outbox_offsets"
+}
+
+// outboxLock is the key of the advisory lock publish takes.
+const outboxLock = 7301842
+
+// record appends rev to the history of its product and publishes its event.
+// It runs in the transaction of the write the revision is of, which holds the
+// lock on the row of the product, so numbers are taken in the order of the
+// writes.
+func record(tx *gorm.DB, rev domain.Revision) error {
+	if err := gormstore.Record(tx, &rev); err != nil {
+		return err
+	}
+	return publish(tx, rev.Event())
+}
+
+// publish writes e to the outbox. It runs in the transaction of the write the
+// event is of. Sequence values are handed out when rows are inserted, not when
+// they commit, so the transaction holds an advisory lock until it ends to keep
+// a consumer from reading an offset before a lower one commits.
+func publish(tx *gorm.DB, e domain.Event) error {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to publish event: %w", repository.ErrFatal)
+	}
+
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", outboxLock).Error; err != nil {
+		return fmt.Errorf("failed to publish event: %w", repository.ErrFatal)
+	}
+
+	row := &event{Tenant: e.Tenant, Type: e.Type, ProductID: e.ProductID, CreatedAt: e.At, Payload: string(payload)}
+	if err := tx.Create(row).Error; err != nil {
+		return fmt.Errorf("failed to publish event: %w", repository.ErrFatal)
+	}
+	return nil
+}
+
+func (d *DB) Events(tenant string, after uint64, limit int) ([]domain.Event, error) {
+	var rows []event
+	q := d.db.Where("id > ?", after).Order("id")
+	if tenant != "" {
+		q = q.Where("tenant = ?", tenant)
+	}
+	if limit > 0 {
+		q = q.Limit(limit)
+	}
+	if err := q.Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to read events: %w", repository.ErrFatal)
+	}
+
+	events := make([]domain.Event, len(rows))
+	for i, row := range rows {
+		if err := json.Unmarshal([]byte(row.Payload), &events[i]); err != nil {
+			return nil, fmt.Errorf("failed to read events: %w", repository.ErrFatal)
+		}
+		events[i].Offset = row.ID
+	}
+	return events, nil
+}
+
+func (d *DB) Offset(consumer string) (uint64, error) {
+	var row offset
+	err := d.db.Where("consumer = ?", consumer).First(&row).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to read offset: %w", repository.ErrFatal)
+	}
+	return row.Offset, nil
+}
+
+func (d *DB) SetOffset(consumer string, o uint64) error {
+	if err := d.db.Save(&offset{Consumer: consumer, Offset: o}).Error; err != nil {
+		return fmt.Errorf("failed to store offset: %w", repository.ErrFatal)
+	}
+	return nil
+}
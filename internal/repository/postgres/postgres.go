@@ -0,0 +1,450 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/postgres"
+	"github.com/mustafadubul/product/internal/audit"
+	"github.com/mustafadubul/product/internal/domain"
+	"github.com/mustafadubul/product/internal/repository"
+	"github.com/mustafadubul/product/internal/repository/gormstore"
+	"github.com/mustafadubul/product/internal/repository/gormtrace"
+	"github.com/mustafadubul/product/internal/tenant"
+	"github.com/rs/zerolog"
+)
+
+type DB struct {
+	*gormstore.Store
+
+	db     *gorm.DB
+	logger *zerolog.Logger
+}
+
+// schema adds a PostGIS geography and a tsvector column to items. Both are
+// kept in sync by a trigger, so the repository only ever writes the fields of
+// domain.Product.
+var schema = []string{
+	`CREATE EXTENSION IF NOT EXISTS postgis`,
+	`CREATE EXTENSION IF NOT EXISTS pg_trgm`,
+	`ALTER TABLE items ADD COLUMN IF NOT EXISTS geog geography(Point, 4326)`,
+	`ALTER TABLE items ADD COLUMN IF NOT EXISTS search tsvector`,
+	`CREATE OR REPLACE FUNCTION items_index() RETURNS trigger AS $$
+	BEGIN
+		NEW.geog := ST_SetSRID(ST_MakePoint(NEW.lng, NEW.lat), 4326)::geography;
+		NEW.search := to_tsvector('english', coalesce(NEW.item_name, ''));
+		RETURN NEW;
+	END
+	$$ LANGUAGE plpgsql`,
+	`DROP TRIGGER IF EXISTS items_index ON items`,
+	`CREATE TRIGGER items_index BEFORE INSERT OR UPDATE ON items
+		FOR EACH ROW EXECUTE PROCEDURE items_index()`,
+	`CREATE INDEX IF NOT EXISTS items_geog_idx ON items USING GIST (geog)`,
+	`CREATE INDEX IF NOT EXISTS items_search_idx ON items USING GIN (search)`,
+	`CREATE INDEX IF NOT EXISTS items_item_name_trgm_idx ON items USING GIN (item_name gin_trgm_ops)`,
+	`UPDATE items SET id = id WHERE geog IS NULL OR search IS NULL`,
+}
+
+// Open connects to PostgreSQL, dsn is either a URL or a list of key=value
+// connection parameters.
+func Open(dsn string) (*gorm.DB, error) {
+	return gorm.Open("postgres", dsn)
+}
+
+func New(db *gorm.DB) *DB {
+	gormtrace.Register(db, "postgresql")
+	componentLogger := zerolog.New(os.Stdout).With().Str("component", "repository").Logger()
+	return &DB{
+		Store:  gormstore.New(db),
+		db:     db,
+		logger: &componentLogger,
+	}
+}
+
+func (d *DB) Close() error {
+	return d.db.Close()
+}
+
+// Migrate creates the items table with its spatial and full text indexes, the
+// revisions, outbox, webhooks and saved searches tables. The database needs
+// the postgis and pg_trgm extensions to be installed.
+func (d *DB) Migrate() error {
+	if err := d.db.AutoMigrate(&domain.Product{}).Error; err != nil {
+		return fmt.Errorf("failed to migrate items: %w", err)
+	}
+	if err := gormstore.MigrateHistory(d.db); err != nil {
+		return err
+	}
+	if err := d.db.AutoMigrate(&event{}, &offset{}).Error; err != nil {
+		return fmt.Errorf("failed to migrate outbox: %w", err)
+	}
+	if err := gormstore.MigrateWebhooks(d.db); err != nil {
+		return err
+	}
+	if err := gormstore.MigrateSavedSearches(d.db); err != nil {
+		return err
+	}
+
+	tx := d.db.Begin()
+	for _, stmt := range schema {
+		if err := tx.Exec(stmt).Error; err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to migrate items: %w", err)
+		}
+	}
+	return tx.Commit().Error
+}
+
+// Search returns the products matching the filter. Every call builds its own
+// query, so searches are safe to run concurrently.
+func (d *DB) Search(ctx context.Context, f repository.Filter) ([]domain.Product, error) {
+	var products []domain.Product
+
+	tx := page(d.query(ctx, f), f)
+	if err := tx.Find(&products).Error; err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+func (d *DB) Each(ctx context.Context, f repository.Filter, fn func(p *domain.Product) error) error {
+	tx := page(d.query(ctx, f).Model(&domain.Product{}).Select(columns), f)
+	rows, err := tx.Rows()
+	if err != nil {
+		return fmt.Errorf("failed to read products: %w", repository.ErrFatal)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p domain.Product
+		if err := d.db.ScanRows(rows, &p); err != nil {
+			return fmt.Errorf("failed to read products: %w", repository.ErrFatal)
+		}
+		if err := fn(&p); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read products: %w", repository.ErrFatal)
+	}
+	return nil
+}
+
+// columns are the columns of domain.Product, leaving out the geog and search
+// columns only the indexes use.
+const columns = "id, tenant, item_name, lat, lng, image_url, url, version, deleted_at"
+
+// query returns the products of the tenant of ctx matching the filter,
+// unordered and unlimited.
+func (d *DB) query(ctx context.Context, f repository.Filter) *gorm.DB {
+	tx := scoped(ctx, d.conn(ctx))
+	switch {
+	case f.Within != nil:
+		d.logger.Debug().Str("index", "items_geog_idx").Msg("radius search")
+		tx = tx.Where("ST_DWithin(geog, ST_SetSRID(ST_MakePoint(?, ?), 4326)::geography, ?)",
+			f.Within.Lng, f.Within.Lat, f.Within.Radius)
+	case len(f.Box) == 4:
+		tx = d.box(tx, f.Box)
+	}
+	if f.Term != "" {
+		tx = d.match(tx, f.Term)
+	}
+	return tx
+}
+
+// box filters on the bounding box given by its top, right, bottom and left
+// points. A box crossing the antimeridian is searched as the two envelopes on
+// either side of it, and one holding every longitude on the latitudes alone.
+func (d *DB) box(tx *gorm.DB, points []domain.Point) *gorm.DB {
+	top, right, bottom, left := points[0].X, points[1].Y, points[2].X, points[3].Y
+	switch {
+	case left == -180 && right == 180:
+		d.logger.Debug().Str("index", "scan").Msg("bounding box search")
+		return tx.Where("lat >= ? AND lat <= ?", bottom, top)
+	case left > right:
+		d.logger.Debug().Str("index", "items_geog_idx").Msg("bounding box search")
+		return tx.Where("(geog && ST_MakeEnvelope(?, ?, 180, ?, 4326)::geography OR geog && ST_MakeEnvelope(-180, ?, ?, ?, 4326)::geography)",
+			left, bottom, top, bottom, right, top)
+	default:
+		d.logger.Debug().Str("index", "items_geog_idx").Msg("bounding box search")
+		return tx.Where("geog && ST_MakeEnvelope(?, ?, ?, ?, 4326)::geography",
+			left, bottom, right, top)
+	}
+}
+
+// page orders the products as the filter asks, leaves out those up to f.After
+// and applies the limit. Distances are measured on the sphere, which orders
+// products like the haversine distance the service ranks them by. The after
+// product is compared on the same expression as the rows, so the comparison
+// is exact.
+func page(tx *gorm.DB, f repository.Filter) *gorm.DB {
+	if f.Order == repository.OrderDistance {
+		c := f.Within
+		if f.After != nil {
+			tx = tx.Where(`(ST_Distance(geog, ST_SetSRID(ST_MakePoint(?, ?), 4326)::geography, false), id) >
+				(ST_Distance(ST_SetSRID(ST_MakePoint(?, ?), 4326)::geography, ST_SetSRID(ST_MakePoint(?, ?), 4326)::geography, false), ?)`,
+				c.Lng, c.Lat, f.After.Lng, f.After.Lat, c.Lng, c.Lat, f.After.ID)
+		}
+		tx = tx.Order(gorm.Expr("ST_Distance(geog, ST_SetSRID(ST_MakePoint(?, ?), 4326)::geography, false), id", c.Lng, c.Lat))
+	} else {
+		if f.After != nil {
+			tx = tx.Where("id > ?", f.After.ID)
+		}
+		tx = tx.Order("id")
+	}
+
+	if f.Limit > 0 {
+		tx = tx.Limit(f.Limit)
+	}
+	return tx
+}
+
+// match filters on the tsvector of the item names. Single words fall back on
+// trigram word similarity so misspelt words still find their items.
+func (d *DB) match(tx *gorm.DB, term string) *gorm.DB {
+	q := repository.ParseTerm(term)
+	if len(q) == 0 {
+		return tx
+	}
+
+	d.logger.Debug().Str("index", "items_search_idx").Msg("term search")
+	where, args := tsquery(q)
+	return tx.Where(where, args...)
+}
+
+// tsquery renders the query as conditions on the search column. Every part
+// is passed as an argument so user input can never produce an invalid
+// expression.
+func tsquery(q repository.TermQuery) (string, []interface{}) {
+	var args []interface{}
+
+	groups := make([]string, 0, len(q))
+	for _, group := range q {
+		parts := make([]string, 0, len(group))
+		for _, p := range group {
+			switch {
+			case p.Prefix:
+				parts = append(parts, "search @@ to_tsquery('english', quote_literal(?) || ':*')")
+				args = append(args, p.Text)
+			case strings.ContainsAny(p.Text, " \t"):
+				parts = append(parts, "search @@ phraseto_tsquery('english', ?)")
+				args = append(args, p.Text)
+			default:
+				parts = append(parts, "(search @@ phraseto_tsquery('english', ?) OR ? <% item_name)")
+				args = append(args, p.Text, p.Text)
+			}
+		}
+		groups = append(groups, "("+strings.Join(parts, " AND ")+")")
+	}
+	return strings.Join(groups, " OR "), args
+}
+
+func (d *DB) Create(ctx context.Context, p *domain.Product) (*domain.Product, error) {
+	err := d.conn(ctx).Transaction(func(tx *gorm.DB) error {
+		return create(ctx, tx, p)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (d *DB) CreateMany(ctx context.Context, products []*domain.Product) error {
+	return d.conn(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, p := range products {
+			if err := create(ctx, tx, p); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// create inserts p at version 1 for the tenant of ctx and records its first
+// revision.
+func create(ctx context.Context, tx *gorm.DB, p *domain.Product) error {
+	p.ID = 0
+	p.Tenant = tenant.FromContext(ctx)
+	p.Version = 1
+	p.DeletedAt = nil
+	if err := tx.Create(p).Error; err != nil {
+		return fmt.Errorf("failed to insert product: %w", repository.ErrFatal)
+	}
+	return record(tx, audit.NewRevision(ctx, domain.ActionCreate, nil, p))
+}
+
+func (d *DB) Get(ctx context.Context, id uint64) (*domain.Product, error) {
+	var product domain.Product
+
+	err := scoped(ctx, d.conn(ctx)).First(&product, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("not found product: %w", repository.ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to get product: %w", repository.ErrFatal)
+	}
+
+	return &product, nil
+}
+
+// Update replaces the stored product with p and bumps the version in a single
+// conditional statement.
+func (d *DB) Update(ctx context.Context, p *domain.Product) (*domain.Product, error) {
+	var stored domain.Product
+	err := d.conn(ctx).Transaction(func(tx *gorm.DB) error {
+		var before domain.Product
+		if err := forUpdate(scoped(ctx, tx)).First(&before, p.ID).Error; err != nil {
+			return notFoundOr(err, "failed to update product")
+		}
+
+		q := scoped(ctx, tx.Model(&domain.Product{})).Where("id = ?", p.ID)
+		if p.Version != 0 {
+			q = q.Where("version = ?", p.Version)
+		}
+		res := q.Updates(changes(p))
+		if err := res.Error; err != nil {
+			return fmt.Errorf("failed to update product: %w", repository.ErrFatal)
+		}
+		if res.RowsAffected == 0 {
+			return missingOrStale(tx, p.ID)
+		}
+		if err := tx.First(&stored, p.ID).Error; err != nil {
+			return fmt.Errorf("failed to update product: %w", repository.ErrFatal)
+		}
+		return record(tx, audit.NewRevision(ctx, domain.ActionUpdate, &before, &stored))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &stored, nil
+}
+
+// changes are the columns Update writes. Every field is written, so zero
+// values clear the stored ones.
+func changes(p *domain.Product) map[string]interface{} {
+	return map[string]interface{}{
+		"item_name": p.ItemName,
+		"lat":       p.Lat,
+		"lng":       p.Lng,
+		"image_url": p.ImageURL,
+		"url":       p.URL,
+		"version":   gorm.Expr("version + 1"),
+	}
+}
+
+// Delete sets deleted_at, gorm leaves the rows that have it out of every
+// query that is not Unscoped.
+func (d *DB) Delete(ctx context.Context, id uint64, version uint64) error {
+	return d.conn(ctx).Transaction(func(tx *gorm.DB) error {
+		var before domain.Product
+		if err := forUpdate(scoped(ctx, tx)).First(&before, id).Error; err != nil {
+			return notFoundOr(err, "failed to delete product")
+		}
+
+		q := scoped(ctx, tx.Model(&domain.Product{})).Where("id = ?", id)
+		if version != 0 {
+			q = q.Where("version = ?", version)
+		}
+		res := q.Updates(map[string]interface{}{"deleted_at": time.Now().UTC()})
+		if err := res.Error; err != nil {
+			return fmt.Errorf("failed to delete product: %w", repository.ErrFatal)
+		}
+		if res.RowsAffected == 0 {
+			return missingOrStale(tx, id)
+		}
+
+		var deleted domain.Product
+		if err := tx.Unscoped().First(&deleted, id).Error; err != nil {
+			return fmt.Errorf("failed to delete product: %w", repository.ErrFatal)
+		}
+		return record(tx, audit.NewRevision(ctx, domain.ActionDelete, &before, &deleted))
+	})
+}
+
+func (d *DB) Trash(ctx context.Context, after uint64, limit int) ([]domain.Product, error) {
+	var products []domain.Product
+	err := scoped(ctx, d.conn(ctx).Unscoped()).Where("deleted_at IS NOT NULL AND id > ?", after).Order("id").Limit(limit).Find(&products).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list trash: %w", repository.ErrFatal)
+	}
+	return products, nil
+}
+
+func (d *DB) Restore(ctx context.Context, id uint64) (*domain.Product, error) {
+	var restored domain.Product
+	err := d.conn(ctx).Transaction(func(tx *gorm.DB) error {
+		var before domain.Product
+		if err := forUpdate(scoped(ctx, tx.Unscoped())).Where("deleted_at IS NOT NULL").First(&before, id).Error; err != nil {
+			return notFoundOr(err, "failed to restore product")
+		}
+
+		res := tx.Unscoped().Model(&domain.Product{}).Where("id = ? AND deleted_at IS NOT NULL", id).
+			Updates(map[string]interface{}{"deleted_at": nil, "version": gorm.Expr("version + 1")})
+		if err := res.Error; err != nil {
+			return fmt.Errorf("failed to restore product: %w", repository.ErrFatal)
+		}
+		if res.RowsAffected == 0 {
+			return fmt.Errorf("not found product in trash: %w", repository.ErrNotFound)
+		}
+		if err := tx.First(&restored, id).Error; err != nil {
+			return fmt.Errorf("failed to restore product: %w", repository.ErrFatal)
+		}
+		return record(tx, audit.NewRevision(ctx, domain.ActionRestore, &before, &restored))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &restored, nil
+}
+
+func (d *DB) Purge(before time.Time) (int, error) {
+	res := d.db.Unscoped().Where("deleted_at IS NOT NULL AND deleted_at < ?", before.UTC()).Delete(&domain.Product{})
+	if err := res.Error; err != nil {
+		return 0, fmt.Errorf("failed to purge trash: %w", repository.ErrFatal)
+	}
+	return int(res.RowsAffected), nil
+}
+
+// forUpdate locks the rows the query reads until the transaction ends, so the
+// product a revision is diffed against can not change under the write.
+func forUpdate(tx *gorm.DB) *gorm.DB {
+	return tx.Set("gorm:query_option", "FOR UPDATE")
+}
+
+// conn returns the connection to query for ctx, tracing the statements within
+// the span of ctx.
+func (d *DB) conn(ctx context.Context) *gorm.DB {
+	return gormtrace.WithContext(ctx, d.db)
+}
+
+// scoped narrows tx to the rows of the tenant of ctx.
+func scoped(ctx context.Context, tx *gorm.DB) *gorm.DB {
+	return tx.Where("tenant = ?", tenant.FromContext(ctx))
+}
+
+// notFoundOr maps a record not found to ErrNotFound and any other error to
+// ErrFatal.
+func notFoundOr(err error, msg string) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("not found product: %w", repository.ErrNotFound)
+	}
+	return fmt.Errorf("%s: %w", msg, repository.ErrFatal)
+}
+
+// missingOrStale tells why a conditional write of the product did not change
+// any row.
+func missingOrStale(tx *gorm.DB, id uint64) error {
+	var count int
+	if err := tx.Model(&domain.Product{}).Where("id = ?", id).Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to check product: %w", repository.ErrFatal)
+	}
+	if count == 0 {
+		return fmt.Errorf("not found product: %w", repository.ErrNotFound)
+	}
+	return fmt.Errorf("stale product: %w", repository.ErrVersionMismatch)
+}
@@ -0,0 +1,163 @@
+package postgres_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/mustafadubul/product/internal/domain"
+	"github.com/mustafadubul/product/internal/repository"
+	"github.com/mustafadubul/product/internal/repository/postgres"
+	"github.com/mustafadubul/product/internal/repository/repositorytest"
+	"github.com/stretchr/testify/assert"
+)
+
+var ctx = context.Background()
+
+// StartTestDB connects to the database in POSTGRES_DSN, e.g. the postgis
+// service of docker-compose.test.yml, and empties every table. Tests are
+// skipped when it is not set.
+func StartTestDB(t *testing.T) *postgres.DB {
+	dsn := os.Getenv("POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("POSTGRES_DSN not set")
+	}
+
+	// the database may still be starting up when the tests start
+	db, err := postgres.Open(dsn)
+	for i := 0; err != nil && i < 30; i++ {
+		time.Sleep(time.Second)
+		db, err = postgres.Open(dsn)
+	}
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+
+	repo := postgres.New(db)
+	assert.Nil(t, repo.Migrate())
+	assert.Nil(t, db.Exec("TRUNCATE items, revisions, outbox, outbox_offsets, webhooks, dead_letters, saved_searches, saved_search_matches RESTART IDENTITY CASCADE").Error)
+
+	return repo
+}
+
+func TestCreateGetProduct(t *testing.T) {
+	db := StartTestDB(t)
+	defer db.Close()
+
+	expectedProduct := &domain.Product{
+		ItemName: "camera",
+		Lat:      51.509865,
+		Lng:      -0.118092,
+	}
+
+	p, err := db.Create(ctx, expectedProduct)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), p.ID)
+
+	product, err := db.Get(ctx, p.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, expectedProduct, product)
+
+	_, err = db.Get(ctx, 99)
+	assert.True(t, errors.Is(err, repository.ErrNotFound))
+}
+
+func TestUpdateDeleteProduct(t *testing.T) {
+	db := StartTestDB(t)
+	defer db.Close()
+
+	p, err := db.Create(ctx, &domain.Product{ItemName: "camera", Lat: 48.864716, Lng: 2.349014})
+	assert.Nil(t, err)
+
+	_, err = db.Update(ctx, &domain.Product{ID: p.ID, ItemName: "Canon", Lat: 51.509865, Lng: -0.118092})
+	assert.Nil(t, err)
+
+	found, err := db.Search(ctx, repository.Filter{
+		Term:   "canon",
+		Within: &repository.Circle{Lat: 51.509865, Lng: -0.118092, Radius: 10},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(found))
+
+	assert.Nil(t, db.Delete(ctx, p.ID, 0))
+
+	_, err = db.Get(ctx, p.ID)
+	assert.NotNil(t, err)
+}
+
+func TestSearchWithin(t *testing.T) {
+	db := StartTestDB(t)
+	defer db.Close()
+
+	products := []*domain.Product{
+		{ItemName: "camera london", Lat: 51.509865, Lng: -0.118092},
+		{ItemName: "camera london 500m north", Lat: 51.514362, Lng: -0.118092},
+		{ItemName: "camera paris", Lat: 48.864716, Lng: 2.349014},
+	}
+	for _, p := range products {
+		_, err := db.Create(ctx, p)
+		assert.Nil(t, err)
+	}
+
+	p, err := db.Search(ctx, repository.Filter{Within: &repository.Circle{Lat: 51.509865, Lng: -0.118092, Radius: 100}})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(p))
+
+	p, err = db.Search(ctx, repository.Filter{Within: &repository.Circle{Lat: 51.509865, Lng: -0.118092, Radius: 1000}})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(p))
+
+	p, err = db.Search(ctx, repository.Filter{Box: []domain.Point{
+		{X: 48.87, Y: 2.349014},
+		{X: 48.864716, Y: 2.35},
+		{X: 48.86, Y: 2.349014},
+		{X: 48.864716, Y: 2.34},
+	}})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(p))
+}
+
+func TestSearchTerm(t *testing.T) {
+	db := StartTestDB(t)
+	defer db.Close()
+
+	products := []*domain.Product{
+		{ItemName: "Canon 50mm f/1.2 Prime Lens"},
+		{ItemName: "Canon 6D +24-70mm F4 L/35mm + Microphone + LED Lights"},
+		{ItemName: "Go Pro Hero - Full HD"},
+		{ItemName: "Nikon D750 Camera"},
+	}
+	for _, p := range products {
+		_, err := db.Create(ctx, p)
+		assert.Nil(t, err)
+	}
+
+	tests := []struct {
+		term     string
+		expected int
+	}{
+		{"canon", 2},
+		{"canon lens", 1},
+		{"canon OR nikon", 3},
+		{"cam*", 1},
+		{`"prime lens"`, 1},
+		{"microphones", 1},
+		{"nikkon", 1},
+	}
+
+	for _, tt := range tests {
+		p, err := db.Search(ctx, repository.Filter{Term: tt.term})
+		assert.Nil(t, err)
+		assert.Equal(t, tt.expected, len(p), tt.term)
+	}
+}
+
+func TestRepositoryContract(t *testing.T) {
+	repositorytest.Run(t, func(t *testing.T) repository.Product {
+		db := StartTestDB(t)
+		t.Cleanup(func() { db.Close() })
+		return db
+	})
+}
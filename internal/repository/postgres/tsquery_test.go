@@ -0,0 +1,16 @@
+package postgres
+
+import (
+	"testing"
+
+	"github.com/mustafadubul/product/internal/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTSQuery(t *testing.T) {
+	where, args := tsquery(repository.ParseTerm(`canon OR "prime lens" cam*`))
+
+	assert.Equal(t, "((search @@ phraseto_tsquery('english', ?) OR ? <% item_name)) OR "+
+		"(search @@ phraseto_tsquery('english', ?) AND search @@ to_tsquery('english', quote_literal(?) || ':*'))", where)
+	assert.Equal(t, []interface{}{"canon", "canon", "prime lens", "cam"}, args)
+}
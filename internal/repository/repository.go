@@ -1,25 +1,178 @@
 package repository
 
 import (
+	"context"
 	"errors"
+	"time"
 
 	"github.com/mustafadubul/product/internal/domain"
 )
 
 var (
 	ErrNotFound = errors.New("not found")
-	ErrFatal    = errors.New("fatal error")
+	ErrConflict = errors.New("conflict")
+	// ErrVersionMismatch is returned by a conditional write when the stored
+	// product is at another version.
+	ErrVersionMismatch = errors.New("version mismatch")
+	ErrFatal           = errors.New("fatal error")
 )
 
-// mockgen -source=repository.go -package=mocks -mock_names Product=MockRepoProduct -destination=../../mocks/mocks_repo_product.go Product
+// Filter describes a product search. It is passed by value, so every search
+// works on its own copy and searches can run concurrently.
+type Filter struct {
+	// Term is matched against the item names. Words are ANDed unless they are
+	// separated by OR, a trailing * matches a prefix and double quotes match a
+	// phrase.
+	Term string
+
+	// Box holds the top, right, bottom and left points of a bounding box the
+	// products have to be in, edges included. A box whose left edge is east of
+	// its right edge crosses the antimeridian, see geo.BoundingBox.
+	Box []domain.Point
+
+	// Within is the circle the bounding box encloses. Backends that can
+	// search on distance use it in place of Box.
+	Within *Circle
+
+	// Order is the order the products are returned in, by ID unless set.
+	Order Order
+
+	// After leaves out the products up to and including the given one in
+	// Order, so the products can be read in batches without reading any
+	// twice.
+	After *Position
+
+	// Limit caps the number of products returned. Zero means no limit.
+	Limit int
+}
+
+// Order is the order of the products a search returns.
+type Order int
+
+const (
+	// OrderID orders products by ID.
+	OrderID Order = iota
+	// OrderDistance orders products by their great-circle distance to the
+	// centre of Within, nearest first, and then by ID. Within must be set.
+	OrderDistance
+)
+
+// Position is the place of a product in either order.
+type Position struct {
+	ID  uint64
+	Lat float64
+	Lng float64
+}
+
+// Circle is the area within Radius meters of Lat, Lng.
+type Circle struct {
+	Lat    float64
+	Lng    float64
+	Radius float64
+}
+
+// mockgen -source=repository.go -package=mocks -mock_names Product=MockRepoProduct,Outbox=MockRepoOutbox,Webhooks=MockRepoWebhooks,SavedSearches=MockRepoSavedSearches -destination=../../mocks/mocks_repo_product.go Product,Outbox,Webhooks,SavedSearches
+//
+// Every write records a revision of the product in its history and an event
+// in the outbox, in the same transaction as the write. The actor and request
+// of the revision are taken from the context, see audit.NewContext.
+//
+// Every method but Purge only sees the products of the tenant of the context,
+// see tenant.NewContext. Products of other tenants are not found, product IDs
+// are unique across all tenants though, so the repository assigns them.
 type Product interface {
-	Search(functions ...func() error) ([]domain.Product, error)
-	Like(term string) func() error
-	Between(points []domain.Point) func() error
+	Search(ctx context.Context, f Filter) ([]domain.Product, error)
+	// Each calls fn with every product matching the filter in its order,
+	// reading them from the store as it goes. It stops at the first error fn
+	// returns and returns that error.
+	Each(ctx context.Context, f Filter, fn func(p *domain.Product) error) error
+
+	// Create stores p at version 1 under a new ID. The ID of p is ignored,
+	// so a caller can not learn which IDs other tenants hold.
+	Create(ctx context.Context, p *domain.Product) (*domain.Product, error)
+	// CreateMany stores all products in a single transaction, either all of
+	// them are stored or none is.
+	CreateMany(ctx context.Context, products []*domain.Product) error
+	Get(ctx context.Context, id uint64) (*domain.Product, error)
+
+	// Update replaces every field of the stored product, zero values
+	// included. Update and Delete return ErrNotFound when the product does
+	// not exist.
+	// A non-zero version makes them conditional, they only write when the
+	// stored product is at that version and return ErrVersionMismatch
+	// otherwise. Update bumps the version and returns the stored product.
+	Update(ctx context.Context, p *domain.Product) (*domain.Product, error)
+	// Delete moves the product to the trash. Products in the trash are left
+	// out of every other method but Trash, Restore, Purge and the history.
+	Delete(ctx context.Context, id uint64, version uint64) error
+
+	// Trash returns up to limit deleted products with an ID above after, in
+	// ID order.
+	Trash(ctx context.Context, after uint64, limit int) ([]domain.Product, error)
+	// Restore takes the product out of the trash and bumps its version. It
+	// returns ErrNotFound when the product is not in the trash.
+	Restore(ctx context.Context, id uint64) (*domain.Product, error)
+	// Purge removes the products of all tenants deleted before the given
+	// time for good and returns how many were removed. Their history is kept.
+	Purge(before time.Time) (int, error)
+
+	// History returns up to limit revisions of the product numbered above
+	// after, oldest first.
+	History(ctx context.Context, id uint64, after uint64, limit int) ([]domain.Revision, error)
+	// Revision returns a revision of the product, ErrNotFound when it does
+	// not exist.
+	Revision(ctx context.Context, id uint64, number uint64) (*domain.Revision, error)
+}
+
+// Outbox is the log of the events of the writes to products. Offsets are
+// assigned in the order the writes commit, so a consumer that remembers the
+// offset of the last event it handled never misses one.
+type Outbox interface {
+	// Events returns up to limit events of the tenant with an offset above
+	// after, in offset order. An empty tenant returns the events of all
+	// tenants.
+	Events(tenant string, after uint64, limit int) ([]domain.Event, error)
+	// Offset returns the offset of the last event the consumer handled, zero
+	// for a new consumer.
+	Offset(consumer string) (uint64, error)
+	SetOffset(consumer string, offset uint64) error
+}
+
+// Webhooks stores the webhook subscriptions and the events that could not be
+// delivered to them.
+type Webhooks interface {
+	// CreateWebhook stores w and assigns its ID.
+	CreateWebhook(w *domain.Webhook) (*domain.Webhook, error)
+	// Webhooks returns all webhooks in ID order.
+	Webhooks() ([]domain.Webhook, error)
+	// DeleteWebhook removes the webhook and its dead letters. It returns
+	// ErrNotFound when the webhook does not exist.
+	DeleteWebhook(id uint64) error
+
+	// AddDeadLetter stores d and assigns its ID.
+	AddDeadLetter(d *domain.DeadLetter) error
+	// DeadLetters returns up to limit dead letters of the webhook with an ID
+	// above after, in ID order.
+	DeadLetters(webhookID uint64, after uint64, limit int) ([]domain.DeadLetter, error)
+}
 
-	Create(p *domain.Product) (*domain.Product, error)
-	Get(id uint64) (*domain.Product, error)
+// SavedSearches stores saved searches and the products that matched them.
+type SavedSearches interface {
+	// CreateSavedSearch stores s and assigns its ID.
+	CreateSavedSearch(s *domain.SavedSearch) (*domain.SavedSearch, error)
+	// SavedSearch returns the saved search or ErrNotFound.
+	SavedSearch(id uint64) (*domain.SavedSearch, error)
+	// SavedSearches returns the saved searches of the owner in ID order, or
+	// those of all owners when owner is empty.
+	SavedSearches(owner string) ([]domain.SavedSearch, error)
+	// DeleteSavedSearch removes the saved search and its matches. It returns
+	// ErrNotFound when the saved search does not exist.
+	DeleteSavedSearch(id uint64) error
 
-	Update(p *domain.Product) (*domain.Product, error)
-	Delete(id uint64) error
+	// AddMatch stores m and assigns its ID, unless the product already matched
+	// the saved search. It tells whether m was stored.
+	AddMatch(m *domain.Match) (bool, error)
+	// Matches returns up to limit matches of the saved search with an ID above
+	// after, in ID order.
+	Matches(savedSearchID uint64, after uint64, limit int) ([]domain.Match, error)
 }
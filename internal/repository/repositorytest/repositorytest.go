@@ -0,0 +1,1092 @@
+// Package repositorytest holds the contract every repository.Product
+// implementation has to follow, so all backends give the same guarantees.
+package repositorytest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mustafadubul/product/internal/audit"
+	"github.com/mustafadubul/product/internal/domain"
+	"github.com/mustafadubul/product/internal/repository"
+	"github.com/mustafadubul/product/internal/tenant"
+	"github.com/mustafadubul/product/pkg/geo"
+	"github.com/stretchr/testify/assert"
+)
+
+var ctx = context.Background()
+
+// Constructor returns an empty repository. It is called once for every test
+// and should register its own cleanup with t.Cleanup.
+type Constructor func(t *testing.T) repository.Product
+
+// Run runs the contract suite against the repositories returned by newRepo.
+func Run(t *testing.T, newRepo Constructor) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, repo repository.Product)
+	}{
+		{"create assigns an id", testCreate},
+		{"create ignores the id", testCreateIgnoresID},
+		{"create many in a single transaction", testCreateMany},
+		{"get returns the created product", testGet},
+		{"get missing product", testGetNotFound},
+		{"update replaces the stored product", testUpdate},
+		{"update clears zero fields", testUpdateClears},
+		{"update missing product", testUpdateNotFound},
+		{"conditional update", testUpdateVersion},
+		{"conditional delete", testDeleteVersion},
+		{"delete removes the product", testDelete},
+		{"delete missing product", testDeleteNotFound},
+		{"deleted products go to the trash", testTrash},
+		{"restore from the trash", testRestore},
+		{"purge the trash", testPurge},
+		{"writes record revisions", testHistory},
+		{"history of a failed write", testHistoryFailedWrite},
+		{"history pages", testHistoryPages},
+		{"writes publish events", testEvents},
+		{"consumer offsets", testOffsets},
+		{"tenants are isolated", testTenants},
+		{"tenants have their own trash and history", testTenantsTrash},
+		{"webhooks", testWebhooks},
+		{"dead letters", testDeadLetters},
+		{"saved searches", testSavedSearches},
+		{"saved search matches", testMatches},
+		{"search within bounding box", testSearchBox},
+		{"search within bounding box across the antimeridian and a pole", testSearchBoxWrapped},
+		{"search within circle", testSearchWithin},
+		{"search by term", testSearchTerm},
+		{"search by term within bounding box", testSearchTermBox},
+		{"search limit", testSearchLimit},
+		{"search by distance", testSearchDistance},
+		{"search after a product", testSearchAfter},
+		{"concurrent searches", testSearchConcurrent},
+		{"each visits products in id order", testEach},
+		{"each stops on error", testEachStop},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newRepo(t))
+		})
+	}
+}
+
+var (
+	london = domain.Point{X: 51.509865, Y: -0.118092}
+	paris  = domain.Point{X: 48.864716, Y: 2.349014}
+)
+
+// box returns the top, right, bottom and left points of a box around p.
+func box(p domain.Point, delta float64) []domain.Point {
+	return []domain.Point{
+		{X: p.X + delta, Y: p.Y},
+		{X: p.X, Y: p.Y + delta},
+		{X: p.X - delta, Y: p.Y},
+		{X: p.X, Y: p.Y - delta},
+	}
+}
+
+func create(t *testing.T, repo repository.Product, products ...*domain.Product) {
+	t.Helper()
+	for _, p := range products {
+		_, err := repo.Create(ctx, p)
+		if !assert.Nil(t, err) {
+			t.FailNow()
+		}
+	}
+}
+
+func ids(products []domain.Product) []uint64 {
+	ids := make([]uint64, 0, len(products))
+	for _, p := range products {
+		ids = append(ids, p.ID)
+	}
+	return ids
+}
+
+func testCreateIgnoresID(t *testing.T, repo repository.Product) {
+	p := &domain.Product{ItemName: "camera", Lat: london.X, Lng: london.Y}
+	create(t, repo, p)
+
+	lens, err := repo.Create(ctx, &domain.Product{ID: p.ID, ItemName: "lens", Lat: london.X, Lng: london.Y})
+	assert.Nil(t, err)
+	assert.NotEqual(t, p.ID, lens.ID)
+
+	stored, err := repo.Get(ctx, p.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "camera", stored.ItemName)
+}
+
+func testCreate(t *testing.T, repo repository.Product) {
+	first, err := repo.Create(ctx, &domain.Product{ItemName: "camera", Lat: london.X, Lng: london.Y})
+	assert.Nil(t, err)
+	assert.NotEqual(t, uint64(0), first.ID)
+
+	second, err := repo.Create(ctx, &domain.Product{ItemName: "lens", Lat: london.X, Lng: london.Y})
+	assert.Nil(t, err)
+	assert.NotEqual(t, first.ID, second.ID)
+}
+
+func testCreateMany(t *testing.T, repo repository.Product) {
+	products := []*domain.Product{
+		{ItemName: "camera", Lat: london.X, Lng: london.Y},
+		{ItemName: "lens", Lat: paris.X, Lng: paris.Y},
+	}
+	assert.Nil(t, repo.CreateMany(ctx, products))
+
+	for _, expected := range products {
+		assert.NotEqual(t, uint64(0), expected.ID)
+		p, err := repo.Get(ctx, expected.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, p)
+	}
+
+	// the IDs of the products are ignored
+	more := []*domain.Product{
+		{ID: products[0].ID, ItemName: "tripod", Lat: london.X, Lng: london.Y},
+		{ID: products[0].ID, ItemName: "tripod", Lat: london.X, Lng: london.Y},
+	}
+	assert.Nil(t, repo.CreateMany(ctx, more))
+	assert.NotEqual(t, products[0].ID, more[0].ID)
+	assert.NotEqual(t, more[0].ID, more[1].ID)
+
+	found, err := repo.Search(ctx, repository.Filter{Term: "camera"})
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{products[0].ID}, ids(found))
+}
+
+func testGet(t *testing.T, repo repository.Product) {
+	expected := &domain.Product{
+		ItemName: "Canon 50mm f/1.2 Prime Lens",
+		Lat:      london.X,
+		Lng:      london.Y,
+		ImageURL: "https://example.com/canon.jpg",
+		URL:      "https://example.com/canon",
+	}
+	create(t, repo, expected)
+
+	p, err := repo.Get(ctx, expected.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, p)
+}
+
+func testGetNotFound(t *testing.T, repo repository.Product) {
+	_, err := repo.Get(ctx, 12345)
+	assert.True(t, errors.Is(err, repository.ErrNotFound), "got %v", err)
+}
+
+func testUpdate(t *testing.T, repo repository.Product) {
+	p := &domain.Product{ItemName: "camera", Lat: london.X, Lng: london.Y}
+	create(t, repo, p)
+
+	updated := &domain.Product{
+		ID:       p.ID,
+		ItemName: "Canon",
+		Lat:      paris.X,
+		Lng:      paris.Y,
+		URL:      "https://example.com/canon",
+	}
+	got, err := repo.Update(ctx, updated)
+	assert.Nil(t, err)
+	updated.Tenant = tenant.Default
+	updated.Version = 2
+	assert.Equal(t, updated, got)
+
+	stored, err := repo.Get(ctx, p.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, updated, stored)
+
+	// the product moved, so searches follow it
+	found, err := repo.Search(ctx, repository.Filter{Box: box(london, 0.01)})
+	assert.Nil(t, err)
+	assert.Empty(t, found)
+
+	found, err = repo.Search(ctx, repository.Filter{Term: "canon", Box: box(paris, 0.01)})
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{p.ID}, ids(found))
+}
+
+func testUpdateClears(t *testing.T, repo repository.Product) {
+	p := &domain.Product{ItemName: "camera", Lat: london.X, Lng: london.Y, ImageURL: "https://example.com/camera.png"}
+	create(t, repo, p)
+
+	_, err := repo.Update(ctx, &domain.Product{ID: p.ID, ItemName: "camera", Lat: 0, Lng: london.Y})
+	assert.Nil(t, err)
+
+	stored, err := repo.Get(ctx, p.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, &domain.Product{ID: p.ID, Tenant: tenant.Default, ItemName: "camera", Lat: 0, Lng: london.Y, Version: 2}, stored)
+}
+
+func testUpdateNotFound(t *testing.T, repo repository.Product) {
+	_, err := repo.Update(ctx, &domain.Product{ID: 12345, ItemName: "camera"})
+	assert.True(t, errors.Is(err, repository.ErrNotFound), "got %v", err)
+}
+
+func testUpdateVersion(t *testing.T, repo repository.Product) {
+	p := &domain.Product{ItemName: "camera", Lat: london.X, Lng: london.Y}
+	create(t, repo, p)
+	assert.Equal(t, uint64(1), p.Version)
+
+	got, err := repo.Update(ctx, &domain.Product{ID: p.ID, ItemName: "lens", Lat: london.X, Lng: london.Y, Version: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2), got.Version)
+
+	// a writer still holding version 1 lost the race
+	_, err = repo.Update(ctx, &domain.Product{ID: p.ID, ItemName: "tripod", Lat: london.X, Lng: london.Y, Version: 1})
+	assert.True(t, errors.Is(err, repository.ErrVersionMismatch), "got %v", err)
+
+	stored, err := repo.Get(ctx, p.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "lens", stored.ItemName)
+	assert.Equal(t, uint64(2), stored.Version)
+
+	_, err = repo.Update(ctx, &domain.Product{ID: 12345, ItemName: "camera", Version: 1})
+	assert.True(t, errors.Is(err, repository.ErrNotFound), "got %v", err)
+}
+
+func testDeleteVersion(t *testing.T, repo repository.Product) {
+	p := &domain.Product{ItemName: "camera", Lat: london.X, Lng: london.Y}
+	create(t, repo, p)
+
+	err := repo.Delete(ctx, p.ID, 2)
+	assert.True(t, errors.Is(err, repository.ErrVersionMismatch), "got %v", err)
+
+	assert.Nil(t, repo.Delete(ctx, p.ID, 1))
+
+	_, err = repo.Get(ctx, p.ID)
+	assert.True(t, errors.Is(err, repository.ErrNotFound), "got %v", err)
+}
+
+func testDelete(t *testing.T, repo repository.Product) {
+	p := &domain.Product{ItemName: "camera", Lat: london.X, Lng: london.Y}
+	create(t, repo, p)
+
+	assert.Nil(t, repo.Delete(ctx, p.ID, 0))
+
+	_, err := repo.Get(ctx, p.ID)
+	assert.True(t, errors.Is(err, repository.ErrNotFound), "got %v", err)
+
+	found, err := repo.Search(ctx, repository.Filter{Term: "camera"})
+	assert.Nil(t, err)
+	assert.Empty(t, found)
+}
+
+func testDeleteNotFound(t *testing.T, repo repository.Product) {
+	err := repo.Delete(ctx, 404, 0)
+	assert.True(t, errors.Is(err, repository.ErrNotFound), "got %v", err)
+}
+
+func testTrash(t *testing.T, repo repository.Product) {
+	camera := &domain.Product{ItemName: "camera", Lat: london.X, Lng: london.Y}
+	lens := &domain.Product{ItemName: "lens", Lat: london.X, Lng: london.Y}
+	tripod := &domain.Product{ItemName: "tripod", Lat: london.X, Lng: london.Y}
+	create(t, repo, camera, lens, tripod)
+
+	assert.Nil(t, repo.Delete(ctx, camera.ID, 0))
+	assert.Nil(t, repo.Delete(ctx, tripod.ID, 0))
+
+	// deleted products are gone from everything but the trash
+	_, err := repo.Get(ctx, camera.ID)
+	assert.True(t, errors.Is(err, repository.ErrNotFound), "got %v", err)
+
+	found, err := repo.Search(ctx, repository.Filter{Box: box(london, 0.01)})
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{lens.ID}, ids(found))
+
+	var each []domain.Product
+	assert.Nil(t, repo.Each(ctx, repository.Filter{}, func(p *domain.Product) error {
+		each = append(each, *p)
+		return nil
+	}))
+	assert.Equal(t, []uint64{lens.ID}, ids(each))
+
+	_, err = repo.Update(ctx, &domain.Product{ID: camera.ID, ItemName: "camera"})
+	assert.True(t, errors.Is(err, repository.ErrNotFound), "got %v", err)
+
+	err = repo.Delete(ctx, camera.ID, 0)
+	assert.True(t, errors.Is(err, repository.ErrNotFound), "got %v", err)
+
+	trash, err := repo.Trash(ctx, 0, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{camera.ID, tripod.ID}, ids(trash))
+	for _, p := range trash {
+		assert.NotNil(t, p.DeletedAt)
+	}
+
+	trash, err = repo.Trash(ctx, camera.ID, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{tripod.ID}, ids(trash))
+
+	trash, err = repo.Trash(ctx, 0, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{camera.ID}, ids(trash))
+}
+
+func testRestore(t *testing.T, repo repository.Product) {
+	p := &domain.Product{ItemName: "camera", Lat: london.X, Lng: london.Y}
+	create(t, repo, p)
+	assert.Nil(t, repo.Delete(ctx, p.ID, 0))
+
+	restored, err := repo.Restore(ctx, p.ID)
+	assert.Nil(t, err)
+	assert.Nil(t, restored.DeletedAt)
+	assert.Equal(t, uint64(2), restored.Version)
+
+	found, err := repo.Search(ctx, repository.Filter{Term: "camera", Box: box(london, 0.01)})
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{p.ID}, ids(found))
+
+	_, err = repo.Restore(ctx, p.ID)
+	assert.True(t, errors.Is(err, repository.ErrNotFound), "got %v", err)
+
+	trash, err := repo.Trash(ctx, 0, 10)
+	assert.Nil(t, err)
+	assert.Empty(t, trash)
+}
+
+func testPurge(t *testing.T, repo repository.Product) {
+	camera := &domain.Product{ItemName: "camera", Lat: london.X, Lng: london.Y}
+	lens := &domain.Product{ItemName: "lens", Lat: london.X, Lng: london.Y}
+	create(t, repo, camera, lens)
+	assert.Nil(t, repo.Delete(ctx, camera.ID, 0))
+
+	purged, err := repo.Purge(time.Now().Add(-time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, purged)
+
+	purged, err = repo.Purge(time.Now().Add(time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, purged)
+
+	trash, err := repo.Trash(ctx, 0, 10)
+	assert.Nil(t, err)
+	assert.Empty(t, trash)
+
+	// purged ids can be used again
+	_, err = repo.Create(ctx, &domain.Product{ID: camera.ID, ItemName: "camera"})
+	assert.Nil(t, err)
+
+	_, err = repo.Get(ctx, lens.ID)
+	assert.Nil(t, err)
+}
+
+func changed(rev domain.Revision) []string {
+	fields := make([]string, len(rev.Changes))
+	for i, c := range rev.Changes {
+		fields[i] = c.Field
+	}
+	return fields
+}
+
+func testHistory(t *testing.T, repo repository.Product) {
+	alice := audit.NewContext(ctx, audit.Info{Actor: "alice", RequestID: "req-1"})
+
+	p := &domain.Product{ItemName: "camera", Lat: london.X, Lng: london.Y}
+	_, err := repo.Create(alice, p)
+	assert.Nil(t, err)
+	_, err = repo.Update(ctx, &domain.Product{ID: p.ID, ItemName: "lens", Lat: london.X, Lng: london.Y})
+	assert.Nil(t, err)
+	assert.Nil(t, repo.Delete(alice, p.ID, 0))
+	_, err = repo.Restore(alice, p.ID)
+	assert.Nil(t, err)
+
+	history, err := repo.History(ctx, p.ID, 0, 0)
+	assert.Nil(t, err)
+	if !assert.Len(t, history, 4) {
+		return
+	}
+
+	expected := []struct {
+		action  string
+		actor   string
+		version uint64
+		changes []string
+	}{
+		{domain.ActionCreate, "alice", 1, []string{"description", "lat", "lng"}},
+		{domain.ActionUpdate, audit.Anonymous, 2, []string{"description"}},
+		{domain.ActionDelete, "alice", 2, []string{"deleted_at"}},
+		{domain.ActionRestore, "alice", 3, []string{"deleted_at"}},
+	}
+	for i, e := range expected {
+		rev := history[i]
+		assert.Equal(t, p.ID, rev.ProductID)
+		assert.Equal(t, uint64(i+1), rev.Number)
+		assert.Equal(t, e.action, rev.Action)
+		assert.Equal(t, e.actor, rev.Actor)
+		assert.Equal(t, e.version, rev.Snapshot.Version)
+		assert.Equal(t, e.changes, changed(rev))
+		assert.WithinDuration(t, time.Now(), rev.At, time.Minute)
+	}
+	assert.Equal(t, "req-1", history[0].RequestID)
+	assert.Equal(t, "lens", history[1].Snapshot.ItemName)
+	assert.NotNil(t, history[2].Snapshot.DeletedAt)
+	assert.Nil(t, history[3].Snapshot.DeletedAt)
+
+	rev, err := repo.Revision(ctx, p.ID, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, history[1].Snapshot, rev.Snapshot)
+
+	_, err = repo.Revision(ctx, p.ID, 5)
+	assert.True(t, errors.Is(err, repository.ErrNotFound), "got %v", err)
+	_, err = repo.Revision(ctx, p.ID+1, 1)
+	assert.True(t, errors.Is(err, repository.ErrNotFound), "got %v", err)
+
+	// the history outlives the product
+	_, err = repo.Purge(time.Now().Add(time.Hour))
+	assert.Nil(t, err)
+	assert.Nil(t, repo.Delete(ctx, p.ID, 0))
+	_, err = repo.Purge(time.Now().Add(time.Hour))
+	assert.Nil(t, err)
+	history, err = repo.History(ctx, p.ID, 0, 0)
+	assert.Nil(t, err)
+	assert.Len(t, history, 5)
+}
+
+func testHistoryFailedWrite(t *testing.T, repo repository.Product) {
+	p := &domain.Product{ItemName: "camera", Lat: london.X, Lng: london.Y}
+	create(t, repo, p)
+
+	_, err := repo.Update(ctx, &domain.Product{ID: p.ID, ItemName: "lens", Version: 7})
+	assert.True(t, errors.Is(err, repository.ErrVersionMismatch), "got %v", err)
+	assert.True(t, errors.Is(repo.Delete(ctx, p.ID, 7), repository.ErrVersionMismatch))
+
+	history, err := repo.History(ctx, p.ID, 0, 0)
+	assert.Nil(t, err)
+	assert.Len(t, history, 1)
+}
+
+func testHistoryPages(t *testing.T, repo repository.Product) {
+	products := []*domain.Product{
+		{ItemName: "camera", Lat: london.X, Lng: london.Y},
+		{ItemName: "lens", Lat: paris.X, Lng: paris.Y},
+	}
+	assert.Nil(t, repo.CreateMany(ctx, products))
+
+	p := products[1]
+	for _, name := range []string{"lens 1", "lens 2", "lens 3"} {
+		_, err := repo.Update(ctx, &domain.Product{ID: p.ID, ItemName: name, Lat: paris.X, Lng: paris.Y})
+		assert.Nil(t, err)
+	}
+
+	history, err := repo.History(ctx, p.ID, 1, 2)
+	assert.Nil(t, err)
+	if assert.Len(t, history, 2) {
+		assert.Equal(t, uint64(2), history[0].Number)
+		assert.Equal(t, "lens 2", history[1].Snapshot.ItemName)
+	}
+
+	history, err = repo.History(ctx, p.ID, 4, 2)
+	assert.Nil(t, err)
+	assert.Empty(t, history)
+
+	history, err = repo.History(ctx, products[0].ID, 0, 0)
+	assert.Nil(t, err)
+	if assert.Len(t, history, 1) {
+		assert.Equal(t, domain.ActionCreate, history[0].Action)
+	}
+}
+
+// outbox returns the outbox of the repository, every backend has one.
+func outbox(t *testing.T, repo repository.Product) repository.Outbox {
+	t.Helper()
+	o, ok := repo.(repository.Outbox)
+	if !ok {
+		t.Fatalf("%T does not implement repository.Outbox", repo)
+	}
+	return o
+}
+
+func testEvents(t *testing.T, repo repository.Product) {
+	o := outbox(t, repo)
+
+	p := &domain.Product{ItemName: "camera", Lat: london.X, Lng: london.Y}
+	create(t, repo, p)
+	_, err := repo.Update(ctx, &domain.Product{ID: p.ID, ItemName: "lens", Lat: london.X, Lng: london.Y, Version: 7})
+	assert.True(t, errors.Is(err, repository.ErrVersionMismatch), "got %v", err)
+	_, err = repo.Update(audit.NewContext(ctx, audit.Info{Actor: "alice"}), &domain.Product{ID: p.ID, ItemName: "lens"})
+	assert.Nil(t, err)
+	assert.Nil(t, repo.Delete(ctx, p.ID, 0))
+	_, err = repo.Restore(ctx, p.ID)
+	assert.Nil(t, err)
+
+	events, err := o.Events("", 0, 0)
+	assert.Nil(t, err)
+	if !assert.Len(t, events, 4) {
+		return
+	}
+
+	types := []string{domain.EventCreated, domain.EventUpdated, domain.EventDeleted, domain.EventRestored}
+	for i, e := range events {
+		assert.Equal(t, types[i], e.Type)
+		assert.Equal(t, p.ID, e.ProductID)
+		assert.Equal(t, uint64(i+1), e.Revision)
+		if i > 0 {
+			assert.True(t, e.Offset > events[i-1].Offset, "offsets %d and %d out of order", events[i-1].Offset, e.Offset)
+		}
+	}
+	assert.Equal(t, "alice", events[1].Actor)
+	assert.Equal(t, "lens", events[1].Product.ItemName)
+	assert.NotNil(t, events[2].Product.DeletedAt)
+
+	page, err := o.Events("", events[0].Offset, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, events[1:3], page)
+
+	page, err = o.Events("", events[3].Offset, 0)
+	assert.Nil(t, err)
+	assert.Empty(t, page)
+}
+
+func testOffsets(t *testing.T, repo repository.Product) {
+	o := outbox(t, repo)
+
+	offset, err := o.Offset("file")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), offset)
+
+	assert.Nil(t, o.SetOffset("file", 3))
+	assert.Nil(t, o.SetOffset("file", 5))
+	assert.Nil(t, o.SetOffset("webhook", 1))
+
+	offset, err = o.Offset("file")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(5), offset)
+	offset, err = o.Offset("webhook")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), offset)
+}
+
+func testTenants(t *testing.T, repo repository.Product) {
+	acme := tenant.NewContext(ctx, "acme")
+	globex := tenant.NewContext(ctx, "globex")
+
+	// globex stores its product first, so a limit on the IDs of all tenants
+	// would hide the product of acme
+	theirs := &domain.Product{ItemName: "camera", Lat: london.X, Lng: london.Y}
+	_, err := repo.Create(globex, theirs)
+	assert.Nil(t, err)
+	ours := &domain.Product{ItemName: "camera", Lat: london.X, Lng: london.Y}
+	_, err = repo.Create(acme, ours)
+	assert.Nil(t, err)
+	assert.Equal(t, "acme", ours.Tenant)
+
+	found, err := repo.Search(acme, repository.Filter{Term: "camera", Box: box(london, 0.01), Limit: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{ours.ID}, ids(found))
+	found, err = repo.Search(ctx, repository.Filter{})
+	assert.Nil(t, err)
+	assert.Empty(t, found)
+
+	var each []uint64
+	assert.Nil(t, repo.Each(globex, repository.Filter{}, func(p *domain.Product) error {
+		each = append(each, p.ID)
+		return nil
+	}))
+	assert.Equal(t, []uint64{theirs.ID}, each)
+
+	_, err = repo.Get(globex, ours.ID)
+	assert.True(t, errors.Is(err, repository.ErrNotFound), "got %v", err)
+	_, err = repo.Update(globex, &domain.Product{ID: ours.ID, ItemName: "stolen"})
+	assert.True(t, errors.Is(err, repository.ErrNotFound), "got %v", err)
+	err = repo.Delete(globex, ours.ID, 0)
+	assert.True(t, errors.Is(err, repository.ErrNotFound), "got %v", err)
+
+	// creating with the ID of another tenant neither fails nor touches the
+	// product of that tenant
+	lens, err := repo.Create(globex, &domain.Product{ID: ours.ID, ItemName: "lens"})
+	assert.Nil(t, err)
+	assert.NotEqual(t, ours.ID, lens.ID)
+	assert.Nil(t, repo.CreateMany(globex, []*domain.Product{{ID: ours.ID, ItemName: "tripod"}}))
+
+	stored, err := repo.Get(acme, ours.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "camera", stored.ItemName)
+	assert.Equal(t, uint64(1), stored.Version)
+
+	events, err := outbox(t, repo).Events("acme", 0, 0)
+	assert.Nil(t, err)
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, ours.ID, events[0].ProductID)
+		assert.Equal(t, "acme", events[0].Tenant)
+	}
+	events, err = outbox(t, repo).Events("", 0, 0)
+	assert.Nil(t, err)
+	assert.Len(t, events, 4)
+}
+
+func testTenantsTrash(t *testing.T, repo repository.Product) {
+	acme := tenant.NewContext(ctx, "acme")
+	globex := tenant.NewContext(ctx, "globex")
+
+	p := &domain.Product{ItemName: "camera", Lat: london.X, Lng: london.Y}
+	_, err := repo.Create(acme, p)
+	assert.Nil(t, err)
+	assert.Nil(t, repo.Delete(acme, p.ID, 0))
+
+	trash, err := repo.Trash(globex, 0, 10)
+	assert.Nil(t, err)
+	assert.Empty(t, trash)
+	_, err = repo.Restore(globex, p.ID)
+	assert.True(t, errors.Is(err, repository.ErrNotFound), "got %v", err)
+
+	history, err := repo.History(globex, p.ID, 0, 0)
+	assert.Nil(t, err)
+	assert.Empty(t, history)
+	_, err = repo.Revision(globex, p.ID, 1)
+	assert.True(t, errors.Is(err, repository.ErrNotFound), "got %v", err)
+
+	trash, err = repo.Trash(acme, 0, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{p.ID}, ids(trash))
+	history, err = repo.History(acme, p.ID, 0, 0)
+	assert.Nil(t, err)
+	assert.Len(t, history, 2)
+	_, err = repo.Restore(acme, p.ID)
+	assert.Nil(t, err)
+}
+
+// webhooks returns the webhooks of the repository, every backend has them.
+func webhooks(t *testing.T, repo repository.Product) repository.Webhooks {
+	t.Helper()
+	w, ok := repo.(repository.Webhooks)
+	if !ok {
+		t.Fatalf("%T does not implement repository.Webhooks", repo)
+	}
+	return w
+}
+
+func testWebhooks(t *testing.T, repo repository.Product) {
+	store := webhooks(t, repo)
+
+	created := time.Now().UTC().Truncate(time.Second)
+	first, err := store.CreateWebhook(&domain.Webhook{
+		Tenant: "acme", URL: "https://example.com/hook", Secret: "s3cr3t", CreatedAt: created,
+		Query: domain.Query{Term: "camera", Lat: london.X, Lng: london.Y, Radius: 5},
+	})
+	assert.Nil(t, err)
+	second, err := store.CreateWebhook(&domain.Webhook{URL: "https://example.org/hook", Secret: "other", CreatedAt: created})
+	assert.Nil(t, err)
+	assert.NotEqual(t, first.ID, second.ID)
+
+	all, err := store.Webhooks()
+	assert.Nil(t, err)
+	if !assert.Len(t, all, 2) {
+		return
+	}
+	assert.Equal(t, *first, all[0])
+	assert.True(t, all[0].CreatedAt.Equal(created))
+	assert.Equal(t, "other", all[1].Secret)
+
+	assert.Nil(t, store.DeleteWebhook(first.ID))
+	err = store.DeleteWebhook(first.ID)
+	assert.True(t, errors.Is(err, repository.ErrNotFound), "got %v", err)
+
+	all, err = store.Webhooks()
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{second.ID}, []uint64{all[0].ID})
+}
+
+func testDeadLetters(t *testing.T, repo repository.Product) {
+	store := webhooks(t, repo)
+
+	w, err := store.CreateWebhook(&domain.Webhook{URL: "https://example.com/hook", Secret: "s3cr3t", CreatedAt: time.Now()})
+	assert.Nil(t, err)
+	other, err := store.CreateWebhook(&domain.Webhook{URL: "https://example.org/hook", Secret: "other", CreatedAt: time.Now()})
+	assert.Nil(t, err)
+
+	failed := time.Now().UTC().Truncate(time.Second)
+	for i := 1; i <= 3; i++ {
+		dl := &domain.DeadLetter{
+			WebhookID: w.ID,
+			Event:     domain.Event{Offset: uint64(i), Type: domain.EventCreated, ProductID: uint64(i), Product: domain.Product{ID: uint64(i), ItemName: "camera"}},
+			Attempts:  5,
+			Error:     "503 Service Unavailable",
+			FailedAt:  failed,
+		}
+		assert.Nil(t, store.AddDeadLetter(dl))
+		assert.NotZero(t, dl.ID)
+	}
+	assert.Nil(t, store.AddDeadLetter(&domain.DeadLetter{WebhookID: other.ID, FailedAt: failed}))
+
+	letters, err := store.DeadLetters(w.ID, 0, 0)
+	assert.Nil(t, err)
+	if !assert.Len(t, letters, 3) {
+		return
+	}
+	assert.Equal(t, uint64(2), letters[1].Event.Offset)
+	assert.Equal(t, "camera", letters[1].Event.Product.ItemName)
+	assert.Equal(t, 5, letters[1].Attempts)
+	assert.True(t, letters[1].FailedAt.Equal(failed))
+
+	page, err := store.DeadLetters(w.ID, letters[0].ID, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, letters[1:2], page)
+
+	assert.Nil(t, store.DeleteWebhook(w.ID))
+	letters, err = store.DeadLetters(w.ID, 0, 0)
+	assert.Nil(t, err)
+	assert.Empty(t, letters)
+	letters, err = store.DeadLetters(other.ID, 0, 0)
+	assert.Nil(t, err)
+	assert.Len(t, letters, 1)
+}
+
+// savedSearches returns the saved searches of the repository, every backend
+// has them.
+func savedSearches(t *testing.T, repo repository.Product) repository.SavedSearches {
+	t.Helper()
+	s, ok := repo.(repository.SavedSearches)
+	if !ok {
+		t.Fatalf("%T does not implement repository.SavedSearches", repo)
+	}
+	return s
+}
+
+func testSavedSearches(t *testing.T, repo repository.Product) {
+	store := savedSearches(t, repo)
+
+	created := time.Now().UTC().Truncate(time.Second)
+	alice, err := store.CreateSavedSearch(&domain.SavedSearch{
+		Tenant: "acme", Owner: "alice", Name: "cameras", CreatedAt: created,
+		Query: domain.Query{Term: "camera", Lat: london.X, Lng: london.Y, Radius: 5},
+	})
+	assert.Nil(t, err)
+	bob, err := store.CreateSavedSearch(&domain.SavedSearch{Owner: "bob", CreatedAt: created})
+	assert.Nil(t, err)
+	assert.NotEqual(t, alice.ID, bob.ID)
+
+	got, err := store.SavedSearch(alice.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, alice, got)
+	assert.True(t, got.CreatedAt.Equal(created))
+
+	owned, err := store.SavedSearches("alice")
+	assert.Nil(t, err)
+	assert.Equal(t, []domain.SavedSearch{*alice}, owned)
+	all, err := store.SavedSearches("")
+	assert.Nil(t, err)
+	assert.Len(t, all, 2)
+
+	assert.Nil(t, store.DeleteSavedSearch(alice.ID))
+	err = store.DeleteSavedSearch(alice.ID)
+	assert.True(t, errors.Is(err, repository.ErrNotFound), "got %v", err)
+	_, err = store.SavedSearch(alice.ID)
+	assert.True(t, errors.Is(err, repository.ErrNotFound), "got %v", err)
+}
+
+func testMatches(t *testing.T, repo repository.Product) {
+	store := savedSearches(t, repo)
+
+	s, err := store.CreateSavedSearch(&domain.SavedSearch{Owner: "alice", CreatedAt: time.Now()})
+	assert.Nil(t, err)
+
+	matched := time.Now().UTC().Truncate(time.Second)
+	for id := uint64(1); id <= 3; id++ {
+		m := &domain.Match{SavedSearchID: s.ID, ProductID: id, Offset: id, MatchedAt: matched,
+			Product: domain.Product{ID: id, ItemName: "camera"}}
+		added, err := store.AddMatch(m)
+		assert.Nil(t, err)
+		assert.True(t, added)
+		assert.NotZero(t, m.ID)
+	}
+
+	// a product matches a saved search once
+	added, err := store.AddMatch(&domain.Match{SavedSearchID: s.ID, ProductID: 2, Offset: 9, MatchedAt: matched})
+	assert.Nil(t, err)
+	assert.False(t, added)
+
+	matches, err := store.Matches(s.ID, 0, 0)
+	assert.Nil(t, err)
+	if !assert.Len(t, matches, 3) {
+		return
+	}
+	assert.Equal(t, uint64(2), matches[1].Offset)
+	assert.Equal(t, "camera", matches[1].Product.ItemName)
+	assert.True(t, matches[1].MatchedAt.Equal(matched))
+
+	page, err := store.Matches(s.ID, matches[0].ID, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, matches[1:2], page)
+
+	assert.Nil(t, store.DeleteSavedSearch(s.ID))
+	matches, err = store.Matches(s.ID, 0, 0)
+	assert.Nil(t, err)
+	assert.Empty(t, matches)
+}
+
+func testSearchBox(t *testing.T, repo repository.Product) {
+	inLondon := []*domain.Product{
+		{ItemName: "camera london", Lat: london.X, Lng: london.Y},
+		{ItemName: "lens london", Lat: london.X + 0.001, Lng: london.Y - 0.001},
+	}
+	create(t, repo, inLondon...)
+	create(t, repo, &domain.Product{ItemName: "camera paris", Lat: paris.X, Lng: paris.Y})
+
+	found, err := repo.Search(ctx, repository.Filter{Box: box(london, 0.01)})
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []uint64{inLondon[0].ID, inLondon[1].ID}, ids(found))
+}
+
+func testSearchBoxWrapped(t *testing.T, repo repository.Product) {
+	east := &domain.Product{ItemName: "camera east", Lat: 0, Lng: 179.95}
+	west := &domain.Product{ItemName: "camera west", Lat: 0, Lng: -179.95}
+	pole := &domain.Product{ItemName: "camera pole", Lat: 89.95, Lng: -160}
+	create(t, repo, east, west, pole)
+	create(t, repo, &domain.Product{ItemName: "camera greenwich", Lat: 0, Lng: 0})
+
+	found, err := repo.Search(ctx, repository.Filter{Box: geo.BoundingBox(0, 179.9, 100000)})
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []uint64{east.ID, west.ID}, ids(found))
+
+	found, err = repo.Search(ctx, repository.Filter{Box: geo.BoundingBox(89.9, 20, 100000)})
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []uint64{pole.ID}, ids(found))
+}
+
+// testSearchWithin checks the products within the circle are found. Backends
+// that only apply the bounding box may return more products, but never ones
+// outside of it.
+func testSearchWithin(t *testing.T, repo repository.Product) {
+	near := &domain.Product{ItemName: "camera", Lat: london.X, Lng: london.Y}
+	// about 500m north
+	north := &domain.Product{ItemName: "camera", Lat: 51.514362, Lng: london.Y}
+	far := &domain.Product{ItemName: "camera", Lat: paris.X, Lng: paris.Y}
+	create(t, repo, near, north, far)
+
+	found, err := repo.Search(ctx, repository.Filter{
+		Box:    box(london, 0.01),
+		Within: &repository.Circle{Lat: london.X, Lng: london.Y, Radius: 1000},
+	})
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []uint64{near.ID, north.ID}, ids(found))
+}
+
+func testSearchTerm(t *testing.T, repo repository.Product) {
+	create(t, repo,
+		&domain.Product{ItemName: "Canon 50mm f/1.2 Prime Lens"},
+		&domain.Product{ItemName: "Canon 6D +24-70mm F4 L/35mm + Microphone + LED Lights"},
+		&domain.Product{ItemName: "Go Pro Hero - Full HD"},
+		&domain.Product{ItemName: "Nikon D750 Camera"},
+	)
+
+	tests := []struct {
+		term     string
+		expected int
+	}{
+		{"canon", 2},
+		{"CANON", 2},
+		{"canon lens", 1},
+		{"canon AND lens", 1},
+		{"canon OR nikon", 3},
+		{"cam*", 1},
+		{`"prime lens"`, 1},
+		{`"go pro" OR nikon`, 2},
+		{"nikon lens", 0},
+		// a term without words matches every product
+		{"*", 4},
+		{`""`, 4},
+		{"OR", 4},
+	}
+
+	for _, tt := range tests {
+		found, err := repo.Search(ctx, repository.Filter{Term: tt.term})
+		assert.Nil(t, err, tt.term)
+		assert.Equal(t, tt.expected, len(found), tt.term)
+	}
+}
+
+func testSearchTermBox(t *testing.T, repo repository.Product) {
+	expected := &domain.Product{ItemName: "Go Pro Hero - Full HD", Lat: london.X, Lng: london.Y}
+	create(t, repo,
+		expected,
+		&domain.Product{ItemName: "Canon 50mm f/1.2 Prime Lens", Lat: london.X, Lng: london.Y},
+		&domain.Product{ItemName: "Go Pro Hero - Full HD", Lat: paris.X, Lng: paris.Y},
+	)
+
+	found, err := repo.Search(ctx, repository.Filter{Term: "Go Pro Hero", Box: box(london, 0.01)})
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{expected.ID}, ids(found))
+}
+
+func testSearchLimit(t *testing.T, repo repository.Product) {
+	products := make([]*domain.Product, 5)
+	for i := range products {
+		products[i] = &domain.Product{ItemName: "camera", Lat: london.X, Lng: london.Y}
+	}
+	create(t, repo, products...)
+
+	found, err := repo.Search(ctx, repository.Filter{Term: "camera", Limit: 3})
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{products[0].ID, products[1].ID, products[2].ID}, ids(found))
+}
+
+func testSearchDistance(t *testing.T, repo repository.Product) {
+	far := &domain.Product{ItemName: "camera", Lat: london.X + 0.004, Lng: london.Y}
+	near := &domain.Product{ItemName: "camera", Lat: london.X, Lng: london.Y + 0.002}
+	here := &domain.Product{ItemName: "camera", Lat: london.X, Lng: london.Y}
+	tie := &domain.Product{ItemName: "camera", Lat: near.Lat, Lng: near.Lng}
+	create(t, repo, far, near, here, tie)
+
+	f := repository.Filter{
+		Box:    box(london, 0.01),
+		Within: &repository.Circle{Lat: london.X, Lng: london.Y, Radius: 1000},
+		Order:  repository.OrderDistance,
+	}
+	found, err := repo.Search(ctx, f)
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{here.ID, near.ID, tie.ID, far.ID}, ids(found))
+
+	// the nearest products are returned first, not the lowest IDs
+	f.Limit = 2
+	found, err = repo.Search(ctx, f)
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{here.ID, near.ID}, ids(found))
+
+	var each []domain.Product
+	err = repo.Each(ctx, f, func(p *domain.Product) error {
+		each = append(each, *p)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{here.ID, near.ID}, ids(each))
+}
+
+func testSearchAfter(t *testing.T, repo repository.Product) {
+	products := []*domain.Product{
+		{ItemName: "camera", Lat: london.X + 0.003, Lng: london.Y},
+		{ItemName: "camera", Lat: london.X + 0.001, Lng: london.Y},
+		{ItemName: "camera", Lat: london.X, Lng: london.Y},
+		{ItemName: "camera", Lat: london.X + 0.001, Lng: london.Y},
+		{ItemName: "camera", Lat: london.X + 0.002, Lng: london.Y},
+	}
+	create(t, repo, products...)
+
+	// reading in batches after the last product read visits every product
+	// once, in order
+	for _, order := range []repository.Order{repository.OrderID, repository.OrderDistance} {
+		f := repository.Filter{
+			Term:   "camera",
+			Box:    box(london, 0.01),
+			Within: &repository.Circle{Lat: london.X, Lng: london.Y, Radius: 1000},
+			Order:  order,
+			Limit:  2,
+		}
+		var read []uint64
+		for {
+			found, err := repo.Search(ctx, f)
+			assert.Nil(t, err)
+			read = append(read, ids(found)...)
+			if len(found) < f.Limit {
+				break
+			}
+			last := found[len(found)-1]
+			f.After = &repository.Position{ID: last.ID, Lat: last.Lat, Lng: last.Lng}
+		}
+
+		all, err := repo.Search(ctx, repository.Filter{Term: f.Term, Box: f.Box, Within: f.Within, Order: order})
+		assert.Nil(t, err)
+		assert.Equal(t, ids(all), read, "order %d", order)
+	}
+
+	found, err := repo.Search(ctx, repository.Filter{
+		Within: &repository.Circle{Lat: london.X, Lng: london.Y, Radius: 1000},
+		Order:  repository.OrderDistance,
+		After:  &repository.Position{ID: products[1].ID, Lat: products[1].Lat, Lng: products[1].Lng},
+	})
+	assert.Nil(t, err)
+	// products[3] is at the same place as products[1] but has a larger ID
+	assert.Equal(t, []uint64{products[3].ID, products[4].ID, products[0].ID}, ids(found))
+}
+
+func testEach(t *testing.T, repo repository.Product) {
+	canon := &domain.Product{ItemName: "Canon 50mm f/1.2 Prime Lens", Lat: london.X, Lng: london.Y, URL: "http://canon"}
+	nikon := &domain.Product{ItemName: "Nikon D850", Lat: london.X, Lng: london.Y}
+	lens := &domain.Product{ItemName: "Canon lens cap", Lat: paris.X, Lng: paris.Y}
+	create(t, repo, canon, nikon, lens)
+
+	var all []domain.Product
+	err := repo.Each(ctx, repository.Filter{}, func(p *domain.Product) error {
+		all = append(all, *p)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []domain.Product{*canon, *nikon, *lens}, all)
+
+	var filtered []domain.Product
+	err = repo.Each(ctx, repository.Filter{Term: "canon", Box: box(london, 0.01)}, func(p *domain.Product) error {
+		filtered = append(filtered, *p)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{canon.ID}, ids(filtered))
+}
+
+func testEachStop(t *testing.T, repo repository.Product) {
+	create(t, repo,
+		&domain.Product{ItemName: "camera", Lat: london.X, Lng: london.Y},
+		&domain.Product{ItemName: "camera", Lat: london.X, Lng: london.Y},
+	)
+
+	stop := errors.New("stop")
+	var visited int
+	err := repo.Each(ctx, repository.Filter{}, func(p *domain.Product) error {
+		visited++
+		return stop
+	})
+	assert.Equal(t, stop, err)
+	assert.Equal(t, 1, visited)
+}
+
+func testSearchConcurrent(t *testing.T, repo repository.Product) {
+	create(t, repo,
+		&domain.Product{ItemName: "camera london", Lat: london.X, Lng: london.Y},
+		&domain.Product{ItemName: "lens london", Lat: london.X, Lng: london.Y},
+		&domain.Product{ItemName: "camera paris", Lat: paris.X, Lng: paris.Y},
+	)
+
+	filters := []struct {
+		filter   repository.Filter
+		expected int
+	}{
+		{repository.Filter{Box: box(london, 0.01)}, 2},
+		{repository.Filter{Box: box(paris, 0.01)}, 1},
+		{repository.Filter{Term: "camera"}, 2},
+		{repository.Filter{Term: "camera", Box: box(london, 0.01)}, 1},
+		{repository.Filter{Term: "lens", Box: box(paris, 0.01)}, 0},
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan string, 1000)
+	for i := 0; i < 20; i++ {
+		for _, f := range filters {
+			wg.Add(1)
+			go func(f repository.Filter, expected int) {
+				defer wg.Done()
+				for j := 0; j < 10; j++ {
+					found, err := repo.Search(ctx, f)
+					if err != nil {
+						errs <- err.Error()
+						return
+					}
+					if len(found) != expected {
+						errs <- fmt.Sprintf("filter %+v returned %d products, expected %d", f, len(found), expected)
+						return
+					}
+				}
+			}(f.filter, f.expected)
+		}
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,42 @@
+package sqlite
+
+import (
+	"strings"
+
+	"github.com/mustafadubul/product/internal/repository"
+)
+
+// ftsMatch renders the query as an FTS5 MATCH expression. Every part is
+// quoted so user input can never produce an invalid expression.
+func ftsMatch(q repository.TermQuery) string {
+	groups := make([]string, 0, len(q))
+	for _, group := range q {
+		parts := make([]string, 0, len(group))
+		for _, p := range group {
+			s := `"` + strings.Replace(p.Text, `"`, `""`, -1) + `"`
+			if p.Prefix {
+				s += "*"
+			}
+			parts = append(parts, s)
+		}
+		groups = append(groups, "("+strings.Join(parts, " AND ")+")")
+	}
+	return strings.Join(groups, " OR ")
+}
+
+// like renders the query as LIKE conditions on column, used when the full
+// text index is not available.
+func like(q repository.TermQuery, column string) (string, []interface{}) {
+	var args []interface{}
+
+	groups := make([]string, 0, len(q))
+	for _, group := range q {
+		parts := make([]string, 0, len(group))
+		for _, p := range group {
+			parts = append(parts, column+" LIKE ?")
+			args = append(args, "%"+p.Text+"%")
+		}
+		groups = append(groups, "("+strings.Join(parts, " AND ")+")")
+	}
+	return strings.Join(groups, " OR "), args
+}
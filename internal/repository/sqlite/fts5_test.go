@@ -0,0 +1,23 @@
+//+build manual,sqlite_fts5
+
+package sqlite_test
+
+import (
+	"testing"
+
+	"github.com/mustafadubul/product/internal/domain"
+	"github.com/mustafadubul/product/internal/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearchMatchStemming(t *testing.T) {
+	db := StartTestDB(t)
+	defer db.Close()
+
+	_, err := db.Create(ctx, &domain.Product{ItemName: "Canon 5D Mii Shooting Kit and 28mm, 50mm and 105mm Lenses"})
+	assert.Nil(t, err)
+
+	p, err := db.Search(ctx, repository.Filter{Term: "shoot kits"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(p))
+}
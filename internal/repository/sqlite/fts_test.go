@@ -0,0 +1,34 @@
+package sqlite
+
+import (
+	"testing"
+
+	"github.com/mustafadubul/product/internal/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFTSMatch(t *testing.T) {
+	tests := []struct {
+		term  string
+		match string
+	}{
+		{`canon`, `("canon")`},
+		{`canon lens`, `("canon" AND "lens")`},
+		{`canon OR nikon lens`, `("canon") OR ("nikon" AND "lens")`},
+		{`cam*`, `("cam"*)`},
+		{`"prime lens" canon`, `("prime lens" AND "canon")`},
+		{`f/1.2 "50mm`, `("f/1.2" AND "50mm")`},
+		{`* ""`, ``},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.match, ftsMatch(repository.ParseTerm(tt.term)), tt.term)
+	}
+}
+
+func TestLike(t *testing.T) {
+	where, args := like(repository.ParseTerm(`canon OR "prime lens" cam*`), "item_name")
+
+	assert.Equal(t, "(item_name LIKE ?) OR (item_name LIKE ? AND item_name LIKE ?)", where)
+	assert.Equal(t, []interface{}{"%canon%", "%prime lens%", "%cam%"}, args)
+}
@@ -0,0 +1,65 @@
+package sqlite
+
+import (
+	"fmt"
+
+	"github.com/jinzhu/gorm"
+)
+
+// ftsSchema mirrors items.item_name into an FTS5 index that is kept in sync
+// by triggers.
+var ftsSchema = []string{
+	`CREATE VIRTUAL TABLE IF NOT EXISTS items_fts USING fts5(
+		item_name, content='items', content_rowid='id', tokenize='porter unicode61')`,
+	`CREATE TRIGGER IF NOT EXISTS items_fts_insert AFTER INSERT ON items BEGIN
+		INSERT INTO items_fts(rowid, item_name) VALUES (new.id, new.item_name);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS items_fts_delete AFTER DELETE ON items BEGIN
+		INSERT INTO items_fts(items_fts, rowid, item_name) VALUES ('delete', old.id, old.item_name);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS items_fts_update AFTER UPDATE ON items BEGIN
+		INSERT INTO items_fts(items_fts, rowid, item_name) VALUES ('delete', old.id, old.item_name);
+		INSERT INTO items_fts(rowid, item_name) VALUES (new.id, new.item_name);
+	END`,
+	`INSERT INTO items_fts(items_fts) VALUES ('rebuild')`,
+}
+
+// rtreeSchema keeps an R*Tree index keyed on the product ID in sync with the
+// coordinates of items.
+var rtreeSchema = []string{
+	`CREATE VIRTUAL TABLE IF NOT EXISTS items_rtree USING rtree(id, min_lat, max_lat, min_lng, max_lng)`,
+	`CREATE TRIGGER IF NOT EXISTS items_rtree_insert AFTER INSERT ON items BEGIN
+		INSERT INTO items_rtree(id, min_lat, max_lat, min_lng, max_lng) VALUES (new.id, new.lat, new.lat, new.lng, new.lng);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS items_rtree_delete AFTER DELETE ON items BEGIN
+		DELETE FROM items_rtree WHERE id = old.id;
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS items_rtree_update AFTER UPDATE OF id, lat, lng ON items BEGIN
+		DELETE FROM items_rtree WHERE id = old.id;
+		INSERT INTO items_rtree(id, min_lat, max_lat, min_lng, max_lng) VALUES (new.id, new.lat, new.lat, new.lng, new.lng);
+	END`,
+	`INSERT OR REPLACE INTO items_rtree(id, min_lat, max_lat, min_lng, max_lng) SELECT id, lat, lat, lng, lng FROM items`,
+}
+
+// createIndex runs the schema of an index in a single transaction. It reports
+// false when SQLite was built without the module the index needs.
+func (d *DB) createIndex(name string, schema []string) (bool, error) {
+	tx := d.db.Begin()
+	for _, stmt := range schema {
+		if err := tx.Exec(stmt).Error; err != nil {
+			tx.Rollback()
+			d.logger.Warn().Err(err).Str("index", name).Msg("index unavailable, searches will scan the items table")
+			return false, nil
+		}
+	}
+	if err := tx.Commit().Error; err != nil {
+		return false, fmt.Errorf("failed to build index %s: %w", name, err)
+	}
+	return true, nil
+}
+
+func tableExists(db *gorm.DB, name string) bool {
+	var count int
+	db.Table("sqlite_master").Where("name = ?", name).Count(&count)
+	return count > 0
+}
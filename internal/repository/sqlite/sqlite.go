@@ -1,21 +1,48 @@
 package sqlite
 
 import (
+	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/jinzhu/gorm"
 	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/mattn/go-sqlite3"
+	"github.com/mustafadubul/product/internal/audit"
 	"github.com/mustafadubul/product/internal/domain"
 	"github.com/mustafadubul/product/internal/repository"
+	"github.com/mustafadubul/product/internal/repository/gormstore"
+	"github.com/mustafadubul/product/internal/repository/gormtrace"
+	"github.com/mustafadubul/product/internal/tenant"
+	"github.com/mustafadubul/product/pkg/geo"
 	"github.com/rs/zerolog"
 )
 
 type DB struct {
+	*gormstore.Store
+
 	db     *gorm.DB
-	tx     *gorm.DB
 	logger *zerolog.Logger
+
+	// fts and rtree are set when the items_fts full text index and the
+	// items_rtree spatial index exist.
+	fts   bool
+	rtree bool
+}
+
+// driverName is the SQLite driver with the distance(lat1, lng1, lat2, lng2)
+// function, the great-circle distance in meters searches are ordered by.
+const driverName = "sqlite3_geo"
+
+func init() {
+	sql.Register(driverName, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			return conn.RegisterFunc("distance", geo.Distance, true)
+		},
+	})
 }
 
 func Open(inMemory bool, fileName string) (*gorm.DB, error) {
@@ -26,14 +53,22 @@ func Open(inMemory bool, fileName string) (*gorm.DB, error) {
 		file = fileName
 	}
 
-	return gorm.Open("sqlite3", file)
+	db, err := sql.Open(driverName, file)
+	if err != nil {
+		return nil, err
+	}
+	return gorm.Open("sqlite3", db)
 }
 
 func New(db *gorm.DB) *DB {
+	gormtrace.Register(db, "sqlite")
 	componentLogger := zerolog.New(os.Stdout).With().Str("component", "repository").Logger()
 	return &DB{
+		Store:  gormstore.New(db),
 		db:     db,
 		logger: &componentLogger,
+		fts:    tableExists(db, "items_fts"),
+		rtree:  tableExists(db, "items_rtree"),
 	}
 }
 
@@ -41,52 +76,189 @@ func (d *DB) Close() error {
 	return d.db.Close()
 }
 
-func (d *DB) Migrate() {
-	d.db.AutoMigrate(&domain.Product{})
+// Migrate creates the items, revisions, outbox, webhooks and saved searches
+// tables and builds the full text and spatial indexes. SQLite has to be
+// compiled with the sqlite_fts5 build tag for the full text index, without it
+// term searches fall back to LIKE.
+func (d *DB) Migrate() error {
+	if err := d.db.AutoMigrate(&domain.Product{}).Error; err != nil {
+		return fmt.Errorf("failed to migrate items: %w", err)
+	}
+	if err := gormstore.MigrateHistory(d.db); err != nil {
+		return err
+	}
+	if err := d.db.AutoMigrate(&event{}, &offset{}).Error; err != nil {
+		return fmt.Errorf("failed to migrate outbox: %w", err)
+	}
+	if err := gormstore.MigrateWebhooks(d.db); err != nil {
+		return err
+	}
+	if err := gormstore.MigrateSavedSearches(d.db); err != nil {
+		return err
+	}
+
+	var err error
+	if d.fts, err = d.createIndex("items_fts", ftsSchema); err != nil {
+		return err
+	}
+	if d.rtree, err = d.createIndex("items_rtree", rtreeSchema); err != nil {
+		return err
+	}
+	return nil
 }
 
-func (d *DB) Search(functions ...func() error) ([]domain.Product, error) {
+// Search returns the products matching the filter. Every call builds its own
+// query, so searches are safe to run concurrently.
+func (d *DB) Search(ctx context.Context, f repository.Filter) ([]domain.Product, error) {
 	var products []domain.Product
 
-	d.tx = d.db
-	for _, f := range functions {
-		if err := f(); err != nil {
-			return nil, err
+	tx := page(d.query(ctx, f), f)
+	if err := tx.Find(&products).Error; err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+func (d *DB) Each(ctx context.Context, f repository.Filter, fn func(p *domain.Product) error) error {
+	tx := page(d.query(ctx, f).Model(&domain.Product{}), f)
+	rows, err := tx.Rows()
+	if err != nil {
+		return fmt.Errorf("failed to read products: %w", repository.ErrFatal)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p domain.Product
+		if err := d.db.ScanRows(rows, &p); err != nil {
+			return fmt.Errorf("failed to read products: %w", repository.ErrFatal)
+		}
+		if err := fn(&p); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read products: %w", repository.ErrFatal)
+	}
+	return nil
+}
+
+// query returns the products of the tenant of ctx matching the filter,
+// unordered and unlimited.
+func (d *DB) query(ctx context.Context, f repository.Filter) *gorm.DB {
+	tx := scoped(ctx, d.conn(ctx))
+	if len(f.Box) == 4 {
+		tx = d.between(tx, f.Box)
+	}
+	if f.Term != "" {
+		tx = d.match(tx, f.Term)
+	}
+	return tx
+}
+
+// page orders the products as the filter asks, leaves out those up to f.After
+// and applies the limit. The after product is compared on the same expression
+// as the rows, so the comparison is exact.
+func page(tx *gorm.DB, f repository.Filter) *gorm.DB {
+	if f.Order == repository.OrderDistance {
+		c := f.Within
+		if f.After != nil {
+			tx = tx.Where("(distance(?, ?, lat, lng), id) > (distance(?, ?, ?, ?), ?)",
+				c.Lat, c.Lng, c.Lat, c.Lng, f.After.Lat, f.After.Lng, f.After.ID)
 		}
+		tx = tx.Order(gorm.Expr("distance(?, ?, lat, lng), id", c.Lat, c.Lng))
+	} else {
+		if f.After != nil {
+			tx = tx.Where("id > ?", f.After.ID)
+		}
+		tx = tx.Order("id")
 	}
 
-	if err := d.tx.Find(&products).Error; err != nil {
-		return nil, err
+	if f.Limit > 0 {
+		tx = tx.Limit(f.Limit)
 	}
-	return products, nil
+	return tx
 }
 
-func (d *DB) Like(term string) func() error {
-	return func() error {
-		d.tx = d.tx.Where("item_name LIKE ? ", "%"+term+"%")
-		return d.tx.Error
+// match filters on the full text index. See repository.Filter for the
+// supported syntax.
+func (d *DB) match(tx *gorm.DB, term string) *gorm.DB {
+	q := repository.ParseTerm(term)
+	if len(q) == 0 {
+		return tx
+	}
+
+	if !d.fts {
+		d.logger.Debug().Str("index", "like").Msg("term search")
+		where, args := like(q, "item_name")
+		return tx.Where(where, args...)
 	}
+
+	d.logger.Debug().Str("index", "items_fts").Msg("term search")
+	return tx.Where("id IN (SELECT rowid FROM items_fts WHERE items_fts MATCH ?)", ftsMatch(q))
 }
 
-func (d *DB) Between(points []domain.Point) func() error {
-	return func() error {
-		d.tx = d.tx.Where("lat > ? AND lat < ? AND lng < ? AND lng > ?",
+// between filters on the bounding box given by its top, right, bottom and left
+// points. The box is answered from the R*Tree index when it exists.
+func (d *DB) between(tx *gorm.DB, points []domain.Point) *gorm.DB {
+	// a box crossing the antimeridian holds the longitudes east of its left
+	// edge or west of its right one.
+	join := "AND"
+	if points[3].Y > points[1].Y {
+		join = "OR"
+	}
+
+	if d.rtree {
+		d.logger.Debug().Str("index", "items_rtree").Msg("bounding box search")
+		tx = tx.Where("id IN (SELECT id FROM items_rtree WHERE max_lat >= ? AND min_lat <= ? AND (min_lng <= ? "+join+" max_lng >= ?))",
 			points[2].X, points[0].X, points[1].Y, points[3].Y)
-		return d.tx.Error
+	} else {
+		d.logger.Debug().Str("index", "scan").Msg("bounding box search")
 	}
+
+	// the R*Tree stores 32 bit floats rounded outwards, so the exact
+	// comparison still applies to the rows it returns.
+	return tx.Where("lat >= ? AND lat <= ? AND (lng <= ? "+join+" lng >= ?)",
+		points[2].X, points[0].X, points[1].Y, points[3].Y)
 }
 
-func (d *DB) Create(p *domain.Product) (*domain.Product, error) {
-	if err := d.db.Create(p).Error; err != nil {
-		return nil, fmt.Errorf("failed to insert product: %w", repository.ErrFatal)
+func (d *DB) Create(ctx context.Context, p *domain.Product) (*domain.Product, error) {
+	err := d.conn(ctx).Transaction(func(tx *gorm.DB) error {
+		return create(ctx, tx, p)
+	})
+	if err != nil {
+		return nil, err
 	}
 	return p, nil
 }
 
-func (d *DB) Get(id uint64) (*domain.Product, error) {
+func (d *DB) CreateMany(ctx context.Context, products []*domain.Product) error {
+	return d.conn(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, p := range products {
+			if err := create(ctx, tx, p); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// create inserts p at version 1 for the tenant of ctx and records its first
+// revision.
+func create(ctx context.Context, tx *gorm.DB, p *domain.Product) error {
+	p.ID = 0
+	p.Tenant = tenant.FromContext(ctx)
+	p.Version = 1
+	p.DeletedAt = nil
+	if err := tx.Create(p).Error; err != nil {
+		return fmt.Errorf("failed to insert product: %w", repository.ErrFatal)
+	}
+	return record(tx, audit.NewRevision(ctx, domain.ActionCreate, nil, p))
+}
+
+func (d *DB) Get(ctx context.Context, id uint64) (*domain.Product, error) {
 	var product domain.Product
 
-	err := d.db.First(&product, id).Error
+	err := scoped(ctx, d.conn(ctx)).First(&product, id).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, fmt.Errorf("not found product: %w", repository.ErrNotFound)
@@ -97,16 +269,153 @@ func (d *DB) Get(id uint64) (*domain.Product, error) {
 	return &product, nil
 }
 
-func (d *DB) Update(p *domain.Product) (*domain.Product, error) {
-	if err := d.db.Model(&domain.Product{ID: p.ID}).Update(p).Error; err != nil {
-		return nil, fmt.Errorf("failed to update product: %w", repository.ErrFatal)
+// Update replaces the stored product with p and bumps the version in a single
+// conditional statement.
+func (d *DB) Update(ctx context.Context, p *domain.Product) (*domain.Product, error) {
+	var stored domain.Product
+	err := d.conn(ctx).Transaction(func(tx *gorm.DB) error {
+		var before domain.Product
+		if err := scoped(ctx, tx).First(&before, p.ID).Error; err != nil {
+			return notFoundOr(err, "failed to update product")
+		}
+
+		q := scoped(ctx, tx.Model(&domain.Product{})).Where("id = ?", p.ID)
+		if p.Version != 0 {
+			q = q.Where("version = ?", p.Version)
+		}
+		res := q.Updates(changes(p))
+		if err := res.Error; err != nil {
+			return fmt.Errorf("failed to update product: %w", repository.ErrFatal)
+		}
+		if res.RowsAffected == 0 {
+			return missingOrStale(tx, p.ID)
+		}
+		if err := tx.First(&stored, p.ID).Error; err != nil {
+			return fmt.Errorf("failed to update product: %w", repository.ErrFatal)
+		}
+		return record(tx, audit.NewRevision(ctx, domain.ActionUpdate, &before, &stored))
+	})
+	if err != nil {
+		return nil, err
 	}
-	return p, nil
+	return &stored, nil
 }
 
-func (d *DB) Delete(id uint64) error {
-	if err := d.db.Delete(&domain.Product{ID: id}).Error; err != nil {
-		return fmt.Errorf("failed to delete product: %w", repository.ErrFatal)
+// changes are the columns Update writes. Every field is written, so zero
+// values clear the stored ones.
+func changes(p *domain.Product) map[string]interface{} {
+	return map[string]interface{}{
+		"item_name": p.ItemName,
+		"lat":       p.Lat,
+		"lng":       p.Lng,
+		"image_url": p.ImageURL,
+		"url":       p.URL,
+		"version":   gorm.Expr("version + 1"),
 	}
-	return nil
+}
+
+// Delete sets deleted_at, gorm leaves the rows that have it out of every
+// query that is not Unscoped.
+func (d *DB) Delete(ctx context.Context, id uint64, version uint64) error {
+	return d.conn(ctx).Transaction(func(tx *gorm.DB) error {
+		var before domain.Product
+		if err := scoped(ctx, tx).First(&before, id).Error; err != nil {
+			return notFoundOr(err, "failed to delete product")
+		}
+
+		q := scoped(ctx, tx.Model(&domain.Product{})).Where("id = ?", id)
+		if version != 0 {
+			q = q.Where("version = ?", version)
+		}
+		res := q.Updates(map[string]interface{}{"deleted_at": time.Now().UTC()})
+		if err := res.Error; err != nil {
+			return fmt.Errorf("failed to delete product: %w", repository.ErrFatal)
+		}
+		if res.RowsAffected == 0 {
+			return missingOrStale(tx, id)
+		}
+
+		var deleted domain.Product
+		if err := tx.Unscoped().First(&deleted, id).Error; err != nil {
+			return fmt.Errorf("failed to delete product: %w", repository.ErrFatal)
+		}
+		return record(tx, audit.NewRevision(ctx, domain.ActionDelete, &before, &deleted))
+	})
+}
+
+func (d *DB) Trash(ctx context.Context, after uint64, limit int) ([]domain.Product, error) {
+	var products []domain.Product
+	err := scoped(ctx, d.conn(ctx).Unscoped()).Where("deleted_at IS NOT NULL AND id > ?", after).Order("id").Limit(limit).Find(&products).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list trash: %w", repository.ErrFatal)
+	}
+	return products, nil
+}
+
+func (d *DB) Restore(ctx context.Context, id uint64) (*domain.Product, error) {
+	var restored domain.Product
+	err := d.conn(ctx).Transaction(func(tx *gorm.DB) error {
+		var before domain.Product
+		if err := scoped(ctx, tx.Unscoped()).Where("deleted_at IS NOT NULL").First(&before, id).Error; err != nil {
+			return notFoundOr(err, "failed to restore product")
+		}
+
+		res := tx.Unscoped().Model(&domain.Product{}).Where("id = ? AND deleted_at IS NOT NULL", id).
+			Updates(map[string]interface{}{"deleted_at": nil, "version": gorm.Expr("version + 1")})
+		if err := res.Error; err != nil {
+			return fmt.Errorf("failed to restore product: %w", repository.ErrFatal)
+		}
+		if res.RowsAffected == 0 {
+			return fmt.Errorf("not found product in trash: %w", repository.ErrNotFound)
+		}
+		if err := tx.First(&restored, id).Error; err != nil {
+			return fmt.Errorf("failed to restore product: %w", repository.ErrFatal)
+		}
+		return record(tx, audit.NewRevision(ctx, domain.ActionRestore, &before, &restored))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &restored, nil
+}
+
+func (d *DB) Purge(before time.Time) (int, error) {
+	res := d.db.Unscoped().Where("deleted_at IS NOT NULL AND deleted_at < ?", before.UTC()).Delete(&domain.Product{})
+	if err := res.Error; err != nil {
+		return 0, fmt.Errorf("failed to purge trash: %w", repository.ErrFatal)
+	}
+	return int(res.RowsAffected), nil
+}
+
+// conn returns the connection to query for ctx, tracing the statements within
+// the span of ctx.
+func (d *DB) conn(ctx context.Context) *gorm.DB {
+	return gormtrace.WithContext(ctx, d.db)
+}
+
+// scoped narrows tx to the rows of the tenant of ctx.
+func scoped(ctx context.Context, tx *gorm.DB) *gorm.DB {
+	return tx.Where("tenant = ?", tenant.FromContext(ctx))
+}
+
+// notFoundOr maps a record not found to ErrNotFound and any other error to
+// ErrFatal.
+func notFoundOr(err error, msg string) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("not found product: %w", repository.ErrNotFound)
+	}
+	return fmt.Errorf("%s: %w", msg, repository.ErrFatal)
+}
+
+// missingOrStale tells why a conditional write of the product did not change
+// any row.
+func missingOrStale(tx *gorm.DB, id uint64) error {
+	var count int
+	if err := tx.Model(&domain.Product{}).Where("id = ?", id).Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to check product: %w", repository.ErrFatal)
+	}
+	if count == 0 {
+		return fmt.Errorf("not found product: %w", repository.ErrNotFound)
+	}
+	return fmt.Errorf("stale product: %w", repository.ErrVersionMismatch)
 }
@@ -3,14 +3,27 @@
 package sqlite_test
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/jinzhu/gorm"
 	"github.com/mustafadubul/product/internal/domain"
+	"github.com/mustafadubul/product/internal/repository"
+	"github.com/mustafadubul/product/internal/repository/repositorytest"
 	"github.com/mustafadubul/product/internal/repository/sqlite"
+	"github.com/mustafadubul/product/internal/tenant"
+	"github.com/mustafadubul/product/internal/trace"
+	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
 )
 
+var ctx = context.Background()
+
 type testDB struct {
 	db *gorm.DB
 }
@@ -19,16 +32,17 @@ func StartTestDB(t *testing.T) *sqlite.DB {
 	db, err := sqlite.Open(true, "")
 	assert.Nil(t, err)
 
-	db.AutoMigrate(&domain.Product{})
+	repo := sqlite.New(db)
+	assert.Nil(t, repo.Migrate())
 
-	return sqlite.New(db)
+	return repo
 }
 
 func TestCreateEntry(t *testing.T) {
 	db := StartTestDB(t)
 	defer db.Close()
 
-	p, err := db.Create(&domain.Product{
+	p, err := db.Create(ctx, &domain.Product{
 		ID:       1,
 		ItemName: "camera",
 		Lat:      99,
@@ -36,7 +50,7 @@ func TestCreateEntry(t *testing.T) {
 	})
 
 	assert.Nil(t, err)
-	assert.Equal(t, 1, p.ID)
+	assert.Equal(t, uint64(1), p.ID)
 }
 
 func TestGetProduct(t *testing.T) {
@@ -49,10 +63,10 @@ func TestGetProduct(t *testing.T) {
 		Lng:      66,
 	}
 
-	p, err := db.Create(expectedProduct)
+	p, err := db.Create(ctx, expectedProduct)
 	assert.Nil(t, err)
 
-	product, err := db.Get(p.ID)
+	product, err := db.Get(ctx, p.ID)
 	assert.Nil(t, err)
 
 	assert.Equal(t, expectedProduct, product)
@@ -68,13 +82,13 @@ func TestDeleteProduct(t *testing.T) {
 		Lng:      66,
 	}
 
-	p, err := db.Create(product)
+	p, err := db.Create(ctx, product)
 	assert.Nil(t, err)
 
-	err = db.Delete(p.ID)
+	err = db.Delete(ctx, p.ID, 0)
 	assert.Nil(t, err)
 
-	_, err = db.Get(p.ID)
+	_, err = db.Get(ctx, p.ID)
 	assert.NotNil(t, err)
 }
 
@@ -88,7 +102,7 @@ func TestUpdateProduct(t *testing.T) {
 		Lat:      99,
 		Lng:      66,
 	}
-	p, err := db.Create(oldProduct)
+	p, err := db.Create(ctx, oldProduct)
 	assert.Nil(t, err)
 
 	updatedProduct := &domain.Product{
@@ -98,9 +112,11 @@ func TestUpdateProduct(t *testing.T) {
 		Lng:      22,
 	}
 
-	newP, err := db.Update(updatedProduct)
+	newP, err := db.Update(ctx, updatedProduct)
 	assert.Nil(t, err)
 
+	updatedProduct.Tenant = tenant.Default
+	updatedProduct.Version = 2
 	assert.Equal(t, updatedProduct, newP)
 }
 
@@ -132,7 +148,7 @@ func TestSearchBetween(t *testing.T) {
 	}
 
 	for _, p := range products {
-		_, err := db.Create(p)
+		_, err := db.Create(ctx, p)
 		assert.Nil(t, err)
 	}
 
@@ -148,9 +164,7 @@ func TestSearchBetween(t *testing.T) {
 		},
 	}
 
-	between := db.Between(points)
-
-	p, err := db.Search(between)
+	p, err := db.Search(ctx, repository.Filter{Box: points})
 	assert.Nil(t, err)
 
 	assert.Equal(t, 3, len(p))
@@ -184,13 +198,11 @@ func TestSearchLike(t *testing.T) {
 	}
 
 	for _, p := range products {
-		_, err := db.Create(p)
+		_, err := db.Create(ctx, p)
 		assert.Nil(t, err)
 	}
 
-	like := db.Like("Canon")
-
-	p, err := db.Search(like)
+	p, err := db.Search(ctx, repository.Filter{Term: "Canon"})
 	assert.Nil(t, err)
 
 	assert.Equal(t, 3, len(p))
@@ -239,7 +251,7 @@ func TestSearchBetweenLike(t *testing.T) {
 	}
 
 	for _, p := range products {
-		_, err := db.Create(p)
+		_, err := db.Create(ctx, p)
 		assert.Nil(t, err)
 	}
 
@@ -255,12 +267,269 @@ func TestSearchBetweenLike(t *testing.T) {
 		},
 	}
 
-	between := db.Between(points)
+	p, err := db.Search(ctx, repository.Filter{Term: "Go Pro Hero", Box: points})
+	assert.Nil(t, err)
+
+	assert.Equal(t, 1, len(p))
+}
+
+func TestSearchMatch(t *testing.T) {
+	db := StartTestDB(t)
+	defer db.Close()
 
-	like := db.Like("Go Pro Hero")
+	products := []*domain.Product{
+		{ItemName: "Canon 50mm f/1.2 Prime Lens"},
+		{ItemName: "Canon 6D +24-70mm F4 L/35mm + Microphone + LED Lights"},
+		{ItemName: "Go Pro Hero - Full HD"},
+		{ItemName: "Nikon D750 Camera"},
+	}
 
-	p, err := db.Search(between, like)
+	for _, p := range products {
+		_, err := db.Create(ctx, p)
+		assert.Nil(t, err)
+	}
+
+	tests := []struct {
+		term     string
+		expected int
+	}{
+		{"canon", 2},
+		{"canon lens", 1},
+		{"canon OR nikon", 3},
+		{"cam*", 1},
+		{`"prime lens"`, 1},
+		{`"lens prime"`, 0},
+		{"nikon lens", 0},
+	}
+
+	for _, tt := range tests {
+		p, err := db.Search(ctx, repository.Filter{Term: tt.term})
+		assert.Nil(t, err)
+		assert.Equal(t, tt.expected, len(p), tt.term)
+	}
+
+	// the index follows updates and deletes
+	_, err := db.Update(ctx, &domain.Product{ID: products[3].ID, ItemName: "Nikon D750 Body"})
 	assert.Nil(t, err)
+	assert.Nil(t, db.Delete(ctx, products[0].ID, 0))
 
-	assert.Equal(t, 1, len(p))
+	p, err := db.Search(ctx, repository.Filter{Term: "cam* OR lens"})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(p))
+}
+
+func TestSearchBetweenFollowsUpdates(t *testing.T) {
+	gdb, err := sqlite.Open(true, "")
+	assert.Nil(t, err)
+	db := sqlite.New(gdb)
+	assert.Nil(t, db.Migrate())
+	defer db.Close()
+
+	// indexed returns the point the R*Tree holds for the product, the
+	// search repeats the exact comparison so only the index shows the triggers
+	// keep it up to date
+	indexed := func(id uint64) (lat, lng float64, ok bool) {
+		row := gdb.Raw("SELECT min_lat, min_lng FROM items_rtree WHERE id = ?", id).Row()
+		if err := row.Scan(&lat, &lng); err != nil {
+			return 0, 0, false
+		}
+		return lat, lng, true
+	}
+
+	p, err := db.Create(ctx, &domain.Product{
+		ItemName: "camera paris",
+		Lat:      48.864716,
+		Lng:      2.349014,
+	})
+	assert.Nil(t, err)
+	lat, lng, ok := indexed(p.ID)
+	assert.True(t, ok)
+	assert.InDelta(t, 48.864716, lat, 0.0001)
+	assert.InDelta(t, 2.349014, lng, 0.0001)
+
+	london := []domain.Point{
+		{X: 51.51, Y: -0.118092},
+		{X: 51.509865, Y: -0.11},
+		{X: 51.50, Y: -0.118092},
+		{X: 51.509865, Y: -0.12},
+	}
+
+	found, err := db.Search(ctx, repository.Filter{Box: london})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(found))
+
+	_, err = db.Update(ctx, &domain.Product{ID: p.ID, ItemName: "camera london", Lat: 51.509865, Lng: -0.118092})
+	assert.Nil(t, err)
+	lat, lng, ok = indexed(p.ID)
+	assert.True(t, ok)
+	assert.InDelta(t, 51.509865, lat, 0.0001)
+	assert.InDelta(t, -0.118092, lng, 0.0001)
+
+	found, err = db.Search(ctx, repository.Filter{Box: london})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(found))
+
+	// the search plan reads the box from the index
+	var plan []string
+	rows, err := gdb.Raw(`EXPLAIN QUERY PLAN SELECT id FROM items WHERE id IN
+		(SELECT id FROM items_rtree WHERE max_lat >= ? AND min_lat <= ? AND min_lng <= ? AND max_lng >= ?)`,
+		51.50, 51.51, -0.11, -0.12).Rows()
+	assert.Nil(t, err)
+	for rows.Next() {
+		var id, parent, unused int
+		var detail string
+		assert.Nil(t, rows.Scan(&id, &parent, &unused, &detail))
+		plan = append(plan, detail)
+	}
+	rows.Close()
+	assert.Contains(t, strings.Join(plan, "\n"), "VIRTUAL TABLE INDEX")
+
+	// a deleted product stays indexed until it is purged, the search leaves
+	// it out by its deleted_at
+	assert.Nil(t, db.Delete(ctx, p.ID, 0))
+	found, err = db.Search(ctx, repository.Filter{Box: london})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(found))
+
+	_, err = db.Purge(time.Now().Add(time.Hour))
+	assert.Nil(t, err)
+	_, _, ok = indexed(p.ID)
+	assert.False(t, ok)
+}
+
+func TestSearchLimit(t *testing.T) {
+	db := StartTestDB(t)
+	defer db.Close()
+
+	for i := 0; i < 5; i++ {
+		_, err := db.Create(ctx, &domain.Product{ItemName: "camera"})
+		assert.Nil(t, err)
+	}
+
+	p, err := db.Search(ctx, repository.Filter{Term: "camera", Limit: 3})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(p))
+	assert.Equal(t, uint64(1), p[0].ID)
+	assert.Equal(t, uint64(3), p[2].ID)
+}
+
+func TestSearchConcurrent(t *testing.T) {
+	db := StartTestDB(t)
+	defer db.Close()
+
+	london := []domain.Point{
+		{X: 51.51, Y: -0.118092},
+		{X: 51.509865, Y: -0.11},
+		{X: 51.50, Y: -0.118092},
+		{X: 51.509865, Y: -0.12},
+	}
+	paris := []domain.Point{
+		{X: 48.87, Y: 2.349014},
+		{X: 48.864716, Y: 2.35},
+		{X: 48.86, Y: 2.349014},
+		{X: 48.864716, Y: 2.34},
+	}
+
+	products := []*domain.Product{
+		{ItemName: "camera london", Lat: 51.509865, Lng: -0.118092},
+		{ItemName: "lens london", Lat: 51.509865, Lng: -0.118092},
+		{ItemName: "camera paris", Lat: 48.864716, Lng: 2.349014},
+	}
+	for _, p := range products {
+		_, err := db.Create(ctx, p)
+		assert.Nil(t, err)
+	}
+
+	filters := []struct {
+		filter   repository.Filter
+		expected int
+	}{
+		{repository.Filter{Box: london}, 2},
+		{repository.Filter{Box: paris}, 1},
+		{repository.Filter{Term: "camera"}, 2},
+		{repository.Filter{Term: "camera", Box: london}, 1},
+		{repository.Filter{Term: "lens", Box: paris}, 0},
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan string, 1000)
+	for i := 0; i < 50; i++ {
+		for _, f := range filters {
+			wg.Add(1)
+			go func(f repository.Filter, expected int) {
+				defer wg.Done()
+				for j := 0; j < 10; j++ {
+					p, err := db.Search(ctx, f)
+					if err != nil {
+						errs <- err.Error()
+						return
+					}
+					if len(p) != expected {
+						errs <- fmt.Sprintf("filter %+v returned %d products, expected %d", f, len(p), expected)
+						return
+					}
+				}
+			}(f.filter, f.expected)
+		}
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestRepositoryContract(t *testing.T) {
+	repositorytest.Run(t, func(t *testing.T) repository.Product {
+		db := StartTestDB(t)
+		t.Cleanup(func() { db.Close() })
+		return db
+	})
+}
+
+func TestTraceStatements(t *testing.T) {
+	db := StartTestDB(t)
+	defer db.Close()
+
+	rec := &trace.Recorder{}
+	l := zerolog.Nop()
+	tracer := trace.NewTracer(&l, rec)
+	ctx, root := tracer.Start(ctx, "GET /q")
+
+	for _, name := range []string{"camera", "camera lens"} {
+		_, err := db.Create(ctx, &domain.Product{ItemName: name})
+		assert.Nil(t, err)
+	}
+	p, err := db.Search(ctx, repository.Filter{Term: "camera", Limit: 10})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(p))
+	_, err = db.Get(ctx, 3)
+	assert.True(t, errors.Is(err, repository.ErrNotFound))
+	root.End()
+	assert.Nil(t, tracer.Shutdown(context.Background()))
+
+	spans := rec.Spans()
+	if !assert.Equal(t, 11, len(spans)) {
+		return
+	}
+	insert, search, get := spans[0], spans[8], spans[9]
+	assert.Equal(t, "sqlite INSERT items", insert.Name)
+	assert.Equal(t, trace.KindClient, insert.Kind)
+	assert.Equal(t, root.SpanContext().SpanID, insert.Parent)
+	assert.Contains(t, insert.Attributes, trace.Int("db.rows", 1))
+
+	// the statement carries placeholders, not the term searched for
+	assert.Equal(t, "sqlite SELECT items", search.Name)
+	for _, a := range search.Attributes {
+		if a.Key == "db.statement" {
+			assert.Contains(t, a.Value, "tenant = ?")
+			assert.NotContains(t, a.Value, "camera")
+		}
+	}
+	assert.Contains(t, search.Attributes, trace.Int("db.rows", 2))
+
+	// a record not found is no failure
+	assert.Contains(t, get.Attributes, trace.Int("db.rows", 0))
+	assert.Empty(t, get.Error)
 }
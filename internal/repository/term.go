@@ -0,0 +1,162 @@
+package repository
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/mustafadubul/product/internal/domain"
+	"github.com/mustafadubul/product/pkg/geo"
+)
+
+// TermPart is a single word, prefix or quoted phrase of a search term.
+type TermPart struct {
+	Text   string
+	Prefix bool
+}
+
+// TermQuery is a search term parsed into groups of parts. A product matches
+// when all parts of any of the groups match, i.e. AND binds tighter than OR.
+type TermQuery [][]TermPart
+
+// ParseTerm parses a user supplied search term, see Filter.Term for the
+// syntax. Everything else is treated as text so user input can never produce
+// an invalid query in the backend.
+func ParseTerm(term string) TermQuery {
+	var (
+		query TermQuery
+		group []TermPart
+	)
+
+	closeGroup := func() {
+		if len(group) > 0 {
+			query = append(query, group)
+		}
+		group = nil
+	}
+
+	for _, tok := range splitTerm(term) {
+		switch {
+		case tok == "OR":
+			closeGroup()
+		case tok == "AND":
+		case strings.HasPrefix(tok, `"`):
+			if text := strings.TrimSpace(strings.Trim(tok, `"`)); text != "" {
+				group = append(group, TermPart{Text: text})
+			}
+		default:
+			prefix := strings.HasSuffix(tok, "*")
+			if text := strings.TrimRight(tok, "*"); text != "" {
+				group = append(group, TermPart{Text: text, Prefix: prefix})
+			}
+		}
+	}
+	closeGroup()
+
+	return query
+}
+
+// splitTerm splits on white space, keeping quoted phrases together.
+func splitTerm(term string) []string {
+	var (
+		tokens []string
+		b      strings.Builder
+		quoted bool
+	)
+
+	flush := func() {
+		if b.Len() > 0 {
+			tokens = append(tokens, b.String())
+		}
+		b.Reset()
+	}
+
+	for _, r := range term {
+		switch {
+		case r == '"':
+			if quoted {
+				b.WriteRune(r)
+				flush()
+			} else {
+				flush()
+				b.WriteRune(r)
+			}
+			quoted = !quoted
+		case unicode.IsSpace(r) && !quoted:
+			flush()
+		default:
+			b.WriteRune(r)
+		}
+	}
+	flush()
+
+	return tokens
+}
+
+// Match tells whether name matches the query the way the backends match item
+// names: the words of a part have to follow each other in name and a prefix
+// part matches the start of its last word. An empty query matches any name.
+//
+// Words are compared as they are, while the full text indexes of SQLite and
+// PostgreSQL stem them, so a search for "microphones" finds a "Microphone"
+// that Match rejects. Webhooks and saved searches, which match with it, only
+// see such products when their term is not inflected differently.
+func (q TermQuery) Match(name string) bool {
+	if len(q) == 0 {
+		return true
+	}
+
+	words := Tokenize(name)
+	for _, group := range q {
+		match := true
+		for _, part := range group {
+			if !ContainsTokens(words, Tokenize(part.Text), part.Prefix) {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches tells whether p matches the term of q and lies within its radius,
+// the same way an export is filtered: a zero radius matches products
+// anywhere. The term is matched without stemming, see TermQuery.Match.
+func Matches(q *domain.Query, p *domain.Product) bool {
+	if q.Radius > 0 && geo.Distance(q.Lat, q.Lng, p.Lat, p.Lng) > q.Radius {
+		return false
+	}
+	return ParseTerm(q.Term).Match(p.ItemName)
+}
+
+// Tokenize splits s into the lower cased words item names and terms are
+// matched on.
+func Tokenize(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// ContainsTokens tells whether want follows each other in name, with the last
+// of want matching the start of its word in name if prefix is set.
+func ContainsTokens(name, want []string, prefix bool) bool {
+	if len(want) == 0 {
+		return false
+	}
+	for i := 0; i+len(want) <= len(name); i++ {
+		match := true
+		for j, w := range want {
+			last := j == len(want)-1
+			if name[i+j] != w && !(last && prefix && strings.HasPrefix(name[i+j], w)) {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
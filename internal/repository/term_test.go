@@ -0,0 +1,50 @@
+package repository_test
+
+import (
+	"testing"
+
+	"github.com/mustafadubul/product/internal/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTerm(t *testing.T) {
+	tests := []struct {
+		term     string
+		expected repository.TermQuery
+	}{
+		{`canon`, repository.TermQuery{{{Text: "canon"}}}},
+		{`canon lens`, repository.TermQuery{{{Text: "canon"}, {Text: "lens"}}}},
+		{`canon AND lens`, repository.TermQuery{{{Text: "canon"}, {Text: "lens"}}}},
+		{`canon OR nikon lens`, repository.TermQuery{{{Text: "canon"}}, {{Text: "nikon"}, {Text: "lens"}}}},
+		{`cam*`, repository.TermQuery{{{Text: "cam", Prefix: true}}}},
+		{`"prime lens" canon`, repository.TermQuery{{{Text: "prime lens"}, {Text: "canon"}}}},
+		{`f/1.2 "50mm`, repository.TermQuery{{{Text: "f/1.2"}, {Text: "50mm"}}}},
+		{`OR canon OR`, repository.TermQuery{{{Text: "canon"}}}},
+		{`* ""`, nil},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, repository.ParseTerm(tt.term), tt.term)
+	}
+}
+
+func TestTermQueryMatch(t *testing.T) {
+	tests := []struct {
+		term     string
+		name     string
+		expected bool
+	}{
+		{``, "Canon EOS", true},
+		{`canon`, "Canon EOS 5D", true},
+		{`canon lens`, "Canon EOS", false},
+		{`canon OR nikon lens`, "Nikon 50mm lens", true},
+		{`cam*`, "Digital camera", true},
+		{`cam`, "Digital camera", false},
+		{`"prime lens"`, "Sigma prime lens", true},
+		{`"prime lens"`, "Sigma lens prime", false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, repository.ParseTerm(tt.term).Match(tt.name), "%s in %s", tt.term, tt.name)
+	}
+}
@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/mustafadubul/product/internal/domain"
+	"github.com/mustafadubul/product/internal/trace"
+)
+
+type traced struct {
+	Product
+}
+
+// Traced returns p tracing its queries as children of the span of their
+// context, with the number of rows they return or write. The backends trace
+// the SQL statements of a query below its span.
+func Traced(p Product) Product {
+	return &traced{Product: p}
+}
+
+// end ends the span of a query. ErrNotFound, ErrConflict and
+// ErrVersionMismatch answer the query and do not fail the span.
+func end(span *trace.Span, err error, rows int) {
+	if err == nil {
+		span.SetAttributes(trace.Int("repository.rows", int64(rows)))
+	} else if !errors.Is(err, ErrNotFound) && !errors.Is(err, ErrConflict) && !errors.Is(err, ErrVersionMismatch) {
+		span.SetError(err)
+	}
+	span.End()
+}
+
+// filterAttributes describe the shape of a search without the values searched
+// for.
+func filterAttributes(f *Filter) []trace.Attribute {
+	return []trace.Attribute{
+		trace.Bool("repository.filter.term", f.Term != ""),
+		trace.Bool("repository.filter.area", f.Within != nil || len(f.Box) > 0),
+		trace.Int("repository.filter.limit", int64(f.Limit)),
+	}
+}
+
+func (t *traced) Search(ctx context.Context, f Filter) ([]domain.Product, error) {
+	ctx, span := trace.Start(ctx, "repository.Search", filterAttributes(&f)...)
+	products, err := t.Product.Search(ctx, f)
+	end(span, err, len(products))
+	return products, err
+}
+
+func (t *traced) Each(ctx context.Context, f Filter, fn func(p *domain.Product) error) error {
+	ctx, span := trace.Start(ctx, "repository.Each", filterAttributes(&f)...)
+	rows := 0
+	err := t.Product.Each(ctx, f, func(p *domain.Product) error {
+		rows++
+		return fn(p)
+	})
+	end(span, err, rows)
+	return err
+}
+
+func (t *traced) Create(ctx context.Context, p *domain.Product) (*domain.Product, error) {
+	ctx, span := trace.Start(ctx, "repository.Create")
+	created, err := t.Product.Create(ctx, p)
+	end(span, err, 1)
+	return created, err
+}
+
+func (t *traced) CreateMany(ctx context.Context, products []*domain.Product) error {
+	ctx, span := trace.Start(ctx, "repository.CreateMany")
+	err := t.Product.CreateMany(ctx, products)
+	end(span, err, len(products))
+	return err
+}
+
+func (t *traced) Get(ctx context.Context, id uint64) (*domain.Product, error) {
+	ctx, span := trace.Start(ctx, "repository.Get")
+	p, err := t.Product.Get(ctx, id)
+	end(span, err, 1)
+	return p, err
+}
+
+func (t *traced) Update(ctx context.Context, p *domain.Product) (*domain.Product, error) {
+	ctx, span := trace.Start(ctx, "repository.Update")
+	updated, err := t.Product.Update(ctx, p)
+	end(span, err, 1)
+	return updated, err
+}
+
+func (t *traced) Delete(ctx context.Context, id uint64, version uint64) error {
+	ctx, span := trace.Start(ctx, "repository.Delete")
+	err := t.Product.Delete(ctx, id, version)
+	end(span, err, 1)
+	return err
+}
+
+func (t *traced) Trash(ctx context.Context, after uint64, limit int) ([]domain.Product, error) {
+	ctx, span := trace.Start(ctx, "repository.Trash")
+	products, err := t.Product.Trash(ctx, after, limit)
+	end(span, err, len(products))
+	return products, err
+}
+
+func (t *traced) Restore(ctx context.Context, id uint64) (*domain.Product, error) {
+	ctx, span := trace.Start(ctx, "repository.Restore")
+	p, err := t.Product.Restore(ctx, id)
+	end(span, err, 1)
+	return p, err
+}
+
+func (t *traced) History(ctx context.Context, id uint64, after uint64, limit int) ([]domain.Revision, error) {
+	ctx, span := trace.Start(ctx, "repository.History")
+	revisions, err := t.Product.History(ctx, id, after, limit)
+	end(span, err, len(revisions))
+	return revisions, err
+}
+
+func (t *traced) Revision(ctx context.Context, id uint64, number uint64) (*domain.Revision, error) {
+	ctx, span := trace.Start(ctx, "repository.Revision")
+	rev, err := t.Product.Revision(ctx, id, number)
+	end(span, err, 1)
+	return rev, err
+}
@@ -0,0 +1,54 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/mustafadubul/product/internal/domain"
+	"github.com/mustafadubul/product/internal/repository"
+	"github.com/mustafadubul/product/internal/repository/memory"
+	"github.com/mustafadubul/product/internal/trace"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTraced(t *testing.T) {
+	rec := &trace.Recorder{}
+	l := zerolog.Nop()
+	tracer := trace.NewTracer(&l, rec)
+	repo := repository.Traced(memory.New())
+	ctx, root := tracer.Start(context.Background(), "GET /q")
+
+	for _, name := range []string{"camera", "camera lens"} {
+		_, err := repo.Create(ctx, &domain.Product{ItemName: name})
+		assert.NoError(t, err)
+	}
+	found, err := repo.Search(ctx, repository.Filter{Term: "camera", Limit: 10})
+	assert.NoError(t, err)
+	assert.Len(t, found, 2)
+	// not found answers the query, it does not fail the span
+	_, err = repo.Get(ctx, 3)
+	assert.True(t, errors.Is(err, repository.ErrNotFound))
+	root.End()
+	assert.NoError(t, tracer.Shutdown(context.Background()))
+
+	spans := rec.Spans()
+	if !assert.Len(t, spans, 5) {
+		return
+	}
+	for _, s := range spans[:4] {
+		assert.Equal(t, root.SpanContext().SpanID, s.Parent)
+		assert.Empty(t, s.Error)
+	}
+	search := spans[2]
+	assert.Equal(t, "repository.Search", search.Name)
+	assert.Equal(t, []trace.Attribute{
+		trace.Bool("repository.filter.term", true),
+		trace.Bool("repository.filter.area", false),
+		trace.Int("repository.filter.limit", 10),
+		trace.Int("repository.rows", 2),
+	}, search.Attributes)
+	assert.Equal(t, "repository.Get", spans[3].Name)
+	assert.Empty(t, spans[3].Attributes)
+}
@@ -0,0 +1,115 @@
+// Package savedsearch evaluates the saved searches incrementally: every
+// product created, updated or restored is matched against them as its event
+// is read from the outbox, instead of rerunning the searches.
+package savedsearch
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mustafadubul/product/internal/domain"
+	"github.com/mustafadubul/product/internal/repository"
+	"github.com/rs/zerolog"
+)
+
+// Notifier tells the owner of a saved search about a new match.
+type Notifier interface {
+	Notify(ctx context.Context, s *domain.SavedSearch, m *domain.Match) error
+}
+
+// LogNotifier logs the matches, it is the notifier of an evaluator that is
+// not configured otherwise.
+type LogNotifier struct {
+	logger *zerolog.Logger
+}
+
+func NewLogNotifier(l *zerolog.Logger) *LogNotifier {
+	componentLogger := l.With().Str("component", "notifier").Logger()
+	return &LogNotifier{logger: &componentLogger}
+}
+
+func (n *LogNotifier) Notify(ctx context.Context, s *domain.SavedSearch, m *domain.Match) error {
+	n.logger.Info().Str("owner", s.Owner).Uint64("saved_search", s.ID).Uint64("product", m.ProductID).
+		Msg("saved search matched")
+	return nil
+}
+
+// Evaluator is an events.Publisher recording the products that come into the
+// saved searches.
+type Evaluator struct {
+	logger   *zerolog.Logger
+	store    repository.SavedSearches
+	notifier Notifier
+}
+
+// Option configures optional behaviour of the Evaluator.
+type Option func(*Evaluator)
+
+// WithNotifier sets the notifier told about new matches.
+func WithNotifier(n Notifier) Option {
+	return func(e *Evaluator) {
+		e.notifier = n
+	}
+}
+
+// NewEvaluator returns an evaluator of the saved searches in store.
+func NewEvaluator(l *zerolog.Logger, store repository.SavedSearches, opts ...Option) *Evaluator {
+	componentLogger := l.With().Str("component", "saved-searches").Logger()
+	e := &Evaluator{
+		logger: &componentLogger,
+		store:  store,
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	if e.notifier == nil {
+		e.notifier = NewLogNotifier(l)
+	}
+	return e
+}
+
+// Publish matches the products of the events against the saved searches of
+// their tenant created before the events. A product matches a saved search
+// once, the first time it is in its area and has its term, so replayed events
+// are not recorded twice. The notifier is told about new matches only, a failed
+// notification is logged and not retried as the match is recorded already.
+func (e *Evaluator) Publish(ctx context.Context, events []domain.Event) error {
+	searches, err := e.store.SavedSearches("")
+	if err != nil {
+		return fmt.Errorf("failed to read saved searches: %w", err)
+	}
+
+	for i := range events {
+		ev := &events[i]
+		if ev.Type == domain.EventDeleted {
+			continue
+		}
+		for j := range searches {
+			s := &searches[j]
+			if ev.Tenant != s.Tenant || ev.At.Before(s.CreatedAt) || !repository.Matches(&s.Query, &ev.Product) {
+				continue
+			}
+
+			m := &domain.Match{
+				SavedSearchID: s.ID,
+				ProductID:     ev.ProductID,
+				Offset:        ev.Offset,
+				Product:       ev.Product,
+				MatchedAt:     time.Now().UTC(),
+			}
+			added, err := e.store.AddMatch(m)
+			if err != nil {
+				return fmt.Errorf("failed to record match of event %d: %w", ev.Offset, err)
+			}
+			if !added {
+				continue
+			}
+			if err := e.notifier.Notify(ctx, s, m); err != nil {
+				e.logger.Warn().Err(err).Uint64("saved_search", s.ID).Uint64("product", m.ProductID).
+					Msg("failed to notify match")
+			}
+		}
+	}
+	return nil
+}
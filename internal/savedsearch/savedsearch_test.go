@@ -0,0 +1,94 @@
+package savedsearch_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mustafadubul/product/internal/domain"
+	"github.com/mustafadubul/product/internal/repository/memory"
+	"github.com/mustafadubul/product/internal/savedsearch"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+type recorder struct {
+	matches []domain.Match
+	err     error
+}
+
+func (r *recorder) Notify(ctx context.Context, s *domain.SavedSearch, m *domain.Match) error {
+	r.matches = append(r.matches, *m)
+	return r.err
+}
+
+func TestEvaluator(t *testing.T) {
+	store := memory.New()
+	created := time.Now().Add(-time.Hour)
+
+	cameras, err := store.CreateSavedSearch(&domain.SavedSearch{
+		Owner: "alice", CreatedAt: created,
+		Query: domain.Query{Term: "camera", Lat: 51.5, Lng: -0.1, Radius: 10000},
+	})
+	assert.NoError(t, err)
+	anything, err := store.CreateSavedSearch(&domain.SavedSearch{Owner: "bob", CreatedAt: created})
+	assert.NoError(t, err)
+
+	now := time.Now()
+	london := domain.Product{ID: 1, ItemName: "Camera", Lat: 51.51, Lng: -0.12}
+	paris := domain.Product{ID: 2, ItemName: "Camera", Lat: 48.86, Lng: 2.35}
+	events := []domain.Event{
+		{Offset: 1, Type: domain.EventCreated, ProductID: 2, At: now, Product: paris},
+		// the camera moves into the area of alice
+		{Offset: 2, Type: domain.EventUpdated, ProductID: 2, At: now, Product: domain.Product{ID: 2, ItemName: "Camera", Lat: 51.52, Lng: -0.11}},
+		{Offset: 3, Type: domain.EventCreated, ProductID: 1, At: now, Product: london},
+		{Offset: 4, Type: domain.EventUpdated, ProductID: 1, At: now, Product: london},
+		{Offset: 5, Type: domain.EventCreated, ProductID: 3, At: created.Add(-time.Minute), Product: domain.Product{ID: 3, ItemName: "Camera"}},
+		{Offset: 6, Type: domain.EventDeleted, ProductID: 4, At: now, Product: domain.Product{ID: 4, ItemName: "Camera"}},
+		// the saved searches do not see the products of other tenants
+		{Offset: 7, Tenant: "acme", Type: domain.EventCreated, ProductID: 5, At: now, Product: domain.Product{ID: 5, ItemName: "Camera", Lat: 51.51, Lng: -0.12}},
+	}
+
+	notifier := &recorder{}
+	l := zerolog.Nop()
+	e := savedsearch.NewEvaluator(&l, store, savedsearch.WithNotifier(notifier))
+	assert.NoError(t, e.Publish(context.Background(), events))
+	// replaying a batch records and notifies nothing new
+	assert.NoError(t, e.Publish(context.Background(), events))
+
+	matches, err := store.Matches(cameras.ID, 0, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{2, 3}, offsets(matches))
+
+	matches, err = store.Matches(anything.ID, 0, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{1, 3}, offsets(matches))
+
+	assert.Len(t, notifier.matches, 4)
+}
+
+func TestEvaluatorNotifierFails(t *testing.T) {
+	store := memory.New()
+	s, err := store.CreateSavedSearch(&domain.SavedSearch{Owner: "alice"})
+	assert.NoError(t, err)
+
+	// the match is kept when the owner cannot be notified
+	l := zerolog.Nop()
+	e := savedsearch.NewEvaluator(&l, store, savedsearch.WithNotifier(&recorder{err: errors.New("mail down")}))
+	assert.NoError(t, e.Publish(context.Background(), []domain.Event{
+		{Offset: 1, Type: domain.EventCreated, ProductID: 1, At: time.Now(), Product: domain.Product{ID: 1}},
+	}))
+
+	matches, err := store.Matches(s.ID, 0, 0)
+	assert.NoError(t, err)
+	assert.Len(t, matches, 1)
+}
+
+func offsets(matches []domain.Match) []uint64 {
+	offsets := make([]uint64, len(matches))
+	for i, m := range matches {
+		offsets[i] = m.Offset
+	}
+	return offsets
+}
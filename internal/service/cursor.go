@@ -0,0 +1,81 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+
+	"github.com/mustafadubul/product/internal/domain"
+	"github.com/mustafadubul/product/internal/repository"
+)
+
+// cursor marks the last result of a page by its position in the ranking.
+// Results are ordered by score, distance and ID, so the next page starts with
+// the first result ranked after the cursor even when results were added or
+// removed in between. The place of the result lets a search without a term,
+// which is ranked on distance alone, read on from the cursor.
+type cursor struct {
+	Query    uint32  `json:"q"`
+	Score    float64 `json:"s"`
+	Distance float64 `json:"d"`
+	ID       uint64  `json:"i"`
+	Lat      float64 `json:"lat"`
+	Lng      float64 `json:"lng"`
+}
+
+func newCursor(q *domain.Query, r domain.SearchResult) cursor {
+	return cursor{
+		Query:    fingerprint(q),
+		Score:    r.Score,
+		Distance: r.Distance,
+		ID:       r.ID,
+		Lat:      r.Lat,
+		Lng:      r.Lng,
+	}
+}
+
+func (c cursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string, q *domain.Query) (*cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("malformed cursor: %w", ErrInputInvalid)
+	}
+
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("malformed cursor: %w", ErrInputInvalid)
+	}
+	if c.Query != fingerprint(q) {
+		return nil, fmt.Errorf("cursor belongs to another query: %w", ErrInputInvalid)
+	}
+	return &c, nil
+}
+
+// after reports whether r is ranked after the cursor.
+func (c cursor) after(r domain.SearchResult) bool {
+	if r.Score != c.Score {
+		return r.Score < c.Score
+	}
+	if r.Distance != c.Distance {
+		return r.Distance > c.Distance
+	}
+	return r.ID > c.ID
+}
+
+// position is the place of the cursor in the distance order of the
+// repository.
+func (c cursor) position() *repository.Position {
+	return &repository.Position{ID: c.ID, Lat: c.Lat, Lng: c.Lng}
+}
+
+// fingerprint identifies the query a cursor was issued for.
+func fingerprint(q *domain.Query) uint32 {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%s|%v|%v|%v", q.Term, q.Lat, q.Lng, q.Radius)
+	return h.Sum32()
+}
@@ -0,0 +1,39 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mustafadubul/product/internal/domain"
+	"github.com/mustafadubul/product/internal/repository"
+	"github.com/mustafadubul/product/internal/tenant"
+)
+
+// WithOutbox sets the outbox the events of the writes are read from.
+func WithOutbox(o repository.Outbox) Option {
+	return func(s *Service) {
+		s.outbox = o
+	}
+}
+
+// Events returns up to limit events of the tenant of ctx with an offset above
+// after, in offset order. A zero limit falls back on the search limit.
+func (s *Service) Events(ctx context.Context, after uint64, limit int) ([]domain.Event, error) {
+	l := s.logger.With().Str("service", "Events").Logger()
+
+	limit, err := s.pageLimit(limit)
+	if err != nil {
+		return nil, err
+	}
+	if s.outbox == nil {
+		l.Error().Msg("no outbox configured")
+		return nil, fmt.Errorf("events are not available: %w", ErrRequestFailed)
+	}
+
+	events, err := s.outbox.Events(tenant.FromContext(ctx), after, limit)
+	if err != nil {
+		l.Error().Err(err).Msg("failed to read events")
+		return nil, fmt.Errorf("failed to read events: %w", ErrRequestFailed)
+	}
+	return events, nil
+}
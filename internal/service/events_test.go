@@ -0,0 +1,35 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/mustafadubul/product/internal/domain"
+	"github.com/mustafadubul/product/internal/service"
+	"github.com/mustafadubul/product/internal/tenant"
+	"github.com/mustafadubul/product/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvents(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	outbox := mocks.NewMockRepoOutbox(ctrl)
+	s, _ := newService(ctrl, service.WithOutbox(outbox))
+
+	outbox.EXPECT().Events(tenant.Default, uint64(4), service.DefaultLimit).Return([]domain.Event{{Offset: 5}}, nil)
+
+	events, err := s.Events(context.Background(), 4, 0)
+	assert.NoError(t, err)
+	assert.Len(t, events, 1)
+
+	_, err = s.Events(context.Background(), 4, service.MaxLimit+1)
+	assert.True(t, errors.Is(err, service.ErrInputInvalid))
+
+	// without an outbox there are no events to read
+	s, _ = newService(ctrl)
+	_, err = s.Events(context.Background(), 0, 0)
+	assert.True(t, errors.Is(err, service.ErrRequestFailed))
+}
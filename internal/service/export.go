@@ -0,0 +1,63 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mustafadubul/product/internal/domain"
+	"github.com/mustafadubul/product/internal/repository"
+	"github.com/mustafadubul/product/pkg/geo"
+)
+
+// Export calls fn with every product in ID order. When q is not nil only the
+// products matching its term and within its radius are exported, a zero
+// radius exports products anywhere. The export stops when ctx is done or fn
+// returns an error.
+func (s *Service) Export(ctx context.Context, q *domain.Query, fn func(p *domain.Product) error) error {
+	l := s.logger.With().Str("service", "Export").Logger()
+
+	var filter repository.Filter
+	var within func(p *domain.Product) bool
+	if q != nil {
+		if err := validateExport(q); err != nil {
+			return err
+		}
+		filter.Term = q.Term
+		if q.Radius > 0 {
+			filter.Box = geo.BoundingBox(q.Lat, q.Lng, q.Radius)
+			filter.Within = &repository.Circle{Lat: q.Lat, Lng: q.Lng, Radius: q.Radius}
+			within = func(p *domain.Product) bool {
+				return geo.Distance(q.Lat, q.Lng, p.Lat, p.Lng) <= q.Radius
+			}
+		}
+	}
+
+	var exported int
+	var stopped error
+	err := s.products.Each(ctx, filter, func(p *domain.Product) error {
+		if err := ctx.Err(); err != nil {
+			stopped = err
+			return err
+		}
+		if within != nil && !within(p) {
+			return nil
+		}
+		if err := fn(p); err != nil {
+			stopped = err
+			return err
+		}
+		exported++
+		return nil
+	})
+	if stopped != nil {
+		l.Info().Err(stopped).Int("exported", exported).Msg("export stopped")
+		return stopped
+	}
+	if err != nil {
+		l.Error().Err(err).Msg("failed to export products")
+		return fmt.Errorf("failed to export products: %w", ErrRequestFailed)
+	}
+
+	l.Info().Int("exported", exported).Msg("export finished")
+	return nil
+}
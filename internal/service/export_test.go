@@ -0,0 +1,74 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/mustafadubul/product/internal/domain"
+	"github.com/mustafadubul/product/internal/repository"
+	"github.com/mustafadubul/product/internal/service"
+	"github.com/stretchr/testify/assert"
+)
+
+func each(products ...domain.Product) func(context.Context, repository.Filter, func(*domain.Product) error) error {
+	return func(_ context.Context, _ repository.Filter, fn func(*domain.Product) error) error {
+		for i := range products {
+			if err := fn(&products[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func TestExport(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s, repo := newService(ctrl)
+
+	near := domain.Product{ID: 1, ItemName: "camera", Lat: 51.509865, Lng: -0.118092}
+	corner := domain.Product{ID: 2, ItemName: "camera", Lat: 51.5160, Lng: -0.1070}
+
+	q := &domain.Query{Term: "camera", Lat: 51.509865, Lng: -0.118092, Radius: 1000}
+	repo.EXPECT().Each(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, f repository.Filter, fn func(*domain.Product) error) error {
+		assert.Equal(t, "camera", f.Term)
+		assert.Len(t, f.Box, 4)
+		assert.Equal(t, &repository.Circle{Lat: q.Lat, Lng: q.Lng, Radius: q.Radius}, f.Within)
+		return each(near, corner)(ctx, f, fn)
+	})
+
+	var exported []uint64
+	err := s.Export(context.Background(), q, func(p *domain.Product) error {
+		exported = append(exported, p.ID)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{1}, exported)
+}
+
+func TestExportStops(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s, repo := newService(ctrl)
+
+	repo.EXPECT().Each(gomock.Any(), repository.Filter{}, gomock.Any()).DoAndReturn(each(domain.Product{ID: 1}, domain.Product{ID: 2}))
+
+	closed := errors.New("closed pipe")
+	err := s.Export(context.Background(), nil, func(p *domain.Product) error {
+		return closed
+	})
+	assert.Equal(t, closed, err)
+}
+
+func TestExportFailed(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s, repo := newService(ctrl)
+
+	repo.EXPECT().Each(gomock.Any(), repository.Filter{}, gomock.Any()).Return(repository.ErrFatal)
+
+	err := s.Export(context.Background(), nil, func(p *domain.Product) error { return nil })
+	assert.True(t, errors.Is(err, service.ErrRequestFailed))
+}
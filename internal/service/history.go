@@ -0,0 +1,60 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/mustafadubul/product/internal/domain"
+	"github.com/mustafadubul/product/internal/repository"
+)
+
+// History returns up to limit revisions of the product numbered above after,
+// oldest first. A zero limit falls back on the search limit. The history of a
+// product is kept after it is deleted or purged.
+func (s *Service) History(ctx context.Context, id uint64, after uint64, limit int) ([]domain.Revision, error) {
+	l := s.logger.With().Str("service", "History").Logger()
+
+	limit, err := s.pageLimit(limit)
+	if err != nil {
+		return nil, err
+	}
+
+	history, err := s.products.History(ctx, id, after, limit)
+	if err != nil {
+		l.Error().Err(err).Msg("failed to read history")
+		return nil, fmt.Errorf("failed to read history: %w", ErrRequestFailed)
+	}
+	return history, nil
+}
+
+// Revision returns a revision of the product.
+func (s *Service) Revision(ctx context.Context, id uint64, number uint64) (*domain.Revision, error) {
+	l := s.logger.With().Str("service", "Revision").Logger()
+
+	rev, err := s.products.Revision(ctx, id, number)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, fmt.Errorf("revision not found: %w", ErrNotFound)
+		}
+		l.Error().Err(err).Msg("failed to get revision")
+		return nil, fmt.Errorf("failed to get revision: %w", ErrRequestFailed)
+	}
+	return rev, nil
+}
+
+// Revert updates the product to the snapshot of one of its revisions, which
+// records a new revision. A non-zero version makes the revert conditional like
+// Update. A product in the trash has to be restored before it is reverted.
+func (s *Service) Revert(ctx context.Context, id uint64, number uint64, version uint64) (*domain.Product, error) {
+	rev, err := s.Revision(ctx, id, number)
+	if err != nil {
+		return nil, err
+	}
+
+	p := rev.Snapshot
+	p.ID = id
+	p.Version = version
+	p.DeletedAt = nil
+	return s.Update(ctx, &p)
+}
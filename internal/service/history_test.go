@@ -0,0 +1,54 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/mustafadubul/product/internal/domain"
+	"github.com/mustafadubul/product/internal/repository"
+	"github.com/mustafadubul/product/internal/service"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistory(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s, repo := newService(ctrl)
+
+	repo.EXPECT().History(gomock.Any(), uint64(7), uint64(2), service.DefaultLimit).Return([]domain.Revision{{ProductID: 7, Number: 3}}, nil)
+
+	history, err := s.History(context.Background(), 7, 2, 0)
+	assert.NoError(t, err)
+	assert.Len(t, history, 1)
+
+	_, err = s.History(context.Background(), 7, 0, -1)
+	assert.True(t, errors.Is(err, service.ErrInputInvalid))
+}
+
+func TestRevert(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s, repo := newService(ctrl)
+
+	deletedAt := time.Now()
+	rev := &domain.Revision{ProductID: 7, Number: 2, Action: domain.ActionDelete, Snapshot: domain.Product{
+		ID: 7, ItemName: "canon", Lat: 51.5, Lng: -0.1, Version: 2, DeletedAt: &deletedAt,
+	}}
+
+	repo.EXPECT().Revision(gomock.Any(), uint64(7), uint64(2)).Return(rev, nil)
+	repo.EXPECT().Update(gomock.Any(), &domain.Product{ID: 7, ItemName: "canon", Lat: 51.5, Lng: -0.1, Version: 5}).
+		Return(&domain.Product{ID: 7, ItemName: "canon", Lat: 51.5, Lng: -0.1, Version: 6}, nil)
+
+	p, err := s.Revert(context.Background(), 7, 2, 5)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(6), p.Version)
+
+	repo.EXPECT().Revision(gomock.Any(), uint64(7), uint64(9)).Return(nil, fmt.Errorf("not found revision: %w", repository.ErrNotFound))
+
+	_, err = s.Revert(context.Background(), 7, 9, 0)
+	assert.True(t, errors.Is(err, service.ErrNotFound))
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/mustafadubul/product/internal/bulk"
+	"github.com/mustafadubul/product/internal/domain"
+)
+
+// DefaultBatchSize is the number of products stored per transaction by an
+// import, when the service is not configured otherwise.
+const DefaultBatchSize = 500
+
+// WithBatchSize sets the number of products stored per transaction by an
+// import. Sizes below 1 are rejected and keep the current size.
+func WithBatchSize(n int) Option {
+	return func(s *Service) {
+		if n < 1 {
+			s.logger.Warn().Int("batch_size", n).Msg("batch size must be at least 1, ignored")
+			return
+		}
+		s.batchSize = n
+	}
+}
+
+// Import reads a catalogue and stores its products in batches. Rows that can
+// not be read or stored are rejected and reported with the reason, they never
+// stop the import. When a batch fails its rows are retried one by one so only
+// the offending rows are rejected. Products get new IDs, the IDs of the
+// catalogue only identify the rejected rows.
+func (s *Service) Import(ctx context.Context, r io.Reader, format bulk.Format) (*domain.ImportReport, error) {
+	l := s.logger.With().Str("service", "Import").Logger()
+
+	decoder, err := bulk.NewDecoder(format, r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read catalogue: %v: %w", err, ErrInputInvalid)
+	}
+
+	report := &domain.ImportReport{}
+	batch := make([]*domain.Product, 0, s.batchSize)
+	lines := make([]int, 0, s.batchSize)
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		s.storeBatch(ctx, report, batch, lines)
+		batch = make([]*domain.Product, 0, s.batchSize)
+		lines = lines[:0]
+	}
+	// rejected rows are reported as they are read, stored rows once their
+	// batch is written
+	defer func() {
+		sort.SliceStable(report.Rows, func(i, j int) bool { return report.Rows[i].Line < report.Rows[j].Line })
+	}()
+
+	for {
+		if err := ctx.Err(); err != nil {
+			flush()
+			return report, err
+		}
+
+		row, err := decoder.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			flush()
+			l.Info().Err(err).Int("accepted", report.Accepted).Msg("import aborted")
+			return report, fmt.Errorf("failed to read catalogue: %v: %w", err, ErrInputInvalid)
+		}
+
+		if row.Err == nil {
+			row.Err = validateProduct(&row.Product)
+		}
+		if row.Err != nil {
+			reject(report, row.Line, row.Product.ID, row.Err.Error())
+			continue
+		}
+
+		p := row.Product
+		batch = append(batch, &p)
+		lines = append(lines, row.Line)
+		if len(batch) == s.batchSize {
+			flush()
+		}
+	}
+	flush()
+
+	l.Info().Int("accepted", report.Accepted).Int("rejected", report.Rejected).Msg("import finished")
+	return report, nil
+}
+
+func (s *Service) storeBatch(ctx context.Context, report *domain.ImportReport, batch []*domain.Product, lines []int) {
+	// the IDs of the catalogue, storing a product replaces its ID
+	ids := make([]uint64, len(batch))
+	for i, p := range batch {
+		ids[i] = p.ID
+	}
+
+	err := s.products.CreateMany(ctx, batch)
+	if err == nil {
+		for i, p := range batch {
+			accept(report, lines[i], p.ID)
+		}
+		return
+	}
+	s.logger.Debug().Err(err).Int("size", len(batch)).Msg("batch failed, storing products one by one")
+
+	for i, p := range batch {
+		if _, err := s.products.Create(ctx, p); err != nil {
+			reject(report, lines[i], ids[i], "failed to store product")
+			continue
+		}
+		accept(report, lines[i], p.ID)
+	}
+}
+
+func accept(report *domain.ImportReport, line int, id uint64) {
+	report.Accepted++
+	report.Rows = append(report.Rows, domain.ImportRow{Line: line, ID: id, Accepted: true})
+}
+
+func reject(report *domain.ImportReport, line int, id uint64, reason string) {
+	report.Rejected++
+	report.Rows = append(report.Rows, domain.ImportRow{Line: line, ID: id, Reason: reason})
+}
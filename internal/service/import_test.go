@@ -0,0 +1,107 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/mustafadubul/product/internal/bulk"
+	"github.com/mustafadubul/product/internal/domain"
+	"github.com/mustafadubul/product/internal/repository"
+	"github.com/mustafadubul/product/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImport(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s, repo := newService(ctrl, service.WithBatchSize(2))
+
+	input := "description,lat,lng\n" +
+		"canon,51.5,-0.1\n" +
+		"nikon,north,-0.1\n" +
+		"sony,51.6,-0.2\n" +
+		"leica,51.7,-0.3\n"
+
+	var stored []string
+	repo.EXPECT().CreateMany(gomock.Any(), gomock.Any()).Times(2).DoAndReturn(func(_ context.Context, products []*domain.Product) error {
+		for _, p := range products {
+			stored = append(stored, p.ItemName)
+			p.ID = uint64(len(stored))
+		}
+		return nil
+	})
+
+	report, err := s.Import(context.Background(), strings.NewReader(input), bulk.CSV)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"canon", "sony", "leica"}, stored)
+	assert.Equal(t, 3, report.Accepted)
+	assert.Equal(t, 1, report.Rejected)
+	assert.Equal(t, []domain.ImportRow{
+		{Line: 2, ID: 1, Accepted: true},
+		{Line: 3, Reason: `invalid lat "north"`},
+		{Line: 4, ID: 2, Accepted: true},
+		{Line: 5, ID: 3, Accepted: true},
+	}, report.Rows)
+}
+
+func TestImportBatchSize(t *testing.T) {
+	for _, n := range []int{0, -1} {
+		ctrl := gomock.NewController(t)
+		s, repo := newService(ctrl, service.WithBatchSize(n))
+
+		input := "description,lat,lng\n" + strings.Repeat("canon,51.5,-0.1\n", service.DefaultBatchSize+1)
+
+		// the size is rejected, the import keeps to the default batches
+		var sizes []int
+		repo.EXPECT().CreateMany(gomock.Any(), gomock.Any()).Times(2).DoAndReturn(func(_ context.Context, products []*domain.Product) error {
+			sizes = append(sizes, len(products))
+			return nil
+		})
+
+		report, err := s.Import(context.Background(), strings.NewReader(input), bulk.CSV)
+		require.NoError(t, err, n)
+		assert.Equal(t, service.DefaultBatchSize+1, report.Accepted, n)
+		assert.Equal(t, []int{service.DefaultBatchSize, 1}, sizes, n)
+		ctrl.Finish()
+	}
+}
+
+func TestImportFailedBatch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s, repo := newService(ctrl, service.WithBatchSize(2))
+
+	input := `{"id":1,"description":"canon","lat":51.5,"lng":-0.1}` + "\n" +
+		`{"id":2,"description":"nikon","lat":51.5,"lng":-0.1}` + "\n"
+
+	repo.EXPECT().CreateMany(gomock.Any(), gomock.Any()).Return(errors.New("disk full"))
+	repo.EXPECT().Create(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, p *domain.Product) (*domain.Product, error) {
+		return p, nil
+	})
+	repo.EXPECT().Create(gomock.Any(), gomock.Any()).Return(nil, fmt.Errorf("failed to insert product: %w", repository.ErrFatal))
+
+	report, err := s.Import(context.Background(), strings.NewReader(input), bulk.NDJSON)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, report.Accepted)
+	assert.Equal(t, 1, report.Rejected)
+	assert.Equal(t, []domain.ImportRow{
+		{Line: 1, ID: 1, Accepted: true},
+		{Line: 2, ID: 2, Reason: "failed to store product"},
+	}, report.Rows)
+}
+
+func TestImportInvalidCatalogue(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s, _ := newService(ctrl, service.WithBatchSize(2))
+
+	_, err := s.Import(context.Background(), strings.NewReader(`{"type":"FeatureCollection"}`), bulk.GeoJSON)
+	assert.True(t, errors.Is(err, service.ErrInputInvalid))
+}
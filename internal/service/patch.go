@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/mustafadubul/product/internal/domain"
+	"github.com/mustafadubul/product/internal/repository"
+)
+
+// patchAttempts is how often Patch reapplies a patch that lost the race
+// against another write, when the caller did not ask for a version.
+const patchAttempts = 3
+
+// Patch applies a merge patch to the stored product. The patched product is
+// validated as a whole and written at the version it was read at, so
+// concurrent writes are never overwritten. A non-zero version makes the patch
+// conditional like Update.
+func (s *Service) Patch(ctx context.Context, id uint64, version uint64, patch *domain.ProductPatch) (*domain.Product, error) {
+	l := s.logger.With().Str("service", "Patch").Logger()
+
+	for attempt := 1; ; attempt++ {
+		p, err := s.Get(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if version != 0 && p.Version != version {
+			return nil, fmt.Errorf("product was changed since version %d: %w", version, ErrPreconditionFailed)
+		}
+
+		patch.Apply(p)
+		if err := validateProduct(p); err != nil {
+			return nil, err
+		}
+
+		stored, err := s.products.Update(ctx, p)
+		switch {
+		case err == nil:
+			return stored, nil
+		case errors.Is(err, repository.ErrNotFound):
+			return nil, fmt.Errorf("product not found: %w", ErrNotFound)
+		case errors.Is(err, repository.ErrVersionMismatch):
+			if version != 0 {
+				return nil, fmt.Errorf("product was changed since version %d: %w", version, ErrPreconditionFailed)
+			}
+			if attempt < patchAttempts {
+				continue
+			}
+			l.Info().Err(err).Uint64("id", id).Msg("patch kept losing against concurrent writes")
+			return nil, fmt.Errorf("product keeps changing: %w", ErrConflict)
+		}
+		l.Error().Err(err).Msg("failed to patch product")
+		return nil, fmt.Errorf("failed to patch product: %w", ErrRequestFailed)
+	}
+}
@@ -0,0 +1,77 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/mustafadubul/product/internal/domain"
+	"github.com/mustafadubul/product/internal/repository"
+	"github.com/mustafadubul/product/internal/service"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPatch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s, repo := newService(ctrl)
+
+	stored := &domain.Product{ID: 7, ItemName: "canon", Lat: 51.5, Lng: -0.1, ImageURL: "https://example.com/canon.png", Version: 2}
+	name := "Canon EOS"
+	cleared := ""
+
+	repo.EXPECT().Get(gomock.Any(), uint64(7)).Return(stored, nil)
+	repo.EXPECT().Update(gomock.Any(), &domain.Product{ID: 7, ItemName: "Canon EOS", Lat: 51.5, Lng: -0.1, Version: 2}).
+		DoAndReturn(func(_ context.Context, p *domain.Product) (*domain.Product, error) {
+			p.Version++
+			return p, nil
+		})
+
+	p, err := s.Patch(context.Background(), 7, 0, &domain.ProductPatch{ItemName: &name, ImageURL: &cleared})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), p.Version)
+}
+
+func TestPatchRetries(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s, repo := newService(ctrl)
+
+	stale := fmt.Errorf("stale product: %w", repository.ErrVersionMismatch)
+	name := "Canon EOS"
+
+	gomock.InOrder(
+		repo.EXPECT().Get(gomock.Any(), uint64(7)).Return(&domain.Product{ID: 7, ItemName: "canon", Lat: 51.5, Version: 2}, nil),
+		repo.EXPECT().Update(gomock.Any(), gomock.Any()).Return(nil, stale),
+		repo.EXPECT().Get(gomock.Any(), uint64(7)).Return(&domain.Product{ID: 7, ItemName: "canon", Lat: 52, Version: 3}, nil),
+		repo.EXPECT().Update(gomock.Any(), &domain.Product{ID: 7, ItemName: "Canon EOS", Lat: 52, Version: 3}).Return(&domain.Product{ID: 7, Version: 4}, nil),
+	)
+
+	_, err := s.Patch(context.Background(), 7, 0, &domain.ProductPatch{ItemName: &name})
+	assert.NoError(t, err)
+}
+
+func TestPatchPrecondition(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s, repo := newService(ctrl)
+
+	repo.EXPECT().Get(gomock.Any(), uint64(7)).Return(&domain.Product{ID: 7, ItemName: "canon", Version: 3}, nil)
+
+	_, err := s.Patch(context.Background(), 7, 2, &domain.ProductPatch{})
+	assert.True(t, errors.Is(err, service.ErrPreconditionFailed))
+}
+
+func TestPatchInvalid(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s, repo := newService(ctrl)
+
+	repo.EXPECT().Get(gomock.Any(), uint64(7)).Return(&domain.Product{ID: 7, ItemName: "canon", Version: 3}, nil)
+
+	lat := 91.0
+	_, err := s.Patch(context.Background(), 7, 0, &domain.ProductPatch{Lat: &lat})
+	assert.True(t, errors.Is(err, service.ErrInputInvalid))
+}
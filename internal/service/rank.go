@@ -0,0 +1,245 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mustafadubul/product/internal/domain"
+	"github.com/mustafadubul/product/internal/repository"
+	"github.com/mustafadubul/product/pkg/geo"
+)
+
+const (
+	// DefaultLimit is the number of results returned by a search that does
+	// not ask for a limit, when the service is not configured otherwise.
+	DefaultLimit = 20
+
+	// MaxLimit is the largest number of results a search can ask for.
+	MaxLimit = 100
+
+	// DefaultCandidates is the number of products a search reads from the
+	// repository at a time when the service is not configured otherwise.
+	DefaultCandidates = 10000
+)
+
+// Weights controls how search results are ranked. Exact, Prefix, Token and
+// Fuzzy are the relevance given to each kind of match between the search term
+// and the item name, the best one wins. Text and Proximity blend that
+// relevance with how close the item is to the queried location.
+type Weights struct {
+	Exact  float64
+	Prefix float64
+	Token  float64
+	Fuzzy  float64
+
+	Text      float64
+	Proximity float64
+}
+
+var DefaultWeights = Weights{
+	Exact:  1,
+	Prefix: 0.8,
+	Token:  0.6,
+	Fuzzy:  0.3,
+
+	Text:      0.7,
+	Proximity: 0.3,
+}
+
+// minFuzzySimilarity is the edit distance similarity under which two tokens
+// are no longer considered a fuzzy match.
+const minFuzzySimilarity = 0.6
+
+// ParseWeights reads weights in the form "text=0.7,proximity=0.3,exact=1".
+// Weights that are not given keep their default value.
+func ParseWeights(s string) (Weights, error) {
+	w := DefaultWeights
+	if strings.TrimSpace(s) == "" {
+		return w, nil
+	}
+
+	fields := map[string]*float64{
+		"exact":     &w.Exact,
+		"prefix":    &w.Prefix,
+		"token":     &w.Token,
+		"fuzzy":     &w.Fuzzy,
+		"text":      &w.Text,
+		"proximity": &w.Proximity,
+	}
+
+	for _, pair := range strings.Split(s, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return w, fmt.Errorf("invalid weight %q", pair)
+		}
+		field, ok := fields[strings.TrimSpace(kv[0])]
+		if !ok {
+			return w, fmt.Errorf("unknown weight %q", kv[0])
+		}
+		v, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64)
+		if err != nil || v < 0 {
+			return w, fmt.Errorf("invalid value for weight %q", kv[0])
+		}
+		*field = v
+	}
+	return w, nil
+}
+
+// rank keeps the products that are within the queried radius, scores them and
+// returns them best first.
+func rank(w Weights, q *domain.Query, products []domain.Product) []domain.SearchResult {
+	groups := termGroups(q.Term)
+
+	results := make([]domain.SearchResult, 0, len(products))
+	for _, p := range products {
+		d := geo.Distance(q.Lat, q.Lng, p.Lat, p.Lng)
+		if d > q.Radius {
+			continue
+		}
+
+		var best float64
+		if len(groups) > 0 {
+			name := repository.Tokenize(p.ItemName)
+			for _, term := range groups {
+				if r := relevance(w, term, name); r > best {
+					best = r
+				}
+			}
+		}
+
+		results = append(results, domain.SearchResult{Product: p, Distance: d, Score: score(w, q, len(groups) > 0, best, d)})
+	}
+
+	sortResults(results)
+	return results
+}
+
+// score blends the relevance of a product with its proximity to the queried
+// location, searches without a term are ranked on proximity alone.
+func score(w Weights, q *domain.Query, term bool, relevance, distance float64) float64 {
+	proximity := 1.0
+	if q.Radius > 0 {
+		proximity = 1 - distance/q.Radius
+	}
+	if !term {
+		return proximity
+	}
+	return w.Text*relevance + w.Proximity*proximity
+}
+
+// maxRelevance is the best relevance a product can have.
+func maxRelevance(w Weights) float64 {
+	return math.Max(math.Max(w.Exact, w.Prefix), math.Max(w.Token, w.Fuzzy))
+}
+
+// sortResults orders results by score, best first, then by distance and ID.
+func sortResults(results []domain.SearchResult) {
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		if results[i].Distance != results[j].Distance {
+			return results[i].Distance < results[j].Distance
+		}
+		return results[i].ID < results[j].ID
+	})
+}
+
+// termGroups returns the words of every OR group of the term, the way the
+// backends parse it, so operators and wildcards are not scored as words.
+func termGroups(term string) [][]string {
+	var groups [][]string
+	for _, group := range repository.ParseTerm(term) {
+		var words []string
+		for _, part := range group {
+			words = append(words, repository.Tokenize(part.Text)...)
+		}
+		if len(words) > 0 {
+			groups = append(groups, words)
+		}
+	}
+	return groups
+}
+
+// relevance scores how well the name matches the words of a term group. Words
+// that are a whole word or prefix of the name score as tokens, misspelt ones,
+// which the postgres backend matches on trigrams, score as fuzzy matches.
+func relevance(w Weights, term, name []string) float64 {
+	if len(name) == 0 {
+		return 0
+	}
+
+	t := strings.Join(term, " ")
+	n := strings.Join(name, " ")
+
+	if n == t {
+		return w.Exact
+	}
+	if strings.HasPrefix(n, t) {
+		return w.Prefix
+	}
+
+	var tokens, fuzzy float64
+	for _, tt := range term {
+		var best float64
+		for _, nt := range name {
+			if strings.HasPrefix(nt, tt) {
+				best = 1
+				break
+			}
+			if s := similarity(tt, nt); s > best {
+				best = s
+			}
+		}
+
+		if best == 1 {
+			tokens++
+		} else if best >= minFuzzySimilarity {
+			fuzzy += best
+		}
+	}
+
+	return (w.Token*tokens + w.Fuzzy*fuzzy) / float64(len(term))
+}
+
+// similarity is the levenshtein distance between a and b normalised to [0, 1].
+func similarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) == 0 && len(rb) == 0 {
+		return 1
+	}
+
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = minInt(prev[j]+1, minInt(curr[j-1]+1, prev[j-1]+cost))
+		}
+		prev, curr = curr, prev
+	}
+
+	longest := len(ra)
+	if len(rb) > longest {
+		longest = len(rb)
+	}
+	return 1 - float64(prev[len(rb)])/float64(longest)
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
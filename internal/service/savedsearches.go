@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mustafadubul/product/internal/audit"
+	"github.com/mustafadubul/product/internal/domain"
+	"github.com/mustafadubul/product/internal/repository"
+	"github.com/mustafadubul/product/internal/tenant"
+)
+
+// WithSavedSearches sets the store of the saved searches.
+func WithSavedSearches(ss repository.SavedSearches) Option {
+	return func(s *Service) {
+		s.searches = ss
+	}
+}
+
+// CreateSavedSearch saves the search for the actor of ctx, who owns it, in the
+// tenant of ctx.
+func (s *Service) CreateSavedSearch(ctx context.Context, ss *domain.SavedSearch) (*domain.SavedSearch, error) {
+	l := s.logger.With().Str("service", "CreateSavedSearch").Logger()
+
+	if err := validateSavedSearch(ss); err != nil {
+		return nil, err
+	}
+	if s.searches == nil {
+		l.Error().Msg("no saved search store configured")
+		return nil, fmt.Errorf("saved searches are not available: %w", ErrRequestFailed)
+	}
+
+	ss.ID = 0
+	ss.Tenant = tenant.FromContext(ctx)
+	ss.Owner = audit.FromContext(ctx).Actor
+	ss.Query.Limit = 0
+	ss.Query.Cursor = ""
+	ss.CreatedAt = time.Now().UTC()
+
+	created, err := s.searches.CreateSavedSearch(ss)
+	if err != nil {
+		l.Error().Err(err).Msg("failed to create saved search")
+		return nil, fmt.Errorf("failed to create saved search: %w", ErrRequestFailed)
+	}
+	return created, nil
+}
+
+// SavedSearches lists the saved searches of the actor of ctx in the tenant of
+// ctx.
+func (s *Service) SavedSearches(ctx context.Context) ([]domain.SavedSearch, error) {
+	l := s.logger.With().Str("service", "SavedSearches").Logger()
+
+	if s.searches == nil {
+		l.Error().Msg("no saved search store configured")
+		return nil, fmt.Errorf("saved searches are not available: %w", ErrRequestFailed)
+	}
+
+	owned, err := s.searches.SavedSearches(audit.FromContext(ctx).Actor)
+	if err != nil {
+		l.Error().Err(err).Msg("failed to list saved searches")
+		return nil, fmt.Errorf("failed to list saved searches: %w", ErrRequestFailed)
+	}
+	t := tenant.FromContext(ctx)
+	searches := owned[:0]
+	for _, ss := range owned {
+		if ss.Tenant == t {
+			searches = append(searches, ss)
+		}
+	}
+	return searches, nil
+}
+
+// DeleteSavedSearch removes a saved search of the actor of ctx with its
+// matches.
+func (s *Service) DeleteSavedSearch(ctx context.Context, id uint64) error {
+	l := s.logger.With().Str("service", "DeleteSavedSearch").Logger()
+
+	if _, err := s.ownSavedSearch(ctx, id); err != nil {
+		return err
+	}
+	if err := s.searches.DeleteSavedSearch(id); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return fmt.Errorf("saved search not found: %w", ErrNotFound)
+		}
+		l.Error().Err(err).Msg("failed to delete saved search")
+		return fmt.Errorf("failed to delete saved search: %w", ErrRequestFailed)
+	}
+	return nil
+}
+
+// Matches returns up to limit matches of a saved search of the actor of ctx
+// with an ID above after, oldest first. A zero limit falls back on the search
+// limit.
+func (s *Service) Matches(ctx context.Context, id uint64, after uint64, limit int) ([]domain.Match, error) {
+	l := s.logger.With().Str("service", "Matches").Logger()
+
+	limit, err := s.pageLimit(limit)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.ownSavedSearch(ctx, id); err != nil {
+		return nil, err
+	}
+
+	matches, err := s.searches.Matches(id, after, limit)
+	if err != nil {
+		l.Error().Err(err).Msg("failed to read matches")
+		return nil, fmt.Errorf("failed to read matches: %w", ErrRequestFailed)
+	}
+	return matches, nil
+}
+
+// ownSavedSearch returns the saved search when the actor of ctx owns it in the
+// tenant of ctx, the saved searches of others are not found.
+func (s *Service) ownSavedSearch(ctx context.Context, id uint64) (*domain.SavedSearch, error) {
+	l := s.logger.With().Str("service", "SavedSearch").Logger()
+
+	if s.searches == nil {
+		l.Error().Msg("no saved search store configured")
+		return nil, fmt.Errorf("saved searches are not available: %w", ErrRequestFailed)
+	}
+
+	ss, err := s.searches.SavedSearch(id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, fmt.Errorf("saved search not found: %w", ErrNotFound)
+		}
+		l.Error().Err(err).Msg("failed to get saved search")
+		return nil, fmt.Errorf("failed to get saved search: %w", ErrRequestFailed)
+	}
+	if ss.Owner != audit.FromContext(ctx).Actor || ss.Tenant != tenant.FromContext(ctx) {
+		return nil, fmt.Errorf("saved search not found: %w", ErrNotFound)
+	}
+	return ss, nil
+}
@@ -0,0 +1,73 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/mustafadubul/product/internal/audit"
+	"github.com/mustafadubul/product/internal/domain"
+	"github.com/mustafadubul/product/internal/service"
+	"github.com/mustafadubul/product/internal/tenant"
+	"github.com/mustafadubul/product/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateSavedSearch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	store := mocks.NewMockRepoSavedSearches(ctrl)
+	s, _ := newService(ctrl, service.WithSavedSearches(store))
+
+	store.EXPECT().CreateSavedSearch(gomock.Any()).DoAndReturn(func(ss *domain.SavedSearch) (*domain.SavedSearch, error) {
+		ss.ID = 4
+		return ss, nil
+	})
+
+	ctx := tenant.NewContext(audit.NewContext(context.Background(), audit.Info{Actor: "alice"}), "acme")
+	ss, err := s.CreateSavedSearch(ctx, &domain.SavedSearch{
+		Owner: "mallory", Name: "cameras", Query: domain.Query{Term: "camera", Lat: 51.5, Lng: -0.1, Radius: 1000, Limit: 5},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(4), ss.ID)
+	assert.Equal(t, "alice", ss.Owner)
+	assert.Equal(t, "acme", ss.Tenant)
+	assert.Zero(t, ss.Query.Limit)
+
+	_, err = s.CreateSavedSearch(ctx, &domain.SavedSearch{Query: domain.Query{Lat: 91, Radius: 10}})
+	assert.True(t, errors.Is(err, service.ErrInputInvalid))
+}
+
+func TestSavedSearchOwner(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	store := mocks.NewMockRepoSavedSearches(ctrl)
+	s, _ := newService(ctrl, service.WithSavedSearches(store))
+
+	alice := audit.NewContext(context.Background(), audit.Info{Actor: "alice"})
+	bob := audit.NewContext(context.Background(), audit.Info{Actor: "bob"})
+
+	store.EXPECT().SavedSearches("alice").Return([]domain.SavedSearch{
+		{ID: 4, Tenant: tenant.Default, Owner: "alice"}, {ID: 5, Tenant: "acme", Owner: "alice"},
+	}, nil)
+	store.EXPECT().SavedSearch(uint64(4)).Return(&domain.SavedSearch{ID: 4, Tenant: tenant.Default, Owner: "alice"}, nil).Times(4)
+	store.EXPECT().Matches(uint64(4), uint64(0), service.DefaultLimit).Return([]domain.Match{{ID: 1, SavedSearchID: 4}}, nil)
+	store.EXPECT().DeleteSavedSearch(uint64(4)).Return(nil)
+
+	searches, err := s.SavedSearches(alice)
+	assert.NoError(t, err)
+	assert.Len(t, searches, 1)
+
+	matches, err := s.Matches(alice, 4, 0, 0)
+	assert.NoError(t, err)
+	assert.Len(t, matches, 1)
+
+	// the saved searches of others are not found
+	_, err = s.Matches(bob, 4, 0, 0)
+	assert.True(t, errors.Is(err, service.ErrNotFound))
+	_, err = s.Matches(tenant.NewContext(alice, "acme"), 4, 0, 0)
+	assert.True(t, errors.Is(err, service.ErrNotFound))
+
+	assert.NoError(t, s.DeleteSavedSearch(alice, 4))
+}
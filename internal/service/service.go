@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/mustafadubul/product/internal/domain"
 
@@ -17,66 +18,206 @@ var (
 	ErrNotFound      = errors.New("not found")
 	ErrRequestFailed = errors.New("request failed")
 	ErrInputInvalid  = errors.New("input invalid")
+
+	// ErrConflict is returned when a write clashes with concurrent ones, e.g.
+	// a patch keeps losing against other writes.
+	ErrConflict = errors.New("conflict")
+	// ErrPreconditionFailed is returned when a conditional request does not
+	// hold for the stored product.
+	ErrPreconditionFailed = errors.New("precondition failed")
 )
 
 type Service struct {
 	ctx    context.Context
 	logger *zerolog.Logger
 
+	weights    Weights
+	limit      int
+	candidates int
+	batchSize  int
+	retention  time.Duration
+
 	products repository.Product
+	outbox   repository.Outbox
+	webhooks repository.Webhooks
+	searches repository.SavedSearches
+}
+
+// Option configures optional behaviour of the Service.
+type Option func(*Service)
+
+// WithWeights sets the weights used to rank search results.
+func WithWeights(w Weights) Option {
+	return func(s *Service) {
+		s.weights = w
+	}
 }
 
-func New(l *zerolog.Logger, productRepo repository.Product) *Service {
+// WithLimit sets the number of results returned by a search that does not
+// ask for a limit.
+func WithLimit(n int) Option {
+	return func(s *Service) {
+		s.limit = n
+	}
+}
+
+// WithCandidates sets the number of products a search with a term reads from
+// the repository at a time.
+func WithCandidates(n int) Option {
+	return func(s *Service) {
+		s.candidates = n
+	}
+}
+
+func New(l *zerolog.Logger, productRepo repository.Product, opts ...Option) *Service {
 	componentLogger := l.With().Str("component", "service").Logger()
-	return &Service{
-		logger:   &componentLogger,
-		products: productRepo,
+	s := &Service{
+		logger:     &componentLogger,
+		weights:    DefaultWeights,
+		limit:      DefaultLimit,
+		candidates: DefaultCandidates,
+		batchSize:  DefaultBatchSize,
+		retention:  DefaultRetention,
+		products:   productRepo,
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+	return s
 }
 
-func (s *Service) Search(ctx context.Context, q *domain.Query) ([]domain.Product, error) {
+// Search returns a page of the best scoring products within q.Radius meters
+// of the queried location, ranked on a blend of text relevance and proximity.
+// The repository returns the products in the bounding box of the radius
+// nearest first, in batches of the configured number of candidates. Reading
+// stops once no product further away can outrank the page, so a dense area
+// never drops the best results. A search without a term is ranked on distance
+// alone, it only reads the page and reads on from the cursor.
+func (s *Service) Search(ctx context.Context, q *domain.Query) (*domain.Page, error) {
 	l := s.logger.With().Str("service", "Search").Logger()
 
-	queryFunctions := []func() error{}
-
-	points := geo.BoundingBox(q.Lat, q.Lng, q.Radius)
+	limit := q.Limit
+	if limit == 0 {
+		limit = s.limit
+	}
+	if err := validateQuery(q, limit); err != nil {
+		return nil, err
+	}
 
-	between := s.products.Between(points)
-	queryFunctions = append(queryFunctions, between)
+	var after *cursor
+	if q.Cursor != "" {
+		c, err := decodeCursor(q.Cursor, q)
+		if err != nil {
+			return nil, err
+		}
+		after = c
+	}
 
-	if q.Term != "" {
-		like := s.products.Like(q.Term)
-		queryFunctions = append(queryFunctions, like)
+	term := len(termGroups(q.Term)) > 0
+	filter := repository.Filter{
+		Term:   q.Term,
+		Box:    geo.BoundingBox(q.Lat, q.Lng, q.Radius),
+		Within: &repository.Circle{Lat: q.Lat, Lng: q.Lng, Radius: q.Radius},
+		Order:  repository.OrderDistance,
+		Limit:  s.candidates,
+	}
+	if !term {
+		filter.Limit = limit + 1
+		if after != nil {
+			filter.After = after.position()
+		}
 	}
 
-	products, err := s.products.Search(queryFunctions...)
-	if err != nil {
-		if !errors.Is(err, repository.ErrNotFound) {
-			l.Error().Err(err).Msg("failed to search products")
-			return nil, fmt.Errorf("failed to search products: %w", ErrRequestFailed)
+	var results []domain.SearchResult
+	for {
+		products, err := s.products.Search(ctx, filter)
+		if err != nil {
+			if !errors.Is(err, repository.ErrNotFound) {
+				l.Error().Err(err).Msg("failed to search products")
+				return nil, fmt.Errorf("failed to search products: %w", ErrRequestFailed)
+			}
+			return nil, fmt.Errorf("product not found: %w", ErrNotFound)
 		}
-		return nil, fmt.Errorf("product not found: %w", ErrNotFound)
+
+		for _, r := range rank(s.weights, q, products) {
+			if after == nil || after.after(r) {
+				results = append(results, r)
+			}
+		}
+		sortResults(results)
+
+		if filter.Limit < 1 || len(products) < filter.Limit {
+			break
+		}
+		last := products[len(products)-1]
+		d := geo.Distance(q.Lat, q.Lng, last.Lat, last.Lng)
+		if d > q.Radius || len(results) > limit && s.outranks(q, term, results[limit], d, last.ID) {
+			break
+		}
+		filter.After = &repository.Position{ID: last.ID, Lat: last.Lat, Lng: last.Lng}
+	}
+
+	page := &domain.Page{TotalEstimate: len(results)}
+	if len(results) > limit {
+		results = results[:limit]
+		page.NextCursor = newCursor(q, results[limit-1]).encode()
 	}
 
-	return products, nil
+	page.Items = results
+	return page, nil
 }
 
+// outranks reports whether r ranks before every product the repository
+// returns after the product id, which are at least d meters away.
+func (s *Service) outranks(q *domain.Query, term bool, r domain.SearchResult, d float64, id uint64) bool {
+	bound := score(s.weights, q, term, maxRelevance(s.weights), d)
+	if r.Score != bound {
+		return r.Score > bound
+	}
+	if r.Distance != d {
+		return r.Distance < d
+	}
+	return r.ID <= id
+}
+
+// Update replaces the stored product with p, fields left out are cleared. When
+// p.Version is set the update only applies if the stored product is still at
+// that version, it fails with ErrPreconditionFailed otherwise.
 func (s *Service) Update(ctx context.Context, p *domain.Product) (*domain.Product, error) {
 	l := s.logger.With().Str("service", "Update").Logger()
 
-	p, err := s.products.Update(p)
+	if err := validateProduct(p); err != nil {
+		return nil, err
+	}
+
+	version := p.Version
+	p, err := s.products.Update(ctx, p)
 	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, fmt.Errorf("product not found: %w", ErrNotFound)
+		}
+		if errors.Is(err, repository.ErrVersionMismatch) {
+			return nil, fmt.Errorf("product was changed since version %d: %w", version, ErrPreconditionFailed)
+		}
 		l.Error().Err(err).Msg("failed to update products")
 		return nil, fmt.Errorf("failed to update products: %w", ErrRequestFailed)
 	}
 	return p, nil
 }
 
-func (s *Service) Delete(ctx context.Context, id uint64) error {
+// Delete moves the product to the trash. A non-zero version makes the delete
+// conditional like Update.
+func (s *Service) Delete(ctx context.Context, id uint64, version uint64) error {
 	l := s.logger.With().Str("service", "Delete").Logger()
 
-	err := s.products.Delete(id)
+	err := s.products.Delete(ctx, id, version)
 	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return fmt.Errorf("product not found: %w", ErrNotFound)
+		}
+		if errors.Is(err, repository.ErrVersionMismatch) {
+			return fmt.Errorf("product was changed since version %d: %w", version, ErrPreconditionFailed)
+		}
 		l.Error().Err(err).Msg("failed to delete products")
 		return fmt.Errorf("failed to delete products: %w", ErrRequestFailed)
 	}
@@ -86,7 +227,11 @@ func (s *Service) Delete(ctx context.Context, id uint64) error {
 func (s *Service) Create(ctx context.Context, p *domain.Product) (*domain.Product, error) {
 	l := s.logger.With().Str("service", "Create").Logger()
 
-	p, err := s.products.Create(p)
+	if err := validateProduct(p); err != nil {
+		return nil, err
+	}
+
+	p, err := s.products.Create(ctx, p)
 	if err != nil {
 		l.Error().Err(err).Msg("failed to create products")
 		return nil, fmt.Errorf("failed to create products: %w", ErrRequestFailed)
@@ -97,7 +242,7 @@ func (s *Service) Create(ctx context.Context, p *domain.Product) (*domain.Produc
 func (s *Service) Get(ctx context.Context, id uint64) (*domain.Product, error) {
 	l := s.logger.With().Str("service", "Get").Logger()
 
-	product, err := s.products.Get(id)
+	product, err := s.products.Get(ctx, id)
 	if err != nil {
 		if !errors.Is(err, repository.ErrNotFound) {
 			l.Error().Err(err).Msg("failed to get products")
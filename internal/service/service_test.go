@@ -2,10 +2,13 @@ package service_test
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"testing"
 
 	"github.com/golang/mock/gomock"
 	"github.com/mustafadubul/product/internal/domain"
+	"github.com/mustafadubul/product/internal/repository"
 	"github.com/mustafadubul/product/internal/service"
 	"github.com/mustafadubul/product/mocks"
 	"github.com/rs/zerolog"
@@ -33,6 +36,14 @@ func CreateService(t *testing.T) *Service {
 	}
 }
 
+// newService returns a service configured with opts on a mocked product
+// repository of ctrl, which the mocked stores passed in opts share.
+func newService(ctrl *gomock.Controller, opts ...service.Option) (*service.Service, *mocks.MockRepoProduct) {
+	repo := mocks.NewMockRepoProduct(ctrl)
+	l := zerolog.Nop()
+	return service.New(&l, repo, opts...), repo
+}
+
 func (s *Service) Finish() {
 	s.ctrl.Finish()
 	s.cancel()
@@ -41,6 +52,13 @@ func (s *Service) Finish() {
 func TestService(t *testing.T) {
 	t.Run("query products", testSearch_QueryProducts)
 	t.Run("query products with term", testSearch_QueryProductsWithterm)
+	t.Run("query products within radius by distance", testSearch_RanksByDistance)
+	t.Run("query products ranked by relevance", testSearch_RanksByRelevance)
+	t.Run("query products ranked by the best term group", testSearch_RanksByTermGroup)
+	t.Run("query products ranked by misspelt terms", testSearch_RanksByFuzzyMatch)
+	t.Run("query products limited to top results", testSearch_Limit)
+	t.Run("query products by cursor", testSearch_Cursor)
+	t.Run("query products in batches nearest first", testSearch_Batches)
 	t.Run("get single products", testGetProduct)
 	t.Run("update single products", testUpdateProduct)
 	t.Run("delete single products", testDeleteProduct)
@@ -57,13 +75,19 @@ func testSearch_QueryProducts(t *testing.T) {
 	}
 
 	points := []domain.Point{
-		{51.509909966080286, -0.11809199999997985},
-		{51.50984485186806, -0.11801975142352036},
-		{51.50983808958223, -0.11809199999997985},
-		{51.509909263797134, -0.1181642486786242},
+		{X: 51.50990996608029, Y: -0.118092},
+		{X: 51.509865, Y: -0.1180197513915456},
+		{X: 51.5098200339197, Y: -0.118092},
+		{X: 51.509865, Y: -0.11816424860845441},
 	}
 
-	s.mockProductRepo.EXPECT().Between(points)
+	// without a term the page is read nearest first
+	filter := repository.Filter{
+		Box:    points,
+		Within: &repository.Circle{Lat: 51.509865, Lng: -0.118092, Radius: 5},
+		Order:  repository.OrderDistance,
+		Limit:  service.DefaultLimit + 1,
+	}
 
 	products := []domain.Product{
 		{
@@ -83,11 +107,11 @@ func testSearch_QueryProducts(t *testing.T) {
 		},
 	}
 
-	s.mockProductRepo.EXPECT().Search(gomock.Any()).Return(products, nil)
+	s.mockProductRepo.EXPECT().Search(gomock.Any(), filter).Return(products, nil)
 
-	products, err := s.Search(context.Background(), query)
+	page, err := s.Search(context.Background(), query)
 	assert.Nil(t, err)
-	assert.NotNil(t, products)
+	assert.NotNil(t, page)
 }
 
 func testSearch_QueryProductsWithterm(t *testing.T) {
@@ -101,14 +125,20 @@ func testSearch_QueryProductsWithterm(t *testing.T) {
 	}
 
 	points := []domain.Point{
-		{51.509909966080286, -0.11809199999997985},
-		{51.50984485186806, -0.11801975142352036},
-		{51.50983808958223, -0.11809199999997985},
-		{51.509909263797134, -0.1181642486786242},
+		{X: 51.50990996608029, Y: -0.118092},
+		{X: 51.509865, Y: -0.1180197513915456},
+		{X: 51.5098200339197, Y: -0.118092},
+		{X: 51.509865, Y: -0.11816424860845441},
+	}
+
+	filter := repository.Filter{
+		Term:   "canon",
+		Box:    points,
+		Within: &repository.Circle{Lat: 51.509865, Lng: -0.118092, Radius: 5},
+		Order:  repository.OrderDistance,
+		Limit:  service.DefaultCandidates,
 	}
 
-	s.mockProductRepo.EXPECT().Between(points)
-	s.mockProductRepo.EXPECT().Like("canon")
 	products := []domain.Product{
 		{
 			ItemName: "Canon 50mm f/1.2 Prime Lens",
@@ -127,11 +157,326 @@ func testSearch_QueryProductsWithterm(t *testing.T) {
 		},
 	}
 
-	s.mockProductRepo.EXPECT().Search(gomock.Any()).Return(products, nil)
+	s.mockProductRepo.EXPECT().Search(gomock.Any(), filter).Return(products, nil)
+
+	page, err := s.Search(context.Background(), query)
+	assert.Nil(t, err)
+	assert.NotNil(t, page)
+}
+
+func testSearch_RanksByDistance(t *testing.T) {
+	s := CreateService(t)
+
+	query := &domain.Query{
+		Lat:    51.509865,
+		Lng:    -0.118092,
+		Radius: 1000,
+	}
+
+	products := []domain.Product{
+		{
+			ID:       1,
+			ItemName: "in the corner of the bounding box",
+			Lat:      51.5160,
+			Lng:      -0.1070,
+		},
+		{
+			ID:       2,
+			ItemName: "500m north",
+			Lat:      51.514362,
+			Lng:      -0.118092,
+		},
+		{
+			ID:       3,
+			ItemName: "at the centre",
+			Lat:      51.509865,
+			Lng:      -0.118092,
+		},
+	}
+
+	s.mockProductRepo.EXPECT().Search(gomock.Any(), gomock.Any()).Return(products, nil)
+
+	page, err := s.Search(context.Background(), query)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(page.Items))
+	assert.Equal(t, 2, page.TotalEstimate)
+	assert.Equal(t, "", page.NextCursor)
+
+	results := page.Items
+	assert.Equal(t, uint64(3), results[0].ID)
+	assert.Equal(t, float64(0), results[0].Distance)
+
+	assert.Equal(t, uint64(2), results[1].ID)
+	assert.InDelta(t, 500, results[1].Distance, 1)
+}
+
+func testSearch_RanksByRelevance(t *testing.T) {
+	s := CreateService(t)
+
+	query := &domain.Query{
+		Lat:    51.509865,
+		Lng:    -0.118092,
+		Radius: 1000,
+		Term:   "canon lens",
+	}
+
+	products := []domain.Product{
+		{
+			ID:       1,
+			ItemName: "Canon 50mm f/1.2 Prime Lenses",
+			Lat:      51.509865,
+			Lng:      -0.118092,
+		},
+		{
+			ID:       2,
+			ItemName: "Canon Lens",
+			Lat:      51.509865,
+			Lng:      -0.118092,
+		},
+		{
+			ID:       3,
+			ItemName: "Canon lens cap",
+			Lat:      51.509865,
+			Lng:      -0.118092,
+		},
+		{
+			ID:       4,
+			ItemName: "Canon 6D",
+			Lat:      51.509865,
+			Lng:      -0.118092,
+		},
+	}
+
+	s.mockProductRepo.EXPECT().Search(gomock.Any(), gomock.Any()).Return(products, nil)
+
+	page, err := s.Search(context.Background(), query)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(page.Items))
+
+	ids := []uint64{}
+	for i, r := range page.Items {
+		ids = append(ids, r.ID)
+		if i > 0 {
+			assert.True(t, page.Items[i-1].Score >= r.Score)
+		}
+	}
+	assert.Equal(t, []uint64{2, 3, 1, 4}, ids)
+}
+
+func testSearch_RanksByTermGroup(t *testing.T) {
+	s := CreateService(t)
+
+	// OR, AND and * are operators, not words of the item names
+	query := &domain.Query{
+		Lat:    51.509865,
+		Lng:    -0.118092,
+		Radius: 1000,
+		Term:   `"canon lens" OR nikon AND d7*`,
+	}
+
+	products := []domain.Product{
+		{ID: 1, ItemName: "Canon 6D lens", Lat: 51.509865, Lng: -0.118092},
+		{ID: 2, ItemName: "Nikon D750", Lat: 51.509865, Lng: -0.118092},
+		{ID: 3, ItemName: "Canon Lens", Lat: 51.509865, Lng: -0.118092},
+	}
+
+	s.mockProductRepo.EXPECT().Search(gomock.Any(), gomock.Any()).Return(products, nil)
+
+	page, err := s.Search(context.Background(), query)
+	assert.Nil(t, err)
+	ids := []uint64{}
+	for _, r := range page.Items {
+		ids = append(ids, r.ID)
+	}
+	assert.Equal(t, []uint64{3, 2, 1}, ids)
+	// the exact match of one group scores as an exact match of the whole term
+	assert.Equal(t, service.DefaultWeights.Text*service.DefaultWeights.Exact+service.DefaultWeights.Proximity, page.Items[0].Score)
+}
+
+func testSearch_RanksByFuzzyMatch(t *testing.T) {
+	s := CreateService(t)
+
+	// the postgres backend returns misspelt matches
+	query := &domain.Query{
+		Lat:    51.509865,
+		Lng:    -0.118092,
+		Radius: 1000,
+		Term:   "nikkon",
+	}
+
+	products := []domain.Product{
+		{ID: 1, ItemName: "Camera bag", Lat: 51.509865, Lng: -0.118092},
+		// about 500m north
+		{ID: 2, ItemName: "Nikon D750", Lat: 51.514362, Lng: -0.118092},
+	}
+
+	s.mockProductRepo.EXPECT().Search(gomock.Any(), gomock.Any()).Return(products, nil)
 
-	products, err := s.Search(context.Background(), query)
+	page, err := s.Search(context.Background(), query)
 	assert.Nil(t, err)
-	assert.NotNil(t, products)
+	if assert.Equal(t, 2, len(page.Items)) {
+		assert.Equal(t, uint64(2), page.Items[0].ID)
+		w := service.DefaultWeights
+		assert.InDelta(t, w.Text*w.Fuzzy*(1-1.0/6)+w.Proximity*0.5, page.Items[0].Score, 0.001)
+	}
+}
+
+func testSearch_Limit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	s, repo := newService(ctrl, service.WithLimit(2))
+
+	query := &domain.Query{
+		Lat:    51.509865,
+		Lng:    -0.118092,
+		Radius: 1000,
+	}
+
+	products := []domain.Product{
+		{ID: 1, Lat: 51.509865, Lng: -0.118092},
+		{ID: 2, Lat: 51.509865, Lng: -0.118092},
+		{ID: 3, Lat: 51.509865, Lng: -0.118092},
+	}
+
+	// the products are at the same place, so they are read in ID order
+	repo.EXPECT().Search(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, f repository.Filter) ([]domain.Product, error) {
+		if f.After == nil {
+			return products, nil
+		}
+		return products[f.After.ID:], nil
+	}).AnyTimes()
+
+	page, err := s.Search(context.Background(), query)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(page.Items))
+	assert.Equal(t, 3, page.TotalEstimate)
+	assert.NotEqual(t, "", page.NextCursor)
+
+	query.Cursor = page.NextCursor
+	page, err = s.Search(context.Background(), query)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(page.Items))
+	assert.Equal(t, uint64(3), page.Items[0].ID)
+	assert.Equal(t, "", page.NextCursor)
+
+	query.Limit = service.MaxLimit + 1
+	_, err = s.Search(context.Background(), query)
+	assert.True(t, errors.Is(err, service.ErrInputInvalid))
+}
+
+func testSearch_Cursor(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	s, repo := newService(ctrl)
+
+	query := &domain.Query{
+		Lat:    51.509865,
+		Lng:    -0.118092,
+		Radius: 1000,
+		Limit:  2,
+	}
+
+	products := []domain.Product{
+		{ID: 1, Lat: 51.509865, Lng: -0.118092},
+		{ID: 2, Lat: 51.510865, Lng: -0.118092},
+		{ID: 3, Lat: 51.511865, Lng: -0.118092},
+		{ID: 4, Lat: 51.512865, Lng: -0.118092},
+	}
+
+	first := repo.EXPECT().Search(gomock.Any(), gomock.Any()).Return(products, nil)
+
+	page, err := s.Search(context.Background(), query)
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{1, 2}, []uint64{page.Items[0].ID, page.Items[1].ID})
+
+	// the next page is read on from the place of the cursor, products added
+	// before it are not read again
+	next := repository.Position{ID: 2, Lat: 51.510865, Lng: -0.118092}
+	repo.EXPECT().Search(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, f repository.Filter) ([]domain.Product, error) {
+		assert.Equal(t, &next, f.After)
+		return products[2:], nil
+	}).After(first)
+
+	query.Cursor = page.NextCursor
+	page, err = s.Search(context.Background(), query)
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{3, 4}, []uint64{page.Items[0].ID, page.Items[1].ID})
+
+	query.Term = "another query"
+	_, err = s.Search(context.Background(), query)
+	assert.True(t, errors.Is(err, service.ErrInputInvalid))
+
+	query.Cursor = "not a cursor"
+	_, err = s.Search(context.Background(), query)
+	assert.True(t, errors.Is(err, service.ErrInputInvalid))
+}
+
+func testSearch_Batches(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	s, repo := newService(ctrl, service.WithCandidates(2))
+
+	query := &domain.Query{
+		Lat:    51.509865,
+		Lng:    -0.118092,
+		Radius: 1000,
+		Term:   "canon lens",
+		Limit:  1,
+	}
+
+	// nearest first, about 111m apart
+	products := []domain.Product{
+		{ID: 1, ItemName: "Canon 6D", Lat: 51.509865, Lng: -0.118092},
+		{ID: 2, ItemName: "Canon 6D", Lat: 51.510865, Lng: -0.118092},
+		{ID: 3, ItemName: "Canon Lens", Lat: 51.511865, Lng: -0.118092},
+		{ID: 4, ItemName: "Canon Lens", Lat: 51.512865, Lng: -0.118092},
+		{ID: 5, ItemName: "Canon Lens", Lat: 51.517865, Lng: -0.118092},
+	}
+
+	// the best match is not among the nearest candidates, the search reads
+	// on until nothing further away can outrank the page and leaves the rest
+	repo.EXPECT().Search(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, f repository.Filter) ([]domain.Product, error) {
+		assert.Equal(t, repository.OrderDistance, f.Order)
+		from := 0
+		if f.After != nil {
+			from = int(f.After.ID)
+		}
+		to := from + f.Limit
+		if to > len(products) {
+			to = len(products)
+		}
+		return products[from:to], nil
+	}).Times(2)
+
+	page, err := s.Search(context.Background(), query)
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, len(page.Items)) {
+		assert.Equal(t, uint64(3), page.Items[0].ID)
+	}
+	assert.NotEqual(t, "", page.NextCursor)
+}
+
+func TestParseWeights(t *testing.T) {
+	w, err := service.ParseWeights("")
+	assert.Nil(t, err)
+	assert.Equal(t, service.DefaultWeights, w)
+
+	w, err = service.ParseWeights("text=0.5, proximity=0.5,token=0,fuzzy=0.1")
+	assert.Nil(t, err)
+	assert.Equal(t, 0.5, w.Text)
+	assert.Equal(t, 0.5, w.Proximity)
+	assert.Equal(t, float64(0), w.Token)
+	assert.Equal(t, 0.1, w.Fuzzy)
+	assert.Equal(t, service.DefaultWeights.Exact, w.Exact)
+
+	_, err = service.ParseWeights("colour=1")
+	assert.NotNil(t, err)
+
+	_, err = service.ParseWeights("text=-1")
+	assert.NotNil(t, err)
 }
 
 func testUpdateProduct(t *testing.T) {
@@ -140,7 +485,7 @@ func testUpdateProduct(t *testing.T) {
 		ID:       1234,
 		ItemName: "canon",
 	}
-	s.mockProductRepo.EXPECT().Create(p).Return(p, nil)
+	s.mockProductRepo.EXPECT().Create(gomock.Any(), p).Return(p, nil)
 }
 
 func testDeleteProduct(t *testing.T) {
@@ -148,7 +493,7 @@ func testDeleteProduct(t *testing.T) {
 	p := &domain.Product{
 		ID: 1234,
 	}
-	s.mockProductRepo.EXPECT().Delete(p.ID).Return(nil)
+	s.mockProductRepo.EXPECT().Delete(gomock.Any(), p.ID, uint64(0)).Return(nil)
 }
 
 func testGetProduct(t *testing.T) {
@@ -160,7 +505,7 @@ func testGetProduct(t *testing.T) {
 		Lng:      2123,
 	}
 
-	s.mockProductRepo.EXPECT().Get(p.ID).Return(p, nil)
+	s.mockProductRepo.EXPECT().Get(gomock.Any(), p.ID).Return(p, nil)
 }
 
 func testCreateProduct(t *testing.T) {
@@ -170,5 +515,51 @@ func testCreateProduct(t *testing.T) {
 		Lat:      1234,
 		Lng:      2123,
 	}
-	s.mockProductRepo.EXPECT().Create(p).Return(p, nil)
+	s.mockProductRepo.EXPECT().Create(gomock.Any(), p).Return(p, nil)
+}
+
+func TestServiceErrors(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s, repo := newService(ctrl)
+
+	p := &domain.Product{ID: 7, ItemName: "canon", Lat: 51.5, Lng: -0.1}
+	notFound := fmt.Errorf("not found product: %w", repository.ErrNotFound)
+
+	repo.EXPECT().Get(gomock.Any(), uint64(7)).Return(nil, notFound)
+	_, err := s.Get(context.Background(), 7)
+	assert.True(t, errors.Is(err, service.ErrNotFound))
+
+	repo.EXPECT().Update(gomock.Any(), p).Return(nil, notFound)
+	_, err = s.Update(context.Background(), p)
+	assert.True(t, errors.Is(err, service.ErrNotFound))
+
+	repo.EXPECT().Delete(gomock.Any(), uint64(7), uint64(0)).Return(notFound)
+	err = s.Delete(context.Background(), 7, 0)
+	assert.True(t, errors.Is(err, service.ErrNotFound))
+
+	repo.EXPECT().Create(gomock.Any(), p).Return(nil, fmt.Errorf("failed to insert product: %w", repository.ErrFatal))
+	_, err = s.Create(context.Background(), p)
+	assert.True(t, errors.Is(err, service.ErrRequestFailed))
+
+	repo.EXPECT().Delete(gomock.Any(), uint64(7), uint64(0)).Return(repository.ErrFatal)
+	err = s.Delete(context.Background(), 7, 0)
+	assert.True(t, errors.Is(err, service.ErrRequestFailed))
+}
+
+func TestServiceVersionMismatch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s, repo := newService(ctrl)
+
+	p := &domain.Product{ID: 7, ItemName: "canon", Lat: 51.5, Lng: -0.1, Version: 2}
+	stale := fmt.Errorf("stale product: %w", repository.ErrVersionMismatch)
+
+	repo.EXPECT().Update(gomock.Any(), p).Return(nil, stale)
+	_, err := s.Update(context.Background(), p)
+	assert.True(t, errors.Is(err, service.ErrPreconditionFailed))
+
+	repo.EXPECT().Delete(gomock.Any(), uint64(7), uint64(2)).Return(stale)
+	err = s.Delete(context.Background(), 7, 2)
+	assert.True(t, errors.Is(err, service.ErrPreconditionFailed))
 }
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mustafadubul/product/internal/domain"
+	"github.com/mustafadubul/product/internal/repository"
+)
+
+// DefaultRetention is how long deleted products stay in the trash before they
+// are purged, when the service is not configured otherwise.
+const DefaultRetention = 30 * 24 * time.Hour
+
+// WithRetention sets how long deleted products stay in the trash.
+func WithRetention(d time.Duration) Option {
+	return func(s *Service) {
+		s.retention = d
+	}
+}
+
+// Trash returns up to limit deleted products with an ID above after, in ID
+// order. A zero limit falls back on the search limit.
+func (s *Service) Trash(ctx context.Context, after uint64, limit int) ([]domain.Product, error) {
+	l := s.logger.With().Str("service", "Trash").Logger()
+
+	limit, err := s.pageLimit(limit)
+	if err != nil {
+		return nil, err
+	}
+
+	products, err := s.products.Trash(ctx, after, limit)
+	if err != nil {
+		l.Error().Err(err).Msg("failed to list trash")
+		return nil, fmt.Errorf("failed to list trash: %w", ErrRequestFailed)
+	}
+	return products, nil
+}
+
+// Restore takes a deleted product out of the trash.
+func (s *Service) Restore(ctx context.Context, id uint64) (*domain.Product, error) {
+	l := s.logger.With().Str("service", "Restore").Logger()
+
+	p, err := s.products.Restore(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, fmt.Errorf("product not in trash: %w", ErrNotFound)
+		}
+		l.Error().Err(err).Msg("failed to restore product")
+		return nil, fmt.Errorf("failed to restore product: %w", ErrRequestFailed)
+	}
+	return p, nil
+}
+
+// Purge removes the products that have been in the trash for longer than the
+// retention period.
+func (s *Service) Purge(ctx context.Context) (int, error) {
+	l := s.logger.With().Str("service", "Purge").Logger()
+
+	purged, err := s.products.Purge(time.Now().Add(-s.retention))
+	if err != nil {
+		l.Error().Err(err).Msg("failed to purge trash")
+		return 0, fmt.Errorf("failed to purge trash: %w", ErrRequestFailed)
+	}
+	if purged > 0 {
+		l.Info().Int("purged", purged).Msg("purged trash")
+	}
+	return purged, nil
+}
+
+// PurgeEvery purges the trash at every interval until ctx is done.
+func (s *Service) PurgeEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		// failures are logged by Purge, the next tick tries again
+		_, _ = s.Purge(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/mustafadubul/product/internal/domain"
+	"github.com/mustafadubul/product/internal/service"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPurge(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s, repo := newService(ctrl, service.WithRetention(24*time.Hour))
+
+	repo.EXPECT().Purge(gomock.Any()).DoAndReturn(func(before time.Time) (int, error) {
+		assert.WithinDuration(t, time.Now().Add(-24*time.Hour), before, time.Minute)
+		return 3, nil
+	})
+
+	purged, err := s.Purge(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 3, purged)
+}
+
+func TestTrash(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s, repo := newService(ctrl)
+
+	repo.EXPECT().Trash(gomock.Any(), uint64(4), service.DefaultLimit).Return([]domain.Product{{ID: 5}}, nil)
+
+	products, err := s.Trash(context.Background(), 4, 0)
+	assert.NoError(t, err)
+	assert.Len(t, products, 1)
+
+	_, err = s.Trash(context.Background(), 0, service.MaxLimit+1)
+	assert.True(t, errors.Is(err, service.ErrInputInvalid))
+}
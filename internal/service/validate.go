@@ -0,0 +1,197 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mustafadubul/product/internal/domain"
+)
+
+// Bounds of the product and query fields.
+const (
+	MaxNameLength = 255
+	MaxURLLength  = 2048
+	MaxTermLength = 255
+
+	// MaxRadius is the largest search radius in meters.
+	MaxRadius = 100000
+
+	// MinSecretLength is the shortest secret a webhook can be given.
+	MinSecretLength = 16
+)
+
+// FieldError says why the value of a single field is invalid. Field is named
+// like the JSON field of the product or the query parameter.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every invalid field of a product or a query. It
+// matches ErrInputInvalid with errors.Is.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		msgs[i] = f.Field + ": " + f.Message
+	}
+	return fmt.Sprintf("%s: %s", ErrInputInvalid, strings.Join(msgs, "; "))
+}
+
+func (e *ValidationError) Unwrap() error {
+	return ErrInputInvalid
+}
+
+// validation collects field errors, err returns nil when there are none.
+type validation struct {
+	fields []FieldError
+}
+
+func (v *validation) add(field, format string, args ...interface{}) {
+	v.fields = append(v.fields, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validation) err() error {
+	if len(v.fields) == 0 {
+		return nil
+	}
+	return &ValidationError{Fields: v.fields}
+}
+
+func (v *validation) coordinates(lat, lng float64) {
+	if math.IsNaN(lat) || lat < -90 || lat > 90 {
+		v.add("lat", "must be between -90 and 90")
+	}
+	if math.IsNaN(lng) || lng < -180 || lng > 180 {
+		v.add("lng", "must be between -180 and 180")
+	}
+}
+
+func (v *validation) limit(limit int) {
+	if limit < 1 || limit > MaxLimit {
+		v.add("limit", "must be between 1 and %d", MaxLimit)
+	}
+}
+
+func (v *validation) url(field, value string) {
+	if value == "" {
+		return
+	}
+	if len(value) > MaxURLLength {
+		v.add(field, "must be at most %d characters", MaxURLLength)
+		return
+	}
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		v.add(field, "must be an absolute http or https URL")
+	}
+}
+
+// validateProduct checks the fields of a product before it is stored.
+func validateProduct(p *domain.Product) error {
+	var v validation
+
+	name := strings.TrimSpace(p.ItemName)
+	switch {
+	case name == "":
+		v.add("description", "must not be empty")
+	case !utf8.ValidString(p.ItemName):
+		v.add("description", "must be valid UTF-8")
+	case utf8.RuneCountInString(p.ItemName) > MaxNameLength:
+		v.add("description", "must be at most %d characters", MaxNameLength)
+	}
+	v.coordinates(p.Lat, p.Lng)
+	v.url("img_URL", p.ImageURL)
+	v.url("product_URL", p.URL)
+
+	return v.err()
+}
+
+// validateQuery checks a search query. Limit is checked against the limit the
+// search will use, as a zero limit falls back on the default.
+func validateQuery(q *domain.Query, limit int) error {
+	var v validation
+
+	v.coordinates(q.Lat, q.Lng)
+	if math.IsNaN(q.Radius) || q.Radius <= 0 || q.Radius > MaxRadius {
+		v.add("radius", "must be greater than 0 and at most %d", MaxRadius)
+	}
+	if utf8.RuneCountInString(q.Term) > MaxTermLength {
+		v.add("term", "must be at most %d characters", MaxTermLength)
+	}
+	v.limit(limit)
+
+	return v.err()
+}
+
+// pageLimit returns the number of items a listing returns for the limit asked
+// for, a zero limit falls back on the search limit.
+func (s *Service) pageLimit(limit int) (int, error) {
+	if limit == 0 {
+		limit = s.limit
+	}
+	var v validation
+	v.limit(limit)
+	return limit, v.err()
+}
+
+// validateExport checks the query an export is filtered by, the area is only
+// checked when it has a radius.
+func validateExport(q *domain.Query) error {
+	var v validation
+	v.filter(q)
+	return v.err()
+}
+
+// filter checks a query that filters products rather than searching them, the
+// area is only checked when it has a radius.
+func (v *validation) filter(q *domain.Query) {
+	if q.Radius != 0 {
+		v.coordinates(q.Lat, q.Lng)
+		if math.IsNaN(q.Radius) || q.Radius < 0 || q.Radius > MaxRadius {
+			v.add("radius", "must be greater than 0 and at most %d", MaxRadius)
+		}
+	}
+	if utf8.RuneCountInString(q.Term) > MaxTermLength {
+		v.add("term", "must be at most %d characters", MaxTermLength)
+	}
+}
+
+// validateWebhook checks a webhook before it is stored. Its query is checked
+// like the query of an export.
+func validateWebhook(w *domain.Webhook) error {
+	var v validation
+
+	if w.URL == "" {
+		v.add("url", "is required")
+	}
+	v.url("url", w.URL)
+	if w.Secret != "" && len(w.Secret) < MinSecretLength {
+		v.add("secret", "must be at least %d characters", MinSecretLength)
+	}
+	v.filter(&w.Query)
+
+	return v.err()
+}
+
+// validateSavedSearch checks a saved search before it is stored. Its query is
+// checked like the query of an export.
+func validateSavedSearch(s *domain.SavedSearch) error {
+	var v validation
+
+	switch {
+	case !utf8.ValidString(s.Name):
+		v.add("name", "must be valid UTF-8")
+	case utf8.RuneCountInString(s.Name) > MaxNameLength:
+		v.add("name", "must be at most %d characters", MaxNameLength)
+	}
+	v.filter(&s.Query)
+
+	return v.err()
+}
@@ -0,0 +1,94 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/mustafadubul/product/internal/bulk"
+	"github.com/mustafadubul/product/internal/domain"
+	"github.com/mustafadubul/product/internal/service"
+	"github.com/stretchr/testify/assert"
+)
+
+func fieldsOf(t *testing.T, err error) []string {
+	t.Helper()
+	assert.True(t, errors.Is(err, service.ErrInputInvalid))
+
+	var verr *service.ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+	fields := make([]string, len(verr.Fields))
+	for i, f := range verr.Fields {
+		fields[i] = f.Field
+	}
+	return fields
+}
+
+func TestValidateProduct(t *testing.T) {
+	tests := []struct {
+		name    string
+		product domain.Product
+		fields  []string
+	}{
+		{"valid", domain.Product{ItemName: "camera", Lat: 51.5, Lng: -0.1, ImageURL: "https://img.example.com/1.png", URL: "http://example.com/p/1"}, nil},
+		{"empty description", domain.Product{ItemName: "  ", Lat: 51.5, Lng: -0.1}, []string{"description"}},
+		{"long description", domain.Product{ItemName: strings.Repeat("é", service.MaxNameLength+1)}, []string{"description"}},
+		{"coordinates out of range", domain.Product{ItemName: "camera", Lat: 500, Lng: -180.5}, []string{"lat", "lng"}},
+		{"nan coordinates", domain.Product{ItemName: "camera", Lat: math.NaN()}, []string{"lat"}},
+		{"relative urls", domain.Product{ItemName: "camera", ImageURL: "/img/1.png", URL: "example.com"}, []string{"img_URL", "product_URL"}},
+		{"unsupported scheme", domain.Product{ItemName: "camera", URL: "javascript:alert(1)"}, []string{"product_URL"}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			s, repo := newService(ctrl)
+
+			if tt.fields == nil {
+				repo.EXPECT().Create(gomock.Any(), &tt.product).Return(&tt.product, nil)
+				_, err := s.Create(context.Background(), &tt.product)
+				assert.NoError(t, err)
+				return
+			}
+
+			_, err := s.Create(context.Background(), &tt.product)
+			assert.Equal(t, tt.fields, fieldsOf(t, err))
+
+			_, err = s.Update(context.Background(), &tt.product)
+			assert.Equal(t, tt.fields, fieldsOf(t, err))
+		})
+	}
+}
+
+func TestValidateQuery(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s, _ := newService(ctrl)
+
+	_, err := s.Search(context.Background(), &domain.Query{Lat: 91, Lng: 10, Radius: -1, Limit: service.MaxLimit + 1})
+	assert.Equal(t, []string{"lat", "radius", "limit"}, fieldsOf(t, err))
+
+	_, err = s.Search(context.Background(), &domain.Query{Lat: 51.5, Lng: -0.1, Radius: service.MaxRadius + 1})
+	assert.Equal(t, []string{"radius"}, fieldsOf(t, err))
+
+	err = s.Export(context.Background(), &domain.Query{Term: strings.Repeat("a", service.MaxTermLength+1)}, nil)
+	assert.Equal(t, []string{"term"}, fieldsOf(t, err))
+}
+
+func TestImportRejectsInvalidProducts(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s, _ := newService(ctrl)
+
+	report, err := s.Import(context.Background(), strings.NewReader("description,lat,lng\n,500,0\n"), bulk.CSV)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, report.Rejected)
+	assert.Equal(t, "input invalid: description: must not be empty; lat: must be between -90 and 90", report.Rows[0].Reason)
+}
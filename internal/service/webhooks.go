@@ -0,0 +1,156 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mustafadubul/product/internal/domain"
+	"github.com/mustafadubul/product/internal/repository"
+	"github.com/mustafadubul/product/internal/tenant"
+)
+
+// WithWebhooks sets the store of the webhook subscriptions.
+func WithWebhooks(w repository.Webhooks) Option {
+	return func(s *Service) {
+		s.webhooks = w
+	}
+}
+
+// CreateWebhook subscribes w to the events of the products of the tenant of
+// ctx matching its query. A secret is generated when w has none, it is only
+// returned here so the receiver can verify the deliveries.
+func (s *Service) CreateWebhook(ctx context.Context, w *domain.Webhook) (*domain.Webhook, error) {
+	l := s.logger.With().Str("service", "CreateWebhook").Logger()
+
+	if err := validateWebhook(w); err != nil {
+		return nil, err
+	}
+	if s.webhooks == nil {
+		l.Error().Msg("no webhook store configured")
+		return nil, fmt.Errorf("webhooks are not available: %w", ErrRequestFailed)
+	}
+
+	if w.Secret == "" {
+		secret, err := newSecret()
+		if err != nil {
+			l.Error().Err(err).Msg("failed to generate secret")
+			return nil, fmt.Errorf("failed to create webhook: %w", ErrRequestFailed)
+		}
+		w.Secret = secret
+	}
+	w.ID = 0
+	w.Tenant = tenant.FromContext(ctx)
+	w.Query.Limit = 0
+	w.Query.Cursor = ""
+	w.CreatedAt = time.Now().UTC()
+
+	created, err := s.webhooks.CreateWebhook(w)
+	if err != nil {
+		l.Error().Err(err).Msg("failed to create webhook")
+		return nil, fmt.Errorf("failed to create webhook: %w", ErrRequestFailed)
+	}
+	return created, nil
+}
+
+// Webhooks lists the webhooks of the tenant of ctx without their secrets.
+func (s *Service) Webhooks(ctx context.Context) ([]domain.Webhook, error) {
+	webhooks, err := s.tenantWebhooks(ctx, "Webhooks")
+	if err != nil {
+		return nil, err
+	}
+	for i := range webhooks {
+		webhooks[i].Secret = ""
+	}
+	return webhooks, nil
+}
+
+// DeleteWebhook unsubscribes the webhook and drops its dead letters.
+func (s *Service) DeleteWebhook(ctx context.Context, id uint64) error {
+	l := s.logger.With().Str("service", "DeleteWebhook").Logger()
+
+	if err := s.ownWebhook(ctx, id); err != nil {
+		return err
+	}
+	if err := s.webhooks.DeleteWebhook(id); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return fmt.Errorf("webhook not found: %w", ErrNotFound)
+		}
+		l.Error().Err(err).Msg("failed to delete webhook")
+		return fmt.Errorf("failed to delete webhook: %w", ErrRequestFailed)
+	}
+	return nil
+}
+
+// DeadLetters returns up to limit events the webhook failed to receive with
+// an ID above after. A zero limit falls back on the search limit.
+func (s *Service) DeadLetters(ctx context.Context, webhookID uint64, after uint64, limit int) ([]domain.DeadLetter, error) {
+	l := s.logger.With().Str("service", "DeadLetters").Logger()
+
+	limit, err := s.pageLimit(limit)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.ownWebhook(ctx, webhookID); err != nil {
+		return nil, err
+	}
+
+	letters, err := s.webhooks.DeadLetters(webhookID, after, limit)
+	if err != nil {
+		l.Error().Err(err).Msg("failed to read dead letters")
+		return nil, fmt.Errorf("failed to read dead letters: %w", ErrRequestFailed)
+	}
+	return letters, nil
+}
+
+// tenantWebhooks returns the webhooks of the tenant of ctx, logging failures
+// for the named service method.
+func (s *Service) tenantWebhooks(ctx context.Context, method string) ([]domain.Webhook, error) {
+	l := s.logger.With().Str("service", method).Logger()
+
+	if s.webhooks == nil {
+		l.Error().Msg("no webhook store configured")
+		return nil, fmt.Errorf("webhooks are not available: %w", ErrRequestFailed)
+	}
+
+	all, err := s.webhooks.Webhooks()
+	if err != nil {
+		l.Error().Err(err).Msg("failed to list webhooks")
+		return nil, fmt.Errorf("failed to list webhooks: %w", ErrRequestFailed)
+	}
+	t := tenant.FromContext(ctx)
+	webhooks := all[:0]
+	for _, w := range all {
+		if w.Tenant == t {
+			webhooks = append(webhooks, w)
+		}
+	}
+	return webhooks, nil
+}
+
+// ownWebhook fails with ErrNotFound unless the webhook belongs to the tenant
+// of ctx.
+func (s *Service) ownWebhook(ctx context.Context, id uint64) error {
+	webhooks, err := s.tenantWebhooks(ctx, "Webhook")
+	if err != nil {
+		return err
+	}
+	for _, w := range webhooks {
+		if w.ID == id {
+			return nil
+		}
+	}
+	return fmt.Errorf("webhook not found: %w", ErrNotFound)
+}
+
+// newSecret returns 32 random bytes hex encoded.
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,92 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/mustafadubul/product/internal/domain"
+	"github.com/mustafadubul/product/internal/repository"
+	"github.com/mustafadubul/product/internal/service"
+	"github.com/mustafadubul/product/internal/tenant"
+	"github.com/mustafadubul/product/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateWebhook(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	store := mocks.NewMockRepoWebhooks(ctrl)
+	s, _ := newService(ctrl, service.WithWebhooks(store))
+
+	store.EXPECT().CreateWebhook(gomock.Any()).DoAndReturn(func(w *domain.Webhook) (*domain.Webhook, error) {
+		w.ID = 3
+		return w, nil
+	})
+
+	w, err := s.CreateWebhook(context.Background(), &domain.Webhook{
+		URL:   "https://partner.example.com/hook",
+		Query: domain.Query{Term: "camera", Lat: 51.5, Lng: -0.1, Radius: 1000, Limit: 5, Cursor: "abc"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), w.ID)
+	assert.Len(t, w.Secret, 64)
+	assert.Equal(t, tenant.Default, w.Tenant)
+	assert.Zero(t, w.Query.Limit)
+	assert.Empty(t, w.Query.Cursor)
+	assert.False(t, w.CreatedAt.IsZero())
+}
+
+func TestCreateWebhookInvalid(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s, _ := newService(ctrl, service.WithWebhooks(mocks.NewMockRepoWebhooks(ctrl)))
+
+	_, err := s.CreateWebhook(context.Background(), &domain.Webhook{
+		URL: "ftp://partner.example.com", Secret: "short", Query: domain.Query{Lat: 91, Radius: 10},
+	})
+	var verr *service.ValidationError
+	if assert.True(t, errors.As(err, &verr)) {
+		fields := make([]string, len(verr.Fields))
+		for i, f := range verr.Fields {
+			fields[i] = f.Field
+		}
+		assert.Equal(t, []string{"url", "secret", "lat"}, fields)
+	}
+}
+
+func TestWebhooksHideSecrets(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	store := mocks.NewMockRepoWebhooks(ctrl)
+	s, _ := newService(ctrl, service.WithWebhooks(store))
+
+	store.EXPECT().Webhooks().Return([]domain.Webhook{
+		{ID: 1, Tenant: tenant.Default, URL: "https://partner.example.com/hook", Secret: "s3cr3t"},
+		{ID: 2, Tenant: "acme", URL: "https://acme.example.com/hook", Secret: "s3cr3t"},
+	}, nil)
+
+	webhooks, err := s.Webhooks(context.Background())
+	assert.NoError(t, err)
+	if assert.Len(t, webhooks, 1) {
+		assert.Empty(t, webhooks[0].Secret)
+	}
+}
+
+func TestDeleteWebhook(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	store := mocks.NewMockRepoWebhooks(ctrl)
+	s, _ := newService(ctrl, service.WithWebhooks(store))
+
+	store.EXPECT().Webhooks().Return([]domain.Webhook{{ID: 1, Tenant: tenant.Default}, {ID: 2, Tenant: "acme"}}, nil).Times(3)
+	store.EXPECT().DeleteWebhook(uint64(1)).Return(nil)
+	store.EXPECT().DeleteWebhook(uint64(1)).Return(fmt.Errorf("not found webhook: %w", repository.ErrNotFound))
+
+	assert.NoError(t, s.DeleteWebhook(context.Background(), 1))
+	assert.True(t, errors.Is(s.DeleteWebhook(context.Background(), 1), service.ErrNotFound))
+	// the webhooks of other tenants are not found
+	assert.True(t, errors.Is(s.DeleteWebhook(context.Background(), 2), service.ErrNotFound))
+}
@@ -0,0 +1,44 @@
+// Package tenant carries the tenant a request acts for in its context. Every
+// product belongs to a tenant and the repositories only ever read and write
+// the products of the tenant of the context they are called with.
+package tenant
+
+import (
+	"context"
+	"errors"
+	"regexp"
+)
+
+// Default is the tenant of requests that do not name one, and of the products
+// stored before there were tenants.
+const Default = "default"
+
+// ErrInvalid is returned by Validate for a malformed tenant ID.
+var ErrInvalid = errors.New("invalid tenant")
+
+var valid = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// Validate checks that id is a tenant ID: up to 63 lower case letters, digits,
+// dashes and underscores, starting with a letter or digit.
+func Validate(id string) error {
+	if !valid.MatchString(id) {
+		return ErrInvalid
+	}
+	return nil
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying the tenant.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the tenant carried by ctx, Default when ctx carries
+// none.
+func FromContext(ctx context.Context) string {
+	if id, _ := ctx.Value(contextKey{}).(string); id != "" {
+		return id
+	}
+	return Default
+}
@@ -0,0 +1,25 @@
+package tenant_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/mustafadubul/product/internal/tenant"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContext(t *testing.T) {
+	assert.Equal(t, tenant.Default, tenant.FromContext(context.Background()))
+	assert.Equal(t, "acme", tenant.FromContext(tenant.NewContext(context.Background(), "acme")))
+	assert.Equal(t, tenant.Default, tenant.FromContext(tenant.NewContext(context.Background(), "")))
+}
+
+func TestValidate(t *testing.T) {
+	for _, id := range []string{"acme", "unit-7", "a_b", tenant.Default} {
+		assert.NoError(t, tenant.Validate(id), id)
+	}
+	for _, id := range []string{"", "Acme", "-acme", "acme corp", "a/b"} {
+		assert.True(t, errors.Is(tenant.Validate(id), tenant.ErrInvalid), id)
+	}
+}
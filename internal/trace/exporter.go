@@ -0,0 +1,266 @@
+package trace
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Exporter sends ended spans to where they are looked at.
+type Exporter interface {
+	// ExportSpans exports a batch of spans.
+	ExportSpans(ctx context.Context, spans []SpanData) error
+	// Shutdown releases what the exporter holds, it is called once no more
+	// spans are exported.
+	Shutdown(ctx context.Context) error
+}
+
+// WriterExporter writes spans to a writer as NDJSON, one span per line, which
+// is enough to follow a request locally.
+type WriterExporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriterExporter returns an exporter writing to w, e.g. os.Stdout.
+func NewWriterExporter(w io.Writer) *WriterExporter {
+	return &WriterExporter{w: w}
+}
+
+type writerSpan struct {
+	TraceID    string                 `json:"trace_id"`
+	SpanID     string                 `json:"span_id"`
+	ParentID   string                 `json:"parent_id,omitempty"`
+	Name       string                 `json:"name"`
+	Kind       string                 `json:"kind"`
+	Start      time.Time              `json:"start"`
+	DurationMS float64                `json:"duration_ms"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+}
+
+func (e *WriterExporter) ExportSpans(ctx context.Context, spans []SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	w := bufio.NewWriter(e.w)
+	enc := json.NewEncoder(w)
+	for i := range spans {
+		s := &spans[i]
+		ws := writerSpan{
+			TraceID:    s.TraceID.String(),
+			SpanID:     s.SpanID.String(),
+			Name:       s.Name,
+			Kind:       s.Kind.String(),
+			Start:      s.Start.UTC(),
+			DurationMS: float64(s.End.Sub(s.Start)) / float64(time.Millisecond),
+			Error:      s.Error,
+		}
+		if s.Parent.IsValid() {
+			ws.ParentID = s.Parent.String()
+		}
+		if len(s.Attributes) > 0 {
+			ws.Attributes = make(map[string]interface{}, len(s.Attributes))
+			for _, a := range s.Attributes {
+				ws.Attributes[a.Key] = a.Value
+			}
+		}
+		if err := enc.Encode(&ws); err != nil {
+			return fmt.Errorf("failed to write span: %w", err)
+		}
+	}
+	return w.Flush()
+}
+
+func (e *WriterExporter) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+const (
+	// DefaultOTLPEndpoint is where an OpenTelemetry collector receives traces
+	// over OTLP/HTTP by default.
+	DefaultOTLPEndpoint = "http://localhost:4318/v1/traces"
+	// DefaultOTLPTimeout bounds an export to the collector.
+	DefaultOTLPTimeout = 10 * time.Second
+)
+
+// OTLPExporter posts spans to an OpenTelemetry collector over OTLP/HTTP, JSON
+// encoded.
+type OTLPExporter struct {
+	endpoint string
+	service  string
+	client   *http.Client
+}
+
+// NewOTLPExporter returns an exporter posting to endpoint the spans of the
+// named service, with the given client, the default client with
+// DefaultOTLPTimeout when it is nil.
+func NewOTLPExporter(endpoint, service string, client *http.Client) *OTLPExporter {
+	if client == nil {
+		client = &http.Client{Timeout: DefaultOTLPTimeout}
+	}
+	return &OTLPExporter{endpoint: endpoint, service: service, client: client}
+}
+
+// The OTLP JSON encoding, see
+// https://github.com/open-telemetry/opentelemetry-proto/blob/main/opentelemetry/proto/trace/v1/trace.proto
+type (
+	otlpRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+	otlpSpan struct {
+		TraceID           string          `json:"traceId"`
+		SpanID            string          `json:"spanId"`
+		ParentSpanID      string          `json:"parentSpanId,omitempty"`
+		Name              string          `json:"name"`
+		Kind              int             `json:"kind"`
+		StartTimeUnixNano string          `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+		Attributes        []otlpAttribute `json:"attributes,omitempty"`
+		Status            otlpStatus      `json:"status"`
+	}
+	otlpAttribute struct {
+		Key   string    `json:"key"`
+		Value otlpValue `json:"value"`
+	}
+	otlpValue struct {
+		StringValue *string  `json:"stringValue,omitempty"`
+		IntValue    *string  `json:"intValue,omitempty"`
+		DoubleValue *float64 `json:"doubleValue,omitempty"`
+		BoolValue   *bool    `json:"boolValue,omitempty"`
+	}
+	otlpStatus struct {
+		Code    int    `json:"code,omitempty"`
+		Message string `json:"message,omitempty"`
+	}
+)
+
+const (
+	otlpStatusError = 2
+	otlpScopeName   = "github.com/mustafadubul/product/internal/trace"
+)
+
+func (e *OTLPExporter) ExportSpans(ctx context.Context, spans []SpanData) error {
+	scope := otlpScopeSpans{Scope: otlpScope{Name: otlpScopeName}, Spans: make([]otlpSpan, len(spans))}
+	for i := range spans {
+		scope.Spans[i] = toOTLP(&spans[i])
+	}
+	body, err := json.Marshal(otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: []otlpAttribute{toOTLPAttribute(String("service.name", e.service))}},
+		ScopeSpans: []otlpScopeSpans{scope},
+	}}})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// drain the body so the connection can be reused
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("collector answered %s", resp.Status)
+	}
+	return nil
+}
+
+func (e *OTLPExporter) Shutdown(ctx context.Context) error {
+	e.client.CloseIdleConnections()
+	return nil
+}
+
+func toOTLP(s *SpanData) otlpSpan {
+	o := otlpSpan{
+		TraceID:           s.TraceID.String(),
+		SpanID:            s.SpanID.String(),
+		Name:              s.Name,
+		Kind:              int(s.Kind) + 1, // the OTLP kinds start with unspecified
+		StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+	}
+	if s.Parent.IsValid() {
+		o.ParentSpanID = s.Parent.String()
+	}
+	for _, a := range s.Attributes {
+		o.Attributes = append(o.Attributes, toOTLPAttribute(a))
+	}
+	if s.Error != "" {
+		o.Status = otlpStatus{Code: otlpStatusError, Message: s.Error}
+	}
+	return o
+}
+
+func toOTLPAttribute(a Attribute) otlpAttribute {
+	var v otlpValue
+	switch value := a.Value.(type) {
+	case int64:
+		i := strconv.FormatInt(value, 10)
+		v.IntValue = &i
+	case float64:
+		v.DoubleValue = &value
+	case bool:
+		v.BoolValue = &value
+	case string:
+		v.StringValue = &value
+	default:
+		s := fmt.Sprint(value)
+		v.StringValue = &s
+	}
+	return otlpAttribute{Key: a.Key, Value: v}
+}
+
+// Recorder keeps the exported spans in memory, to look at in tests.
+type Recorder struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+func (r *Recorder) ExportSpans(ctx context.Context, spans []SpanData) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, spans...)
+	return nil
+}
+
+func (r *Recorder) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+// Spans returns the spans exported so far, in the order they ended.
+func (r *Recorder) Spans() []SpanData {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]SpanData(nil), r.spans...)
+}
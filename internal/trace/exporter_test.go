@@ -0,0 +1,109 @@
+package trace_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mustafadubul/product/internal/trace"
+	"github.com/stretchr/testify/assert"
+)
+
+func spans(t *testing.T) []trace.SpanData {
+	sc, err := trace.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	assert.NoError(t, err)
+	start := time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	root := trace.SpanData{
+		SpanContext: sc,
+		Name:        "GET /q",
+		Kind:        trace.KindServer,
+		Start:       start,
+		End:         start.Add(20 * time.Millisecond),
+		Attributes:  []trace.Attribute{trace.String("http.route", "/q"), trace.Int("http.status_code", 200)},
+	}
+	query := trace.SpanData{
+		SpanContext: trace.SpanContext{TraceID: sc.TraceID, SpanID: trace.SpanID{1}, Sampled: true},
+		Parent:      sc.SpanID,
+		Name:        "sqlite SELECT",
+		Kind:        trace.KindClient,
+		Start:       start.Add(time.Millisecond),
+		End:         start.Add(11 * time.Millisecond),
+		Attributes:  []trace.Attribute{trace.Float64("ratio", 0.5), trace.Bool("cached", true)},
+		Error:       "boom",
+	}
+	return []trace.SpanData{query, root}
+}
+
+func TestWriterExporter(t *testing.T) {
+	var b bytes.Buffer
+	e := trace.NewWriterExporter(&b)
+	assert.NoError(t, e.ExportSpans(context.Background(), spans(t)))
+	assert.NoError(t, e.Shutdown(context.Background()))
+
+	assert.Equal(t, `{"trace_id":"4bf92f3577b34da6a3ce929d0e0e4736","span_id":"0100000000000000","parent_id":"00f067aa0ba902b7","name":"sqlite SELECT","kind":"client","start":"2020-05-01T12:00:00.001Z","duration_ms":10,"attributes":{"cached":true,"ratio":0.5},"error":"boom"}
+{"trace_id":"4bf92f3577b34da6a3ce929d0e0e4736","span_id":"00f067aa0ba902b7","name":"GET /q","kind":"server","start":"2020-05-01T12:00:00Z","duration_ms":20,"attributes":{"http.route":"/q","http.status_code":200}}
+`, b.String())
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/v1/traces", r.URL.Path)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		body, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	e := trace.NewOTLPExporter(srv.URL+"/v1/traces", "product", nil)
+	assert.NoError(t, e.ExportSpans(context.Background(), spans(t)))
+	assert.NoError(t, e.Shutdown(context.Background()))
+
+	assert.JSONEq(t, `{"resourceSpans": [{
+		"resource": {"attributes": [{"key": "service.name", "value": {"stringValue": "product"}}]},
+		"scopeSpans": [{
+			"scope": {"name": "github.com/mustafadubul/product/internal/trace"},
+			"spans": [{
+				"traceId": "4bf92f3577b34da6a3ce929d0e0e4736",
+				"spanId": "0100000000000000",
+				"parentSpanId": "00f067aa0ba902b7",
+				"name": "sqlite SELECT",
+				"kind": 3,
+				"startTimeUnixNano": "1588334400001000000",
+				"endTimeUnixNano": "1588334400011000000",
+				"attributes": [
+					{"key": "ratio", "value": {"doubleValue": 0.5}},
+					{"key": "cached", "value": {"boolValue": true}}
+				],
+				"status": {"code": 2, "message": "boom"}
+			}, {
+				"traceId": "4bf92f3577b34da6a3ce929d0e0e4736",
+				"spanId": "00f067aa0ba902b7",
+				"name": "GET /q",
+				"kind": 2,
+				"startTimeUnixNano": "1588334400000000000",
+				"endTimeUnixNano": "1588334400020000000",
+				"attributes": [
+					{"key": "http.route", "value": {"stringValue": "/q"}},
+					{"key": "http.status_code", "value": {"intValue": "200"}}
+				],
+				"status": {}
+			}]
+		}]
+	}]}`, string(body))
+}
+
+func TestOTLPExporterError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	e := trace.NewOTLPExporter(srv.URL, "product", nil)
+	assert.EqualError(t, e.ExportSpans(context.Background(), spans(t)), "collector answered 503 Service Unavailable")
+}
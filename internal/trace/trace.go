@@ -0,0 +1,276 @@
+// Package trace records spans of the work done for a request, so a slow call
+// can be followed from the HTTP layer through the service to the queries of
+// the repository. Spans join the trace of the caller by its W3C traceparent
+// header and are handed to an Exporter in batches.
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceparentHeader is the W3C header carrying the trace of the caller.
+const TraceparentHeader = "traceparent"
+
+// ErrInvalidTraceparent is returned for a traceparent that is malformed or
+// carries a zero trace or span ID.
+var ErrInvalidTraceparent = errors.New("invalid traceparent")
+
+// TraceID identifies a trace, the spans of all the work done for a request.
+type TraceID [16]byte
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+
+// IsValid reports whether t is not all zeros.
+func (t TraceID) IsValid() bool { return t != TraceID{} }
+
+// SpanID identifies a span within its trace.
+type SpanID [8]byte
+
+func (s SpanID) String() string { return hex.EncodeToString(s[:]) }
+
+// IsValid reports whether s is not all zeros.
+func (s SpanID) IsValid() bool { return s != SpanID{} }
+
+// SpanContext is what identifies a span across process boundaries.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// ParseTraceparent parses a traceparent header, e.g.
+// 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01. Versions after 00
+// are accepted as long as they start with the fields of version 00.
+func ParseTraceparent(s string) (SpanContext, error) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, ErrInvalidTraceparent
+	}
+	if parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return sc, ErrInvalidTraceparent
+	}
+	var version, flags [1]byte
+	if !decodeHex(version[:], parts[0]) || !decodeHex(sc.TraceID[:], parts[1]) ||
+		!decodeHex(sc.SpanID[:], parts[2]) || !decodeHex(flags[:], parts[3]) {
+		return sc, ErrInvalidTraceparent
+	}
+	if !sc.TraceID.IsValid() || !sc.SpanID.IsValid() {
+		return sc, ErrInvalidTraceparent
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, nil
+}
+
+// decodeHex decodes lowercase hex only, as the header requires.
+func decodeHex(dst []byte, s string) bool {
+	if strings.ToLower(s) != s {
+		return false
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err == nil
+}
+
+// Traceparent formats sc as a version 00 traceparent header.
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// Kind is the role of a span in the trace.
+type Kind int
+
+const (
+	// KindInternal is work done within the process.
+	KindInternal Kind = iota
+	// KindServer is a request served for a remote caller.
+	KindServer
+	// KindClient is a request made to a remote service, e.g. a database.
+	KindClient
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindServer:
+		return "server"
+	case KindClient:
+		return "client"
+	}
+	return "internal"
+}
+
+// Attribute is a key with a string, int64, float64 or bool value.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+func String(key, value string) Attribute { return Attribute{Key: key, Value: value} }
+
+func Int(key string, value int64) Attribute { return Attribute{Key: key, Value: value} }
+
+func Float64(key string, value float64) Attribute { return Attribute{Key: key, Value: value} }
+
+func Bool(key string, value bool) Attribute { return Attribute{Key: key, Value: value} }
+
+// SpanData is a span once it ended, as it is exported.
+type SpanData struct {
+	SpanContext
+	Parent     SpanID
+	Name       string
+	Kind       Kind
+	Start      time.Time
+	End        time.Time
+	Attributes []Attribute
+	// Error is the message of the error the span failed with, empty when it
+	// did not fail.
+	Error string
+}
+
+// Span is the work of one operation. The methods of a nil span do nothing, so
+// code can be instrumented whether or not a trace is recorded.
+type Span struct {
+	tracer *Tracer
+
+	mu    sync.Mutex
+	data  SpanData
+	ended bool
+}
+
+// SpanContext returns the context identifying s, the zero context for a nil
+// span.
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.data.SpanContext
+}
+
+// SetName renames s, e.g. once the route of a request is known.
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Name = name
+}
+
+// SetKind sets the role of s in the trace.
+func (s *Span) SetKind(k Kind) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Kind = k
+}
+
+// SetAttributes adds the attributes to s, replacing those with the same key.
+func (s *Span) SetAttributes(attrs ...Attribute) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+next:
+	for _, a := range attrs {
+		for i := range s.data.Attributes {
+			if s.data.Attributes[i].Key == a.Key {
+				s.data.Attributes[i].Value = a.Value
+				continue next
+			}
+		}
+		s.data.Attributes = append(s.data.Attributes, a)
+	}
+}
+
+// SetError marks s as failed with err, a nil err does nothing.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Error = err.Error()
+}
+
+// End ends s and queues it for export. Only the first call has an effect.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	s.mu.Unlock()
+
+	s.tracer.export(data)
+}
+
+type contextKey int
+
+const (
+	spanKey contextKey = iota
+	remoteKey
+)
+
+// ContextWithSpan returns a copy of ctx carrying s, the parent of the spans
+// started from it.
+func ContextWithSpan(ctx context.Context, s *Span) context.Context {
+	return context.WithValue(ctx, spanKey, s)
+}
+
+// FromContext returns the span ctx carries, nil when it carries none.
+func FromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey).(*Span)
+	return s
+}
+
+// ContextWithRemote returns a copy of ctx carrying the span of a remote
+// caller, which the next span started by a Tracer joins.
+func ContextWithRemote(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteKey, sc)
+}
+
+// Start starts a child of the span ctx carries and returns a copy of ctx
+// carrying the child. When ctx carries no span nothing is recorded and the
+// returned span is nil.
+func Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, *Span) {
+	parent := FromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	s := parent.tracer.newSpan(parent.data.TraceID, parent.data.SpanID, name, KindInternal, attrs)
+	return ContextWithSpan(ctx, s), s
+}
+
+func newTraceID() TraceID {
+	var t TraceID
+	for !t.IsValid() {
+		_, _ = rand.Read(t[:])
+	}
+	return t
+}
+
+func newSpanID() SpanID {
+	var s SpanID
+	for !s.IsValid() {
+		_, _ = rand.Read(s[:])
+	}
+	return s
+}
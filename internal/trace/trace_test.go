@@ -0,0 +1,119 @@
+package trace_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/mustafadubul/product/internal/trace"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	sc, err := trace.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	assert.NoError(t, err)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String())
+	assert.Equal(t, "00f067aa0ba902b7", sc.SpanID.String())
+	assert.True(t, sc.Sampled)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", sc.Traceparent())
+
+	sc, err = trace.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	assert.NoError(t, err)
+	assert.False(t, sc.Sampled)
+
+	// later versions may add fields
+	_, err = trace.ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra")
+	assert.NoError(t, err)
+
+	for _, s := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473g-00f067aa0ba902b7-01",
+	} {
+		_, err := trace.ParseTraceparent(s)
+		assert.Equal(t, trace.ErrInvalidTraceparent, err, s)
+	}
+}
+
+func TestTracer(t *testing.T) {
+	rec := &trace.Recorder{}
+	l := zerolog.Nop()
+	tracer := trace.NewTracer(&l, rec)
+
+	remote, err := trace.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	assert.NoError(t, err)
+	ctx, root := tracer.Start(trace.ContextWithRemote(context.Background(), remote), "GET")
+	root.SetName("GET /q")
+	root.SetAttributes(trace.String("http.route", "/q"), trace.Int("http.status_code", 200))
+	root.SetAttributes(trace.Int("http.status_code", 500))
+
+	_, child := trace.Start(ctx, "service.Search", trace.Bool("cached", false))
+	child.SetError(errors.New("boom"))
+	child.End()
+	child.End()
+	root.End()
+
+	assert.NoError(t, tracer.Shutdown(context.Background()))
+	spans := rec.Spans()
+	if assert.Len(t, spans, 2) {
+		c, r := spans[0], spans[1]
+		assert.Equal(t, "service.Search", c.Name)
+		assert.Equal(t, trace.KindInternal, c.Kind)
+		assert.Equal(t, remote.TraceID, c.TraceID)
+		assert.Equal(t, r.SpanID, c.Parent)
+		assert.Equal(t, "boom", c.Error)
+		assert.Equal(t, []trace.Attribute{trace.Bool("cached", false)}, c.Attributes)
+
+		assert.Equal(t, "GET /q", r.Name)
+		assert.Equal(t, trace.KindServer, r.Kind)
+		assert.Equal(t, remote.TraceID, r.TraceID)
+		assert.Equal(t, remote.SpanID, r.Parent)
+		assert.Equal(t, []trace.Attribute{trace.String("http.route", "/q"), trace.Int("http.status_code", 500)}, r.Attributes)
+		assert.False(t, r.End.Before(r.Start))
+	}
+}
+
+func TestTracerRoot(t *testing.T) {
+	rec := &trace.Recorder{}
+	l := zerolog.Nop()
+	tracer := trace.NewTracer(&l, rec, trace.WithBatchSize(1))
+
+	_, root := tracer.Start(context.Background(), "GET")
+	root.End()
+	assert.NoError(t, tracer.Shutdown(context.Background()))
+
+	spans := rec.Spans()
+	if assert.Len(t, spans, 1) {
+		assert.True(t, spans[0].TraceID.IsValid())
+		assert.False(t, spans[0].Parent.IsValid())
+	}
+}
+
+func TestNotRecorded(t *testing.T) {
+	rec := &trace.Recorder{}
+	l := zerolog.Nop()
+	tracer := trace.NewTracer(&l, rec)
+
+	// without a span in the context nothing is recorded
+	ctx, s := trace.Start(context.Background(), "service.Search")
+	assert.Nil(t, s)
+	assert.Nil(t, trace.FromContext(ctx))
+	s.SetAttributes(trace.Int("rows", 1))
+	s.SetError(errors.New("boom"))
+	s.End()
+
+	// nor when the caller did not sample its trace
+	remote, err := trace.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	assert.NoError(t, err)
+	_, s = tracer.Start(trace.ContextWithRemote(context.Background(), remote), "GET")
+	assert.Nil(t, s)
+
+	assert.NoError(t, tracer.Shutdown(context.Background()))
+	assert.Empty(t, rec.Spans())
+}
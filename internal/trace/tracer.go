@@ -0,0 +1,183 @@
+package trace
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	// DefaultBatchSize is the number of spans exported at once.
+	DefaultBatchSize = 512
+	// DefaultInterval is how long an ended span waits at most for its batch
+	// to fill.
+	DefaultInterval = 5 * time.Second
+	// DefaultQueueSize is the number of ended spans waiting for export past
+	// which further spans are dropped.
+	DefaultQueueSize = 2048
+)
+
+// Tracer starts the spans of the requests a process serves and exports them
+// in batches in the background.
+type Tracer struct {
+	logger   *zerolog.Logger
+	exporter Exporter
+
+	batchSize int
+	interval  time.Duration
+	queueSize int
+
+	queue chan SpanData
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// Option configures optional behaviour of the Tracer.
+type Option func(*Tracer)
+
+// WithBatchSize sets the number of spans exported at once.
+func WithBatchSize(n int) Option {
+	return func(t *Tracer) {
+		t.batchSize = n
+	}
+}
+
+// WithInterval sets how long an ended span waits at most for its batch to
+// fill.
+func WithInterval(d time.Duration) Option {
+	return func(t *Tracer) {
+		t.interval = d
+	}
+}
+
+// WithQueueSize sets the number of ended spans waiting for export past which
+// further spans are dropped, so a slow exporter does not hold up requests.
+func WithQueueSize(n int) Option {
+	return func(t *Tracer) {
+		t.queueSize = n
+	}
+}
+
+// NewTracer returns a tracer exporting to e, which runs until Shutdown.
+func NewTracer(l *zerolog.Logger, e Exporter, opts ...Option) *Tracer {
+	componentLogger := l.With().Str("component", "trace").Logger()
+	t := &Tracer{
+		logger:    &componentLogger,
+		exporter:  e,
+		batchSize: DefaultBatchSize,
+		interval:  DefaultInterval,
+		queueSize: DefaultQueueSize,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	t.queue = make(chan SpanData, t.queueSize)
+
+	go t.run()
+	return t
+}
+
+// Start starts a server span for a request and returns a copy of ctx carrying
+// it. The span joins the trace of the remote caller ctx carries, or starts a
+// trace when it carries none. When the caller did not sample its trace nothing
+// is recorded and the returned span is nil.
+func (t *Tracer) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, *Span) {
+	var s *Span
+	if remote, ok := ctx.Value(remoteKey).(SpanContext); ok {
+		if !remote.Sampled {
+			return ctx, nil
+		}
+		s = t.newSpan(remote.TraceID, remote.SpanID, name, KindServer, attrs)
+	} else {
+		s = t.newSpan(newTraceID(), SpanID{}, name, KindServer, attrs)
+	}
+	return ContextWithSpan(ctx, s), s
+}
+
+func (t *Tracer) newSpan(traceID TraceID, parent SpanID, name string, kind Kind, attrs []Attribute) *Span {
+	s := &Span{
+		tracer: t,
+		data: SpanData{
+			SpanContext: SpanContext{TraceID: traceID, SpanID: newSpanID(), Sampled: true},
+			Parent:      parent,
+			Name:        name,
+			Kind:        kind,
+			Start:       time.Now(),
+		},
+	}
+	s.SetAttributes(attrs...)
+	return s
+}
+
+// export queues an ended span, dropping it when the queue is full or the
+// tracer was shut down.
+func (t *Tracer) export(s SpanData) {
+	select {
+	case <-t.stop:
+		return
+	default:
+	}
+	select {
+	case t.queue <- s:
+	default:
+		t.logger.Warn().Str("span", s.Name).Msg("span queue full, span dropped")
+	}
+}
+
+func (t *Tracer) run() {
+	defer close(t.done)
+
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	batch := make([]SpanData, 0, t.batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := t.exporter.ExportSpans(context.Background(), batch); err != nil {
+			t.logger.Error().Err(err).Int("spans", len(batch)).Msg("failed to export spans")
+		}
+		batch = make([]SpanData, 0, t.batchSize)
+	}
+
+	for {
+		select {
+		case s := <-t.queue:
+			batch = append(batch, s)
+			if len(batch) >= t.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-t.stop:
+			for {
+				select {
+				case s := <-t.queue:
+					batch = append(batch, s)
+					if len(batch) >= t.batchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// Shutdown exports the spans that ended and shuts the exporter down. Spans
+// ending afterwards are dropped.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	close(t.stop)
+	select {
+	case <-t.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return t.exporter.Shutdown(ctx)
+}
@@ -0,0 +1,318 @@
+// Package webhook delivers the events of the outbox to the webhooks partners
+// subscribed. Deliveries are signed with the secret of the webhook and retried
+// with exponential backoff, the events a webhook keeps failing on end up in
+// its dead letters.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mustafadubul/product/internal/domain"
+	"github.com/mustafadubul/product/internal/repository"
+	"github.com/rs/zerolog"
+)
+
+// Headers of a delivery. The signature is computed over the timestamp and the
+// body, see Sign.
+const (
+	IDHeader        = "X-Webhook-ID"
+	TimestampHeader = "X-Signature-Timestamp"
+	SignatureHeader = "X-Signature"
+)
+
+// Defaults of a deliverer that is not configured otherwise.
+const (
+	DefaultAttempts   = 5
+	DefaultBackoff    = time.Second
+	DefaultMaxBackoff = time.Minute
+	DefaultTimeout    = 10 * time.Second
+	DefaultPause      = time.Minute
+)
+
+// ErrSignature is returned by Verify when a delivery is not signed with the
+// secret.
+var ErrSignature = errors.New("invalid signature")
+
+// Sign returns the signature of a delivery: the hex encoded HMAC-SHA256 of the
+// timestamp, a dot and the body keyed with the secret.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature headers of a delivery for receivers. A positive
+// tolerance rejects deliveries signed longer ago, which stops replays.
+func Verify(secret string, h http.Header, body []byte, tolerance time.Duration) error {
+	timestamp, err := strconv.ParseInt(h.Get(TimestampHeader), 10, 64)
+	if err != nil {
+		return fmt.Errorf("timestamp not valid: %w", ErrSignature)
+	}
+	if tolerance > 0 {
+		age := time.Since(time.Unix(timestamp, 0))
+		if age > tolerance || age < -tolerance {
+			return fmt.Errorf("timestamp out of tolerance: %w", ErrSignature)
+		}
+	}
+	if !hmac.Equal([]byte(h.Get(SignatureHeader)), []byte(Sign(secret, timestamp, body))) {
+		return ErrSignature
+	}
+	return nil
+}
+
+// Deliverer is an events.Publisher posting the events to every webhook whose
+// query matches the product of the event.
+type Deliverer struct {
+	logger *zerolog.Logger
+	store  repository.Webhooks
+	client *http.Client
+
+	attempts   int
+	backoff    time.Duration
+	maxBackoff time.Duration
+	pause      time.Duration
+
+	mu     sync.Mutex
+	paused map[uint64]paused
+}
+
+// paused is a webhook that is held back after a failed delivery.
+type paused struct {
+	until time.Time
+	err   error
+}
+
+// Option configures optional behaviour of the Deliverer.
+type Option func(*Deliverer)
+
+// WithClient sets the client deliveries are posted with.
+func WithClient(c *http.Client) Option {
+	return func(d *Deliverer) {
+		d.client = c
+	}
+}
+
+// WithAttempts sets how often a delivery is tried before the event goes to the
+// dead letters.
+func WithAttempts(n int) Option {
+	return func(d *Deliverer) {
+		d.attempts = n
+	}
+}
+
+// WithBackoff sets the wait after the first failed attempt, which doubles with
+// every further attempt up to max.
+func WithBackoff(base, max time.Duration) Option {
+	return func(d *Deliverer) {
+		d.backoff = base
+		d.maxBackoff = max
+	}
+}
+
+// WithPause sets how long a webhook is held back once an event used up its
+// attempts. Meanwhile its events go to the dead letters without being tried.
+func WithPause(d time.Duration) Option {
+	return func(dl *Deliverer) {
+		dl.pause = d
+	}
+}
+
+// NewDeliverer returns a deliverer for the webhooks in store.
+func NewDeliverer(l *zerolog.Logger, store repository.Webhooks, opts ...Option) *Deliverer {
+	componentLogger := l.With().Str("component", "webhook").Logger()
+	d := &Deliverer{
+		logger:     &componentLogger,
+		store:      store,
+		client:     &http.Client{Timeout: DefaultTimeout},
+		attempts:   DefaultAttempts,
+		backoff:    DefaultBackoff,
+		maxBackoff: DefaultMaxBackoff,
+		pause:      DefaultPause,
+		paused:     map[uint64]paused{},
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+// Publish delivers the events to the webhooks, concurrently across webhooks
+// and in order for every webhook. A webhook only receives events of its
+// tenant that happened after it was created and whose product matches its
+// query. An event that exhausts its attempts is added to the dead letters of
+// the webhook and does not fail the batch. The webhook is then paused: the
+// rest of the batch and its events until the pause is over are dead lettered
+// without being tried, so a broken receiver holds up the others for the
+// attempts of a single event at most once per pause.
+func (d *Deliverer) Publish(ctx context.Context, events []domain.Event) error {
+	webhooks, err := d.store.Webhooks()
+	if err != nil {
+		return fmt.Errorf("failed to read webhooks: %w", err)
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	for i := range webhooks {
+		wg.Add(1)
+		go func(w *domain.Webhook) {
+			defer wg.Done()
+			if err := d.deliverAll(ctx, w, events); err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		}(&webhooks[i])
+	}
+	wg.Wait()
+
+	return firstErr
+}
+
+func (d *Deliverer) deliverAll(ctx context.Context, w *domain.Webhook, events []domain.Event) error {
+	l := d.logger.With().Uint64("webhook", w.ID).Logger()
+
+	// once an event failed the rest of the batch is not tried either
+	held := d.pausedBy(w.ID)
+	for i := range events {
+		e := &events[i]
+		if e.Tenant != w.Tenant || e.At.Before(w.CreatedAt) || !repository.Matches(&w.Query, &e.Product) {
+			continue
+		}
+
+		if held != nil {
+			if err := d.deadLetter(w, e, 0, fmt.Errorf("not tried, webhook paused after: %w", held)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		attempts, err := d.deliver(ctx, w, e)
+		if err == nil {
+			continue
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+
+		l.Warn().Err(err).Uint64("offset", e.Offset).Int("attempts", attempts).Msg("delivery failed, event dead lettered and webhook paused")
+		d.hold(w.ID, err)
+		held = err
+		if err := d.deadLetter(w, e, attempts, err); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Deliverer) deadLetter(w *domain.Webhook, e *domain.Event, attempts int, err error) error {
+	dl := &domain.DeadLetter{
+		WebhookID: w.ID,
+		Event:     *e,
+		Attempts:  attempts,
+		Error:     err.Error(),
+		FailedAt:  time.Now().UTC(),
+	}
+	if err := d.store.AddDeadLetter(dl); err != nil {
+		return fmt.Errorf("failed to dead letter event %d: %w", e.Offset, err)
+	}
+	return nil
+}
+
+// hold pauses the webhook after err.
+func (d *Deliverer) hold(id uint64, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.paused[id] = paused{until: time.Now().Add(d.pause), err: err}
+}
+
+// pausedBy returns the error the webhook is paused after, nil when it is not
+// paused.
+func (d *Deliverer) pausedBy(id uint64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	p, ok := d.paused[id]
+	if !ok {
+		return nil
+	}
+	if !time.Now().Before(p.until) {
+		delete(d.paused, id)
+		return nil
+	}
+	return p.err
+}
+
+// deliver posts the event until the webhook accepts it or the attempts are
+// used up, and returns the number of attempts with the last error.
+func (d *Deliverer) deliver(ctx context.Context, w *domain.Webhook, e *domain.Event) (int, error) {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return 0, err
+	}
+
+	wait := d.backoff
+	for attempt := 1; ; attempt++ {
+		err = d.post(ctx, w, e, body)
+		if err == nil || attempt >= d.attempts {
+			return attempt, err
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return attempt, err
+		case <-timer.C:
+		}
+		if wait *= 2; wait > d.maxBackoff {
+			wait = d.maxBackoff
+		}
+	}
+}
+
+func (d *Deliverer) post(ctx context.Context, w *domain.Webhook, e *domain.Event, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Event-Type", e.Type)
+	req.Header.Set("X-Event-Offset", fmt.Sprint(e.Offset))
+	req.Header.Set(IDHeader, fmt.Sprint(w.ID))
+	req.Header.Set(TimestampHeader, fmt.Sprint(timestamp))
+	req.Header.Set(SignatureHeader, Sign(w.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// drain the body so the connection can be reused
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
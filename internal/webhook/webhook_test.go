@@ -0,0 +1,195 @@
+package webhook_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mustafadubul/product/internal/domain"
+	"github.com/mustafadubul/product/internal/repository/memory"
+	"github.com/mustafadubul/product/internal/webhook"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+// receiver records the events delivered to it with a valid signature and
+// fails the first n deliveries.
+type receiver struct {
+	t      *testing.T
+	secret string
+
+	mu     sync.Mutex
+	fail   int
+	events []domain.Event
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	assert.NoError(rc.t, err)
+	assert.NoError(rc.t, webhook.Verify(rc.secret, r.Header, body, time.Minute))
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.fail > 0 {
+		rc.fail--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	var e domain.Event
+	assert.NoError(rc.t, json.Unmarshal(body, &e))
+	rc.events = append(rc.events, e)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func TestSignVerify(t *testing.T) {
+	body := []byte(`{"offset":1}`)
+	h := http.Header{}
+	h.Set(webhook.TimestampHeader, "1600000000")
+	h.Set(webhook.SignatureHeader, webhook.Sign("s3cr3t", 1600000000, body))
+
+	assert.NoError(t, webhook.Verify("s3cr3t", h, body, 0))
+	assert.True(t, errors.Is(webhook.Verify("other", h, body, 0), webhook.ErrSignature))
+	assert.True(t, errors.Is(webhook.Verify("s3cr3t", h, []byte(`{"offset":2}`), 0), webhook.ErrSignature))
+	// an old delivery is rejected once a tolerance is set
+	assert.True(t, errors.Is(webhook.Verify("s3cr3t", h, body, time.Minute), webhook.ErrSignature))
+
+	h.Set(webhook.TimestampHeader, "yesterday")
+	assert.True(t, errors.Is(webhook.Verify("s3cr3t", h, body, 0), webhook.ErrSignature))
+}
+
+func TestDeliverer(t *testing.T) {
+	store := memory.New()
+	created := time.Now().Add(-time.Hour)
+
+	// the london receiver recovers after two failures, the other never does
+	london := &receiver{t: t, secret: "london-secret", fail: 2}
+	londonServer := httptest.NewServer(london)
+	defer londonServer.Close()
+	broken := &receiver{t: t, secret: "broken-secret", fail: 1 << 20}
+	brokenServer := httptest.NewServer(broken)
+	defer brokenServer.Close()
+
+	londonHook, err := store.CreateWebhook(&domain.Webhook{
+		URL: londonServer.URL, Secret: london.secret, CreatedAt: created,
+		Query: domain.Query{Term: "camera", Lat: 51.5, Lng: -0.1, Radius: 10000},
+	})
+	assert.NoError(t, err)
+	brokenHook, err := store.CreateWebhook(&domain.Webhook{URL: brokenServer.URL, Secret: broken.secret, CreatedAt: created})
+	assert.NoError(t, err)
+
+	now := time.Now()
+	events := []domain.Event{
+		{Offset: 1, Type: domain.EventCreated, At: now, Product: domain.Product{ID: 1, ItemName: "Camera", Lat: 51.51, Lng: -0.12}},
+		{Offset: 2, Type: domain.EventCreated, At: now, Product: domain.Product{ID: 2, ItemName: "Camera", Lat: 48.86, Lng: 2.35}},
+		{Offset: 3, Type: domain.EventCreated, At: now, Product: domain.Product{ID: 3, ItemName: "Lens", Lat: 51.51, Lng: -0.12}},
+		{Offset: 4, Type: domain.EventCreated, At: created.Add(-time.Minute), Product: domain.Product{ID: 4, ItemName: "Camera", Lat: 51.51, Lng: -0.12}},
+		// the webhooks do not see the products of other tenants
+		{Offset: 5, Tenant: "acme", Type: domain.EventCreated, At: now, Product: domain.Product{ID: 5, ItemName: "Camera", Lat: 51.51, Lng: -0.12}},
+	}
+
+	l := zerolog.Nop()
+	d := webhook.NewDeliverer(&l, store, webhook.WithAttempts(3), webhook.WithBackoff(time.Millisecond, 2*time.Millisecond))
+	assert.NoError(t, d.Publish(context.Background(), events))
+
+	if assert.Len(t, london.events, 1) {
+		assert.Equal(t, uint64(1), london.events[0].Offset)
+	}
+	assert.Empty(t, broken.events)
+
+	letters, err := store.DeadLetters(londonHook.ID, 0, 0)
+	assert.NoError(t, err)
+	assert.Empty(t, letters)
+
+	letters, err = store.DeadLetters(brokenHook.ID, 0, 0)
+	assert.NoError(t, err)
+	if assert.Len(t, letters, 3) {
+		assert.Equal(t, uint64(1), letters[0].Event.Offset)
+		assert.Equal(t, 3, letters[0].Attempts)
+		assert.Contains(t, letters[0].Error, "503")
+	}
+}
+
+func TestDelivererPause(t *testing.T) {
+	store := memory.New()
+
+	// the hanging receiver never answers in time
+	var hung int32
+	done := make(chan struct{})
+	hanging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hung, 1)
+		<-done
+	}))
+	defer hanging.Close()
+	defer close(done)
+	healthy := &receiver{t: t, secret: "healthy-secret"}
+	healthyServer := httptest.NewServer(healthy)
+	defer healthyServer.Close()
+
+	hangingHook, err := store.CreateWebhook(&domain.Webhook{URL: hanging.URL, Secret: "hanging-secret"})
+	assert.NoError(t, err)
+	_, err = store.CreateWebhook(&domain.Webhook{URL: healthyServer.URL, Secret: healthy.secret})
+	assert.NoError(t, err)
+
+	batch := func(from uint64) []domain.Event {
+		events := make([]domain.Event, 5)
+		for i := range events {
+			events[i] = domain.Event{Offset: from + uint64(i), At: time.Now(), Product: domain.Product{ID: from + uint64(i)}}
+		}
+		return events
+	}
+
+	l := zerolog.Nop()
+	d := webhook.NewDeliverer(&l, store, webhook.WithAttempts(2), webhook.WithBackoff(time.Millisecond, time.Millisecond),
+		webhook.WithClient(&http.Client{Timeout: 50 * time.Millisecond}), webhook.WithPause(time.Hour))
+
+	// the first batch waits for the attempts of a single event, not of all
+	start := time.Now()
+	assert.NoError(t, d.Publish(context.Background(), batch(1)))
+	assert.True(t, time.Since(start) < 250*time.Millisecond, "first batch took %v", time.Since(start))
+
+	// while the hanging webhook is paused the next batch is not held up
+	start = time.Now()
+	assert.NoError(t, d.Publish(context.Background(), batch(6)))
+	assert.True(t, time.Since(start) < 100*time.Millisecond, "second batch took %v", time.Since(start))
+
+	assert.Len(t, healthy.events, 10)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&hung))
+
+	letters, err := store.DeadLetters(hangingHook.ID, 0, 0)
+	assert.NoError(t, err)
+	if assert.Len(t, letters, 10) {
+		assert.Equal(t, 2, letters[0].Attempts)
+		assert.Equal(t, 0, letters[1].Attempts)
+		assert.Contains(t, letters[9].Error, "paused")
+	}
+}
+
+func TestDelivererCancelled(t *testing.T) {
+	store := memory.New()
+	broken := &receiver{t: t, secret: "broken-secret", fail: 1 << 20}
+	server := httptest.NewServer(broken)
+	defer server.Close()
+
+	w, err := store.CreateWebhook(&domain.Webhook{URL: server.URL, Secret: broken.secret})
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	// a cancelled delivery fails the batch so the dispatcher retries it
+	l := zerolog.Nop()
+	d := webhook.NewDeliverer(&l, store, webhook.WithBackoff(time.Hour, time.Hour))
+	err = d.Publish(ctx, []domain.Event{{Offset: 1, At: time.Now(), Product: domain.Product{ID: 1}}})
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "got %v", err)
+
+	letters, err := store.DeadLetters(w.ID, 0, 0)
+	assert.NoError(t, err)
+	assert.Empty(t, letters)
+}
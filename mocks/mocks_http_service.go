@@ -7,7 +7,9 @@ package mocks
 import (
 	context "context"
 	gomock "github.com/golang/mock/gomock"
+	bulk "github.com/mustafadubul/product/internal/bulk"
 	domain "github.com/mustafadubul/product/internal/domain"
+	io "io"
 	reflect "reflect"
 )
 
@@ -65,10 +67,10 @@ func (mr *MockHTTPServiceMockRecorder) Get(ctx, id interface{}) *gomock.Call {
 }
 
 // Search mocks base method
-func (m *MockHTTPService) Search(ctx context.Context, q *domain.Query) ([]domain.Product, error) {
+func (m *MockHTTPService) Search(ctx context.Context, q *domain.Query) (*domain.Page, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "Search", ctx, q)
-	ret0, _ := ret[0].([]domain.Product)
+	ret0, _ := ret[0].(*domain.Page)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
@@ -94,16 +96,268 @@ func (mr *MockHTTPServiceMockRecorder) Update(ctx, p interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockHTTPService)(nil).Update), ctx, p)
 }
 
+// Patch mocks base method
+func (m *MockHTTPService) Patch(ctx context.Context, id, version uint64, patch *domain.ProductPatch) (*domain.Product, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Patch", ctx, id, version, patch)
+	ret0, _ := ret[0].(*domain.Product)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Patch indicates an expected call of Patch
+func (mr *MockHTTPServiceMockRecorder) Patch(ctx, id, version, patch interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Patch", reflect.TypeOf((*MockHTTPService)(nil).Patch), ctx, id, version, patch)
+}
+
 // Delete mocks base method
-func (m *MockHTTPService) Delete(ctx context.Context, id uint64) error {
+func (m *MockHTTPService) Delete(ctx context.Context, id, version uint64) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Delete", ctx, id)
+	ret := m.ctrl.Call(m, "Delete", ctx, id, version)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // Delete indicates an expected call of Delete
-func (mr *MockHTTPServiceMockRecorder) Delete(ctx, id interface{}) *gomock.Call {
+func (mr *MockHTTPServiceMockRecorder) Delete(ctx, id, version interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockHTTPService)(nil).Delete), ctx, id, version)
+}
+
+// Trash mocks base method
+func (m *MockHTTPService) Trash(ctx context.Context, after uint64, limit int) ([]domain.Product, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Trash", ctx, after, limit)
+	ret0, _ := ret[0].([]domain.Product)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Trash indicates an expected call of Trash
+func (mr *MockHTTPServiceMockRecorder) Trash(ctx, after, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Trash", reflect.TypeOf((*MockHTTPService)(nil).Trash), ctx, after, limit)
+}
+
+// Restore mocks base method
+func (m *MockHTTPService) Restore(ctx context.Context, id uint64) (*domain.Product, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Restore", ctx, id)
+	ret0, _ := ret[0].(*domain.Product)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Restore indicates an expected call of Restore
+func (mr *MockHTTPServiceMockRecorder) Restore(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Restore", reflect.TypeOf((*MockHTTPService)(nil).Restore), ctx, id)
+}
+
+// History mocks base method
+func (m *MockHTTPService) History(ctx context.Context, id, after uint64, limit int) ([]domain.Revision, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "History", ctx, id, after, limit)
+	ret0, _ := ret[0].([]domain.Revision)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// History indicates an expected call of History
+func (mr *MockHTTPServiceMockRecorder) History(ctx, id, after, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "History", reflect.TypeOf((*MockHTTPService)(nil).History), ctx, id, after, limit)
+}
+
+// Revision mocks base method
+func (m *MockHTTPService) Revision(ctx context.Context, id, number uint64) (*domain.Revision, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Revision", ctx, id, number)
+	ret0, _ := ret[0].(*domain.Revision)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Revision indicates an expected call of Revision
+func (mr *MockHTTPServiceMockRecorder) Revision(ctx, id, number interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Revision", reflect.TypeOf((*MockHTTPService)(nil).Revision), ctx, id, number)
+}
+
+// Revert mocks base method
+func (m *MockHTTPService) Revert(ctx context.Context, id, number, version uint64) (*domain.Product, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Revert", ctx, id, number, version)
+	ret0, _ := ret[0].(*domain.Product)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Revert indicates an expected call of Revert
+func (mr *MockHTTPServiceMockRecorder) Revert(ctx, id, number, version interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Revert", reflect.TypeOf((*MockHTTPService)(nil).Revert), ctx, id, number, version)
+}
+
+// Events mocks base method
+func (m *MockHTTPService) Events(ctx context.Context, after uint64, limit int) ([]domain.Event, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Events", ctx, after, limit)
+	ret0, _ := ret[0].([]domain.Event)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Events indicates an expected call of Events
+func (mr *MockHTTPServiceMockRecorder) Events(ctx, after, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Events", reflect.TypeOf((*MockHTTPService)(nil).Events), ctx, after, limit)
+}
+
+// CreateWebhook mocks base method
+func (m *MockHTTPService) CreateWebhook(ctx context.Context, w *domain.Webhook) (*domain.Webhook, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateWebhook", ctx, w)
+	ret0, _ := ret[0].(*domain.Webhook)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateWebhook indicates an expected call of CreateWebhook
+func (mr *MockHTTPServiceMockRecorder) CreateWebhook(ctx, w interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateWebhook", reflect.TypeOf((*MockHTTPService)(nil).CreateWebhook), ctx, w)
+}
+
+// Webhooks mocks base method
+func (m *MockHTTPService) Webhooks(ctx context.Context) ([]domain.Webhook, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Webhooks", ctx)
+	ret0, _ := ret[0].([]domain.Webhook)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Webhooks indicates an expected call of Webhooks
+func (mr *MockHTTPServiceMockRecorder) Webhooks(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Webhooks", reflect.TypeOf((*MockHTTPService)(nil).Webhooks), ctx)
+}
+
+// DeleteWebhook mocks base method
+func (m *MockHTTPService) DeleteWebhook(ctx context.Context, id uint64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteWebhook", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteWebhook indicates an expected call of DeleteWebhook
+func (mr *MockHTTPServiceMockRecorder) DeleteWebhook(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteWebhook", reflect.TypeOf((*MockHTTPService)(nil).DeleteWebhook), ctx, id)
+}
+
+// DeadLetters mocks base method
+func (m *MockHTTPService) DeadLetters(ctx context.Context, webhookID, after uint64, limit int) ([]domain.DeadLetter, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeadLetters", ctx, webhookID, after, limit)
+	ret0, _ := ret[0].([]domain.DeadLetter)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeadLetters indicates an expected call of DeadLetters
+func (mr *MockHTTPServiceMockRecorder) DeadLetters(ctx, webhookID, after, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeadLetters", reflect.TypeOf((*MockHTTPService)(nil).DeadLetters), ctx, webhookID, after, limit)
+}
+
+// CreateSavedSearch mocks base method
+func (m *MockHTTPService) CreateSavedSearch(ctx context.Context, s *domain.SavedSearch) (*domain.SavedSearch, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateSavedSearch", ctx, s)
+	ret0, _ := ret[0].(*domain.SavedSearch)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateSavedSearch indicates an expected call of CreateSavedSearch
+func (mr *MockHTTPServiceMockRecorder) CreateSavedSearch(ctx, s interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateSavedSearch", reflect.TypeOf((*MockHTTPService)(nil).CreateSavedSearch), ctx, s)
+}
+
+// SavedSearches mocks base method
+func (m *MockHTTPService) SavedSearches(ctx context.Context) ([]domain.SavedSearch, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SavedSearches", ctx)
+	ret0, _ := ret[0].([]domain.SavedSearch)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SavedSearches indicates an expected call of SavedSearches
+func (mr *MockHTTPServiceMockRecorder) SavedSearches(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SavedSearches", reflect.TypeOf((*MockHTTPService)(nil).SavedSearches), ctx)
+}
+
+// DeleteSavedSearch mocks base method
+func (m *MockHTTPService) DeleteSavedSearch(ctx context.Context, id uint64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteSavedSearch", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteSavedSearch indicates an expected call of DeleteSavedSearch
+func (mr *MockHTTPServiceMockRecorder) DeleteSavedSearch(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteSavedSearch", reflect.TypeOf((*MockHTTPService)(nil).DeleteSavedSearch), ctx, id)
+}
+
+// Matches mocks base method
+func (m *MockHTTPService) Matches(ctx context.Context, id, after uint64, limit int) ([]domain.Match, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Matches", ctx, id, after, limit)
+	ret0, _ := ret[0].([]domain.Match)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Matches indicates an expected call of Matches
+func (mr *MockHTTPServiceMockRecorder) Matches(ctx, id, after, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Matches", reflect.TypeOf((*MockHTTPService)(nil).Matches), ctx, id, after, limit)
+}
+
+// Import mocks base method
+func (m *MockHTTPService) Import(ctx context.Context, r io.Reader, format bulk.Format) (*domain.ImportReport, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Import", ctx, r, format)
+	ret0, _ := ret[0].(*domain.ImportReport)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Import indicates an expected call of Import
+func (mr *MockHTTPServiceMockRecorder) Import(ctx, r, format interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Import", reflect.TypeOf((*MockHTTPService)(nil).Import), ctx, r, format)
+}
+
+// Export mocks base method
+func (m *MockHTTPService) Export(ctx context.Context, q *domain.Query, fn func(*domain.Product) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Export", ctx, q, fn)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Export indicates an expected call of Export
+func (mr *MockHTTPServiceMockRecorder) Export(ctx, q, fn interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockHTTPService)(nil).Delete), ctx, id)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Export", reflect.TypeOf((*MockHTTPService)(nil).Export), ctx, q, fn)
 }
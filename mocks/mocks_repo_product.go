@@ -5,9 +5,12 @@
 package mocks
 
 import (
+	context "context"
 	gomock "github.com/golang/mock/gomock"
 	domain "github.com/mustafadubul/product/internal/domain"
+	repository "github.com/mustafadubul/product/internal/repository"
 	reflect "reflect"
+	time "time"
 )
 
 // MockRepoProduct is a mock of Product interface
@@ -34,107 +37,453 @@ func (m *MockRepoProduct) EXPECT() *MockRepoProductMockRecorder {
 }
 
 // Search mocks base method
-func (m *MockRepoProduct) Search(functions ...func() error) ([]domain.Product, error) {
+func (m *MockRepoProduct) Search(ctx context.Context, f repository.Filter) ([]domain.Product, error) {
 	m.ctrl.T.Helper()
-	varargs := []interface{}{}
-	for _, a := range functions {
-		varargs = append(varargs, a)
-	}
-	ret := m.ctrl.Call(m, "Search", varargs...)
+	ret := m.ctrl.Call(m, "Search", ctx, f)
 	ret0, _ := ret[0].([]domain.Product)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // Search indicates an expected call of Search
-func (mr *MockRepoProductMockRecorder) Search(functions ...interface{}) *gomock.Call {
+func (mr *MockRepoProductMockRecorder) Search(ctx, f interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Search", reflect.TypeOf((*MockRepoProduct)(nil).Search), functions...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Search", reflect.TypeOf((*MockRepoProduct)(nil).Search), ctx, f)
 }
 
-// Like mocks base method
-func (m *MockRepoProduct) Like(term string) func() error {
+// Each mocks base method
+func (m *MockRepoProduct) Each(ctx context.Context, f repository.Filter, fn func(*domain.Product) error) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Like", term)
-	ret0, _ := ret[0].(func() error)
+	ret := m.ctrl.Call(m, "Each", ctx, f, fn)
+	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-// Like indicates an expected call of Like
-func (mr *MockRepoProductMockRecorder) Like(term interface{}) *gomock.Call {
+// Each indicates an expected call of Each
+func (mr *MockRepoProductMockRecorder) Each(ctx, f, fn interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Like", reflect.TypeOf((*MockRepoProduct)(nil).Like), term)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Each", reflect.TypeOf((*MockRepoProduct)(nil).Each), ctx, f, fn)
 }
 
-// Between mocks base method
-func (m *MockRepoProduct) Between(points []domain.Point) func() error {
+// Create mocks base method
+func (m *MockRepoProduct) Create(ctx context.Context, p *domain.Product) (*domain.Product, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Between", points)
-	ret0, _ := ret[0].(func() error)
-	return ret0
+	ret := m.ctrl.Call(m, "Create", ctx, p)
+	ret0, _ := ret[0].(*domain.Product)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
-// Between indicates an expected call of Between
-func (mr *MockRepoProductMockRecorder) Between(points interface{}) *gomock.Call {
+// Create indicates an expected call of Create
+func (mr *MockRepoProductMockRecorder) Create(ctx, p interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Between", reflect.TypeOf((*MockRepoProduct)(nil).Between), points)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockRepoProduct)(nil).Create), ctx, p)
 }
 
-// Create mocks base method
-func (m *MockRepoProduct) Create(p *domain.Product) (*domain.Product, error) {
+// CreateMany mocks base method
+func (m *MockRepoProduct) CreateMany(ctx context.Context, products []*domain.Product) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Create", p)
-	ret0, _ := ret[0].(*domain.Product)
-	ret1, _ := ret[1].(error)
-	return ret0, ret1
+	ret := m.ctrl.Call(m, "CreateMany", ctx, products)
+	ret0, _ := ret[0].(error)
+	return ret0
 }
 
-// Create indicates an expected call of Create
-func (mr *MockRepoProductMockRecorder) Create(p interface{}) *gomock.Call {
+// CreateMany indicates an expected call of CreateMany
+func (mr *MockRepoProductMockRecorder) CreateMany(ctx, products interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockRepoProduct)(nil).Create), p)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateMany", reflect.TypeOf((*MockRepoProduct)(nil).CreateMany), ctx, products)
 }
 
 // Get mocks base method
-func (m *MockRepoProduct) Get(id uint64) (*domain.Product, error) {
+func (m *MockRepoProduct) Get(ctx context.Context, id uint64) (*domain.Product, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Get", id)
+	ret := m.ctrl.Call(m, "Get", ctx, id)
 	ret0, _ := ret[0].(*domain.Product)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // Get indicates an expected call of Get
-func (mr *MockRepoProductMockRecorder) Get(id interface{}) *gomock.Call {
+func (mr *MockRepoProductMockRecorder) Get(ctx, id interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockRepoProduct)(nil).Get), id)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockRepoProduct)(nil).Get), ctx, id)
 }
 
 // Update mocks base method
-func (m *MockRepoProduct) Update(p *domain.Product) (*domain.Product, error) {
+func (m *MockRepoProduct) Update(ctx context.Context, p *domain.Product) (*domain.Product, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Update", p)
+	ret := m.ctrl.Call(m, "Update", ctx, p)
 	ret0, _ := ret[0].(*domain.Product)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // Update indicates an expected call of Update
-func (mr *MockRepoProductMockRecorder) Update(p interface{}) *gomock.Call {
+func (mr *MockRepoProductMockRecorder) Update(ctx, p interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockRepoProduct)(nil).Update), p)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockRepoProduct)(nil).Update), ctx, p)
 }
 
 // Delete mocks base method
-func (m *MockRepoProduct) Delete(id uint64) error {
+func (m *MockRepoProduct) Delete(ctx context.Context, id, version uint64) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Delete", id)
+	ret := m.ctrl.Call(m, "Delete", ctx, id, version)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // Delete indicates an expected call of Delete
-func (mr *MockRepoProductMockRecorder) Delete(id interface{}) *gomock.Call {
+func (mr *MockRepoProductMockRecorder) Delete(ctx, id, version interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockRepoProduct)(nil).Delete), ctx, id, version)
+}
+
+// Trash mocks base method
+func (m *MockRepoProduct) Trash(ctx context.Context, after uint64, limit int) ([]domain.Product, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Trash", ctx, after, limit)
+	ret0, _ := ret[0].([]domain.Product)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Trash indicates an expected call of Trash
+func (mr *MockRepoProductMockRecorder) Trash(ctx, after, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Trash", reflect.TypeOf((*MockRepoProduct)(nil).Trash), ctx, after, limit)
+}
+
+// Restore mocks base method
+func (m *MockRepoProduct) Restore(ctx context.Context, id uint64) (*domain.Product, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Restore", ctx, id)
+	ret0, _ := ret[0].(*domain.Product)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Restore indicates an expected call of Restore
+func (mr *MockRepoProductMockRecorder) Restore(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Restore", reflect.TypeOf((*MockRepoProduct)(nil).Restore), ctx, id)
+}
+
+// Purge mocks base method
+func (m *MockRepoProduct) Purge(before time.Time) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Purge", before)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Purge indicates an expected call of Purge
+func (mr *MockRepoProductMockRecorder) Purge(before interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Purge", reflect.TypeOf((*MockRepoProduct)(nil).Purge), before)
+}
+
+// History mocks base method
+func (m *MockRepoProduct) History(ctx context.Context, id, after uint64, limit int) ([]domain.Revision, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "History", ctx, id, after, limit)
+	ret0, _ := ret[0].([]domain.Revision)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// History indicates an expected call of History
+func (mr *MockRepoProductMockRecorder) History(ctx, id, after, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "History", reflect.TypeOf((*MockRepoProduct)(nil).History), ctx, id, after, limit)
+}
+
+// Revision mocks base method
+func (m *MockRepoProduct) Revision(ctx context.Context, id, number uint64) (*domain.Revision, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Revision", ctx, id, number)
+	ret0, _ := ret[0].(*domain.Revision)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Revision indicates an expected call of Revision
+func (mr *MockRepoProductMockRecorder) Revision(ctx, id, number interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Revision", reflect.TypeOf((*MockRepoProduct)(nil).Revision), ctx, id, number)
+}
+
+// MockRepoOutbox is a mock of Outbox interface
+type MockRepoOutbox struct {
+	ctrl     *gomock.Controller
+	recorder *MockRepoOutboxMockRecorder
+}
+
+// MockRepoOutboxMockRecorder is the mock recorder for MockRepoOutbox
+type MockRepoOutboxMockRecorder struct {
+	mock *MockRepoOutbox
+}
+
+// NewMockRepoOutbox creates a new mock instance
+func NewMockRepoOutbox(ctrl *gomock.Controller) *MockRepoOutbox {
+	mock := &MockRepoOutbox{ctrl: ctrl}
+	mock.recorder = &MockRepoOutboxMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockRepoOutbox) EXPECT() *MockRepoOutboxMockRecorder {
+	return m.recorder
+}
+
+// Events mocks base method
+func (m *MockRepoOutbox) Events(tenant string, after uint64, limit int) ([]domain.Event, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Events", tenant, after, limit)
+	ret0, _ := ret[0].([]domain.Event)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Events indicates an expected call of Events
+func (mr *MockRepoOutboxMockRecorder) Events(tenant, after, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Events", reflect.TypeOf((*MockRepoOutbox)(nil).Events), tenant, after, limit)
+}
+
+// Offset mocks base method
+func (m *MockRepoOutbox) Offset(consumer string) (uint64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Offset", consumer)
+	ret0, _ := ret[0].(uint64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Offset indicates an expected call of Offset
+func (mr *MockRepoOutboxMockRecorder) Offset(consumer interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Offset", reflect.TypeOf((*MockRepoOutbox)(nil).Offset), consumer)
+}
+
+// SetOffset mocks base method
+func (m *MockRepoOutbox) SetOffset(consumer string, offset uint64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetOffset", consumer, offset)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetOffset indicates an expected call of SetOffset
+func (mr *MockRepoOutboxMockRecorder) SetOffset(consumer, offset interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetOffset", reflect.TypeOf((*MockRepoOutbox)(nil).SetOffset), consumer, offset)
+}
+
+// MockRepoWebhooks is a mock of Webhooks interface
+type MockRepoWebhooks struct {
+	ctrl     *gomock.Controller
+	recorder *MockRepoWebhooksMockRecorder
+}
+
+// MockRepoWebhooksMockRecorder is the mock recorder for MockRepoWebhooks
+type MockRepoWebhooksMockRecorder struct {
+	mock *MockRepoWebhooks
+}
+
+// NewMockRepoWebhooks creates a new mock instance
+func NewMockRepoWebhooks(ctrl *gomock.Controller) *MockRepoWebhooks {
+	mock := &MockRepoWebhooks{ctrl: ctrl}
+	mock.recorder = &MockRepoWebhooksMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockRepoWebhooks) EXPECT() *MockRepoWebhooksMockRecorder {
+	return m.recorder
+}
+
+// CreateWebhook mocks base method
+func (m *MockRepoWebhooks) CreateWebhook(w *domain.Webhook) (*domain.Webhook, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateWebhook", w)
+	ret0, _ := ret[0].(*domain.Webhook)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateWebhook indicates an expected call of CreateWebhook
+func (mr *MockRepoWebhooksMockRecorder) CreateWebhook(w interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateWebhook", reflect.TypeOf((*MockRepoWebhooks)(nil).CreateWebhook), w)
+}
+
+// Webhooks mocks base method
+func (m *MockRepoWebhooks) Webhooks() ([]domain.Webhook, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Webhooks")
+	ret0, _ := ret[0].([]domain.Webhook)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Webhooks indicates an expected call of Webhooks
+func (mr *MockRepoWebhooksMockRecorder) Webhooks() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Webhooks", reflect.TypeOf((*MockRepoWebhooks)(nil).Webhooks))
+}
+
+// DeleteWebhook mocks base method
+func (m *MockRepoWebhooks) DeleteWebhook(id uint64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteWebhook", id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteWebhook indicates an expected call of DeleteWebhook
+func (mr *MockRepoWebhooksMockRecorder) DeleteWebhook(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteWebhook", reflect.TypeOf((*MockRepoWebhooks)(nil).DeleteWebhook), id)
+}
+
+// AddDeadLetter mocks base method
+func (m *MockRepoWebhooks) AddDeadLetter(d *domain.DeadLetter) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddDeadLetter", d)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddDeadLetter indicates an expected call of AddDeadLetter
+func (mr *MockRepoWebhooksMockRecorder) AddDeadLetter(d interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddDeadLetter", reflect.TypeOf((*MockRepoWebhooks)(nil).AddDeadLetter), d)
+}
+
+// DeadLetters mocks base method
+func (m *MockRepoWebhooks) DeadLetters(webhookID, after uint64, limit int) ([]domain.DeadLetter, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeadLetters", webhookID, after, limit)
+	ret0, _ := ret[0].([]domain.DeadLetter)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeadLetters indicates an expected call of DeadLetters
+func (mr *MockRepoWebhooksMockRecorder) DeadLetters(webhookID, after, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeadLetters", reflect.TypeOf((*MockRepoWebhooks)(nil).DeadLetters), webhookID, after, limit)
+}
+
+// MockRepoSavedSearches is a mock of SavedSearches interface
+type MockRepoSavedSearches struct {
+	ctrl     *gomock.Controller
+	recorder *MockRepoSavedSearchesMockRecorder
+}
+
+// MockRepoSavedSearchesMockRecorder is the mock recorder for MockRepoSavedSearches
+type MockRepoSavedSearchesMockRecorder struct {
+	mock *MockRepoSavedSearches
+}
+
+// NewMockRepoSavedSearches creates a new mock instance
+func NewMockRepoSavedSearches(ctrl *gomock.Controller) *MockRepoSavedSearches {
+	mock := &MockRepoSavedSearches{ctrl: ctrl}
+	mock.recorder = &MockRepoSavedSearchesMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockRepoSavedSearches) EXPECT() *MockRepoSavedSearchesMockRecorder {
+	return m.recorder
+}
+
+// CreateSavedSearch mocks base method
+func (m *MockRepoSavedSearches) CreateSavedSearch(s *domain.SavedSearch) (*domain.SavedSearch, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateSavedSearch", s)
+	ret0, _ := ret[0].(*domain.SavedSearch)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateSavedSearch indicates an expected call of CreateSavedSearch
+func (mr *MockRepoSavedSearchesMockRecorder) CreateSavedSearch(s interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateSavedSearch", reflect.TypeOf((*MockRepoSavedSearches)(nil).CreateSavedSearch), s)
+}
+
+// SavedSearch mocks base method
+func (m *MockRepoSavedSearches) SavedSearch(id uint64) (*domain.SavedSearch, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SavedSearch", id)
+	ret0, _ := ret[0].(*domain.SavedSearch)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SavedSearch indicates an expected call of SavedSearch
+func (mr *MockRepoSavedSearchesMockRecorder) SavedSearch(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SavedSearch", reflect.TypeOf((*MockRepoSavedSearches)(nil).SavedSearch), id)
+}
+
+// SavedSearches mocks base method
+func (m *MockRepoSavedSearches) SavedSearches(owner string) ([]domain.SavedSearch, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SavedSearches", owner)
+	ret0, _ := ret[0].([]domain.SavedSearch)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SavedSearches indicates an expected call of SavedSearches
+func (mr *MockRepoSavedSearchesMockRecorder) SavedSearches(owner interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SavedSearches", reflect.TypeOf((*MockRepoSavedSearches)(nil).SavedSearches), owner)
+}
+
+// DeleteSavedSearch mocks base method
+func (m *MockRepoSavedSearches) DeleteSavedSearch(id uint64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteSavedSearch", id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteSavedSearch indicates an expected call of DeleteSavedSearch
+func (mr *MockRepoSavedSearchesMockRecorder) DeleteSavedSearch(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteSavedSearch", reflect.TypeOf((*MockRepoSavedSearches)(nil).DeleteSavedSearch), id)
+}
+
+// AddMatch mocks base method
+func (m_2 *MockRepoSavedSearches) AddMatch(m *domain.Match) (bool, error) {
+	m_2.ctrl.T.Helper()
+	ret := m_2.ctrl.Call(m_2, "AddMatch", m)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AddMatch indicates an expected call of AddMatch
+func (mr *MockRepoSavedSearchesMockRecorder) AddMatch(m interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddMatch", reflect.TypeOf((*MockRepoSavedSearches)(nil).AddMatch), m)
+}
+
+// Matches mocks base method
+func (m *MockRepoSavedSearches) Matches(savedSearchID, after uint64, limit int) ([]domain.Match, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Matches", savedSearchID, after, limit)
+	ret0, _ := ret[0].([]domain.Match)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Matches indicates an expected call of Matches
+func (mr *MockRepoSavedSearchesMockRecorder) Matches(savedSearchID, after, limit interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockRepoProduct)(nil).Delete), id)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Matches", reflect.TypeOf((*MockRepoSavedSearches)(nil).Matches), savedSearchID, after, limit)
 }
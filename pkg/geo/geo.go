@@ -21,7 +21,7 @@ func Destination(lat, lng, distance, bearing float64) domain.Point {
 	lng1 := (lng * (math.Pi / 180.0))
 
 	sinφ1 := math.Sin(lat1) * math.Cos(dr)
-	sinφ2 := math.Cos(lat1) * math.Sin(dr) * math.Cos(bearing)
+	sinφ2 := math.Cos(lat1) * math.Sin(dr) * math.Cos(bearing2)
 
 	lat2 := math.Asin(sinφ1 + sinφ2)
 
@@ -37,13 +37,65 @@ func Destination(lat, lng, distance, bearing float64) domain.Point {
 	}
 }
 
+// BoundingBox returns the top, right, bottom and left edges of the box that
+// encloses the circle of the given radius. The box is only a prefilter, items
+// in its corners still have to be checked with Distance.
+//
+// Longitudes are kept within -180 and 180, so a box that crosses the
+// antimeridian has its left edge east of its right edge and holds the
+// longitudes from left to 180 and from -180 to right. A box that covers a pole
+// holds every longitude.
 func BoundingBox(lat, lng, distance float64) []domain.Point {
+	lat = math.Max(-90, math.Min(90, lat))
 
-	top := Destination(lat, lng, distance, 0)
-	right := Destination(lat, lng, distance, 90)
-	bottom := Destination(lat, lng, distance, 180)
-	left := Destination(lat, lng, distance, 270)
+	// along a meridian the circle reaches exactly its angular radius north
+	// and south of its centre, unless it goes over a pole.
+	dr := distance / earthRadius
+	top := lat + dr*(180.0/math.Pi)
+	bottom := lat - dr*(180.0/math.Pi)
+
+	// the widest longitude of a circle is not due east/west of its centre but
+	// slightly towards the pole, so the bearings 90 and 270 would cut it off.
+	dLng := 180.0
+	if top < 90 && bottom > -90 {
+		lat1 := lat * (math.Pi / 180.0)
+		if s := math.Sin(dr) / math.Cos(lat1); s < 1 {
+			dLng = math.Asin(s) * (180.0 / math.Pi)
+		}
+	}
+	top = math.Min(top, 90)
+	bottom = math.Max(bottom, -90)
+
+	left, right := -180.0, 180.0
+	if dLng < 180 {
+		left, right = lng-dLng, lng+dLng
+		if left < -180 {
+			left += 360
+		}
+		if right > 180 {
+			right -= 360
+		}
+	}
+
+	return []domain.Point{
+		{X: top, Y: lng},
+		{X: lat, Y: right},
+		{X: bottom, Y: lng},
+		{X: lat, Y: left},
+	}
+}
+
+// Distance returns the great-circle distance in meters between two
+// coordinates using the haversine formula.
+func Distance(lat1, lng1, lat2, lng2 float64) float64 {
+	φ1 := lat1 * (math.Pi / 180.0)
+	φ2 := lat2 * (math.Pi / 180.0)
+	Δφ := (lat2 - lat1) * (math.Pi / 180.0)
+	Δλ := (lng2 - lng1) * (math.Pi / 180.0)
+
+	a := math.Sin(Δφ/2)*math.Sin(Δφ/2) +
+		math.Cos(φ1)*math.Cos(φ2)*math.Sin(Δλ/2)*math.Sin(Δλ/2)
+	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
 
-	points := []domain.Point{top, right, bottom, left}
-	return points
+	return earthRadius * c
 }
@@ -0,0 +1,78 @@
+package geo_test
+
+import (
+	"testing"
+
+	"github.com/mustafadubul/product/internal/domain"
+	"github.com/mustafadubul/product/pkg/geo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDistance(t *testing.T) {
+	// London to Paris
+	d := geo.Distance(51.509865, -0.118092, 48.864716, 2.349014)
+	assert.InDelta(t, 342500, d, 500)
+
+	assert.Equal(t, float64(0), geo.Distance(51.509865, -0.118092, 51.509865, -0.118092))
+}
+
+// inBox reports whether p is in the box, which may cross the antimeridian.
+func inBox(box []domain.Point, p domain.Point) bool {
+	top, right, bottom, left := box[0].X, box[1].Y, box[2].X, box[3].Y
+	if p.X > top+1e-9 || p.X < bottom-1e-9 {
+		return false
+	}
+	if left > right {
+		return p.Y >= left-1e-9 || p.Y <= right+1e-9
+	}
+	return p.Y >= left-1e-9 && p.Y <= right+1e-9
+}
+
+func TestBoundingBoxContainsRadius(t *testing.T) {
+	for _, c := range []struct {
+		lat, lng, radius float64
+	}{
+		{51.509865, -0.118092, 10000},
+		{0, 179.9, 100000},
+		{-33.8, -179.9, 100000},
+		{89.9, 20, 100000},
+		{-89.9, -20, 100000},
+		{90, 0, 1000},
+	} {
+		box := geo.BoundingBox(c.lat, c.lng, c.radius)
+		for bearing := 0.0; bearing < 360; bearing += 5 {
+			p := geo.Destination(c.lat, c.lng, c.radius, bearing)
+			assert.True(t, inBox(box, p), "centre %v,%v bearing %v point %v outside box %v", c.lat, c.lng, bearing, p, box)
+			assert.InDelta(t, c.radius, geo.Distance(c.lat, c.lng, p.X, p.Y), 1)
+		}
+		assert.True(t, inBox(box, domain.Point{X: c.lat, Y: c.lng}), "centre %v,%v outside box %v", c.lat, c.lng, box)
+	}
+}
+
+func TestBoundingBoxAntimeridian(t *testing.T) {
+	box := geo.BoundingBox(0, 179.9, 100000)
+	top, right, bottom, left := box[0].X, box[1].Y, box[2].X, box[3].Y
+	assert.InDelta(t, 0.9, top, 0.01)
+	assert.InDelta(t, -0.9, bottom, 0.01)
+	assert.InDelta(t, 179, left, 0.01)
+	assert.InDelta(t, -179.2, right, 0.01)
+
+	assert.True(t, inBox(box, domain.Point{X: 0, Y: -179.5}))
+	assert.False(t, inBox(box, domain.Point{X: 0, Y: 0}))
+}
+
+func TestBoundingBoxPole(t *testing.T) {
+	box := geo.BoundingBox(89.9, 20, 100000)
+	top, right, bottom, left := box[0].X, box[1].Y, box[2].X, box[3].Y
+	assert.Equal(t, float64(90), top)
+	assert.InDelta(t, 89, bottom, 0.01)
+	assert.Equal(t, float64(-180), left)
+	assert.Equal(t, float64(180), right)
+
+	// across the pole
+	assert.True(t, inBox(box, domain.Point{X: 89.9, Y: -160}))
+
+	box = geo.BoundingBox(-89.9, 20, 100000)
+	assert.Equal(t, float64(-90), box[2].X)
+	assert.InDelta(t, -89, box[0].X, 0.01)
+}